@@ -25,11 +25,12 @@ func (g *Goes) Apropos() lang.Alt {
 }
 
 func (g *Goes) apropos(args ...string) error {
+	w := g.Stdout()
 	pad := func(n int) {
 		if n < 0 {
-			fmt.Print("\n\t\t")
+			fmt.Fprint(w, "\n\t\t")
 		} else {
-			fmt.Print("                "[:n])
+			fmt.Fprint(w, "                "[:n])
 		}
 	}
 	if len(args) == 0 {
@@ -40,9 +41,9 @@ func (g *Goes) apropos(args ...string) error {
 			continue
 		}
 		if cmd, found := g.ByName[name]; found {
-			fmt.Print(name)
+			fmt.Fprint(w, name)
 			pad(16 - len(name))
-			fmt.Println(cmd.Apropos())
+			fmt.Fprintln(w, cmd.Apropos())
 		} else if i == 0 {
 			return fmt.Errorf("%s: not found", name)
 		}
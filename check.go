@@ -0,0 +1,135 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// +build linux
+
+package goes
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/platinasystems/goes/internal/shellutils"
+)
+
+// A Catline may also be a Locator that identifies the source of its most
+// recently read line, e.g. "FILE:LINE".
+type Locator interface {
+	Location() string
+}
+
+// Location returns the source of the most recently read command line or an
+// empty string if unknown.
+func (g *Goes) Location() string {
+	if l, found := g.Catline.(Locator); found {
+		return l.Location()
+	}
+	return ""
+}
+
+// MissingTerminator returns the error of a block beginning at loc that
+// reached the end of input without its terminating keyword. The error wraps
+// io.EOF.
+func (g *Goes) MissingTerminator(block, term, loc string) error {
+	return &missingTerminator{block, term, loc}
+}
+
+type missingTerminator struct {
+	block, term, loc string
+}
+
+func (err *missingTerminator) Error() string {
+	if len(err.loc) > 0 {
+		return fmt.Sprintf("missing %q for %q at %s",
+			err.term, err.block, err.loc)
+	}
+	return fmt.Sprintf("missing %q for %q", err.term, err.block)
+}
+
+func (*missingTerminator) Unwrap() error { return io.EOF }
+
+// keywords that are only expected within a block
+var keywords = map[string]bool{
+	"then": true,
+	"else": true,
+	"elif": true,
+	"fi":   true,
+	"do":   true,
+	"done": true,
+	"{":    true,
+	"}":    true,
+}
+
+// check records problems with the command line that would otherwise be found
+// when it's run. Commands named by variables or globs aren't checked.
+func (g *Goes) check(cl shellutils.Cmdline, loc string) {
+	var name string
+	for i := 0; i < len(cl.Cmds) && len(name) == 0; i++ {
+		w := cl.Cmds[i]
+		if _, _, found := redirectionOp(w.String()); found {
+			i++
+			continue
+		}
+		isAssignment := false
+		for _, t := range w.Tokens {
+			switch t.T {
+			case shellutils.TokenEnvget, shellutils.TokenGlob:
+				return
+			case shellutils.TokenEnvset:
+				isAssignment = true
+			}
+		}
+		if !isAssignment {
+			name = w.String()
+		}
+	}
+	if len(name) == 0 {
+		return
+	}
+	problem := func(format string, args ...interface{}) {
+		s := fmt.Sprintf(format, args...)
+		if len(loc) > 0 {
+			s = loc + ": " + s
+		}
+		g.Problems = append(g.Problems, fmt.Errorf("%s", s))
+	}
+	if keywords[name] {
+		problem("unexpected %q", name)
+		return
+	}
+	if _, found := g.ByName[name]; found {
+		return
+	}
+	if _, found := g.FunctionMap[name]; found {
+		return
+	}
+	if _, found := g.Builtins()[name]; found {
+		return
+	}
+	if name == os.Args[0] {
+		return
+	}
+	problem("%s: command not found", name)
+}
+
+// trace prints the expanded command before it's run.
+func (g *Goes) trace(w io.Writer, loc string, envMap map[string]string,
+	args []string) {
+	s := make([]string, 0, 2+len(envMap)+len(args))
+	s = append(s, "+")
+	if len(loc) > 0 {
+		s = append(s, loc+":")
+	}
+	envs := make([]string, 0, len(envMap))
+	for k, v := range envMap {
+		envs = append(envs, k+"="+v)
+	}
+	sort.Strings(envs)
+	s = append(s, envs...)
+	s = append(s, args...)
+	fmt.Fprintln(w, strings.Join(s, " "))
+}
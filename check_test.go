@@ -0,0 +1,119 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// +build linux
+
+package goes_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/cmd/cli"
+	"github.com/platinasystems/goes/cmd/echo"
+	"github.com/platinasystems/goes/cmd/ficmd"
+	"github.com/platinasystems/goes/cmd/function"
+	"github.com/platinasystems/goes/cmd/ifcmd"
+	"github.com/platinasystems/goes/cmd/thencmd"
+	"github.com/platinasystems/goes/cmd/truecmd"
+	"github.com/platinasystems/goes/cmd/while"
+)
+
+type script struct {
+	line  int
+	lines []string
+}
+
+func (s *script) Write(p []byte) (int, error) { return len(p), nil }
+
+func (s *script) Read(p []byte) (int, error) {
+	if s.line >= len(s.lines) {
+		return 0, io.EOF
+	}
+	n := copy(p, s.lines[s.line])
+	s.line++
+	return n, nil
+}
+
+func (s *script) Location() string { return fmt.Sprint("test:", s.line) }
+
+func run(flag string, lines ...string) (string, error) {
+	stderr := new(bytes.Buffer)
+	g := &goes.Goes{
+		NAME: "test",
+		ByName: map[string]cmd.Cmd{
+			"cli":      &cli.Command{Stderr: stderr},
+			"echo":     echo.Command{},
+			"fi":       ficmd.Command{},
+			"function": function.Command{},
+			"if":       ifcmd.Command{},
+			"then":     thencmd.Command{},
+			"true":     truecmd.Command{},
+			"while":    whilecmd.Command{},
+		},
+		Catline: &script{lines: lines},
+	}
+	err := g.Main("test", "cli", flag, "-")
+	return stderr.String(), err
+}
+
+func TestCheckClean(t *testing.T) {
+	out, err := run("-n",
+		"function hello {",
+		"	echo hello",
+		"}",
+		"if true; then",
+		"	hello > /dev/null 2>&1",
+		"fi",
+		"X=1 echo $X",
+		"$X ignored",
+	)
+	if err != nil {
+		t.Error(err, out)
+	}
+}
+
+func TestCheckProblems(t *testing.T) {
+	out, err := run("-n",
+		"echo one",
+		"ehco two",
+		"fi",
+		"if true; then",
+		"	echo three",
+	)
+	if err == nil {
+		t.Fatal("no problems found")
+	}
+	if !strings.HasSuffix(err.Error(), "3 problems") {
+		t.Error("wrong problem count:", err)
+	}
+	for _, s := range []string{
+		`test:2: ehco: command not found`,
+		`test:3: unexpected "fi"`,
+		`test:5: missing "fi" for "if" at test:4`,
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("missing %q in %q", s, out)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	out, err := run("-x",
+		"X=1",
+		"true",
+		"Y=2 true $X",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "+ test:1: X=1\n+ test:2: true\n+ test:3: Y=2 true 1\n" {
+		t.Errorf("wrong trace: %q", out)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/internal/audit"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct{}
+
+func (Command) String() string { return "audit" }
+
+func (Command) Usage() string {
+	return `audit [-failed] [-json] [-user USER] [-addr ADDR] [-session TYPE]
+	[-since DURATION] [-n COUNT] [-file FILE] [PATTERN]`
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "search the command audit log",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Print the audited commands that match all of the given options.
+
+	Auditing is enabled by the presence of ` + audit.ConfigFile + `,
+	which may be empty or have these KEY=VALUE lines.
+
+		file=` + audit.DefaultFile + `
+		maxsize=1048576
+		redis=false
+		syslog=false
+
+	When the log exceeds maxsize it's renamed with a ".1" suffix.
+
+	Each interactive cli command and each command executed by a remote
+	session, e.g. "ssh HOST COMMAND", is recorded with its user,
+	session type (console, ssh or telnet), source address, tty, start
+	time, exit status and duration.
+
+	With redis=true, the JSON encoded records are also published to the
+	"` + audit.Channel + `" redis channel.
+
+	With syslog=true, records are also logged with the auth facility.
+
+OPTIONS
+	-failed		only commands with a non-zero exit status
+	-json		print the JSON encoded records
+	-user USER	only commands of this user
+	-addr ADDR	only commands from this source address prefix
+	-session TYPE	only commands of this session type
+	-since DURATION
+			only commands run within this duration, e.g. 1h
+	-n COUNT	only the last COUNT matching commands
+	-file FILE	search FILE instead of the configured log
+	PATTERN		only commands matching this regular expression
+
+EXAMPLES
+	audit -user root -since 24h
+	audit -failed 'rm|reboot'`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-failed", "-json")
+	parm, args := parms.New(args, "-user", "-addr", "-session", "-since",
+		"-n", "-file")
+	var (
+		re    *regexp.Regexp
+		since time.Time
+		n     int
+		err   error
+	)
+	switch len(args) {
+	case 0:
+	case 1:
+		if re, err = regexp.Compile(args[0]); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%v: unexpected", args[1:])
+	}
+	if s := parm.ByName["-since"]; len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("-since: %v", err)
+		}
+		since = time.Now().Add(-d)
+	}
+	if s := parm.ByName["-n"]; len(s) > 0 {
+		if n, err = strconv.Atoi(s); err != nil || n < 0 {
+			return fmt.Errorf("%s: invalid count", s)
+		}
+	}
+	fn := parm.ByName["-file"]
+	if len(fn) == 0 {
+		config, err := audit.LoadConfig(audit.ConfigFile)
+		if err != nil {
+			return err
+		}
+		if config == nil {
+			return fmt.Errorf("disabled; no %s", audit.ConfigFile)
+		}
+		fn = config.File
+	}
+	match := func(r *audit.Record) bool {
+		switch {
+		case flag.ByName["-failed"] && r.Exit == 0:
+		case len(parm.ByName["-user"]) > 0 &&
+			r.User != parm.ByName["-user"]:
+		case len(parm.ByName["-addr"]) > 0 &&
+			!strings.HasPrefix(r.Addr, parm.ByName["-addr"]):
+		case len(parm.ByName["-session"]) > 0 &&
+			r.Session != parm.ByName["-session"]:
+		case !since.IsZero() && r.Time.Before(since):
+		case re != nil && !re.MatchString(r.Command):
+		default:
+			return true
+		}
+		return false
+	}
+	var records []*audit.Record
+	found := false
+	for _, name := range []string{fn + ".1", fn} {
+		f, err := os.Open(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		found = true
+		err = audit.Read(f, func(r *audit.Record) bool {
+			if match(r) {
+				records = append(records, r)
+			}
+			return true
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s: no records", fn)
+	}
+	if n > 0 && len(records) > n {
+		records = records[len(records)-n:]
+	}
+	for _, r := range records {
+		if flag.ByName["-json"] {
+			buf, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(buf))
+			continue
+		}
+		fmt.Println(r.Time.Format("2006-01-02 15:04:05"), r)
+	}
+	return nil
+}
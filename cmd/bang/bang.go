@@ -16,6 +16,7 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/platinasystems/goes"
 	"github.com/platinasystems/goes/cmd"
 	"github.com/platinasystems/goes/external/flags"
 	"github.com/platinasystems/goes/external/parms"
@@ -42,7 +43,9 @@ var parmlist = map[string]struct{}{
 	"-chroot": {},
 }
 
-type Command struct{}
+type Command struct {
+	g *goes.Goes
+}
 
 func (Command) String() string { return "!" }
 
@@ -76,9 +79,11 @@ OPTIONS
 	}
 }
 
+func (c *Command) Goes(g *goes.Goes) { c.g = g }
+
 func (Command) Kind() cmd.Kind { return cmd.DontFork }
 
-func (Command) Main(args ...string) error {
+func (c Command) Main(args ...string) error {
 	var background bool
 
 	opts := args
@@ -153,9 +158,9 @@ func (Command) Main(args ...string) error {
 	cmd := exec.Command(execpath, args[1:]...)
 	cmd.Args[0] = command
 	cmd.Dir = parms.ByName["-cd"]
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdin = c.g.Stdin()
+	cmd.Stdout = c.g.Stdout()
+	cmd.Stderr = c.g.Stderr()
 
 	unshareFlags := uintptr(0)
 	for _, flag := range namespaces {
@@ -172,7 +177,7 @@ func (Command) Main(args ...string) error {
 		go func() {
 			err := cmd.Run()
 			if err != nil {
-				fmt.Fprintln(os.Stderr, cmd.Args[0], ": ", err)
+				fmt.Fprintln(c.g.Stderr(), cmd.Args[0], ": ", err)
 			}
 		}()
 		return nil
@@ -2,7 +2,7 @@
 // Use of this source code is governed by the GPL-2 license described in the
 // LICENSE file.
 
-// +build linux,amd64
+// +build linux
 
 package biosupdate
 
@@ -22,7 +22,8 @@ type Command struct{}
 func (Command) String() string { return "biosupdate" }
 
 func (Command) Usage() string {
-	return "biosupdate [-h|-V|[-s <slot>][-E|(-r|-w|-v) <file>]"
+	return "biosupdate [-p PROGRAMMER] [-s SPI] " +
+		"[--region LIST|--preserve LIST] [-l|-E|(-r|-w|-v) FILE]"
 }
 
 func (Command) Apropos() lang.Alt {
@@ -35,15 +36,29 @@ func (Command) Man() lang.Alt {
 	return lang.Alt{
 		lang.EnUS: `
 DESCRIPTION
-	This command reads and writes the BIOS image in SPI0 or SPI1.
-	  -r | --read <file>                 Read BIOS image from flash and save to <file>
-	  -w | --write <file>                Write BIOS image <file> to flas
-	  -v | --verify <file>               Verify BIOS image against <file>
-	  -E | --erase                       Erase BIOS image from flash memory
-	  -s | --spi <num>                   Select SPI 0 or 1
-
-	You can specify one of -h, -V, -E, -r, -w, -v or no operation.
-	If no operation is specified, then the programmer will be tested.`,
+	This command reads and writes the BIOS image in SPI0 or SPI1, or
+	the regions of other flash parts.
+	  -r <file>             Read regions from flash and save to <file>
+	  -w <file>             Write regions of image <file> to flash
+	  -v <file>             Verify regions against <file>
+	  -E                    Erase regions
+	  -l                    List the regions
+	  -s <num>              Select SPI 0 or 1
+	  -p <programmer>       ich (default), mtd:/dev/mtdN or file:<image>
+	  --region <list>       Comma separated regions, default: bios
+	  --preserve <list>     All regions but these
+
+	You can specify one of -h, -V, -l, -E, -r, -w, -v or no operation.
+	If no operation is specified, then the programmer will be tested.
+
+	The regions are those of the Intel Flash Descriptor: descriptor,
+	bios, me, gbe, pd, devexp, bios2 and ec; or "all" for the whole
+	flash. Without a descriptor, the whole flash is the bios region.
+	Files are the size of the flash; regions not read are 0xff.
+
+	Writes skip unchanged erase blocks and are verified by reading back
+	the written regions. If the image has a descriptor with a different
+	layout, the whole flash must be written.`,
 	}
 }
 
@@ -53,15 +68,21 @@ const (
 	op_write
 	op_verify
 	op_erase
+	op_list
 )
 
 func (Command) Main(args ...string) (err error) {
-	flag, args := flags.New(args, "-E")
-	parm, args := parms.New(args, "-r", "-w", "-v", "-s")
+	flag, args := flags.New(args, "-E", "-l")
+	parm, args := parms.New(args, "-r", "-w", "-v", "-s", "-p",
+		"--region", "--preserve")
 
 	var spinum uint64
 	op := op_none
 
+	if len(args) > 0 {
+		return fmt.Errorf("%v: unexpected", args)
+	}
+
 	if len(parm.ByName["-s"]) != 0 {
 		spinum, err = strconv.ParseUint(parm.ByName["-s"], 0, 1)
 		if err != nil {
@@ -69,271 +90,280 @@ func (Command) Main(args ...string) (err error) {
 		}
 	}
 
-	if flag.ByName["-E"] {
-		op = op_erase
-	}
-
-	if len(parm.ByName["-r"]) != 0 {
-		if op != op_none {
-			return fmt.Errorf("Multiple operations specified.")
-		}
-		op = op_read
-	}
-
-	if len(parm.ByName["-w"]) != 0 {
-		if op != op_none {
-			return fmt.Errorf("Multiple operations specified.")
+	names, preserve := "bios", false
+	if s := parm.ByName["--preserve"]; len(s) != 0 {
+		if len(parm.ByName["--region"]) != 0 {
+			return fmt.Errorf("--region and --preserve are exclusive")
 		}
-		op = op_write
+		names, preserve = s, true
+	} else if s = parm.ByName["--region"]; len(s) != 0 {
+		names = s
 	}
 
-	if len(parm.ByName["-v"]) != 0 {
-		if op != op_none {
-			return fmt.Errorf("Multiple operations specified.")
+	for _, x := range []struct {
+		set bool
+		op  int
+	}{
+		{flag.ByName["-E"], op_erase},
+		{flag.ByName["-l"], op_list},
+		{len(parm.ByName["-r"]) != 0, op_read},
+		{len(parm.ByName["-w"]) != 0, op_write},
+		{len(parm.ByName["-v"]) != 0, op_verify},
+	} {
+		if x.set {
+			if op != op_none {
+				return fmt.Errorf("Multiple operations specified.")
+			}
+			op = x.op
 		}
-		op = op_verify
-	}
-
-	switch op {
-	case op_read:
-		err = doRead(parm.ByName["-r"], uint(spinum))
-	case op_write:
-		err = doWrite(parm.ByName["-w"], uint(spinum))
-	case op_erase:
-		err = doErase(uint(spinum))
-	case op_verify:
-		err = doVerify(parm.ByName["-v"], uint(spinum))
-	default:
-		err = doFindProgrammer()
 	}
 
-	return
-}
-
-func doFindProgrammer() (err error) {
-	var programmer Programmer
-
-	if err = programmer.Open(0); err != nil {
+	f, err := OpenFlash(parm.ByName["-p"], uint(spinum))
+	if err != nil {
 		return
 	}
+	defer f.Close()
 
-	defer programmer.Close()
-
-	fmt.Printf("BIOS Programmer found.\n")
-	return
-}
-
-func showAddressProgress(opName string, c chan float32) {
-	for a := range c {
-		fmt.Printf("%s......%3.0f%%\r", opName, a)
-	}
-
-	fmt.Printf("%s......done.\n", opName)
-}
-
-func doRead(filename string, spinum uint) (err error) {
-	fmt.Printf("Reading BIOS from SPI%d to file %s.\n", spinum, filename)
-
-	var programmer Programmer
-
-	if err = programmer.Open(spinum); err != nil {
+	if op == op_none {
+		fmt.Printf("BIOS Programmer found: %s, %d bytes.\n", f,
+			f.Size())
 		return
 	}
 
-	defer programmer.Close()
-
-	d := make([]byte, programmer.TotalFlashSize())
-	base := (programmer.BiosBase())
-	limit := (programmer.BiosLimit())
-
-	c := make(chan float32)
-	var n int
-	go func() {
-		n, err = programmer.ReadAt(d[base:(limit+1)], int64(base), c)
-		close(c)
-		return
-	}()
-
-	showAddressProgress("Reading", c)
-
+	layout, err := Layout(f)
 	if err != nil {
 		return
 	}
-	if uint32(n) != programmer.BiosImageSize() {
-		return fmt.Errorf("%d bytes read, expecting %d bytes", n, programmer.BiosImageSize())
-	}
-
-	err = ioutil.WriteFile(filename, d, 0644)
-
-	return
-}
-
-func doVerify(filename string, spinum uint) (err error) {
-	fmt.Printf("Verifying BIOS from SPI%d with file %s.\n", spinum, filename)
-
-	var programmer Programmer
 
-	if err = programmer.Open(spinum); err != nil {
+	if op == op_list {
+		for _, r := range layout {
+			fmt.Println(r)
+		}
 		return
 	}
 
-	defer programmer.Close()
-
-	d1 := make([]byte, programmer.TotalFlashSize())
-	base := (programmer.BiosBase())
-	limit := (programmer.BiosLimit())
-
-	c := make(chan float32)
-	var n int
-	go func() {
-		n, err = programmer.ReadAt(d1[base:(limit+1)], int64(base), c)
-		close(c)
-		return
-	}()
-
-	showAddressProgress("Reading", c)
+	if op == op_write {
+		layout, err = writeLayout(f, layout, parm.ByName["-w"], names,
+			preserve)
+		if err != nil {
+			return
+		}
+	}
 
+	regions, err := SelectRegions(layout, names, preserve, f.Size())
 	if err != nil {
 		return
 	}
-	if uint32(n) != programmer.BiosImageSize() {
-		return fmt.Errorf("%d bytes read, expecting %d bytes", n, programmer.BiosImageSize())
-	}
-
-	fmt.Printf("Verifying......")
-	d0, err := ioutil.ReadFile(filename)
-	if len(d0) != len(d1) {
-		return fmt.Errorf("Read %d bytes, expecting %d bytes", len(d0), len(d1))
-	}
 
-	if bytes.Equal(d0, d1) {
-		fmt.Printf("Valid.\n")
-	} else {
-		fmt.Printf("Invalid!\n")
+	switch op {
+	case op_read:
+		err = doRead(f, parm.ByName["-r"], regions)
+	case op_write:
+		err = doWrite(f, parm.ByName["-w"], regions)
+	case op_erase:
+		err = doErase(f, regions)
+	case op_verify:
+		err = doVerify(f, parm.ByName["-v"], regions)
 	}
 
 	return
 }
 
-func doErase(spinum uint) (err error) {
-	fmt.Printf("Erasing BIOS from SPI%d.\n", spinum)
-
-	var programmer Programmer
-
-	if err = programmer.Open(spinum); err != nil {
-		return
+// Layout returns the regions of the flash descriptor, the programmer's
+// region registers or, without either, the whole flash as the bios.
+func Layout(f Flash) ([]Region, error) {
+	b := make([]byte, DescriptorSize)
+	if f.Size() < DescriptorSize {
+		b = b[:f.Size()]
 	}
-
-	defer programmer.Close()
-
-	base := programmer.BiosBase()
-	n := programmer.BiosImageSize()
-
-	err = doEraseAndVerify(&programmer, base, n)
-
-	return
-}
-
-func doWrite(filename string, spinum uint) (err error) {
-	var programmer Programmer
-
-	if err = programmer.Open(spinum); err != nil {
-		return
+	if _, err := f.ReadAt(b, 0, nil); err != nil {
+		return nil, err
 	}
-
-	defer programmer.Close()
-
-	d, err := ioutil.ReadFile(filename)
-	if uint32(len(d)) != programmer.TotalFlashSize() {
-		err = fmt.Errorf("File is %d bytes, expecting %d bytes", len(d), programmer.TotalFlashSize())
-		return
+	if regions, err := ParseIFD(b, f.Size()); err == nil {
+		return regions, nil
 	}
+	if r, ok := f.(interface{ Regions() []Region }); ok {
+		if regions := r.Regions(); len(regions) > 0 {
+			return regions, nil
+		}
+	}
+	return []Region{{"bios", 0, f.Size() - 1}}, nil
+}
 
-	base := programmer.BiosBase()
-	limit := programmer.BiosLimit()
-	size := programmer.BiosImageSize()
-
-	err = doEraseAndVerify(&programmer, base, size)
+// writeLayout returns the layout of the image's descriptor, which must
+// match the flash unless writing all of it.
+func writeLayout(f Flash, layout []Region, filename, names string,
+	preserve bool) ([]Region, error) {
+	d, err := readImage(f, filename)
 	if err != nil {
-		return
+		return nil, err
 	}
-
-	c := make(chan float32)
-	var n int
-	go func() {
-		n, err = programmer.WriteAt(d[base:(limit+1)], int64(base), c)
-		close(c)
-		return
-	}()
-
-	showAddressProgress(fmt.Sprintf("Writing BIOS in SPI%d with file %s", spinum, filename), c)
-
+	newLayout, err := ParseIFD(d, f.Size())
 	if err != nil {
-		return
+		return layout, nil
 	}
-	if uint32(n) != programmer.BiosImageSize() {
-		return fmt.Errorf("%d bytes written, expecting %d bytes", n, size)
+	if fmt.Sprint(newLayout) != fmt.Sprint(layout) &&
+		(names != "all" || preserve) {
+		return nil, fmt.Errorf("%s: changes the region layout, use --region all",
+			filename)
 	}
-
-	return
+	return newLayout, nil
 }
 
-func doEraseAndVerify(programmer *Programmer, base uint32, size uint32) (err error) {
-	spinum := programmer.CurrentSPINum()
+func readImage(f Flash, filename string) ([]byte, error) {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(d)) != f.Size() {
+		return nil, fmt.Errorf("File is %d bytes, expecting %d bytes",
+			len(d), f.Size())
+	}
+	return d, nil
+}
 
-	erased, err := doVerifyErase(programmer, base, size)
-	if err != nil || erased {
-		return
+func showAddressProgress(opName string, c chan float32) {
+	for a := range c {
+		fmt.Printf("%s......%3.0f%%\r", opName, a)
 	}
 
+	fmt.Printf("%s......done.\n", opName)
+}
+
+// progress runs op while showing its progress.
+func progress(opName string, op func(c chan float32) error) (err error) {
 	c := make(chan float32)
 	go func() {
-		err = programmer.EraseFlash(base, size, c)
+		err = op(c)
 		close(c)
-		return
 	}()
+	showAddressProgress(opName, c)
+	return
+}
 
-	showAddressProgress(fmt.Sprintf("Erasing BIOS in SPI%d", spinum), c)
+func readRegion(f Flash, d []byte, r Region) error {
+	return progress(fmt.Sprintf("Reading %s from %s", r.Name, f),
+		func(c chan float32) error {
+			n, err := f.ReadAt(d[r.Base:r.Limit+1], int64(r.Base), c)
+			if err == nil && uint32(n) != r.Size() {
+				err = fmt.Errorf("%d bytes read, expecting %d bytes",
+					n, r.Size())
+			}
+			return err
+		})
+}
 
-	if err != nil {
-		fmt.Printf("Error erasing flash.\n")
-		return
+func doRead(f Flash, filename string, regions []Region) error {
+	d := erased(f.Size())
+	for _, r := range regions {
+		if err := readRegion(f, d, r); err != nil {
+			return err
+		}
 	}
+	return ioutil.WriteFile(filename, d, 0644)
+}
 
-	erased, err = doVerifyErase(programmer, base, size)
+func doVerify(f Flash, filename string, regions []Region) error {
+	d, err := readImage(f, filename)
 	if err != nil {
-		return
+		return err
 	}
+	return verify(f, d, regions)
+}
 
-	if !erased {
-		return fmt.Errorf("Unable to erase flash!")
+// verify compares the regions of the flash with the image, d.
+func verify(f Flash, d []byte, regions []Region) error {
+	d1 := make([]byte, f.Size())
+	for _, r := range regions {
+		if err := readRegion(f, d1, r); err != nil {
+			return err
+		}
+		if !bytes.Equal(d[r.Base:r.Limit+1], d1[r.Base:r.Limit+1]) {
+			fmt.Printf("%s Invalid!\n", r.Name)
+			return fmt.Errorf("%s: verify failed", r.Name)
+		}
+		fmt.Printf("%s Valid.\n", r.Name)
 	}
-
-	return
+	return nil
 }
 
-func doVerifyErase(programmer *Programmer, base uint32, size uint32) (erased bool, err error) {
-	spinum := programmer.CurrentSPINum()
-
-	c := make(chan float32)
-	go func() {
-		erased, err = programmer.CheckErased(base, size, c)
-		close(c)
-		return
-	}()
-
-	showAddressProgress(fmt.Sprintf("Checking BIOS in SPI%d", spinum), c)
-
+func doWrite(f Flash, filename string, regions []Region) error {
+	d, err := readImage(f, filename)
 	if err != nil {
-		fmt.Printf("Error Verifying Erase!\n")
-		return
+		return err
 	}
+	return update(f, d, regions)
+}
+
+func doErase(f Flash, regions []Region) error {
+	return update(f, erased(f.Size()), regions)
+}
 
-	if erased {
-		fmt.Printf("Erased.\n")
-	} else {
-		fmt.Printf("BIOS not erased.\n")
+// update programs the regions that differ from the image, d, then
+// verifies them.
+func update(f Flash, d []byte, regions []Region) error {
+	for _, r := range regions {
+		var changed, blocks int
+		err := progress(fmt.Sprintf("Writing %s in %s", r.Name, f),
+			func(c chan float32) (err error) {
+				changed, blocks, err = program(f, d, r, c)
+				return
+			})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d of %d blocks changed.\n", r.Name, changed,
+			blocks)
 	}
+	return verify(f, d, regions)
+}
 
+// program writes the erase blocks of the region that differ from the
+// image, d, erasing those that can't be programmed over.
+func program(f Flash, d []byte, r Region,
+	c chan float32) (changed, blocks int, err error) {
+	for off := uint32(0); off < r.Size(); {
+		a := r.Base + off
+		bs := f.EraseSize(a)
+		if bs == 0 || a%bs != 0 || off+bs > r.Size() {
+			err = fmt.Errorf("%s: %#x: not aligned to erase block",
+				r.Name, a)
+			return
+		}
+		if c != nil {
+			c <- (float32(off) / float32(r.Size())) * 100
+		}
+		cur := make([]byte, bs)
+		if _, err = f.ReadAt(cur, int64(a), nil); err != nil {
+			return
+		}
+		want := d[a : a+bs]
+		blocks++
+		off += bs
+		if bytes.Equal(cur, want) {
+			continue
+		}
+		changed++
+		if !programmable(cur, want) {
+			if err = f.Erase(a, bs, nil); err != nil {
+				return
+			}
+		}
+		if !bytes.Equal(want, erased(bs)) {
+			if _, err = f.WriteAt(want, int64(a), nil); err != nil {
+				return
+			}
+		}
+	}
 	return
 }
+
+// programmable returns true if writing want over cur only clears bits.
+func programmable(cur, want []byte) bool {
+	for i := range cur {
+		if cur[i]&want[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
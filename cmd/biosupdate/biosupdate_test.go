@@ -0,0 +1,122 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// +build linux
+
+package biosupdate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSize = 64 * 1024
+
+// testImage returns a flash image with a descriptor of 4K, a 12K me and a
+// 48K bios region, each filled with the given byte.
+func testImage(me, bios byte) []byte {
+	b := make([]byte, testSize)
+	le := binary.LittleEndian
+	le.PutUint32(b[ifdSignatureOffset:], ifdSignature)
+	le.PutUint32(b[ifdSignatureOffset+4:], 0x40<<12) // FRBA 0x40
+	flreg := func(base, limit uint32) uint32 {
+		return (base >> 12) | (limit>>12)<<16
+	}
+	le.PutUint32(b[0x40:], flreg(0, 0xfff))
+	le.PutUint32(b[0x44:], flreg(0x4000, 0xffff))
+	le.PutUint32(b[0x48:], flreg(0x1000, 0x3fff))
+	le.PutUint32(b[0x4c:], 0x7fff) // unused gbe
+	for i := 0x1000; i < 0x4000; i++ {
+		b[i] = me
+	}
+	for i := 0x4000; i < testSize; i++ {
+		b[i] = bios
+	}
+	return b
+}
+
+func TestParseIFD(t *testing.T) {
+	regions, err := ParseIFD(testImage(0, 0), testSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Region{
+		{"descriptor", 0, 0xfff},
+		{"bios", 0x4000, 0xffff},
+		{"me", 0x1000, 0x3fff},
+	}
+	if len(regions) != len(want) {
+		t.Fatal("unexpected", regions)
+	}
+	for i := range want {
+		if regions[i] != want[i] {
+			t.Error("unexpected", regions[i])
+		}
+	}
+	if _, err = ParseIFD(make([]byte, testSize), testSize); err != ErrNoDescriptor {
+		t.Error("expected", ErrNoDescriptor, "not", err)
+	}
+	preserved, err := SelectRegions(regions, "me", true, testSize)
+	if err != nil || len(preserved) != 2 || preserved[1].Name != "bios" {
+		t.Error("unexpected", preserved, err)
+	}
+	if _, err = SelectRegions(regions, "gbe", false, testSize); err == nil {
+		t.Error("selected unused gbe")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "biosupdate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "flash.bin")
+	if err = ioutil.WriteFile(fn, testImage(0x11, 0x22), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenFlash("file:"+fn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	layout, err := Layout(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions, err := SelectRegions(layout, "bios", false, f.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the last bios block differs
+	img := testImage(0x33, 0x22)
+	img[testSize-1] = 0x44
+	changed, blocks, err := program(f, img, regions[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 1 || blocks != 12 {
+		t.Error("changed", changed, "of", blocks)
+	}
+	if err = verify(f, img, regions); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(fn)
+	if !bytes.Equal(b[0x1000:0x4000], bytes.Repeat([]byte{0x11}, 0x3000)) {
+		t.Error("me region changed")
+	}
+
+	if err = doErase(f, regions); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadFile(fn)
+	if !bytes.Equal(b[0x4000:], erased(0xc000)) {
+		t.Error("bios region not erased")
+	}
+}
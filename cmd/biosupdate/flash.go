@@ -0,0 +1,182 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// +build linux
+
+package biosupdate
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/platinasystems/goes/internal/mtd"
+)
+
+// Flash is a flash programmer. The progress of the read, write and erase
+// operations is sent in percent to the channel c, if not nil.
+type Flash interface {
+	fmt.Stringer
+	Size() uint32
+	// EraseSize returns the size of the erase block at addr.
+	EraseSize(addr uint32) uint32
+	ReadAt(b []byte, off int64, c chan float32) (int, error)
+	WriteAt(b []byte, off int64, c chan float32) (int, error)
+	Erase(addr, size uint32, c chan float32) error
+	Close() error
+}
+
+// OpenFlash returns the programmer of the spec, one of:
+//
+//	ich		Intel ICH SPI controller, selecting the SPI number
+//	mtd:DEVICE	Linux MTD device, e.g. mtd:/dev/mtd0
+//	file:FILE	a flash image file
+func OpenFlash(spec string, spinum uint) (Flash, error) {
+	switch {
+	case len(spec) == 0, spec == "ich":
+		return openICH(spinum)
+	case strings.HasPrefix(spec, "mtd:"):
+		return openMTD(strings.TrimPrefix(spec, "mtd:"))
+	case strings.HasPrefix(spec, "/dev/mtd"):
+		return openMTD(spec)
+	case strings.HasPrefix(spec, "file:"):
+		return openFile(strings.TrimPrefix(spec, "file:"))
+	}
+	return nil, fmt.Errorf("%s: unknown programmer", spec)
+}
+
+type mtdFlash struct {
+	*mtd.Device
+}
+
+func openMTD(fn string) (Flash, error) {
+	d, err := mtd.Open(fn, os.O_RDWR)
+	if err != nil {
+		return nil, err
+	}
+	if d.Type == mtd.NandFlash || d.Type == mtd.MlcNandFlash {
+		d.Close()
+		return nil, fmt.Errorf("%s: is NAND", fn)
+	}
+	return mtdFlash{d}, nil
+}
+
+func (f mtdFlash) String() string               { return f.Name() }
+func (f mtdFlash) Size() uint32                 { return f.Info.Size }
+func (f mtdFlash) EraseSize(addr uint32) uint32 { return f.Info.EraseSize }
+
+func (f mtdFlash) ReadAt(b []byte, off int64, c chan float32) (int, error) {
+	return chunks(b, off, c, f.File.ReadAt)
+}
+
+func (f mtdFlash) WriteAt(b []byte, off int64, c chan float32) (int, error) {
+	return chunks(b, off, c, f.File.WriteAt)
+}
+
+func (f mtdFlash) Erase(addr, size uint32, c chan float32) error {
+	return eraseBlocks(f, addr, size, c, f.Device.Erase)
+}
+
+// FileEraseSize is the erase block size of file programmers.
+var FileEraseSize uint32 = 4096
+
+// fileFlash programs an image file for offline updates and tests.
+type fileFlash struct {
+	*os.File
+	size uint32
+}
+
+func openFile(fn string) (Flash, error) {
+	f, err := os.OpenFile(fn, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.Size() == 0 || fi.Size()%int64(FileEraseSize) != 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s: size isn't a multiple of %d", fn,
+			FileEraseSize)
+	}
+	return &fileFlash{f, uint32(fi.Size())}, nil
+}
+
+func (f *fileFlash) String() string               { return f.Name() }
+func (f *fileFlash) Size() uint32                 { return f.size }
+func (f *fileFlash) EraseSize(addr uint32) uint32 { return FileEraseSize }
+
+func (f *fileFlash) ReadAt(b []byte, off int64, c chan float32) (int, error) {
+	return chunks(b, off, c, f.File.ReadAt)
+}
+
+func (f *fileFlash) WriteAt(b []byte, off int64, c chan float32) (int, error) {
+	// like flash, programming only clears bits
+	cur := make([]byte, len(b))
+	if _, err := f.File.ReadAt(cur, off); err != nil {
+		return 0, err
+	}
+	for i := range cur {
+		cur[i] &= b[i]
+	}
+	return chunks(cur, off, c, f.File.WriteAt)
+}
+
+func (f *fileFlash) Erase(addr, size uint32, c chan float32) error {
+	return eraseBlocks(f, addr, size, c, func(addr, size uint32) error {
+		_, err := f.File.WriteAt(erased(size), int64(addr))
+		return err
+	})
+}
+
+func erased(n uint32) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = 0xff
+	}
+	return b
+}
+
+// chunks reads or writes 64KiB at a time to report progress.
+func chunks(b []byte, off int64, c chan float32,
+	f func([]byte, int64) (int, error)) (n int, err error) {
+	const chunk = 64 * 1024
+	for n < len(b) {
+		if c != nil {
+			c <- (float32(n) / float32(len(b))) * 100
+		}
+		end := n + chunk
+		if end > len(b) {
+			end = len(b)
+		}
+		var i int
+		i, err = f(b[n:end], off+int64(n))
+		n += i
+		if err != nil {
+			break
+		}
+	}
+	return
+}
+
+func eraseBlocks(f Flash, addr, size uint32, c chan float32,
+	erase func(addr, size uint32) error) error {
+	end := addr + size
+	for a := addr; a < end; {
+		bs := f.EraseSize(a)
+		if a%bs != 0 || a+bs > end {
+			return fmt.Errorf("%#x: erase not aligned to %#x", a, bs)
+		}
+		if c != nil {
+			c <- (float32(a-addr) / float32(size)) * 100
+		}
+		if err := erase(a, bs); err != nil {
+			return err
+		}
+		a += bs
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// +build linux
+
+package biosupdate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Region is an address range of the flash, inclusive of Limit.
+type Region struct {
+	Name        string
+	Base, Limit uint32
+}
+
+func (r Region) Size() uint32 { return r.Limit - r.Base + 1 }
+
+func (r Region) String() string {
+	return fmt.Sprintf("%-10s %08x-%08x", r.Name, r.Base, r.Limit)
+}
+
+// RegionNames are the Intel Flash Descriptor regions by FLREG index.
+var RegionNames = []string{
+	"descriptor",
+	"bios",
+	"me",
+	"gbe",
+	"pd",
+	"devexp",
+	"bios2",
+	"reserved",
+	"ec",
+}
+
+const (
+	ifdSignature       = 0x0ff0a55a
+	ifdSignatureOffset = 0x10
+	// DescriptorSize is the flash read to find the regions.
+	DescriptorSize = 4096
+)
+
+var ErrNoDescriptor = errors.New("no flash descriptor")
+
+// ParseIFD returns the used regions of the Intel Flash Descriptor at the
+// beginning of the image, b, of a flash with the given size.
+func ParseIFD(b []byte, size uint32) ([]Region, error) {
+	le := binary.LittleEndian
+	if len(b) < ifdSignatureOffset+8 ||
+		le.Uint32(b[ifdSignatureOffset:]) != ifdSignature {
+		return nil, ErrNoDescriptor
+	}
+	flmap0 := le.Uint32(b[ifdSignatureOffset+4:])
+	frba := int((flmap0>>16)&0xff) << 4
+	var regions []Region
+	for i, name := range RegionNames {
+		off := frba + 4*i
+		if off+4 > len(b) {
+			break
+		}
+		flreg := le.Uint32(b[off:])
+		base := (flreg & 0x7fff) << 12
+		limit := ((flreg>>16)&0x7fff)<<12 | 0xfff
+		// unused regions have base > limit; older descriptors have
+		// fewer regions and other data beyond
+		if base > limit || limit >= size || (i > 0 && base == 0) {
+			continue
+		}
+		regions = append(regions, Region{name, base, limit})
+	}
+	if len(regions) == 0 || regions[0].Name != "descriptor" {
+		return nil, ErrNoDescriptor
+	}
+	return regions, nil
+}
+
+// SelectRegions returns the named regions of the layout; "all" is the
+// whole flash. If preserve is true, it returns the regions not named.
+func SelectRegions(layout []Region, names string, preserve bool,
+	size uint32) ([]Region, error) {
+	want := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		if len(name) == 0 {
+			continue
+		}
+		if name != "all" && find(layout, name) == nil {
+			return nil, fmt.Errorf("%s: no such region", name)
+		}
+		want[name] = true
+	}
+	if want["all"] {
+		if preserve {
+			return nil, nil
+		}
+		return []Region{{"all", 0, size - 1}}, nil
+	}
+	var regions []Region
+	for _, r := range layout {
+		if want[r.Name] != preserve {
+			regions = append(regions, r)
+		}
+	}
+	return regions, nil
+}
+
+func find(layout []Region, name string) *Region {
+	for i := range layout {
+		if layout[i].Name == name {
+			return &layout[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// +build linux,!amd64
+
+package biosupdate
+
+import "fmt"
+
+func openICH(spinum uint) (Flash, error) {
+	return nil, fmt.Errorf("ich: unavailable on this platform")
+}
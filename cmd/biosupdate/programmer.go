@@ -79,6 +79,45 @@ func (p *Programmer) BiosImageSize() uint32  { return p.biosImageSize }
 func (p *Programmer) TotalFlashSize() uint32 { return p.totalFlashSize }
 func (p *Programmer) CurrentSPINum() uint    { return p.currentSPINum }
 
+func openICH(spinum uint) (Flash, error) {
+	p := new(Programmer)
+	if err := p.Open(spinum); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Programmer) String() string { return fmt.Sprintf("SPI%d", p.currentSPINum) }
+
+func (p *Programmer) Size() uint32 { return p.totalFlashSize }
+
+func (p *Programmer) EraseSize(addr uint32) uint32 {
+	size, _ := p.getEraseBlockSize(addr)
+	return size
+}
+
+func (p *Programmer) Erase(addr, size uint32, c chan float32) error {
+	return p.EraseFlash(addr, size, c)
+}
+
+// Regions returns the flash regions of the FREG registers for the case
+// that the descriptor isn't readable.
+func (p *Programmer) Regions() []Region {
+	var regions []Region
+	for i := 0; i < 5; i++ {
+		freg := p.spiBarReadReg32(ich9RegFreg0 + uintptr(4*i))
+		base, limit := ichFregBase(freg), ichFregLimit(freg)
+		if base < limit {
+			regions = append(regions, Region{
+				Name:  RegionNames[i],
+				Base:  base,
+				Limit: limit,
+			})
+		}
+	}
+	return regions
+}
+
 func (p *Programmer) spiBarReadReg32(offset uintptr) uint32 {
 	//	return *(*uint32)(unsafe.Pointer(uintptr(p.spibar)+offset))
 	return memio.LoadUint32(uintptr(p.spibar) + offset)
@@ -0,0 +1,155 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package blkid
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/internal/blockdev"
+	"github.com/platinasystems/goes/lang"
+)
+
+// These are the tags printed by default in this order.
+var tags = []string{
+	"LABEL",
+	"UUID",
+	"TYPE",
+	"PTUUID",
+	"PTTYPE",
+	"PARTLABEL",
+	"PARTUUID",
+}
+
+type Command struct{}
+
+func (Command) String() string { return "blkid" }
+
+func (Command) Usage() string {
+	return `blkid [-o full|value|export|device] [-s TAG,...] [-t NAME=VALUE] [DEVICE]...
+	blkid -U UUID | -L LABEL`
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "print block device attributes",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Print the filesystem type, UUID and LABEL, and partition table
+	attributes of the given or all block devices that have any.
+
+OPTIONS
+	-o full		DEVICE: NAME="VALUE"... (default)
+	-o value	print each value on a separate line
+	-o export	print NAME=VALUE lines with DEVNAME for each device,
+			separated by an empty line
+	-o device	print only the device name
+	-s TAG,...	print only these tags
+	-t NAME=VALUE	print only devices with this tag, e.g. TYPE=ext4
+	-U UUID		print the device of the filesystem with this UUID
+	-L LABEL	print the device of the filesystem with this LABEL
+
+TAGS
+	LABEL UUID TYPE PTUUID PTTYPE PARTLABEL PARTUUID PARTTYPE`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	parm, args := parms.New(args, "-o", "-s", "-t", "-U", "-L")
+	devs, err := blockdev.Scan()
+	if err != nil {
+		return err
+	}
+	for _, x := range []struct{ opt, tag string }{
+		{"-U", "UUID"},
+		{"-L", "LABEL"},
+	} {
+		if v := parm.ByName[x.opt]; len(v) > 0 {
+			d := blockdev.Lookup(devs, x.tag+"="+v)
+			if d == nil {
+				return fmt.Errorf("%s=%s: not found", x.tag, v)
+			}
+			fmt.Println(d.Path)
+			return nil
+		}
+	}
+	show := tags
+	if s := parm.ByName["-s"]; len(s) > 0 {
+		show = strings.Split(strings.ToUpper(s), ",")
+	}
+	var selected []*blockdev.Device
+	if len(args) > 0 {
+		for _, arg := range args {
+			d := blockdev.Lookup(devs, arg)
+			if d == nil {
+				return fmt.Errorf("%s: not a block device", arg)
+			}
+			selected = append(selected, d)
+		}
+	} else {
+		blockdev.Walk(devs, func(d *blockdev.Device, _ int) bool {
+			for _, tag := range tags {
+				if len(d.Tag(tag)) > 0 {
+					selected = append(selected, d)
+					break
+				}
+			}
+			return true
+		})
+	}
+	var tname, tval string
+	if t := parm.ByName["-t"]; len(t) > 0 {
+		eq := strings.Index(t, "=")
+		if eq < 1 {
+			return fmt.Errorf("%s: expected NAME=VALUE", t)
+		}
+		tname, tval = t[:eq], strings.Trim(t[eq+1:], `"`)
+	}
+	printed := make(map[string]bool)
+	for _, d := range selected {
+		if printed[d.Name] {
+			continue
+		}
+		printed[d.Name] = true
+		if len(tname) > 0 && !strings.EqualFold(d.Tag(tname), tval) {
+			continue
+		}
+		switch o := parm.ByName["-o"]; o {
+		case "", "full":
+			s := d.Path + ":"
+			for _, tag := range show {
+				if v := d.Tag(tag); len(v) > 0 {
+					s += fmt.Sprintf(" %s=%q", tag, v)
+				}
+			}
+			fmt.Println(s)
+		case "value":
+			for _, tag := range show {
+				if v := d.Tag(tag); len(v) > 0 {
+					fmt.Println(v)
+				}
+			}
+		case "export":
+			fmt.Printf("DEVNAME=%s\n", d.Path)
+			for _, tag := range show {
+				if v := d.Tag(tag); len(v) > 0 {
+					fmt.Printf("%s=%s\n", tag, v)
+				}
+			}
+			fmt.Println()
+		case "device":
+			fmt.Println(d.Path)
+		default:
+			return fmt.Errorf("%s: unknown output format", o)
+		}
+	}
+	return nil
+}
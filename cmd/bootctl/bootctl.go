@@ -0,0 +1,188 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package bootctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/platinasystems/goes/cmd/grub/bootentry"
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct{}
+
+func (Command) String() string { return "bootctl" }
+
+func (Command) Usage() string {
+	return "bootctl [-f FILE | -m DIR] [COMMAND [ARG]]"
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "control the default, next and fallback boot entries",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Print or change the grubenv of the boot configuration that grubd
+	would run. ENTRY is a menu number, title or id; or a ">" separated
+	path of these through submenus.
+
+COMMANDS
+	status			print the boot configuration and variables
+				(default)
+	set-default ENTRY	boot ENTRY by default, i.e. saved_entry
+	set-oneshot ENTRY	boot ENTRY once, i.e. next_entry
+	set-fallback ENTRY	boot ENTRY after too many failures
+	set-tries N		fall back after N unconfirmed boots of the
+				default; 0 disables boot counting
+	good			confirm the current boot
+	bad			fall back on the next boot
+	unset VARIABLE		remove a variable
+
+	Booted systems should run "bootctl good", or otherwise unset
+	recordfail, once they're up.
+
+OPTIONS
+	-f FILE		the grubenv file
+	-m DIR		the boot filesystem mount point, default: the first
+			in /mountd with a boot configuration`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	parm, args := parms.New(args, "-f", "-m")
+	fn := parm.ByName["-f"]
+	cfg := ""
+	if len(fn) == 0 {
+		var err error
+		fn, cfg, err = find(parm.ByName["-m"])
+		if err != nil {
+			return err
+		}
+	}
+	cmd := "status"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	arg := func() (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("%s: expected one argument", cmd)
+		}
+		return args[0], nil
+	}
+	set := func(k, v string) error {
+		return grubenv.Update(fn, func(env grubenv.Env) error {
+			env.Set(k, v)
+			return nil
+		})
+	}
+	switch cmd {
+	case "status":
+		env, err := grubenv.Read(fn)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(cfg) > 0 {
+			fmt.Println("config:", cfg)
+		}
+		fmt.Println("grubenv:", fn)
+		for _, k := range grubenv.Vars {
+			if v := env[k]; len(v) > 0 {
+				fmt.Printf("%s: %s\n", k, v)
+			}
+		}
+		return nil
+	case "set-default", "set-oneshot", "set-fallback":
+		v, err := arg()
+		if err != nil {
+			return err
+		}
+		return set(map[string]string{
+			"set-default":  grubenv.SavedEntry,
+			"set-oneshot":  grubenv.NextEntry,
+			"set-fallback": grubenv.Fallback,
+		}[cmd], v)
+	case "set-tries":
+		v, err := arg()
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s: invalid", v)
+		}
+		return grubenv.Update(fn, func(env grubenv.Env) error {
+			if n == 0 {
+				env.Set(grubenv.BootTries, "")
+				env.Set(grubenv.BootCount, "")
+			} else {
+				env.Set(grubenv.BootTries, v)
+			}
+			return nil
+		})
+	case "good":
+		return grubenv.Update(fn, func(env grubenv.Env) error {
+			env.Set(grubenv.RecordFail, "")
+			env.Set(grubenv.BootCount, "")
+			return nil
+		})
+	case "bad":
+		return grubenv.Update(fn, func(env grubenv.Env) error {
+			tries := env.Int(grubenv.BootTries)
+			if tries == 0 {
+				return fmt.Errorf("boot counting is disabled")
+			}
+			env.Set(grubenv.RecordFail, "1")
+			env.Set(grubenv.BootCount, strconv.Itoa(tries))
+			return nil
+		})
+	case "unset":
+		v, err := arg()
+		if err != nil {
+			return err
+		}
+		return set(v, "")
+	}
+	return fmt.Errorf("%s: unknown command", cmd)
+}
+
+// find returns the grubenv and boot configuration of the given mount
+// point or the first in /mountd in the order that grubd runs them.
+func find(mnt string) (fn, cfg string, err error) {
+	var mnts []string
+	if len(mnt) > 0 {
+		mnts = []string{mnt}
+	} else {
+		const mp = "/mountd"
+		fis, err := ioutil.ReadDir(mp)
+		if err != nil {
+			return "", "", err
+		}
+		for _, fi := range fis {
+			mnts = append(mnts, filepath.Join(mp, fi.Name()))
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(mnts)))
+	}
+	for _, mnt := range mnts {
+		for _, dir := range []string{"", "/boot", "/d-i"} {
+			if cfg = bootentry.Find(mnt, dir); len(cfg) > 0 {
+				return filepath.Join(mnt, grubenv.File(cfg)),
+					filepath.Join(mnt, cfg), nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("no boot configuration")
+}
@@ -10,6 +10,8 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/platinasystems/goes"
 	"github.com/platinasystems/goes/cmd"
@@ -17,6 +19,7 @@ import (
 	"github.com/platinasystems/goes/cmd/cli/internal/notliner"
 	"github.com/platinasystems/goes/cmd/resize"
 	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/internal/audit"
 	"github.com/platinasystems/goes/internal/shellutils"
 	"github.com/platinasystems/goes/lang"
 	"github.com/platinasystems/url"
@@ -37,12 +40,20 @@ type Command struct {
 	}
 	Stdin          io.Reader
 	Stdout, Stderr io.Writer
+
+	source   string
+	line     int
+	problems int
+
+	// recorded lines of an audited interactive command
+	audit    bool
+	recorded []string
 }
 
 func (*Command) String() string { return "cli" }
 
 func (*Command) Usage() string {
-	return "cli [-x] [-p PROMPT] [URL]"
+	return "cli [-n] [-x] [-p PROMPT] [URL]"
 }
 
 func (*Command) Apropos() lang.Alt {
@@ -67,7 +78,13 @@ DESCRIPTION
 	associatated commands to provide semantics without altering the basic
 	syntax.
 
-	The '-x' flag enables trace of each interpreted command.
+	The '-x' flag enables trace of each interpreted command; this
+	prints the expanded command and its script location to stderr
+	before it's run.
+
+	The '-n' flag reads and checks the script without running any
+	commands. This reports syntax errors, unbalanced blocks (e.g. if
+	without fi) and unknown commands with their script location.
 
 	With 'URL', commands are sourced from the reference instead of prompted
 	tty input.
@@ -151,8 +168,52 @@ OPTIONS
 		Read command script upto LABEL as stdin. If LABEL is prefaced
 		by '-', the leading whitespace is trimmed from each line.
 
-	Note: unlike other shells, there must be a space or equal ('=')
-	between the redirection symbols and URL or LABEL.
+	<<< WORD
+		Read WORD and a trailing newline as stdin.
+
+	<> FILE	Open FILE for reading and writing as stdin.
+
+	Each of these may be prefaced by a descriptor number to redirect
+	other than stdin or stdout, e.g.:
+
+		N> URL	N>> URL	  N< URL    N<> FILE
+
+	N>&M
+	N<&M	Duplicate descriptor M as N, e.g. 2>&1 or >&2.
+
+	N>&-
+	N<&-	Close descriptor N.
+
+	&> URL
+	&>> URL
+		Redirect or append both stdout and stderr to URL.
+
+	Redirections are applied from left to right, so,
+		COMMAND > FILE 2>&1
+	sends both stdout and stderr to FILE whereas
+		COMMAND 2>&1 > FILE
+	sends stderr to the former stdout. Descriptors above 2 are only
+	available to forked commands and must refer to files.
+
+HISTORY
+	Interactive commands are saved to $HISTFILE, or ~/.goes_history by
+	default, and reloaded by later sessions. The file is trimmed to the
+	last $HISTSIZE (default 1000) entries on exit; HISTSIZE=0 disables
+	the saved history.
+
+	Lines continuing an if, while, for, function or other command block
+	are joined with the first line of the block into one history entry
+	that may be recalled and edited as a whole.
+
+EDITING
+	In addition to the usual line editing keys, Ctrl-R incrementally
+	searches the history backwards and TAB completes:
+
+		command and function names
+		$VARIABLE names
+		file names following a redirection operator
+		command specific arguments, e.g. the redis keys and
+		fields of hget and hset
 
 PIPES
 	The COMMAND output may be piped to the input of another COMMAND, e.g.:
@@ -176,6 +237,10 @@ func (c *Command) Read(p []byte) (n int, err error) {
 	if err != nil {
 		return
 	}
+	c.line++
+	if c.audit {
+		c.recorded = append(c.recorded, s)
+	}
 	n = copy(p, s)
 	if len(s) > len(p) {
 		err = errors.New("input too long")
@@ -183,6 +248,14 @@ func (c *Command) Read(p []byte) (n int, err error) {
 	return
 }
 
+// Location returns the script and line number of the last command read.
+func (c *Command) Location() string {
+	if len(c.source) == 0 {
+		return ""
+	}
+	return fmt.Sprint(c.source, ":", c.line)
+}
+
 func (c *Command) Write(p []byte) (n int, err error) {
 	c.promptString = string(p)
 	return len(c.promptString), nil
@@ -225,12 +298,29 @@ func (c *Command) Main(args ...string) error {
 		}
 	}()
 
-	flag, args := flags.New(args, "-f", "-x", "-", "-no-liner")
+	flag, args := flags.New(args, "-f", "-n", "-x", "-", "-no-liner")
+
+	// restore the context of a sourcing script
+	prompter, source, line := c.prompter, c.source, c.line
+	noexec, trace, audited := c.g.NoExec, c.g.Trace, c.audit
+	defer func() {
+		c.prompter, c.source, c.line = prompter, source, line
+		c.g.NoExec, c.g.Trace, c.audit = noexec, trace, audited
+	}()
+	c.source, c.line = "", 0
+	if flag.ByName["-n"] {
+		c.g.NoExec = true
+	}
+	if flag.ByName["-x"] {
+		c.g.Trace = true
+	}
+
 	switch len(args) {
 	case 0:
 		switch {
 		case flag.ByName["-"]:
 			c.prompter = notliner.New(c.Stdin, nil)
+			c.source = "stdin"
 			isScript = true
 		case flag.ByName["-no-liner"]:
 			c.prompter = notliner.New(c.Stdin, c.Stdout)
@@ -249,6 +339,7 @@ func (c *Command) Main(args ...string) error {
 		defer script.Close()
 		c.prompter = notliner.New(script, nil)
 		defer c.prompter.Close()
+		c.source = args[0]
 		isScript = true
 	default:
 		return fmt.Errorf("%v: unexpected", args[1:])
@@ -260,6 +351,7 @@ func (c *Command) Main(args ...string) error {
 	if c.g.Catline == nil {
 		c.g.Catline = c
 	}
+	c.audit = !isScript && !c.g.NoExec && audit.Enabled() != nil
 readCommandLoop:
 	for {
 		select {
@@ -276,10 +368,19 @@ readCommandLoop:
 				}
 			}
 		}
+		if c.audit {
+			c.recorded = c.recorded[:0]
+			// forked commands fail through Status rather than err
+			c.g.Status = nil
+		}
 		cl, err := shellutils.Parse(prompt, c.g.Catline)
 		if err != nil {
 			if err == io.EOF {
-				return nil
+				return c.checked()
+			}
+			if c.g.NoExec {
+				c.problem(err)
+				continue readCommandLoop
 			}
 			fmt.Fprintln(c.Stderr, err)
 			if isScript && !flag.ByName["-f"] {
@@ -287,8 +388,25 @@ readCommandLoop:
 			}
 			continue readCommandLoop
 		}
+		start := time.Now()
 		err = c.runList(*cl, flag, isScript)
-		if err != nil {
+		if c.audit && len(c.recorded) > 0 {
+			status := err
+			if status == nil {
+				status = c.g.Status
+			}
+			audit.Log(strings.Join(c.recorded, "\n"), start, status)
+		}
+		if c.g.NoExec {
+			for _, p := range c.g.Problems {
+				c.problems++
+				fmt.Fprintln(c.Stderr, p)
+			}
+			c.g.Problems = c.g.Problems[:0]
+			if err != nil {
+				c.problem(err)
+			}
+		} else if err != nil {
 			if isScript && !flag.ByName["-f"] {
 				return err
 			} else {
@@ -302,7 +420,7 @@ func (c *Command) runList(ls shellutils.List, flag *flags.Flags, isScript bool)
 	// loop for each pipeline in command list
 	for len(ls.Cmds) != 0 {
 		newls, _, runner, err := c.g.ProcessList(ls)
-		if err == nil {
+		if err == nil && !c.g.NoExec {
 			err = runner(c.Stdin, c.Stdout, c.Stderr)
 		}
 		if err != nil {
@@ -316,3 +434,25 @@ func (c *Command) runList(ls shellutils.List, flag *flags.Flags, isScript bool)
 	}
 	return nil
 }
+
+// problem prints an error found while checking a script.
+func (c *Command) problem(err error) {
+	c.problems++
+	if loc := c.g.Location(); len(loc) > 0 {
+		fmt.Fprint(c.Stderr, loc, ": ")
+	}
+	fmt.Fprintln(c.Stderr, err)
+}
+
+// checked returns an error if problems were found while checking a script.
+func (c *Command) checked() error {
+	if !c.g.NoExec || c.problems == 0 {
+		return nil
+	}
+	n := c.problems
+	c.problems = 0
+	if n == 1 {
+		return errors.New("1 problem")
+	}
+	return fmt.Errorf("%d problems", n)
+}
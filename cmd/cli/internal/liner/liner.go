@@ -8,9 +8,13 @@ package liner
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -22,16 +26,23 @@ import (
 	"github.com/platinasystems/goes/internal/fields"
 	"github.com/platinasystems/goes/internal/nocomment"
 	"github.com/platinasystems/goes/internal/pizza"
+	"github.com/platinasystems/goes/internal/shellutils"
 	"github.com/platinasystems/liner"
 )
 
 const woliner = false
 
+// DefaultHistorySize is the number of persistent history entries retained
+// unless overridden by $HISTSIZE.
+const DefaultHistorySize = 1000
+
 type Liner struct {
 	history struct {
-		buf   *bytes.Buffer
+		fn    string
+		size  int
 		lines []string
-		i     int
+		// saved is false until the last entry is appended to fn
+		saved bool
 	}
 	fallback *notliner.Prompter
 	goes     *goes.Goes
@@ -40,54 +51,236 @@ type Liner struct {
 
 func New(g *goes.Goes) *Liner {
 	l := new(Liner)
-	l.history.buf = new(bytes.Buffer)
-	l.history.lines = make([]string, 0, 1<<6)
 	if woliner {
 		l.fallback = notliner.New(os.Stdin, os.Stdout)
 	}
 	l.goes = g
+	l.history.size = DefaultHistorySize
+	if s := l.getenv("HISTSIZE"); len(s) > 0 {
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+			l.history.size = n
+		}
+	}
+	l.history.fn = l.historyFile()
+	l.history.lines = make([]string, 0, 1<<6)
+	l.loadHistory()
 	return l
 }
 
+// Close saves the last history entry and trims the history file to
+// $HISTSIZE entries.
 func (l *Liner) Close() {
+	l.saveHistory()
+	l.trimHistory()
 }
 
-// Returns all completions of the given command line.
-func (l *Liner) complete(line string) (lines []string) {
-	lsi := strings.LastIndex(line, " ")
-	pl := pizza.New("|")
-	defer pl.Reset()
-	pl.Slice(fields.New(nocomment.New(strings.TrimLeft(line, " \t")))...)
-	if len(pl.Slices) == 0 {
+func (l *Liner) getenv(k string) string {
+	if v, found := l.goes.EnvMap[k]; found {
+		return v
+	}
+	return os.Getenv(k)
+}
+
+// historyFile returns $HISTFILE or ~/.goes_history
+func (l *Liner) historyFile() string {
+	if fn, found := l.goes.EnvMap["HISTFILE"]; found {
+		return fn
+	}
+	if fn, found := os.LookupEnv("HISTFILE"); found {
+		return fn
+	}
+	home, err := os.UserHomeDir()
+	if err != nil || len(home) == 0 {
+		u, err := user.Current()
+		if err != nil {
+			return ""
+		}
+		home = u.HomeDir
+	}
+	return filepath.Join(home, ".goes_history")
+}
+
+func (l *Liner) loadHistory() {
+	if len(l.history.fn) == 0 || l.history.size == 0 {
 		return
 	}
-	args := pl.Slices[len(pl.Slices)-1]
-	pr, pw, err := os.Pipe()
+	f, err := os.Open(l.history.fn)
 	if err != nil {
 		return
 	}
-	go func() {
-		t := os.Stdout
-		defer func() { os.Stdout = t }()
-		os.Stdout = pw
-		l.goes.Main(append([]string{"complete"}, args...)...)
-		pw.Close()
-	}()
-	prs := bufio.NewScanner(pr)
-	for prs.Scan() {
-		if lsi < 1 {
-			lines = append(lines, prs.Text())
-		} else {
-			lines = append(lines, line[:lsi+1]+prs.Text())
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		l.history.lines = append(l.history.lines, scanner.Text())
+	}
+	if n := len(l.history.lines) - l.history.size; n > 0 {
+		l.history.lines = l.history.lines[n:]
+	}
+	l.history.saved = true
+}
+
+// saveHistory appends the last entry to the history file.
+func (l *Liner) saveHistory() {
+	n := len(l.history.lines)
+	if l.history.saved || n == 0 || len(l.history.fn) == 0 ||
+		l.history.size == 0 {
+		return
+	}
+	l.history.saved = true
+	f, err := os.OpenFile(l.history.fn,
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, l.history.lines[n-1])
+}
+
+// trimHistory rewrites the history file with the last $HISTSIZE entries,
+// including those of concurrent sessions.
+func (l *Liner) trimHistory() {
+	if len(l.history.fn) == 0 || l.history.size == 0 {
+		return
+	}
+	buf, err := ioutil.ReadFile(l.history.fn)
+	if err != nil {
+		return
+	}
+	lines := strings.SplitAfter(string(buf), "\n")
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	n := len(lines) - l.history.size
+	if n <= 0 {
+		return
+	}
+	tmp := l.history.fn + ".tmp"
+	err = ioutil.WriteFile(tmp, []byte(strings.Join(lines[n:], "")), 0600)
+	if err == nil {
+		err = os.Rename(tmp, l.history.fn)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// addHistory appends a new entry or, for the continuation of a block or
+// escaped line, extends the last entry so that it may be recalled and edited
+// as one line.
+func (l *Liner) addHistory(prompt, line string) {
+	n := len(l.history.lines)
+	if n > 0 {
+		if sep, found := l.continuation(prompt); found {
+			last := l.history.lines[n-1]
+			if sep == "\\" {
+				last = strings.TrimSuffix(last, sep)
+				sep = ""
+			} else if sep == "; " && (strings.HasSuffix(last, "{") ||
+				strings.HasSuffix(last, ";")) {
+				sep = " "
+			}
+			l.history.lines[n-1] = last + sep + line
+			l.history.saved = false
+			return
 		}
 	}
-	pr.Close()
-	if len(lines) == 1 {
+	l.saveHistory()
+	if len(strings.TrimSpace(line)) == 0 ||
+		(n > 0 && line == l.history.lines[n-1]) {
+		return
+	}
+	if l.history.size > 0 && n >= l.history.size {
+		copy(l.history.lines, l.history.lines[1:])
+		l.history.lines = l.history.lines[:n-1]
+	}
+	l.history.lines = append(l.history.lines, line)
+	l.history.saved = false
+}
+
+// continuation returns the separator used to join a line read with the given
+// prompt to the previous history entry.
+func (l *Liner) continuation(prompt string) (string, bool) {
+	switch prompt {
+	case "... ":
+		return "\\", true
+	case "|>>", "||>>", "&&>>":
+		return " ", true
+	}
+	if name := strings.TrimSuffix(prompt, ">"); name != prompt {
+		if v, found := l.goes.ByName[name]; found {
+			if _, found = v.(goes.Blocker); found {
+				return "; ", true
+			}
+		}
+	}
+	return "", false
+}
+
+// Returns all completions of the given command line.
+func (l *Liner) complete(line string) (lines []string) {
+	lead, words, redirect := commandWords(line)
+	cur := words[len(words)-1]
+	var completions []string
+	switch {
+	case strings.HasPrefix(cur, "$"):
+		completions = l.completeVariable(cur)
+	case redirect:
+		completions = completeFile(cur)
+	case len(words) == 1:
+		completions = l.goes.Complete(cur)
+		for name := range l.goes.FunctionMap {
+			if strings.HasPrefix(name, cur) {
+				completions = append(completions, name)
+			}
+		}
+		sort.Strings(completions)
+	default:
+		completions = l.goes.Complete(words...)
+	}
+	for _, s := range completions {
+		lines = append(lines, lead+s)
+	}
+	if len(lines) == 1 && !strings.HasSuffix(lines[0], "/") {
 		lines[0] += " "
 	}
 	return
 }
 
+func (l *Liner) completeVariable(cur string) (completions []string) {
+	prefix := strings.TrimPrefix(cur[1:], "{")
+	names := make(map[string]bool)
+	for k := range l.goes.EnvMap {
+		names[k] = true
+	}
+	for _, kv := range os.Environ() {
+		if eq := strings.Index(kv, "="); eq > 0 {
+			names[kv[:eq]] = true
+		}
+	}
+	for k := range names {
+		if strings.HasPrefix(k, prefix) {
+			if strings.HasPrefix(cur, "${") {
+				completions = append(completions, "${"+k+"}")
+			} else {
+				completions = append(completions, "$"+k)
+			}
+		}
+	}
+	sort.Strings(completions)
+	return
+}
+
+func completeFile(cur string) (completions []string) {
+	matches, _ := filepath.Glob(cur + "*")
+	for _, match := range matches {
+		if fi, err := os.Stat(match); err == nil && fi.IsDir() {
+			match += "/"
+		}
+		completions = append(completions, match)
+	}
+	return
+}
+
 // Prints the best available help text for the last arg of line
 func (l *Liner) help(line string) {
 	pl := pizza.New("|")
@@ -109,6 +302,7 @@ func (l *Liner) Prompt(prompt string) (string, error) {
 		l.s = liner.NewLiner()
 		l.s.SetCompleter(l.complete)
 		l.s.SetHelper(l.help)
+		l.s.SetMultiLineMode(true)
 		defer func() {
 			ll := l.s
 			l.s = nil
@@ -160,37 +354,92 @@ func (l *Liner) Prompt(prompt string) (string, error) {
 		l.goes.Status = status
 	}
 
-	if len(l.history.lines) > 0 {
-		l.history.buf.Reset()
-		if len(l.history.lines) < cap(l.history.lines) {
-			for i := 0; i < l.history.i; i++ {
-				fmt.Fprintln(l.history.buf, l.history.lines[i])
-			}
-		} else {
-			for i := l.history.i + 1; ; i++ {
-				i &= cap(l.history.lines) - 1
-				if i == l.history.i {
-					break
-				}
-				fmt.Fprintln(l.history.buf, l.history.lines[i])
-			}
-		}
-		l.s.ReadHistory(l.history.buf)
+	for _, line := range l.history.lines {
+		l.s.AppendHistory(line)
 	}
 
 	line, err := l.s.Prompt(prompt)
 
 	if err == nil {
-		if len(l.history.lines) < cap(l.history.lines) {
-			l.history.lines = append(l.history.lines, line)
-		} else {
-			l.history.lines[l.history.i] = line
-		}
-		l.history.i++
-		l.history.i &= cap(l.history.lines) - 1
+		l.addHistory(prompt, line)
 	} else if err == liner.ErrNotTerminalOutput {
 		l.fallback = notliner.New(os.Stdin, os.Stdout)
 		line, err = l.fallback.Prompt(prompt)
 	}
 	return line, err
 }
+
+// commandWords returns the text preceding the word being completed and the
+// words of the last command in line, less leading variable assignments and
+// redirections. The last word is the one being completed; it's empty for
+// completion of the next argument. redirect is true if the completed word is
+// the target of a redirection.
+func commandWords(line string) (lead string, words []string, redirect bool) {
+	start := 0
+	quote := rune(0)
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'', r == '"':
+			quote = r
+		case r == '|', r == ';', r == '(', r == ')':
+			start = i + 1
+		case r == '&':
+			prev, next := byte(0), byte(0)
+			if i > 0 {
+				prev = line[i-1]
+			}
+			if i < len(line)-1 {
+				next = line[i+1]
+			}
+			if prev != '>' && prev != '<' && next != '>' {
+				start = i + 1
+			}
+		}
+	}
+	lead = line[:start]
+	if i := strings.LastIndexAny(line[start:], " \t"); i >= 0 {
+		lead = line[:start+i+1]
+	}
+	cur := line[len(lead):]
+	prior := fields.New(nocomment.New(line[start:len(lead)]))
+	if i := strings.LastIndexAny(cur, "<>"); i >= 0 {
+		// e.g. >FILE or 2>>FILE
+		lead += cur[:i+1]
+		cur = cur[i+1:]
+		redirect = true
+	} else if n := len(prior); n > 0 {
+		op, target := splitRedirection(prior[n-1])
+		redirect = len(op) > 0 && len(target) == 0
+	}
+	for i := 0; i < len(prior); i++ {
+		w := prior[i]
+		if op, target := splitRedirection(w); len(op) > 0 {
+			if len(target) == 0 {
+				i++
+			}
+			continue
+		}
+		if len(words) == 0 && strings.Contains(w, "=") {
+			continue
+		}
+		words = append(words, w)
+	}
+	return lead, append(words, cur), redirect
+}
+
+// splitRedirection returns the redirection operator, if any, that prefaces
+// the word, and the remaining target, e.g. 2>&1 -> 2>& 1
+func splitRedirection(w string) (op, target string) {
+	fd := strings.TrimLeft(w, "0123456789")
+	for _, t := range shellutils.RedirectionOps {
+		if strings.HasPrefix(fd, t) {
+			n := len(w) - len(fd) + len(t)
+			return w[:n], w[n:]
+		}
+	}
+	return "", w
+}
@@ -0,0 +1,101 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package liner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/cmd/ifcmd"
+)
+
+func TestCommandWords(t *testing.T) {
+	for _, x := range []struct {
+		line     string
+		lead     string
+		words    []string
+		redirect bool
+	}{
+		{"hg", "", []string{"hg"}, false},
+		{"hget ", "hget ", []string{"hget", ""}, false},
+		{"hget eth0 m", "hget eth0 ", []string{"hget", "eth0", "m"},
+			false},
+		{"ls | gr", "ls | ", []string{"gr"}, false},
+		{"true && echo $HO", "true && echo ",
+			[]string{"echo", "$HO"}, false},
+		{"X=1 echo hi", "X=1 echo ", []string{"echo", "hi"}, false},
+		{"cat >/tm", "cat >", []string{"cat", "/tm"}, true},
+		{"cat 2> /tm", "cat 2> ", []string{"cat", "/tm"}, true},
+		{"cat 2>&1 -", "cat 2>&1 ", []string{"cat", "-"}, false},
+		{"echo 'a;b' x", "echo 'a;b' ", []string{"echo", "a;b", "x"},
+			false},
+	} {
+		lead, words, redirect := commandWords(x.line)
+		if lead != x.lead || !reflect.DeepEqual(words, x.words) ||
+			redirect != x.redirect {
+			t.Errorf("%q: got %q %q %v", x.line, lead, words,
+				redirect)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "liner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "history")
+
+	g := &goes.Goes{
+		ByName: map[string]cmd.Cmd{
+			"if": ifcmd.Command{},
+		},
+		EnvMap: map[string]string{
+			"HISTFILE": fn,
+			"HISTSIZE": "3",
+		},
+	}
+	l := New(g)
+	for _, x := range []struct{ prompt, line string }{
+		{"goes> ", "echo one"},
+		{"goes> ", "echo two"},
+		{"goes> ", "if true"},
+		{"if>", "then"},
+		{"if>", "echo three"},
+		{"if>", "fi"},
+		{"goes> ", "echo \\"},
+		{"... ", "four"},
+		{"goes> ", "echo four"},
+	} {
+		l.addHistory(x.prompt, x.line)
+	}
+	want := []string{
+		"echo two",
+		"if true; then; echo three; fi",
+		"echo four",
+	}
+	if !reflect.DeepEqual(l.history.lines, want) {
+		t.Errorf("got %q, want %q", l.history.lines, want)
+	}
+	l.Close()
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("saved %q, want %q", got, want)
+	}
+	if l = New(g); !reflect.DeepEqual(l.history.lines, want) {
+		t.Errorf("loaded %q, want %q", l.history.lines, want)
+	}
+}
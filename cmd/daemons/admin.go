@@ -132,6 +132,18 @@ func (Status) Main(args ...string) error {
 	return err
 }
 
+// Names returns those of the daemons running under the supervisor.
+func Names() ([]string, error) {
+	var names []string
+	cl, err := atsock.NewRpcClient(sockname())
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+	err = cl.Call("Daemons.Names", struct{}{}, &names)
+	return names, err
+}
+
 func (Stop) String() string { return "stop" }
 
 func (Stop) Usage() string {
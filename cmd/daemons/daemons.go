@@ -116,6 +116,18 @@ func (d *Daemons) List(args struct{}, reply *string) error {
 	return nil
 }
 
+// Names of the running daemons, i.e. the first argument of each.
+func (d *Daemons) Names(args struct{}, reply *[]string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	names := make([]string, 0, len(d.pids))
+	for _, pid := range d.pids {
+		names = append(names, d.cmdsByPid[pid].Args[0])
+	}
+	*reply = names
+	return nil
+}
+
 func (d *Daemons) Log(args []string, reply *string) error {
 	if len(args) > 0 {
 		vargs := make([]interface{}, len(args))
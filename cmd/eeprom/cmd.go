@@ -5,10 +5,16 @@
 package eeprom
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/platinasystems/goes/external/flags"
@@ -16,6 +22,9 @@ import (
 	"github.com/platinasystems/goes/lang"
 )
 
+// BackupDir has the time stamped images saved before writing the eeprom.
+const BackupDir = "/var/lib/goes/eeprom"
+
 type Command struct {
 	Config func()
 }
@@ -23,7 +32,9 @@ type Command struct {
 func (Command) String() string { return "eeprom" }
 
 func (Command) Usage() string {
-	return "eeprom [-n] [-FIELD | FIELD=VALUE]..."
+	return `eeprom [-n] [-device FILE] [-backup FILE] [-FIELD | FIELD=VALUE]...
+eeprom [-device FILE] export FILE
+eeprom [-n] [-device FILE] [-backup FILE] import FILE`
 }
 
 func (Command) Apropos() lang.Alt {
@@ -43,12 +54,35 @@ DESCRIPTION
 	-vendor-extension 
 		set, modify, or delete vendor sub-fields
 
-	Without any args, show current eeprom configuation.`,
+	Without any args, show current eeprom configuation.
+
+	export FILE
+		save the eeprom fields, including those of the vendor
+		extension, as JSON
+
+	import FILE
+		replace the eeprom fields with those of an exported FILE
+
+	Before writing, the fields are validated and the CRC recomputed.
+	Then the current image is saved to the -backup FILE, by default,
+	a time stamped file in ` + BackupDir + `. After writing, the
+	image is read back and compared. To restore a backup,
+
+		eeprom -device BACKUP export FILE
+		eeprom import FILE
+
+OPTIONS
+	-device FILE
+		operate on an eeprom image file rather than the device;
+		its backup defaults to FILE.bak
+
+	-backup FILE
+		save the current image here rather than the default`,
 	}
 }
 
 func (c Command) Complete(args ...string) []string {
-	var a []string
+	a := []string{"export", "import"}
 	for _, v := range c.flags() {
 		a = append(a, v.(string))
 	}
@@ -60,31 +94,53 @@ func (c Command) Complete(args ...string) []string {
 }
 
 func (c Command) Main(args ...string) error {
-	var eeprom Eeprom
+	var (
+		eeprom *Eeprom
+		err    error
+	)
 	if c.Config != nil {
 		c.Config()
 	}
-	nargs := len(args)
 	flag, args := flags.New(args, c.flags()...)
 	parm, args := parms.New(args, c.parms()...)
-	if len(args) > 0 {
+	device := parm.ByName["-device"]
+	modified := false
+	for k, t := range flag.ByName {
+		modified = modified || (k != "-n" && t)
+	}
+	for k, s := range parm.ByName {
+		modified = modified || (len(s) > 0 && !strings.HasPrefix(k, "-"))
+	}
+	op := ""
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && (args[0] == "export" || args[0] == "import"):
+		if modified {
+			return fmt.Errorf("%s: unexpected with fields", args[0])
+		}
+		op = args[0]
+	default:
 		return fmt.Errorf("%v: unexpected", args)
 	}
-	buf, err := Vendor.ReadBytes()
-	if err != nil {
-		return err
+	if op == "import" {
+		eeprom, err = importFile(args[1])
+		modified = true
+	} else {
+		eeprom, err = read(device)
 	}
-	_, err = eeprom.Write(buf)
 	if err != nil {
 		return err
 	}
+	if op == "export" {
+		return exportFile(eeprom, args[1])
+	}
 	for k, t := range flag.ByName {
 		if k != "-n" && t {
 			eeprom.Del(k[1:])
 		}
 	}
 	for k, s := range parm.ByName {
-		if len(s) == 0 {
+		if len(s) == 0 || strings.HasPrefix(k, "-") {
 			continue
 		}
 		if err = eeprom.Set(k, s); err != nil {
@@ -92,13 +148,62 @@ func (c Command) Main(args ...string) error {
 		}
 
 	}
+	if modified {
+		if err = eeprom.Validate(); err != nil {
+			return err
+		}
+	}
 	os.Stdout.WriteString(eeprom.String())
-	if nargs == 0 || flag.ByName["-n"] {
+	if !modified || flag.ByName["-n"] {
 		return nil
 	}
-	if !WriteEnable {
+	return write(eeprom, device, parm.ByName["-backup"])
+}
+
+// readImage returns that of the device file, less any padding beyond the
+// length in its header, or that of Vendor.ReadBytes.
+func readImage(device string) ([]byte, error) {
+	var (
+		buf []byte
+		err error
+	)
+	if len(device) > 0 {
+		buf, err = ioutil.ReadFile(device)
+	} else if Vendor.ReadBytes != nil {
+		buf, err = Vendor.ReadBytes()
+	} else {
+		err = fmt.Errorf("no device")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < HeaderSz {
+		return nil, fmt.Errorf("truncated header")
+	}
+	n := HeaderSz + int(binary.BigEndian.Uint16(buf[LenOffset:]))
+	if n < len(buf) {
+		buf = buf[:n]
+	}
+	return buf, nil
+}
+
+func read(device string) (*Eeprom, error) {
+	buf, err := readImage(device)
+	if err != nil {
+		return nil, err
+	}
+	eeprom := new(Eeprom)
+	if _, err = eeprom.Write(buf); err != nil {
+		return nil, err
+	}
+	return eeprom, nil
+}
+
+func write(eeprom *Eeprom, device, backupFile string) error {
+	if len(device) == 0 && !WriteEnable {
 		return fmt.Errorf("write disabled")
 	}
+	buf := eeprom.Bytes()
 	clone, err := eeprom.Clone()
 	if err != nil {
 		return err
@@ -107,18 +212,114 @@ func (c Command) Main(args ...string) error {
 	if err != nil {
 		return err
 	}
-	fmt.Print("Write in  ")
-	for i := 5; i > 0; i-- {
-		fmt.Print("\b", i)
-		time.Sleep(time.Second)
+	if err = backup(device, backupFile); err != nil {
+		return err
+	}
+	if len(device) > 0 {
+		err = writeFile(device, buf)
+	} else {
+		fmt.Print("Write in  ")
+		for i := 5; i > 0; i-- {
+			fmt.Print("\b", i)
+			time.Sleep(time.Second)
+		}
+		fmt.Print("\rWriting...")
+		signal.Ignore(os.Interrupt)
+		_, err = Vendor.Write(buf)
+		fmt.Print("\r          \r")
+	}
+	if err != nil {
+		return err
+	}
+	return verify(device, buf)
+}
+
+// writeFile overwrites the leading bytes of an existing image so that
+// its size, e.g. that of a sysfs eeprom, remains.
+func writeFile(fn string, buf []byte) error {
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-	fmt.Print("\rWriting...")
-	signal.Ignore(os.Interrupt)
-	_, err = Vendor.Write(eeprom.Bytes())
-	fmt.Print("\r          \r")
 	return err
 }
 
+// backup saves the current image, if any, to the given file or the default
+// of the device.
+func backup(device, fn string) error {
+	buf, err := readImage(device)
+	if err != nil {
+		if len(device) > 0 && os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("backup: %v", err)
+	}
+	if len(fn) == 0 {
+		if len(device) > 0 {
+			fn = device + ".bak"
+		} else {
+			if err = os.MkdirAll(BackupDir, 0755); err != nil {
+				return fmt.Errorf("backup: %v", err)
+			}
+			fn = filepath.Join(BackupDir,
+				time.Now().Format("20060102T150405")+".bin")
+		}
+	}
+	if err = ioutil.WriteFile(fn, buf, 0644); err != nil {
+		return fmt.Errorf("backup: %v", err)
+	}
+	fmt.Println("backup:", fn)
+	return nil
+}
+
+// verify that the image read back is that written with a valid CRC.
+func verify(device string, buf []byte) error {
+	rb, err := readImage(device)
+	if err == nil {
+		err = Check(rb)
+	}
+	if err == nil && !bytes.Equal(rb, buf) {
+		err = fmt.Errorf("read back differs")
+	}
+	if err != nil {
+		return fmt.Errorf("verify: %v", err)
+	}
+	return nil
+}
+
+func exportFile(eeprom *Eeprom, fn string) error {
+	x, err := eeprom.Export()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(x, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, append(b, '\n'), 0644)
+}
+
+// importFile returns an eeprom of an exported file with strictly the
+// fields of Export.
+func importFile(fn string) (*Eeprom, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var x Export
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&x); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return x.Import()
+}
+
 func (Command) flags() []interface{} {
 	a := make([]interface{}, 1+len(Types))
 	a[0] = "-n"
@@ -129,11 +330,13 @@ func (Command) flags() []interface{} {
 }
 
 func (Command) parms() []interface{} {
-	a := make([]interface{}, 2+len(Types))
+	a := make([]interface{}, 4+len(Types))
 	a[0] = "Onie.Data"
 	a[1] = "Onie.Version"
+	a[2] = "-device"
+	a[3] = "-backup"
 	for i, t := range Types {
-		a[2+i] = t.String()
+		a[4+i] = t.String()
 	}
 	return a
 }
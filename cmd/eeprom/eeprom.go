@@ -8,12 +8,25 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
 )
 
 const (
 	OnieDataSz = 8
 	LenOffset  = OnieDataSz + 1
 	HeaderSz   = LenOffset + 2
+	CrcSz      = 4
+	CrcTlvSz   = 2 + CrcSz
+	// MaxSz is that of the ONIE TlvInfo header and TLVs.
+	MaxSz = 2048
+)
+
+// Signature and Version of ONIE TlvInfo
+const (
+	Signature = "TlvInfo\x00"
+	Version   = 1
 )
 
 type Eeprom struct {
@@ -24,16 +37,51 @@ type Eeprom struct {
 	Tlv TlvMap
 }
 
+// Bytes returns the image of the TLVs in type order followed by a
+// recomputed CRC, which is also updated in the Crc TLV.
 func (p *Eeprom) Bytes() []byte {
 	buf := new(bytes.Buffer)
 	buf.Write(p.Onie.Data[:])
 	buf.WriteByte(byte(*p.Onie.Version))
 	tlvbytes := p.Tlv.Bytes()
-	binary.Write(buf, binary.BigEndian, uint16(len(tlvbytes)))
+	binary.Write(buf, binary.BigEndian, uint16(len(tlvbytes)+CrcTlvSz))
 	buf.Write(tlvbytes)
+	buf.WriteByte(CrcType.Byte())
+	buf.WriteByte(CrcSz)
+	crc := Hex32(crc32.ChecksumIEEE(buf.Bytes()))
+	p.Tlv[CrcType] = &crc
+	buf.Write(crc.Bytes())
 	return buf.Bytes()
 }
 
+// Check returns an error if the image doesn't have the ONIE signature and
+// version or if its last TLV isn't a matching CRC.
+func Check(buf []byte) error {
+	if len(buf) < HeaderSz {
+		return fmt.Errorf("truncated header")
+	}
+	if string(buf[:OnieDataSz]) != Signature {
+		return fmt.Errorf("Onie.Data: %q: invalid", buf[:OnieDataSz])
+	}
+	if buf[OnieDataSz] != Version {
+		return fmt.Errorf("Onie.Version: %#x: unsupported",
+			buf[OnieDataSz])
+	}
+	n := HeaderSz + int(binary.BigEndian.Uint16(buf[LenOffset:]))
+	if n > len(buf) {
+		return fmt.Errorf("truncated to %d of %d bytes", len(buf), n)
+	}
+	if n < HeaderSz+CrcTlvSz || buf[n-CrcTlvSz] != CrcType.Byte() ||
+		buf[n-CrcTlvSz+1] != CrcSz {
+		return fmt.Errorf("Crc: missing")
+	}
+	want := crc32.ChecksumIEEE(buf[:n-CrcSz])
+	if got := binary.BigEndian.Uint32(buf[n-CrcSz:]); got != want {
+		return fmt.Errorf("Crc: %#08x vs. computed %#08x", got, want)
+	}
+	return nil
+}
+
 func (p *Eeprom) Clone() (*Eeprom, error) {
 	clone := new(Eeprom)
 	_, err := clone.Write(p.Bytes())
@@ -47,7 +95,9 @@ func (p *Eeprom) Del(name string) {
 			return
 		}
 	}
-	delete(p.Tlv, typesByName[name])
+	if t, found := lookupType(name); found {
+		delete(p.Tlv, t)
+	}
 }
 
 func (p *Eeprom) Equal(clone *Eeprom) error {
@@ -69,9 +119,16 @@ func (p *Eeprom) Set(name, s string) (err error) {
 	case "Onie.Version":
 		err = p.Onie.Version.Scan(s)
 	default:
-		t, found := typesByName[name]
+		t, found := lookupType(name)
 		if !found {
-			err = p.Tlv[VendorExtensionType].(Setter).Set(name, s)
+			v := p.Tlv[VendorExtensionType]
+			if v == nil {
+				v = p.Tlv.Add(VendorExtensionType)
+			}
+			if method, found := v.(Setter); found {
+				return method.Set(name, s)
+			}
+			return fmt.Errorf("%s: unknown", name)
 		}
 		v := p.Tlv[t]
 		if v == nil {
@@ -123,3 +180,16 @@ func (p *Eeprom) Write(buf []byte) (n int, err error) {
 	n += i
 	return
 }
+
+// lookupType returns the type of a name or of a hex number, e.g. 0x30, as
+// shown of those without a name.
+func lookupType(name string) (Type, bool) {
+	if t, found := typesByName[name]; found {
+		return t, true
+	}
+	if strings.HasPrefix(name, "0x") {
+		u, err := strconv.ParseUint(name[2:], 16, 8)
+		return Type(u), err == nil
+	}
+	return 0, false
+}
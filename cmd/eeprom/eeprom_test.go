@@ -0,0 +1,164 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package eeprom_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/platinasystems/goes/cmd/eeprom"
+	"github.com/platinasystems/goes/cmd/eeprom/platina_eeprom"
+)
+
+func init() {
+	platina_eeprom.Config()
+}
+
+func export() *eeprom.Export {
+	return &eeprom.Export{
+		OnieData:    eeprom.Signature,
+		OnieVersion: "0x01",
+		Tlv: map[string]string{
+			"ProductName":         "MK1",
+			"SerialNumber":        "SN1234",
+			"BaseEthernetAddress": "02:46:8a:00:02:00",
+			"NEthernetAddress":    "134",
+			"ManufactureDate":     "10/19/2021 12:30:00",
+			"DeviceVersion":       "0x02",
+			"CountryCode":         "US",
+		},
+		VendorExtension: map[string]string{
+			"BoardType":               "0x05",
+			"SubType":                 "0x01",
+			"Tor1CpuPcbaSerialNumber": "cpu-1234",
+		},
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	x := export()
+	p, err := x.Import()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	buf := p.Bytes()
+	if err = eeprom.Check(buf); err != nil {
+		t.Fatal(err)
+	}
+	q := new(eeprom.Eeprom)
+	if _, err = q.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Equal(q); err != nil {
+		t.Fatal(err)
+	}
+	y, err := q.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, y) {
+		t.Errorf("exported\n%#v\nimported\n%#v", x, y)
+	}
+	buf[eeprom.HeaderSz+2] ^= 1
+	if err = eeprom.Check(buf); err == nil {
+		t.Error("corrupted image passed Check")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name, value, want string
+	}{
+		{"ManufactureDate", "2021-10-19", "MM/DD/YYYY"},
+		{"ManufactureDate", "13/19/2021 12:30:00", "MM/DD/YYYY"},
+		{"CountryCode", "usa", "alpha-2"},
+		{"BaseEthernetAddress", "01:00:5e:00:00:01", "multicast"},
+		{"BaseEthernetAddress", "00:00:00:00:00:00", "zero"},
+		{"BaseEthernetAddress", "02:46:8a:ff:ff:c0", "OUI"},
+		{"NEthernetAddress", "0", "zero"},
+		{"ProductName", strings.Repeat("x", 256), "exceeds 255"},
+		{"Tor1CpuPcbaSerialNumber", "1234", "prefix"},
+		{"BoardType", "0x105", "invalid"},
+	} {
+		x := export()
+		if _, found := x.VendorExtension[tc.name]; found {
+			x.VendorExtension[tc.name] = tc.value
+		} else {
+			x.Tlv[tc.name] = tc.value
+		}
+		p, err := x.Import()
+		if err == nil {
+			err = p.Validate()
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s=%q: %v, expected %q",
+				tc.name, tc.value, err, tc.want)
+		}
+	}
+}
+
+func TestDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eeprom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var (
+		image = filepath.Join(dir, "image")
+		in    = filepath.Join(dir, "in.json")
+		out   = filepath.Join(dir, "out.json")
+	)
+	b, err := json.Marshal(export())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(in, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := eeprom.Command{}
+	if err = c.Main("-device", image, "import", in); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(image + ".bak"); !os.IsNotExist(err) {
+		t.Error("backup of new image:", err)
+	}
+	err = c.Main("-device", image, "SerialNumber=SN5678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := ioutil.ReadFile(image + ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(backup, []byte("SN1234")) {
+		t.Error("backup isn't of the imported image")
+	}
+	if err = c.Main("-device", image, "export", out); err != nil {
+		t.Fatal(err)
+	}
+	var x eeprom.Export
+	if b, err = ioutil.ReadFile(out); err == nil {
+		err = json.Unmarshal(b, &x)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := x.Tlv["SerialNumber"]; s != "SN5678" {
+		t.Errorf("exported SerialNumber %q", s)
+	}
+	err = c.Main("-device", image, "CountryCode=usa")
+	if err == nil {
+		t.Error("invalid CountryCode was written")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package eeprom
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// Export is the JSON form of an eeprom with fields as shown and accepted by
+// Set, e.g. "DeviceVersion": "0x01". The Crc is recomputed on Import.
+type Export struct {
+	OnieData        string `json:"Onie.Data"`
+	OnieVersion     string `json:"Onie.Version"`
+	Tlv             map[string]string
+	VendorExtension map[string]string `json:",omitempty"`
+}
+
+func (p *Eeprom) Export() (*Export, error) {
+	x := &Export{
+		OnieData:    string(p.Onie.Data[:]),
+		OnieVersion: p.Onie.Version.String(),
+		Tlv:         make(map[string]string),
+	}
+	for t, v := range p.Tlv {
+		switch {
+		case t == CrcType:
+		case t == VendorExtensionType:
+			if method, found := v.(Fielder); found {
+				x.VendorExtension = method.Fields()
+			} else {
+				x.Tlv[t.String()] =
+					hex.EncodeToString(v.(Byteser).Bytes())
+			}
+		default:
+			s := fmt.Sprint(v)
+			if !utf8.ValidString(s) {
+				return nil, fmt.Errorf("%s: %q: not text", t, s)
+			}
+			x.Tlv[t.String()] = s
+		}
+	}
+	return x, nil
+}
+
+// Import returns an eeprom with the exported fields; it's left to the
+// caller to Validate.
+func (x *Export) Import() (*Eeprom, error) {
+	p := &Eeprom{Tlv: make(TlvMap)}
+	p.Onie.Data = new(OnieData)
+	p.Onie.Version = new(Hex8)
+	if err := p.Set("Onie.Data", x.OnieData); err != nil {
+		return nil, fmt.Errorf("Onie.Data: %v", err)
+	}
+	if err := p.Set("Onie.Version", x.OnieVersion); err != nil {
+		return nil, fmt.Errorf("Onie.Version: %v", err)
+	}
+	for name, s := range x.Tlv {
+		var err error
+		if name == VendorExtensionType.String() {
+			err = p.writeVendorExtension(s)
+		} else {
+			err = p.Set(name, s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if len(x.VendorExtension) == 0 {
+		return p, nil
+	}
+	v := p.Tlv[VendorExtensionType]
+	if v == nil {
+		v = p.Tlv.Add(VendorExtensionType)
+	}
+	method, found := v.(Setter)
+	if !found {
+		return nil, fmt.Errorf("%s: has no fields",
+			VendorExtensionType)
+	}
+	for name, s := range x.VendorExtension {
+		if err := method.Set(name, s); err != nil {
+			return nil, fmt.Errorf("%s.%s: %v",
+				VendorExtensionType, name, err)
+		}
+	}
+	return p, nil
+}
+
+// writeVendorExtension of exported hex bytes
+func (p *Eeprom) writeVendorExtension(s string) error {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("%q: invalid hex", s)
+	}
+	v := p.Tlv.Add(VendorExtensionType)
+	if method, found := v.(io.Writer); found {
+		_, err = method.Write(b)
+	} else {
+		err = fmt.Errorf("%T: missing Writer", v)
+	}
+	return err
+}
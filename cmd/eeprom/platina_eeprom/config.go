@@ -58,4 +58,5 @@ func Config(args ...interface{}) {
 	}
 	eeprom.Vendor.ReadBytes = ReadBytes
 	eeprom.Vendor.Write = Write
+	eeprom.Vendor.Validate = Validate
 }
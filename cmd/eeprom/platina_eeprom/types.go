@@ -69,7 +69,7 @@ func (t Type) String() string {
 		VendorExtensionType: "VendorExtension",
 	}[t]
 	if len(s) == 0 {
-		s = fmt.Sprintf("%#x", t)
+		s = fmt.Sprintf("%#x", uint8(t))
 	}
 	return s
 }
@@ -0,0 +1,53 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package platina_eeprom
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/platinasystems/goes/cmd/eeprom"
+)
+
+// Validate the configured minimum of MAC addresses and the sub-fields of
+// the vendor extension; the Tor1 PCBA serial numbers must have the prefix
+// that distinguishes them when read.
+func Validate(p *eeprom.Eeprom) error {
+	if config.minMacs > 0 {
+		t := eeprom.NEthernetAddressType
+		v, found := p.Tlv[t].(*eeprom.Dec16)
+		if !found {
+			return fmt.Errorf("%s: missing", t)
+		}
+		if n := int(*v); n < config.minMacs {
+			return fmt.Errorf("%s: %d < %d", t, n, config.minMacs)
+		}
+	}
+	m, found := p.Tlv[eeprom.VendorExtensionType].(XtlvMap)
+	if !found {
+		return nil
+	}
+	for t, b := range m {
+		switch t {
+		case BoardTypeType, ChassisTypeType, SubTypeType:
+			if b.Len() != 1 {
+				return fmt.Errorf("%s: expected one byte", t)
+			}
+		case Tor1CpuPcbaSerialNumberType,
+			Tor1FanPcbaSerialNumberType,
+			Tor1MainPcbaSerialNumberType:
+			prefix := map[Type]string{
+				Tor1CpuPcbaSerialNumberType:  "cpu",
+				Tor1FanPcbaSerialNumberType:  "fan",
+				Tor1MainPcbaSerialNumberType: "main",
+			}[t]
+			if !strings.HasPrefix(b.String(), prefix) {
+				return fmt.Errorf("%s: %q: expected %q prefix",
+					t, b, prefix)
+			}
+		}
+	}
+	return nil
+}
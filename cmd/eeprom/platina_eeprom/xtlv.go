@@ -6,7 +6,9 @@ package platina_eeprom
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
+	"strconv"
 )
 
 type XtlvMap map[Type]*bytes.Buffer
@@ -21,6 +23,7 @@ func (m XtlvMap) Bytes() []byte {
 		BoardTypeType,
 		ChassisTypeType,
 		SubTypeType,
+		PcbaNumberType,
 	} {
 		if b, found := m[t]; found {
 			buf.WriteByte(t.Byte())
@@ -29,6 +32,7 @@ func (m XtlvMap) Bytes() []byte {
 		}
 	}
 	for _, t := range []Type{
+		PcbaSerialNumberType,
 		Tor1CpuPcbaSerialNumberType,
 		Tor1FanPcbaSerialNumberType,
 		Tor1MainPcbaSerialNumberType,
@@ -49,13 +53,45 @@ func (m XtlvMap) Del(name string) {
 	}
 }
 
+// Fields returns those accepted by Set: the hex of a raw extension or the
+// byte sub-fields, and the others as strings.
+func (m XtlvMap) Fields() map[string]string {
+	fields := make(map[string]string)
+	for t, b := range m {
+		switch t {
+		case VendorExtensionType:
+			fields[t.String()] = hex.EncodeToString(b.Bytes())
+		case BoardTypeType, ChassisTypeType, SubTypeType:
+			fields[t.String()] = fmt.Sprintf("%#x", b.Bytes())
+		default:
+			fields[t.String()] = b.String()
+		}
+	}
+	return fields
+}
+
 func (m XtlvMap) Set(name, s string) error {
 	t, found := typesByName[name]
 	if !found {
 		return fmt.Errorf("%s: unknown", name)
 	}
 	b := new(bytes.Buffer)
-	b.WriteString(s)
+	switch t {
+	case VendorExtensionType:
+		x, err := hex.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("%s: %s: invalid hex", name, s)
+		}
+		b.Write(x)
+	case BoardTypeType, ChassisTypeType, SubTypeType:
+		u, err := strconv.ParseUint(s, 0, 8)
+		if err != nil {
+			return fmt.Errorf("%s: %s: invalid", name, s)
+		}
+		b.WriteByte(byte(u))
+	default:
+		b.WriteString(s)
+	}
 	m[t] = b
 	return nil
 }
@@ -123,7 +159,7 @@ func (m XtlvMap) Write(buf []byte) (n int, err error) {
 		t := Type(buf[0])
 		switch t {
 		case BoardTypeType, ChassisTypeType, SubTypeType,
-			PcbaSerialNumberType:
+			PcbaNumberType, PcbaSerialNumberType:
 		default:
 			v := new(bytes.Buffer)
 			v.Write(buf)
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 )
 
 type TlvMap map[Typer]interface{}
@@ -21,7 +22,11 @@ func (m TlvMap) Add(t Type) (v interface{}) {
 	case NEthernetAddressType:
 		v = new(Dec16)
 	case VendorExtensionType:
-		v = Vendor.New()
+		if Vendor.New != nil {
+			v = Vendor.New()
+		} else {
+			v = new(bytes.Buffer)
+		}
 	case CrcType:
 		v = new(Hex32)
 	default:
@@ -31,10 +36,14 @@ func (m TlvMap) Add(t Type) (v interface{}) {
 	return
 }
 
+// Bytes returns the TLVs in type order, less the Crc, which must be last.
 func (m TlvMap) Bytes() []byte {
 	buf := new(bytes.Buffer)
-	for t, v := range m {
-		b := v.(Byteser).Bytes()
+	for _, t := range m.Sorted() {
+		if t == CrcType {
+			continue
+		}
+		b := m[t].(Byteser).Bytes()
 		buf.WriteByte(t.Byte())
 		buf.WriteByte(byte(len(b)))
 		buf.Write(b)
@@ -42,6 +51,18 @@ func (m TlvMap) Bytes() []byte {
 	return buf.Bytes()
 }
 
+// Sorted returns the types of the map in order.
+func (m TlvMap) Sorted() []Typer {
+	types := make([]Typer, 0, len(m))
+	for t := range m {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Byte() < types[j].Byte()
+	})
+	return types
+}
+
 func (m TlvMap) Equal(nm TlvMap) error {
 	for t, v := range m {
 		nv, found := nm[t]
@@ -8,6 +8,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -106,6 +108,12 @@ type VendorExtension interface {
 	fmt.Stringer
 }
 
+// A VendorExtension with Fields is exported by name as accepted by its Set;
+// otherwise, it's exported as hex bytes.
+type Fielder interface {
+	Fields() map[string]string
+}
+
 type Type uint8
 
 func (t Type) Byte() byte {
@@ -133,7 +141,7 @@ func (t Type) String() string {
 		CrcType:                 "Crc",
 	}[t]
 	if len(s) == 0 {
-		s = fmt.Sprintf("%#x", t)
+		s = fmt.Sprintf("%#x", uint8(t))
 	}
 	return s
 }
@@ -167,9 +175,14 @@ func (p EthernetAddress) Bytes() []byte {
 }
 
 func (p EthernetAddress) Scan(s string) error {
-	//input := new(parse.Input)
-	//input.SetString(s)
-	//(*ethernet.Address)(p).Parse(input)
+	ea, err := net.ParseMAC(s)
+	if err != nil {
+		return err
+	}
+	if len(ea) != len(p) {
+		return fmt.Errorf("%s: not a %d byte address", s, len(p))
+	}
+	copy(p, ea)
 	return nil
 }
 
@@ -189,7 +202,10 @@ func (p *Hex8) Bytes() []byte {
 }
 
 func (p *Hex8) Scan(s string) error {
-	_, err := fmt.Sscanf(s, "%x", p)
+	u, err := scanHex(s, 8)
+	if err == nil {
+		*p = Hex8(u)
+	}
 	return err
 }
 
@@ -211,7 +227,10 @@ func (p *Hex32) Bytes() []byte {
 }
 
 func (p *Hex32) Scan(s string) error {
-	_, err := fmt.Sscanf(s, "%x", p)
+	u, err := scanHex(s, 32)
+	if err == nil {
+		*p = Hex32(u)
+	}
 	return err
 }
 
@@ -224,6 +243,15 @@ func (p *Hex32) Write(b []byte) (int, error) {
 	return 4, nil
 }
 
+// scanHex parses hex with an optional 0x prefix, as shown by String.
+func scanHex(s string, bits int) (uint64, error) {
+	u, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, bits)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid", s)
+	}
+	return u, nil
+}
+
 type OnieData [OnieDataSz]byte
 
 func (p *OnieData) Bytes() []byte {
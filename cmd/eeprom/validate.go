@@ -0,0 +1,95 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package eeprom
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// DateFormat of ManufactureDate, i.e. MM/DD/YYYY hh:mm:ss
+const DateFormat = "01/02/2006 15:04:05"
+
+// Validate returns the first of these errors, then any of Vendor.Validate.
+//
+//	an ONIE signature or version other than TlvInfo 1
+//	a TLV longer than 255 or an image longer than MaxSz bytes
+//	a ManufactureDate not of DateFormat
+//	a CountryCode not of two upper case letters
+//	a zero or multicast BaseEthernetAddress
+//	a NEthernetAddress of zero or beyond the OUI of the base address
+func (p *Eeprom) Validate() error {
+	if string(p.Onie.Data[:]) != Signature {
+		return fmt.Errorf("Onie.Data: %q: invalid", p.Onie.Data[:])
+	}
+	if *p.Onie.Version != Version {
+		return fmt.Errorf("Onie.Version: %s: unsupported", p.Onie.Version)
+	}
+	for _, t := range p.Tlv.Sorted() {
+		v, found := p.Tlv[t].(Byteser)
+		if !found {
+			return fmt.Errorf("%s has no Bytes()", t)
+		}
+		b := v.Bytes()
+		if len(b) > 255 {
+			return fmt.Errorf("%s: %d bytes exceeds 255", t, len(b))
+		}
+		switch t {
+		case ManufactureDateType:
+			_, err := time.Parse(DateFormat, string(b))
+			if err != nil || len(b) != len(DateFormat) {
+				return fmt.Errorf("%s: %q: expected MM/DD/YYYY hh:mm:ss",
+					t, b)
+			}
+		case CountryCodeType:
+			if len(b) != 2 || !isUpper(b[0]) || !isUpper(b[1]) {
+				return fmt.Errorf("%s: %q: expected ISO 3166-1 alpha-2",
+					t, b)
+			}
+		}
+	}
+	if n := len(p.Bytes()); n > MaxSz {
+		return fmt.Errorf("%d bytes exceeds %d", n, MaxSz)
+	}
+	if err := p.validateMacs(); err != nil {
+		return err
+	}
+	if Vendor.Validate != nil {
+		return Vendor.Validate(p)
+	}
+	return nil
+}
+
+func (p *Eeprom) validateMacs() error {
+	v, found := p.Tlv[BaseEthernetAddressType]
+	if !found {
+		return nil
+	}
+	t := BaseEthernetAddressType
+	ea, found := v.(EthernetAddress)
+	if !found || len(ea) != 6 {
+		return fmt.Errorf("%s: invalid", t)
+	}
+	if bytes.Equal(ea, make([]byte, 6)) {
+		return fmt.Errorf("%s: zero", t)
+	}
+	if ea[0]&1 != 0 {
+		return fmt.Errorf("%s: %s: multicast", t, ea)
+	}
+	n := 1
+	if v, found := p.Tlv[NEthernetAddressType].(*Dec16); found {
+		if n = int(*v); n == 0 {
+			return fmt.Errorf("%s: zero", NEthernetAddressType)
+		}
+	}
+	nic := int(ea[3])<<16 | int(ea[4])<<8 | int(ea[5])
+	if nic+n > 1<<24 {
+		return fmt.Errorf("%s: %s + %d exceeds its OUI", t, ea, n)
+	}
+	return nil
+}
+
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
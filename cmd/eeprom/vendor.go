@@ -4,9 +4,11 @@
 
 package eeprom
 
-// Each machine main must assign the following Vendor parameters
+// Each machine main must assign the following Vendor parameters, except
+// the optional Validate that's called by Eeprom.Validate.
 var Vendor struct {
 	New       func() VendorExtension
 	ReadBytes func() ([]byte, error)
 	Write     func([]byte) (int, error)
+	Validate  func(*Eeprom) error
 }
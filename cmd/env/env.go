@@ -49,11 +49,12 @@ func (*Command) Kind() cmd.Kind { return cmd.DontFork | cmd.CantPipe }
 func (c *Command) Main(args ...string) error {
 	switch len(args) {
 	case 0:
+		w := c.g.Stdout()
 		for _, env := range os.Environ() {
-			fmt.Println(env)
+			fmt.Fprintln(w, env)
 		}
 	case 1:
-		fmt.Println(os.Getenv(args[0]))
+		fmt.Fprintln(c.g.Stdout(), os.Getenv(args[0]))
 	default:
 		for {
 			eq := strings.Index(args[0], "=")
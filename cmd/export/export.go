@@ -9,11 +9,14 @@ import (
 	"os"
 	"strings"
 
+	"github.com/platinasystems/goes"
 	"github.com/platinasystems/goes/cmd"
 	"github.com/platinasystems/goes/lang"
 )
 
-type Command struct{}
+type Command struct {
+	g *goes.Goes
+}
 
 func (Command) String() string { return "export" }
 
@@ -38,12 +41,15 @@ DESCRIPTION
 	}
 }
 
+func (c *Command) Goes(g *goes.Goes) { c.g = g }
+
 func (Command) Kind() cmd.Kind { return cmd.DontFork | cmd.CantPipe }
 
-func (Command) Main(args ...string) error {
+func (c Command) Main(args ...string) error {
 	if len(args) == 0 {
+		w := c.g.Stdout()
 		for _, nv := range os.Environ() {
-			fmt.Println(nv)
+			fmt.Fprintln(w, nv)
 		}
 		return nil
 	}
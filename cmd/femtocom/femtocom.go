@@ -7,15 +7,36 @@ package femtocom
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"syscall"
-	"unsafe"
+	"time"
 
 	"github.com/platinasystems/goes/external/flags"
 	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/internal/serial"
 	"github.com/platinasystems/goes/lang"
 )
 
+const (
+	ctrlA byte = 1
+	ctrlC byte = 'c' - 'a' + 1
+	ctrlX byte = 'x' - 'a' + 1
+	esc   byte = 0x1b
+)
+
+const help = `^A^X	exit
+^A^A	send ^A
+^A b	send break
+^A h	toggle hex dump
+^A s	send [-x] FILE with YMODEM or, with -x, XMODEM
+^A r	receive [-x FILE] with YMODEM or, with -x, XMODEM to FILE
+^A ?	this help
+`
+
 type Command struct{}
 
 func (Command) String() string { return "femtocom" }
@@ -35,118 +56,47 @@ func (Command) Man() lang.Alt {
 		lang.EnUS: `
 DESCRIPTION
 	femtocom copies console input to DEVICE and DEVICE output to the
-	console until input of "^A^X".
+	console until input of "^A^X". These are the other "^A" commands:
 
-OPTIONS
-	-baud BAUD
-		The valid baud rates are 300, 600, 1200, 2400,
-		4800, 9600, 19200, 38400, 57600, and 115200.
+	` + strings.Replace(strings.TrimSpace(help), "\n", "\n\t", -1) + `
 
-	-parity PARITY
-		The valid parity options are "odd", "even" and default, "none".
+	YMODEM files are received in the current directory; existing files
+	aren't overwritten.
 
-	-databits BITS
-		The valid bits per character are 5, 6, 7, and default, 8.
+OPTIONS
+	-hex
+		Start with a hex dump of DEVICE output.
 
-	-stopbits BITS
-		The valid stop bits per character are 2 and default, 1.
+	-log FILE
+		Append DEVICE output to FILE with each line prefixed by its
+		time of arrival.
 
-	-noinit
-		Don't initialize the device at start-up or reset on exit.
+	-script FILE
+		Rather than copy console input, run the FILE, or "-" for
+		standard input, of these lines then exit:
 
-	-noreset
-		Don't reset the device on exit.
+			timeout DURATION
+			expect REGEXP
+			send TEXT
+			sendline TEXT
+			sleep DURATION
+			break
 
-	-nolock
-		Don't attempt exclusive device use.`,
+		REGEXP and TEXT may be quoted with Go escapes, e.g. "\x03".
+		sendline appends a carriage return. The default expect
+		timeout is 10s.
+` + serial.Options,
 	}
 }
 
 func (Command) Main(args ...string) error {
-	const (
-		ctrlA rune = 1
-		ctrlX rune = 'x' - 'a' + 1
-	)
-	var err error
-	flag, args := flags.New(args, "-noinit", "-noreset", "-nolock")
-	parm, args := parms.New(args, "-baud", "-parity", "-databits",
-		"-stopbits")
-
-	if len(parm.ByName["-baud"]) == 0 {
-		parm.ByName["-baud"] = "115200"
-	}
-	baud, found := map[string]uint32{
-		"50":      syscall.B50,
-		"75":      syscall.B75,
-		"110":     syscall.B110,
-		"134":     syscall.B134,
-		"150":     syscall.B150,
-		"200":     syscall.B200,
-		"300":     syscall.B300,
-		"600":     syscall.B600,
-		"1200":    syscall.B1200,
-		"1800":    syscall.B1800,
-		"2400":    syscall.B2400,
-		"4800":    syscall.B4800,
-		"9600":    syscall.B9600,
-		"19200":   syscall.B19200,
-		"38400":   syscall.B38400,
-		"57600":   syscall.B57600,
-		"115200":  syscall.B115200,
-		"230400":  syscall.B230400,
-		"460800":  syscall.B460800,
-		"500000":  syscall.B500000,
-		"576000":  syscall.B576000,
-		"921600":  syscall.B921600,
-		"1000000": syscall.B1000000,
-		"1152000": syscall.B1152000,
-		"1500000": syscall.B1500000,
-		"2000000": syscall.B2000000,
-		"2500000": syscall.B2500000,
-		"3000000": syscall.B3000000,
-		"3500000": syscall.B3500000,
-		"4000000": syscall.B4000000,
-	}[parm.ByName["-baud"]]
-	if !found {
-		return fmt.Errorf("%s: invalid baud", parm.ByName["-baud"])
-	}
-
-	if len(parm.ByName["-parity"]) == 0 {
-		parm.ByName["-parity"] = "none"
-	}
-	parity, found := map[string]uint32{
-		"odd":  syscall.PARENB | syscall.PARODD,
-		"even": syscall.PARENB,
-		"none": 0,
-	}[parm.ByName["-parity"]]
-	if !found {
-		return fmt.Errorf("%s: invalid parity", parm.ByName["-parity"])
-	}
-
-	if len(parm.ByName["-databits"]) == 0 {
-		parm.ByName["-databits"] = "8"
-	}
-	databits, found := map[string]uint32{
-		"5": syscall.CS5,
-		"6": syscall.CS6,
-		"7": syscall.CS7,
-		"8": syscall.CS8,
-	}[parm.ByName["-databits"]]
-	if !found {
-		return fmt.Errorf("%s: invalid databits", parm.ByName["-databits"])
-	}
-
-	if len(parm.ByName["-stopbits"]) == 0 {
-		parm.ByName["-stopbits"] = "1"
-	}
-	stopbits, found := map[string]uint32{
-		"1": 0,
-		"2": syscall.CSTOPB,
-	}[parm.ByName["-stopbits"]]
-	if !found {
-		return fmt.Errorf("%s: invalid stopbits", parm.ByName["-stopbits"])
+	flag, args := flags.New(args, append(serial.Flags, "-hex")...)
+	parm, args := parms.New(args, append(serial.Parms, "-log",
+		"-script")...)
+	cfg, err := serial.ParseConfig(flag, parm)
+	if err != nil {
+		return err
 	}
-
 	if len(args) == 0 {
 		return fmt.Errorf("DEVICE: missing")
 	}
@@ -154,155 +104,330 @@ func (Command) Main(args ...string) error {
 		return fmt.Errorf("%v: unexpected", args[1:])
 	}
 
-	dev, err := os.OpenFile(args[0], os.O_RDWR, 0664)
+	dev, err := serial.Open(args[0], cfg)
 	if err != nil {
 		return err
 	}
 	defer dev.Close()
 
-	if !flag.ByName["-nolock"] {
-		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL,
-			uintptr(dev.Fd()),
-			uintptr(syscall.TIOCEXCL),
-			uintptr(0))
-		if errno != 0 {
-			return fmt.Errorf("TIOCEXCL: %v", errno)
-		}
-		defer syscall.Syscall(syscall.SYS_IOCTL,
-			uintptr(dev.Fd()),
-			uintptr(syscall.TIOCNXCL),
-			uintptr(0))
-	}
-
-	var savedStdin, savedDev syscall.Termios
-
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL,
-		uintptr(syscall.Stdin),
-		uintptr(syscall.TCGETS),
-		uintptr(unsafe.Pointer(&savedStdin)))
-	if errno != 0 {
-		return fmt.Errorf("TCGETS: stdin: %v", errno)
-	}
-	_, _, errno = syscall.Syscall(syscall.SYS_IOCTL,
-		uintptr(dev.Fd()),
-		uintptr(syscall.TCGETS),
-		uintptr(unsafe.Pointer(&savedDev)))
-	if errno != 0 {
-		return fmt.Errorf("TCGETS: %s: %v", args[0], errno)
-	}
-	defer func() {
-		syscall.Syscall(syscall.SYS_IOCTL,
-			uintptr(syscall.Stdin),
-			uintptr(syscall.TCSETS),
-			uintptr(unsafe.Pointer(&savedStdin)))
-		if !flag.ByName["-noinit"] && !flag.ByName["-noreset"] {
-			syscall.Syscall(syscall.SYS_IOCTL,
-				uintptr(dev.Fd()),
-				uintptr(syscall.TCSETS),
-				uintptr(unsafe.Pointer(&savedDev)))
-		}
-	}()
-
-	if !flag.ByName["-noinit"] {
-		t := savedDev
-		t.Iflag &^= syscall.IGNBRK |
-			syscall.BRKINT |
-			syscall.PARMRK |
-			syscall.ISTRIP |
-			syscall.INLCR |
-			syscall.IGNCR |
-			syscall.ICRNL |
-			syscall.IXON
-		t.Oflag &^= syscall.OPOST
-		t.Lflag &^= syscall.ECHO |
-			syscall.ECHONL |
-			syscall.ICANON |
-			syscall.ISIG |
-			syscall.IEXTEN
-		t.Cflag = baud | parity | databits | stopbits |
-			syscall.HUPCL |
-			syscall.CREAD |
-			syscall.CLOCAL
-		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL,
-			uintptr(dev.Fd()),
-			uintptr(syscall.TCSETS),
-			uintptr(unsafe.Pointer(&t)))
-		if errno != 0 {
-			return fmt.Errorf("TCSETS: %v", errno)
-		}
+	s := &session{
+		dev:   dev,
+		pause: make(chan chan struct{}),
+		done:  make(chan struct{}),
 	}
-	{
-		t := savedStdin
-		t.Iflag &^= syscall.IGNBRK |
-			syscall.BRKINT |
-			syscall.PARMRK |
-			syscall.ISTRIP |
-			syscall.INLCR |
-			syscall.IGNCR |
-			syscall.ICRNL |
-			syscall.IXON
-		t.Oflag &^= syscall.OPOST
-		t.Lflag &^= syscall.ECHO |
-			syscall.ECHONL |
-			syscall.ICANON |
-			syscall.ISIG |
-			syscall.IEXTEN
-		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL,
-			uintptr(syscall.Stdin),
-			uintptr(syscall.TCSETS),
-			uintptr(unsafe.Pointer(&t)))
-		if errno != 0 {
-			return fmt.Errorf("TCSETS: %v", errno)
+	if flag.ByName["-hex"] {
+		s.hex = 1
+	}
+	if fn := parm.ByName["-log"]; len(fn) > 0 {
+		f, err := os.OpenFile(fn,
+			os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
 		}
+		defer f.Close()
+		s.log = serial.NewLog(f)
+	}
+	if fn := parm.ByName["-script"]; len(fn) > 0 {
+		return s.script(fn)
 	}
+	return s.interact()
+}
 
-	fmt.Print("Type ^A^X to exit.\r\n")
+type session struct {
+	dev *serial.Port
+	log io.Writer
+	hex int32
 
-	go func() {
-		// Copy from dev to Stdout
-		rx := make([]byte, 4096)
-		for {
-			n, err := dev.Read(rx)
-			if err != nil {
-				break
-			}
-			os.Stdout.Write(rx[:n])
+	// pause receives a channel that's closed to resume rx
+	pause chan chan struct{}
+	// done is closed when rx stops
+	done chan struct{}
+}
+
+func (s *session) script(fn string) error {
+	r := os.Stdin
+	if fn != "-" {
+		f, err := os.Open(fn)
+		if err != nil {
+			return err
 		}
-		rx = rx[:0]
-	}()
+		defer f.Close()
+		r = f
+	}
+	var out io.Writer = os.Stdout
+	if s.log != nil {
+		out = io.MultiWriter(out, s.log)
+	}
+	sc := &serial.Script{Conn: s.dev, Output: out}
+	if err := sc.Run(r); err != nil {
+		return fmt.Errorf("%s: %v", fn, err)
+	}
+	return nil
+}
+
+func (s *session) interact() error {
+	var saved syscall.Termios
+	if err := serial.GetTermios(uintptr(syscall.Stdin), &saved); err != nil {
+		return fmt.Errorf("TCGETS: stdin: %v", err)
+	}
+	defer serial.SetTermios(uintptr(syscall.Stdin), &saved)
+	t := saved
+	serial.MakeRaw(&t)
+	if err := serial.SetTermios(uintptr(syscall.Stdin), &t); err != nil {
+		return fmt.Errorf("TCSETS: %v", err)
+	}
+
+	s.printf("Type ^A^X to exit or ^A? for help.\n")
+
+	go s.rx()
 	tx := make([]byte, 4096)
 	escaped := false
 	for {
 		// Copy from Stdin to DEVICE up until C-a C-x
 		n, err := os.Stdin.Read(tx)
 		if err != nil {
-			break
+			return nil
 		}
-		txs := tx
-		if !escaped {
-			if i := bytes.IndexRune(txs, ctrlA); i >= 0 {
-				escaped = true
-				if i > 0 {
-					dev.Write(txs[:i])
-					txs = txs[i+1:]
-					n -= i + 1
+		out := tx[:0]
+		for _, c := range tx[:n] {
+			if !escaped {
+				if c == ctrlA {
+					escaped = true
 				} else {
-					txs = txs[1:]
-					n -= 1
+					out = append(out, c)
 				}
+				continue
 			}
+			escaped = false
+			if len(out) > 0 {
+				s.dev.Write(out)
+				out = out[:0]
+			}
+			if c == ctrlX {
+				return nil
+			}
+			s.escape(c)
 		}
-		if n <= 0 {
+		if len(out) > 0 {
+			s.dev.Write(out)
+		}
+	}
+}
+
+// rx copies DEVICE output to Stdout and the log
+func (s *session) rx() {
+	defer close(s.done)
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.dev.Read(buf)
+		if n > 0 {
+			if atomic.LoadInt32(&s.hex) != 0 {
+				hexDump(os.Stdout, buf[:n])
+			} else {
+				os.Stdout.Write(buf[:n])
+			}
+			if s.log != nil {
+				s.log.Write(buf[:n])
+			}
+		}
+		if os.IsTimeout(err) {
+			<-<-s.pause
 			continue
 		}
-		if escaped {
-			if r := rune(txs[0]); r == ctrlX {
-				break
+		if err != nil {
+			return
+		}
+	}
+}
+
+// stop rx for a transfer then return its resume function
+func (s *session) stop() (func(), error) {
+	resume := make(chan struct{})
+	s.dev.SetReadDeadline(time.Now())
+	select {
+	case s.pause <- resume:
+	case <-s.done:
+		return nil, fmt.Errorf("%s: closed", s.dev.Name())
+	}
+	return func() {
+		s.dev.SetReadDeadline(time.Time{})
+		close(resume)
+	}, nil
+}
+
+func (s *session) escape(c byte) {
+	switch c {
+	case 'b':
+		if err := s.dev.SendBreak(); err != nil {
+			s.printf("\n[%v]\n", err)
+		}
+	case 'h':
+		if atomic.LoadInt32(&s.hex) != 0 {
+			atomic.StoreInt32(&s.hex, 0)
+			s.printf("\n[hex off]\n")
+		} else {
+			atomic.StoreInt32(&s.hex, 1)
+			s.printf("\n[hex on]\n")
+		}
+	case 's':
+		if line, ok := s.prompt("send [-x] FILE: "); ok {
+			n, err := s.send(strings.Fields(line))
+			s.result("sent", n, err)
+		}
+	case 'r':
+		if line, ok := s.prompt("receive [-x FILE]: "); ok {
+			n, err := s.receive(strings.Fields(line))
+			s.result("received", n, err)
+		}
+	case '?':
+		s.printf("\n%s", help)
+	default:
+		s.dev.Write([]byte{c})
+	}
+}
+
+func (s *session) send(args []string) (int64, error) {
+	xmodem := len(args) > 0 && args[0] == "-x"
+	if xmodem {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return 0, fmt.Errorf("usage: [-x] FILE")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	resume, err := s.stop()
+	if err != nil {
+		return 0, err
+	}
+	defer resume()
+	var n int64
+	m := &serial.Modem{Conn: s.dev, Progress: s.progress(&n)}
+	if xmodem {
+		err = m.SendXmodem(f)
+	} else {
+		err = m.SendYmodem(fi.Name(), fi.Size(), f)
+	}
+	return n, err
+}
+
+func (s *session) receive(args []string) (int64, error) {
+	create := func(name string) (*os.File, error) {
+		return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+			0644)
+	}
+	var fn string
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && args[0] == "-x":
+		fn = args[1]
+	default:
+		return 0, fmt.Errorf("usage: [-x FILE]")
+	}
+	var f *os.File
+	var err error
+	if len(fn) > 0 {
+		if f, err = create(fn); err != nil {
+			return 0, err
+		}
+		defer f.Close()
+	}
+	resume, err := s.stop()
+	if err != nil {
+		return 0, err
+	}
+	defer resume()
+	var n, total int64
+	m := &serial.Modem{Conn: s.dev, Progress: s.progress(&n)}
+	if f != nil {
+		return m.ReceiveXmodem(f)
+	}
+	err = m.ReceiveYmodem(func(name string, size int64) (io.WriteCloser,
+		error) {
+		total += n
+		n = 0
+		f, err := create(filepath.Base(name))
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	})
+	return total + n, err
+}
+
+func (s *session) progress(n *int64) func(int64) {
+	return func(i int64) {
+		*n = i
+		fmt.Print("\r", i, " bytes")
+	}
+}
+
+func (s *session) result(what string, n int64, err error) {
+	if err != nil {
+		s.printf("\n[%v]\n", err)
+	} else {
+		s.printf("\n[%s %d bytes]\n", what, n)
+	}
+}
+
+// prompt for a line of raw input; ^C or ESC cancels
+func (s *session) prompt(msg string) (string, bool) {
+	s.printf("\n%s", msg)
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(b); err != nil {
+			return "", false
+		}
+		switch c := b[0]; {
+		case c == '\r' || c == '\n':
+			s.printf("\n")
+			return string(line), true
+		case c == ctrlC || c == esc:
+			s.printf("\n")
+			return "", false
+		case c == '\b' || c == 0x7f:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				s.printf("\b \b")
 			}
-			escaped = false
+		case c >= ' ' && c <= '~':
+			line = append(line, c)
+			os.Stdout.Write(b)
 		}
-		dev.Write(txs[:n])
 	}
-	tx = tx[:0]
-	return nil
+}
+
+// printf to the raw console with newlines as CRLF
+func (s *session) printf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Print(strings.Replace(msg, "\n", "\r\n", -1))
+}
+
+// hexDump as 16 bytes per line followed by the printable characters
+func hexDump(w io.Writer, b []byte) {
+	var buf bytes.Buffer
+	for len(b) > 0 {
+		n := len(b)
+		if n > 16 {
+			n = 16
+		}
+		fmt.Fprintf(&buf, "%-48s|", fmt.Sprintf("% x", b[:n]))
+		for _, c := range b[:n] {
+			if c < ' ' || c > '~' {
+				c = '.'
+			}
+			buf.WriteByte(c)
+		}
+		buf.WriteString("|\r\n")
+		b = b[n:]
+	}
+	w.Write(buf.Bytes())
 }
@@ -0,0 +1,298 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package fit provides a command to inspect, extract from, verify and build
+// Flattened Image Tree images.
+package fit
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/internal/fit"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct{}
+
+func (Command) String() string { return "fit" }
+
+func (Command) Usage() string {
+	return `fit info [-k KEYDIR] FILE
+	fit verify [-k KEYDIR] [-c CONFIG] FILE
+	fit extract FILE IMAGE OUT
+	fit build [-k KEYDIR] DESCRIPTION OUT`
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "inspect, extract, verify and build FIT images",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Flattened Image Tree (FIT) images bundle kernels, device trees and
+	ramdisks with their hashes and signatures.
+
+	info	prints the image description, configurations and each image
+		with its hash and signature verification results. A
+		configuration isn't verified if any of its images has an
+		incorrect hash or none; nor if signed, with only crc32 or md5.
+
+	verify	checks the hashes and signatures of the given or default
+		configuration and its images.
+
+	extract	writes the named image data to OUT; "-" is stdout.
+
+	build	writes a FIT image from a description like this.
+
+		description = goes machine image
+		default = conf-1
+
+		image kernel
+			type = kernel
+			arch = arm
+			os = linux
+			compression = none
+			load = 0x80008000
+			entry = 0x80008000
+			data = zImage
+			hash = sha256 crc32
+
+		image fdt-1
+			type = flat_dt
+			arch = arm
+			data = board.dtb
+			hash = sha256
+
+		config conf-1
+			description = default
+			kernel = kernel
+			fdt = fdt-1
+			sign = dev-key sha256 pss
+
+		Relative data files are read from the directory of the
+		description. An image or config "sign" property names the key,
+		KEYDIR/NAME.key, and optionally the hash (sha256 or sha384) and
+		RSA padding (pkcs-1.5 or pss). RSA and ECDSA P-256 keys are
+		supported.
+
+OPTIONS
+	-k KEYDIR
+		for info and verify, the trusted public keys (default ` +
+			fit.KeyDir + `); for build, the private keys
+		(default ".")
+	-c CONFIG
+		verify this configuration instead of the default`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("COMMAND: missing")
+	}
+	cmd := args[0]
+	parm, args := parms.New(args[1:], "-k", "-c")
+	keydir := parm.ByName["-k"]
+	switch cmd {
+	case "info":
+		if len(args) != 1 {
+			return fmt.Errorf("FILE: missing or unexpected")
+		}
+		return info(args[0], keydir)
+	case "verify":
+		if len(args) != 1 {
+			return fmt.Errorf("FILE: missing or unexpected")
+		}
+		return verify(args[0], keydir, parm.ByName["-c"])
+	case "extract":
+		if len(args) != 3 {
+			return fmt.Errorf("FILE IMAGE OUT: missing or unexpected")
+		}
+		return extract(args[0], args[1], args[2])
+	case "build":
+		if len(args) != 2 {
+			return fmt.Errorf("DESCRIPTION OUT: missing or unexpected")
+		}
+		if len(keydir) == 0 {
+			keydir = "."
+		}
+		return build(args[0], args[1], keydir)
+	default:
+		return fmt.Errorf("%s: unknown", cmd)
+	}
+}
+
+func read(fn string) (*fit.Fit, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fit.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return f, nil
+}
+
+func keyring(dir string) (*fit.Keyring, error) {
+	if len(dir) == 0 {
+		dir = fit.KeyDir
+	}
+	return fit.LoadKeyring(dir)
+}
+
+func result(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "OK"
+}
+
+func info(fn, keydir string) error {
+	f, err := read(fn)
+	if err != nil {
+		return err
+	}
+	kr, err := keyring(keydir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Description = %s\nAddressCells = %d\nTimeStamp = %s\n",
+		f.Description, f.AddressCells, f.TimeStamp)
+	fmt.Printf("DefaultConfig = %s\n", f.DefaultConfig)
+
+	var names []string
+	for name := range f.Configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cfg := f.Configs[name]
+		fmt.Printf("Configuration %s:%s\n", name, cfg.Description)
+		for _, i := range cfg.ImageList {
+			fmt.Printf("  %s\n", i.Name)
+		}
+		n := signatures(f, cfg, "  ")
+		fmt.Printf("  Verified=%s\n", verified(n, f.VerifyConfig(cfg, kr)))
+	}
+
+	names = names[:0]
+	for name := range f.Images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i := f.Images[name]
+		fmt.Printf(`Image %s:
+    Description=%s
+    Type=%s
+    Arch=%s
+    OS=%s
+    Compression=%s
+    LoadAddr=%x
+    Size=%d
+`,
+			i.Name, i.Description, i.Type, i.Arch, i.Os,
+			i.Compression, i.LoadAddr, len(i.Data))
+		for _, h := range i.Hashes {
+			fmt.Printf("    %s: %s %s %s\n", h.Name, h.Algo,
+				hex.EncodeToString(h.Value), result(h.Err))
+		}
+		n := signatures(f, i, "    ")
+		fmt.Printf("    Verified=%s\n", verified(n, f.VerifyImage(i, kr)))
+	}
+	return nil
+}
+
+func verified(n int, err error) string {
+	if err == nil && n == 0 {
+		return "unsigned"
+	}
+	return result(err)
+}
+
+// signatures prints and returns the number of signatures of an image or
+// configuration.
+func signatures(f *fit.Fit, v interface{}, indent string) int {
+	sigs, err := f.Signatures(v)
+	for _, sig := range sigs {
+		fmt.Printf("%s%s: %s key=%s padding=%s\n", indent, sig.Name,
+			sig.Algo, sig.KeyName, sig.Padding)
+	}
+	if err != nil {
+		fmt.Printf("%s%v\n", indent, err)
+	}
+	return len(sigs)
+}
+
+func verify(fn, keydir, name string) error {
+	f, err := read(fn)
+	if err != nil {
+		return err
+	}
+	kr, err := keyring(keydir)
+	if err != nil {
+		return err
+	}
+	if len(name) == 0 {
+		name = f.DefaultConfig
+	}
+	cfg, found := f.Configs[name]
+	if !found {
+		return fmt.Errorf("%s: configuration not found", name)
+	}
+	// Verify also checks the image hashes of the configuration
+	if err = f.Verify(cfg.Name, kr); err != nil {
+		return err
+	}
+	fmt.Println(name, "OK")
+	return nil
+}
+
+func extract(fn, name, out string) error {
+	f, err := read(fn)
+	if err != nil {
+		return err
+	}
+	i, found := f.Images[name]
+	if !found {
+		return fmt.Errorf("%s: image not found", name)
+	}
+	for _, h := range i.Hashes {
+		if h.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s/%s: %v\n", name, h.Name, h.Err)
+		}
+	}
+	if out == "-" {
+		_, err = os.Stdout.Write(i.Data)
+		return err
+	}
+	return ioutil.WriteFile(out, i.Data, 0644)
+}
+
+func build(fn, out, keydir string) error {
+	r, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	d, err := fit.ReadDescription(r, filepath.Dir(fn))
+	if err != nil {
+		return fmt.Errorf("%s: %v", fn, err)
+	}
+	b, err := d.Build(keydir)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, b, 0644)
+}
@@ -37,6 +37,7 @@ DESCRIPTION
 }
 
 func (c Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error, error) {
+	loc := g.Location()
 	var doList []func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error
 	cl := ls.Cmds[0]
 
@@ -68,6 +69,9 @@ func (c Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func
 			for len(ls.Cmds) == 0 {
 				newls, err := shellutils.Parse("for>", g.Catline)
 				if err != nil {
+					if err == io.EOF {
+						err = g.MissingTerminator("for", "done", loc)
+					}
 					return nil, nil, err
 				}
 				ls = *newls
@@ -42,6 +42,7 @@ func (Command) String() string    { return Name }
 func (Command) Usage() string     { return Usage }
 
 func (Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error, error) {
+	loc := g.Location()
 	cl := ls.Cmds[0]
 	// function name { definition ... ; }
 	if len(cl.Cmds) < 2 {
@@ -55,6 +56,9 @@ func (Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func(s
 		for len(ls.Cmds) == 0 {
 			newls, err := shellutils.Parse("function>", g.Catline)
 			if err != nil {
+				if err == io.EOF {
+					err = g.MissingTerminator("function", "}", loc)
+				}
 				return nil, nil, err
 			}
 			ls = *newls
@@ -83,6 +87,9 @@ func (Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func(s
 		for len(ls.Cmds) == 0 {
 			newls, err := shellutils.Parse("function>", g.Catline)
 			if err != nil {
+				if err == io.EOF {
+					err = g.MissingTerminator("function", "}", loc)
+				}
 				return nil, nil, err
 			}
 			ls = *newls
@@ -116,6 +123,10 @@ func (Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func(s
 		g.FunctionMap[name] = f
 		return nil
 	}
+	if g.NoExec {
+		// define now so that the check finds later calls
+		deffun(nil, nil, nil)
+	}
 	return &ls, deffun, nil
 }
 
@@ -7,17 +7,32 @@ package gpio
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
 	"sort"
+	"syscall"
+	"time"
 
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/gpiochip"
+	"github.com/platinasystems/goes/external/parms"
 	"github.com/platinasystems/goes/lang"
 	"github.com/platinasystems/gpio"
 )
 
+// Consumer label of lines requested by the command
+const Consumer = "goes"
+
 type Command struct{}
 
 func (Command) String() string { return "gpio" }
 
-func (Command) Usage() string { return "gpio PIN_NAME [VALUE]" }
+func (Command) Usage() string {
+	return `gpio [PIN_NAME [VALUE] | default]
+gpio [-active-low] [-bias BIAS] [-drive DRIVE] LINE [VALUE]
+gpio monitor [-active-low] [-bias BIAS] [-debounce DURATION] LINE...
+gpio info [CHIP]...`
+}
 
 func (Command) Apropos() lang.Alt {
 	return lang.Alt{
@@ -25,7 +40,56 @@ func (Command) Apropos() lang.Alt {
 	}
 }
 
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Without args, show the value of all named pins of the device tree;
+	with "default", set their default direction. Otherwise, show or set
+	the VALUE, true|false or 1|0, of a PIN_NAME.
+
+	A LINE that isn't a named pin, or with any option, is that of a GPIO
+	character device by its kernel line name or CHIP:OFFSET, e.g.
+	gpiochip0:12 or 0:12. Reading a LINE leaves its direction as is
+	unless with -bias, which makes it an input.
+
+	monitor
+		print the edges of the lines until interrupted
+
+	info
+		list the lines of all or the given CHIPs
+
+OPTIONS
+	-active-low
+		invert the line's value
+	-bias pull-up | pull-down | bias-disabled
+	-drive push-pull | open-drain | open-source
+	-debounce DURATION
+		of monitored lines, e.g. 10ms`,
+	}
+}
+
 func (c Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-active-low")
+	parm, args := parms.New(args, "-bias", "-drive", "-debounce")
+	cfg, err := config(flag, parm)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		switch args[0] {
+		case "monitor":
+			return monitor(cfg, args[1:])
+		case "info":
+			return info(args[1:])
+		case "default":
+		default:
+			_, found := gpio.FindPin(args[0])
+			if !found || cfg.Flags != 0 {
+				return line(cfg, args)
+			}
+		}
+	}
 	switch len(args) {
 	case 0: // No args?  Report all pin values.
 		names := make([]string, 0, gpio.NumPins())
@@ -66,17 +130,177 @@ func (c Command) Main(args ...string) error {
 		if !found {
 			return fmt.Errorf("%s: not found", args[0])
 		}
-		switch args[1] {
-		case "true", "1":
-			return pin.SetValue(true)
-		case "false", "0":
-			return pin.SetValue(false)
-		default:
-			return fmt.Errorf("%s: invalid, must be true|false",
-				args[1])
+		v, err := parseValue(args[1])
+		if err != nil {
+			return err
 		}
+		return pin.SetValue(v)
 	default:
 		return fmt.Errorf("%v: unexpected", args[2:])
 	}
 	return nil
 }
+
+func parseValue(s string) (bool, error) {
+	switch s {
+	case "true", "1":
+		return true, nil
+	case "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s: invalid, must be true|false", s)
+}
+
+func config(flag *flags.Flags, parm *parms.Parms) (gpiochip.Config, error) {
+	var cfg gpiochip.Config
+	if flag.ByName["-active-low"] {
+		cfg.Flags |= gpiochip.ActiveLow
+	}
+	for _, x := range []struct {
+		name    string
+		allowed gpiochip.Flag
+	}{
+		{"-bias", gpiochip.Bias},
+		{"-drive", gpiochip.Drive},
+	} {
+		s := parm.ByName[x.name]
+		if len(s) == 0 {
+			continue
+		}
+		f, found := gpiochip.FlagsByName[s]
+		if !found || f&^x.allowed != 0 {
+			return cfg, fmt.Errorf("%s %s: invalid", x.name, s)
+		}
+		cfg.Flags |= f
+	}
+	if s := parm.ByName["-debounce"]; len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("-debounce %s: invalid", s)
+		}
+		cfg.Debounce = d
+	}
+	return cfg, nil
+}
+
+// line shows or sets the value of a character device line; most drivers
+// retain an output's value after it's released. A line is read without
+// a direction, so as is, lest an input request glitch a driven output.
+func line(cfg gpiochip.Config, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("%v: unexpected", args[2:])
+	}
+	l, err := gpiochip.Find(args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 {
+		v, err := parseValue(args[1])
+		if err != nil {
+			return err
+		}
+		cfg.Flags |= gpiochip.Output
+		if v {
+			cfg.Values = 1
+		}
+	} else if cfg.Flags&gpiochip.Drive != 0 {
+		return fmt.Errorf("-drive: requires VALUE")
+	} else if cfg.Flags&gpiochip.Bias != 0 {
+		// the kernel only biases a line of explicit direction
+		cfg.Flags |= gpiochip.Input
+	}
+	lines, err := l.Request(Consumer, cfg)
+	if err != nil {
+		return err
+	}
+	defer lines.Close()
+	if len(args) == 1 {
+		v, err := lines.Values()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %v\n", args[0], v == 1)
+	}
+	return nil
+}
+
+func monitor(cfg gpiochip.Config, names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("LINE: missing")
+	}
+	type event struct {
+		name string
+		gpiochip.Event
+	}
+	events := make(chan event)
+	errs := make(chan error, len(names))
+	done := make(chan struct{})
+	defer close(done)
+	cfg.Flags |= gpiochip.Input | gpiochip.Edges
+	for _, name := range names {
+		l, err := gpiochip.Find(name)
+		if err != nil {
+			return err
+		}
+		lines, err := l.Request(Consumer, cfg)
+		if err != nil {
+			return err
+		}
+		defer lines.Close()
+		go func(name string) {
+			for {
+				e, err := lines.ReadEvent()
+				if err != nil {
+					errs <- err
+					return
+				}
+				select {
+				case events <- event{name, e}:
+				case <-done:
+					return
+				}
+			}
+		}(name)
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case e := <-events:
+			fmt.Printf("%d.%09d %s %s\n", e.Time/time.Second,
+				e.Time%time.Second, e.name, e.ID)
+		case err := <-errs:
+			return err
+		case <-sig:
+			return nil
+		}
+	}
+}
+
+func info(names []string) error {
+	if len(names) == 0 {
+		var err error
+		if names, err = gpiochip.Chips(); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		c, err := gpiochip.Open(name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s [%s] %d lines\n", c.Name, c.Label, c.Lines)
+		for offset := 0; offset < c.Lines; offset++ {
+			li, err := c.LineInfo(offset)
+			if err != nil {
+				c.Close()
+				return err
+			}
+			fmt.Printf("\t%d\t%q\t%q\t%s\n", li.Offset, li.Name,
+				li.Consumer, li.Flags)
+		}
+		c.Close()
+	}
+	return nil
+}
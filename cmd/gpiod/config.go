@@ -0,0 +1,97 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package gpiod
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/goes/external/gpiochip"
+)
+
+// Watch is a named line to monitor, e.g. psu0.present of PSU0_PRSNT_L
+// with the active-low flag.
+type Watch struct {
+	Name     string
+	Line     string // kernel line name or CHIP:OFFSET
+	Flags    gpiochip.Flag
+	Debounce time.Duration
+}
+
+// LoadConfig returns no watches if the file doesn't exist.
+func LoadConfig(fn string) ([]Watch, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	watches, err := ReadConfig(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fn, err)
+	}
+	return watches, err
+}
+
+// ReadConfig parses lines of this form where FLAG is active-low, pull-up,
+// pull-down or bias-disabled.
+//
+//	NAME LINE [FLAG]... [debounce DURATION]
+func ReadConfig(r io.Reader) ([]Watch, error) {
+	var watches []Watch
+	names := make(map[string]bool)
+	scan := bufio.NewScanner(r)
+	for line := 1; scan.Scan(); line++ {
+		s := scan.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected NAME LINE [FLAG]... [debounce DURATION]",
+				line)
+		}
+		w := Watch{Name: fields[0], Line: fields[1]}
+		if names[w.Name] {
+			return nil, fmt.Errorf("line %d: %s: duplicate",
+				line, w.Name)
+		}
+		if strings.ContainsRune(w.Line, ':') {
+			if _, err := gpiochip.ParseLine(w.Line); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+		for i := 2; i < len(fields); i++ {
+			if fields[i] == "debounce" && i+1 < len(fields) {
+				d, err := time.ParseDuration(fields[i+1])
+				if err != nil || d < 0 {
+					return nil, fmt.Errorf("line %d: %s: invalid",
+						line, fields[i+1])
+				}
+				w.Debounce = d
+				i++
+				continue
+			}
+			f, found := gpiochip.FlagsByName[fields[i]]
+			if !found || f&^(gpiochip.ActiveLow|gpiochip.Bias) != 0 {
+				return nil, fmt.Errorf("line %d: %s: invalid",
+					line, fields[i])
+			}
+			w.Flags |= f
+		}
+		names[w.Name] = true
+		watches = append(watches, w)
+	}
+	return watches, scan.Err()
+}
@@ -0,0 +1,51 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package gpiod
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/goes/external/gpiochip"
+)
+
+func TestReadConfig(t *testing.T) {
+	watches, err := ReadConfig(strings.NewReader(`
+# PSU and fan lines
+psu0.present	PSU0_PRSNT_L active-low pull-up
+fan.fault	gpiochip1:7 debounce 10ms	# open drain
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Watch{
+		{
+			Name:  "psu0.present",
+			Line:  "PSU0_PRSNT_L",
+			Flags: gpiochip.ActiveLow | gpiochip.PullUp,
+		},
+		{
+			Name:     "fan.fault",
+			Line:     "gpiochip1:7",
+			Debounce: 10 * time.Millisecond,
+		},
+	}
+	if !reflect.DeepEqual(watches, want) {
+		t.Errorf("%+v", watches)
+	}
+	for _, s := range []string{
+		"psu0.present",
+		"psu0.present X\npsu0.present Y",
+		"psu0.present X output",
+		"psu0.present X debounce soon",
+		"psu0.present gpiochip:x",
+	} {
+		if _, err := ReadConfig(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: not an error", s)
+		}
+	}
+}
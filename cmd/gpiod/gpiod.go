@@ -0,0 +1,157 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package gpiod watches the edges of GPIO character device lines, e.g.
+// PSU present and fan fault, and publishes their values to redis.
+package gpiod
+
+import (
+	"fmt"
+
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/gpiochip"
+	"github.com/platinasystems/goes/external/log"
+	"github.com/platinasystems/goes/external/redis/publisher"
+	"github.com/platinasystems/goes/lang"
+)
+
+const ConfigFile = "/etc/goes/gpiod"
+
+type Command struct {
+	// Config, if set, are the machine's lines to watch; otherwise,
+	// those of the CONFIG file.
+	Config []Watch
+
+	pub *publisher.Publisher
+}
+
+func (*Command) String() string { return "gpiod" }
+
+func (*Command) Usage() string { return "gpiod [-n] [CONFIG]" }
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "gpio edge daemon, publishes to redis",
+	}
+}
+
+func (*Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Watch the edges of the GPIO character device lines described by the
+	machine or the CONFIG file, default: ` + ConfigFile + `, with
+	lines of:
+
+	NAME LINE [FLAG]... [debounce DURATION]
+
+	LINE is the kernel's name of the line or CHIP:OFFSET, e.g.
+	gpiochip0:12. FLAG is one of active-low, pull-up, pull-down or
+	bias-disabled.
+
+	The value of each line is published at start and on each edge as:
+		NAME: true | false
+
+OPTIONS
+	-n	print the values and exit rather than publish`,
+	}
+}
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+type event struct {
+	name string
+	gpiochip.Event
+}
+
+func (c *Command) Main(args ...string) error {
+	once := len(args) > 0 && args[0] == "-n"
+	if once {
+		args = args[1:]
+	}
+	watches := c.Config
+	if watches == nil || len(args) > 0 {
+		fn := ConfigFile
+		if len(args) > 0 {
+			fn = args[0]
+		}
+		var err error
+		if watches, err = LoadConfig(fn); err != nil {
+			return err
+		}
+	}
+	publish := func(s string) { fmt.Println(s) }
+	if !once {
+		var err error
+		if c.pub, err = publisher.New(); err != nil {
+			return err
+		}
+		defer c.pub.Close()
+		publish = func(s string) { c.pub.Print(s) }
+	}
+	events := make(chan event)
+	done := make(chan struct{})
+	defer close(done)
+	for _, w := range watches {
+		lines, err := request(w)
+		if err != nil {
+			log.Print("err", w.Name, ": ", err)
+			continue
+		}
+		defer lines.Close()
+		v, err := lines.Values()
+		if err != nil {
+			log.Print("err", w.Name, ": ", err)
+			continue
+		}
+		publish(fmt.Sprint(w.Name, ": ", v == 1))
+		if once {
+			continue
+		}
+		go watch(w.Name, lines, events, done)
+	}
+	if once {
+		return nil
+	}
+	for {
+		select {
+		case <-goes.Stop:
+			return nil
+		case e := <-events:
+			publish(fmt.Sprint(e.name, ": ", e.ID == gpiochip.RisingEdge))
+		}
+	}
+}
+
+func request(w Watch) (*gpiochip.Lines, error) {
+	l, err := gpiochip.Find(w.Line)
+	if err != nil {
+		return nil, err
+	}
+	return l.Request("gpiod", gpiochip.Config{
+		Flags:    w.Flags | gpiochip.Input | gpiochip.Edges,
+		Debounce: w.Debounce,
+	})
+}
+
+func watch(name string, lines *gpiochip.Lines, events chan<- event,
+	done <-chan struct{}) {
+	for {
+		e, err := lines.ReadEvent()
+		if err != nil {
+			select {
+			case <-done:
+			default:
+				log.Print("err", name, ": ", err)
+			}
+			return
+		}
+		select {
+		case events <- event{name, e}:
+		case <-done:
+			return
+		}
+	}
+}
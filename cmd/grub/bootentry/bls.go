@@ -0,0 +1,203 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package bootentry
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Architectures maps GOARCH to the BLS architecture key.
+var Architectures = map[string]string{
+	"386":     "ia32",
+	"amd64":   "x64",
+	"arm":     "arm",
+	"arm64":   "aa64",
+	"riscv64": "riscv64",
+}
+
+// ParseBLS returns the Boot Loader Specification type #1 entry of id, the
+// file name less ".conf".
+func ParseBLS(id string, r io.Reader) (*Entry, error) {
+	e := &Entry{ID: id}
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		key, value := keyValue(scan.Text())
+		switch key {
+		case "title":
+			e.Title = value
+		case "version":
+			e.Version = value
+		case "machine-id":
+			e.MachineID = value
+		case "sort-key":
+			e.SortKey = value
+		case "linux":
+			e.Linux = rel("", value)
+		case "initrd":
+			for _, fn := range strings.Fields(value) {
+				e.Initrd = append(e.Initrd, rel("", fn))
+			}
+		case "options":
+			e.Options = append(e.Options, strings.Fields(value)...)
+		case "devicetree":
+			e.Devicetree = rel("", value)
+		case "efi":
+			e.Efi = rel("", value)
+		case "architecture":
+			arch := Architectures[runtime.GOARCH]
+			if len(arch) > 0 && !strings.EqualFold(value, arch) {
+				return nil, nil
+			}
+		}
+	}
+	return e, scan.Err()
+}
+
+// ReadBLS returns the sorted entries of the root relative directory, e.g.
+// "loader/entries", with the default and timeout of the adjacent
+// loader.conf. Entries for other architectures are skipped.
+func ReadBLS(root, dir string) (*Config, error) {
+	conf := &Config{Format: BLS}
+	fis, err := ioutil.ReadDir(filepath.Join(root, dir))
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range fis {
+		fn := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(fn, ".conf") {
+			continue
+		}
+		f, err := os.Open(filepath.Join(root, dir, fn))
+		if err != nil {
+			return nil, err
+		}
+		e, err := ParseBLS(strings.TrimSuffix(fn, ".conf"), f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if e != nil && (len(e.Linux) > 0 || len(e.Efi) > 0) {
+			conf.Entries = append(conf.Entries, e)
+		}
+	}
+	SortBLS(conf.Entries)
+
+	f, err := os.Open(filepath.Join(root, filepath.Dir(dir), "loader.conf"))
+	if err != nil {
+		return conf, nil
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		key, value := keyValue(scan.Text())
+		switch key {
+		case "default":
+			for i, e := range conf.Entries {
+				m, _ := filepath.Match(value, e.ID)
+				mconf, _ := filepath.Match(value, e.ID+".conf")
+				if m || mconf {
+					conf.Default = i
+					break
+				}
+			}
+		case "timeout":
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				conf.Timeout = time.Duration(n) * time.Second
+			}
+		}
+	}
+	return conf, scan.Err()
+}
+
+// SortBLS orders entries as specified: those with a sort-key first by
+// sort-key, machine-id, then descending version; followed by the rest in
+// descending order of their IDs.
+func SortBLS(entries []*Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if (len(a.SortKey) > 0) != (len(b.SortKey) > 0) {
+			return len(a.SortKey) > 0
+		}
+		if len(a.SortKey) > 0 {
+			if a.SortKey != b.SortKey {
+				return a.SortKey < b.SortKey
+			}
+			if a.MachineID != b.MachineID {
+				return a.MachineID < b.MachineID
+			}
+			if c := VersionCompare(a.Version, b.Version); c != 0 {
+				return c > 0
+			}
+		}
+		return VersionCompare(a.ID, b.ID) > 0
+	})
+}
+
+// VersionCompare returns -1, 0 or 1 if a is older, the same or newer than
+// b by comparing runs of digits numerically and the rest lexically.
+func VersionCompare(a, b string) int {
+	for len(a) > 0 && len(b) > 0 {
+		ra, rb := versionRun(a), versionRun(b)
+		a, b = a[len(ra):], b[len(rb):]
+		na, erra := strconv.ParseUint(ra, 10, 64)
+		nb, errb := strconv.ParseUint(rb, 10, 64)
+		switch {
+		case erra == nil && errb == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		case erra == nil:
+			return 1
+		case errb == nil:
+			return -1
+		case ra != rb:
+			if ra < rb {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) > 0:
+		return 1
+	case len(b) > 0:
+		return -1
+	}
+	return 0
+}
+
+func versionRun(s string) string {
+	digit := func(c byte) bool { return c >= '0' && c <= '9' }
+	i := 1
+	for i < len(s) && digit(s[i]) == digit(s[0]) {
+		i++
+	}
+	return s[:i]
+}
+
+// keyValue splits a line of "KEY VALUE" ignoring comments.
+func keyValue(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 || line[0] == '#' {
+		return "", ""
+	}
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return line, ""
+	}
+	return line[:i], strings.TrimSpace(line[i:])
+}
@@ -0,0 +1,245 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package bootentry parses the boot menus of other loaders: Boot Loader
+// Specification entries, extlinux/syslinux configurations and Unified
+// Kernel Images. Each is returned as a Config of Entry that may be
+// presented as grub menu entries.
+package bootentry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/goes/cmd/grub/menu"
+)
+
+// Formats recognized by Detect and Load.
+const (
+	BLS      = "bls"
+	Extlinux = "extlinux"
+	UKI      = "uki"
+)
+
+var ErrNoEntries = errors.New("no boot entries")
+var ErrNoKernel = errors.New("no kernel")
+
+// Entry is a kernel, its initial ramdisks and command line. Linux, Initrd
+// and Devicetree are relative to the root of the filesystem containing the
+// configuration. Efi, if set, is a Unified Kernel Image that supplies the
+// kernel, initrd and default options.
+type Entry struct {
+	ID         string // file name or label
+	Title      string
+	Version    string
+	MachineID  string
+	SortKey    string
+	Linux      string
+	Initrd     []string
+	Options    []string
+	Devicetree string
+	Efi        string
+}
+
+// Config is the menu of a loader configuration.
+type Config struct {
+	Format  string
+	Default int
+	Timeout time.Duration // zero to wait indefinitely
+	Entries []*Entry
+}
+
+// Name returns the menu text of the entry.
+func (e *Entry) Name() string {
+	switch {
+	case len(e.Title) > 0 && len(e.Version) > 0 &&
+		!strings.Contains(e.Title, e.Version):
+		return e.Title + " (" + e.Version + ")"
+	case len(e.Title) > 0:
+		return e.Title
+	case len(e.Version) > 0:
+		return e.Version
+	}
+	return e.ID
+}
+
+func (e *Entry) String() string {
+	s := e.Name() + ":"
+	if len(e.Efi) > 0 {
+		s += " efi " + e.Efi
+	}
+	if len(e.Linux) > 0 {
+		s += " linux " + e.Linux
+	}
+	for _, fn := range e.Initrd {
+		s += " initrd " + fn
+	}
+	if len(e.Options) > 0 {
+		s += " options " + strings.Join(e.Options, " ")
+	}
+	return s
+}
+
+// Configs are the boot configurations, relative to a scanned directory,
+// in order of preference. BLS entries come before grub.cfg since those
+// that use blscfg have no menu entries of their own.
+var Configs = []string{
+	"loader/entries",
+	"grub/grub.cfg",
+	"extlinux/extlinux.conf",
+	"extlinux.conf",
+	"syslinux/syslinux.cfg",
+	"syslinux.cfg",
+	"EFI/Linux",
+}
+
+// Find returns the root relative path of the first of Configs in dir, or
+// an empty string if there are none. Empty directories are skipped.
+func Find(root, dir string) string {
+	for _, cfg := range Configs {
+		fn := filepath.Join(dir, cfg)
+		fi, err := os.Stat(filepath.Join(root, fn))
+		if err != nil {
+			continue
+		}
+		if fi.IsDir() && !hasEntries(filepath.Join(root, fn)) {
+			continue
+		}
+		return fn
+	}
+	return ""
+}
+
+// hasEntries returns true if the BLS or UKI directory isn't empty.
+func hasEntries(dir string) bool {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, fi := range fis {
+		switch strings.ToLower(filepath.Ext(fi.Name())) {
+		case ".conf", ".efi":
+			return true
+		}
+	}
+	return false
+}
+
+// Detect returns the format of the configuration at the root relative
+// path, or an empty string if it's presumed to be a grub script.
+func Detect(root, fn string) string {
+	switch strings.ToLower(filepath.Base(fn)) {
+	case "extlinux.conf", "syslinux.cfg":
+		return Extlinux
+	}
+	if strings.EqualFold(filepath.Ext(fn), ".efi") {
+		return UKI
+	}
+	fi, err := os.Stat(filepath.Join(root, fn))
+	if err != nil || !fi.IsDir() {
+		return ""
+	}
+	if filepath.Base(fn) == "entries" {
+		return BLS
+	}
+	return UKI
+}
+
+// Load parses the BLS entries directory, extlinux or syslinux
+// configuration, UKI directory or file at the root relative path.
+func Load(root, fn string) (*Config, error) {
+	var (
+		conf *Config
+		err  error
+	)
+	switch Detect(root, fn) {
+	case BLS:
+		conf, err = ReadBLS(root, fn)
+	case Extlinux:
+		conf, err = ReadExtlinux(root, fn)
+	case UKI:
+		conf, err = ReadUKIs(root, fn)
+	default:
+		return nil, fmt.Errorf("%s: unknown boot configuration", fn)
+	}
+	if err == nil && len(conf.Entries) == 0 {
+		err = fmt.Errorf("%s: %w", fn, ErrNoEntries)
+	}
+	return conf, err
+}
+
+// Menu returns grub menu entries that call set with the selected entry.
+func (conf *Config) Menu(set func(*Entry) error) []menu.Entry {
+	l := make([]menu.Entry, 0, len(conf.Entries))
+	for _, e := range conf.Entries {
+		e := e
+		l = append(l, menu.Entry{
+			Name: e.Name(),
+			RunFun: func(stdin io.Reader, stdout io.Writer,
+				stderr io.Writer) error {
+				return set(e)
+			},
+		})
+	}
+	return l
+}
+
+// Stage returns the paths of the kernel and initrd to load from the
+// filesystem mounted at root. The kernel and initrd of a Unified Kernel
+// Image, and multiple initrds, are first copied to files in dir.
+func (e *Entry) Stage(root, dir string) (kernel, initrd string, err error) {
+	if len(e.Efi) > 0 {
+		return stageUKI(filepath.Join(root, e.Efi), dir)
+	}
+	if len(e.Linux) == 0 {
+		return "", "", fmt.Errorf("%s: %w", e.Name(), ErrNoKernel)
+	}
+	kernel = filepath.Join(root, e.Linux)
+	switch len(e.Initrd) {
+	case 0:
+	case 1:
+		initrd = filepath.Join(root, e.Initrd[0])
+	default:
+		// concatenated cpio archives are unpacked in turn
+		initrd = filepath.Join(dir, "initrd")
+		err = concat(initrd, root, e.Initrd)
+	}
+	return
+}
+
+func concat(out, root string, fns []string) error {
+	w, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	for _, fn := range fns {
+		r, err := os.Open(filepath.Join(root, fn))
+		if err != nil {
+			w.Close()
+			return err
+		}
+		_, err = io.Copy(w, r)
+		r.Close()
+		if err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// rel returns a root relative path of the configured file name where
+// relative names are in dir.
+func rel(dir, fn string) string {
+	if strings.HasPrefix(fn, "/") {
+		return filepath.Clean(fn)
+	}
+	return filepath.Join("/", dir, fn)
+}
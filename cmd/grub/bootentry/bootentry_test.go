@@ -0,0 +1,216 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package bootentry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const root = "testdata"
+
+func TestBLS(t *testing.T) {
+	if f := Detect(root, "loader/entries"); f != BLS {
+		t.Fatal("detected", f)
+	}
+	conf, err := Load(root, "loader/entries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, e := range conf.Entries {
+		ids = append(ids, e.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{
+		"fedora-5.10.7-200.fc33.x86_64",
+		"fedora-5.9.16-200.fc33.x86_64",
+		"recovery",
+	}) {
+		t.Fatal("unexpected order", ids)
+	}
+	if conf.Default != 0 || conf.Timeout != 5*time.Second {
+		t.Error("default", conf.Default, "timeout", conf.Timeout)
+	}
+	e := conf.Entries[0]
+	if e.Name() != "Fedora 33 (Workstation Edition) (5.10.7-200.fc33.x86_64)" ||
+		e.Linux != "/vmlinuz-5.10.7-200.fc33.x86_64" ||
+		!reflect.DeepEqual(e.Initrd, []string{
+			"/microcode.img",
+			"/initramfs-5.10.7-200.fc33.x86_64.img",
+		}) ||
+		!reflect.DeepEqual(e.Options, []string{
+			"root=UUID=5d3b1e0a-7c1f-4e4b-9b8c-0f1e2d3c4b5a",
+			"ro",
+			"quiet",
+		}) {
+		t.Error("unexpected", e)
+	}
+
+	dir, err := ioutil.TempDir("", "bootentry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kernel, initrd, err := e.Stage(root, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kernel != filepath.Join(root, e.Linux) {
+		t.Error("kernel", kernel)
+	}
+	if b, err := ioutil.ReadFile(initrd); err != nil ||
+		string(b) != "ucodeinitramfs" {
+		t.Errorf("initrd %q %v", b, err)
+	}
+}
+
+func TestExtlinux(t *testing.T) {
+	conf, err := Load(root, "extlinux/extlinux.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Entries) != 2 || conf.Default != 1 ||
+		conf.Timeout != 2500*time.Millisecond {
+		t.Fatalf("unexpected %+v", conf)
+	}
+	l0, l0r := conf.Entries[0], conf.Entries[1]
+	if l0.Name() != "Debian GNU/Linux, kernel 5.10.0-8-arm64" ||
+		l0.Linux != "/vmlinuz-5.10.0-8-arm64" ||
+		!reflect.DeepEqual(l0.Initrd, []string{
+			"/initrd.img-5.10.0-8-arm64",
+		}) ||
+		!reflect.DeepEqual(l0.Options, []string{
+			"root=/dev/mmcblk0p2",
+			"console=ttyS2,1500000",
+		}) ||
+		l0.Devicetree != "/dtbs/rk3399-rockpro64.dtb" {
+		t.Error("unexpected", l0)
+	}
+	if l0r.Linux != "/extlinux/vmlinuz-5.10.0-8-arm64" ||
+		!reflect.DeepEqual(l0r.Initrd, []string{
+			"/extlinux/initrd.img-5.10.0-8-arm64",
+		}) ||
+		len(l0r.Options) != 0 {
+		t.Error("unexpected", l0r)
+	}
+}
+
+func TestUKI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootentry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "EFI/Linux"), 0755)
+	err = ioutil.WriteFile(filepath.Join(dir, "EFI/Linux/linux.efi"),
+		testPE([][2]string{
+			{".osrel", "NAME=Arch\nPRETTY_NAME=\"Arch Linux\"\n"},
+			{".cmdline", "rw quiet\x00"},
+			{".uname", "5.15.2-arch1-1\n"},
+			{".linux", "MZkernel\x00"},
+			{".initrd", "initramfs"},
+		}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "EFI/Linux/other.efi"),
+		testPE([][2]string{{".text", "stub"}}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := Detect(dir, "EFI/Linux"); f != UKI {
+		t.Fatal("detected", f)
+	}
+	conf, err := Load(dir, "EFI/Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Entries) != 1 {
+		t.Fatal("unexpected", conf.Entries)
+	}
+	e := conf.Entries[0]
+	if e.Name() != "Arch Linux (5.15.2-arch1-1)" ||
+		e.Efi != "/EFI/Linux/linux.efi" ||
+		!reflect.DeepEqual(e.Options, []string{"rw", "quiet"}) {
+		t.Error("unexpected", e)
+	}
+	kernel, initrd, err := e.Stage(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(kernel); string(b) != "MZkernel\x00" {
+		t.Errorf("kernel %q", b)
+	}
+	if b, _ := ioutil.ReadFile(initrd); string(b) != "initramfs" {
+		t.Errorf("initrd %q", b)
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	for _, x := range []struct {
+		a, b string
+		c    int
+	}{
+		{"5.10.7", "5.9.16", 1},
+		{"5.9", "5.9.1", -1},
+		{"1.0-rc1", "1.0-rc1", 0},
+		{"a", "b", -1},
+	} {
+		if c := VersionCompare(x.a, x.b); c != x.c {
+			t.Errorf("%s vs %s: %d", x.a, x.b, c)
+		}
+	}
+}
+
+// testPE returns a minimal PE image with the given sections, each padded
+// to a 512 byte file alignment.
+func testPE(sections [][2]string) []byte {
+	const align = 512
+	var b bytes.Buffer
+	dos := make([]byte, 64)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 64)
+	b.Write(dos)
+	b.WriteString("PE\x00\x00")
+	binary.Write(&b, binary.LittleEndian, struct {
+		Machine, NumberOfSections                   uint16
+		TimeDateStamp, SymbolTable, NumberOfSymbols uint32
+		SizeOfOptionalHeader, Characteristics       uint16
+	}{0x8664, uint16(len(sections)), 0, 0, 0, 0, 0x22})
+	off := uint32(align)
+	for i, s := range sections {
+		var name [8]byte
+		copy(name[:], s[0])
+		n := uint32(len(s[1]))
+		size := (n + align - 1) / align * align
+		binary.Write(&b, binary.LittleEndian, struct {
+			Name                                  [8]byte
+			VirtualSize, VirtualAddress           uint32
+			SizeOfRawData, PointerToRawData       uint32
+			Relocations, LineNumbers              uint32
+			NumberOfRelocations, NumberOfLineNums uint16
+			Characteristics                       uint32
+		}{name, n, uint32(i+1) * 0x1000, size, off, 0, 0, 0, 0,
+			0x40000040})
+		off += size
+	}
+	pad := func() {
+		if r := b.Len() % align; r > 0 {
+			b.Write(make([]byte, align-r))
+		}
+	}
+	pad()
+	for _, s := range sections {
+		b.WriteString(s[1])
+		pad()
+	}
+	return b.Bytes()
+}
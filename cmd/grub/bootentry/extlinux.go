@@ -0,0 +1,117 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package bootentry
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseExtlinux returns the LABEL entries of an extlinux.conf or
+// syslinux.cfg in the root relative dir. Relative file names are in dir.
+// LOCALBOOT, COM32 and other labels without a kernel are skipped.
+func ParseExtlinux(dir string, r io.Reader) (*Config, error) {
+	conf := &Config{Format: Extlinux}
+	var (
+		e       *Entry
+		def     string
+		menudef string
+		entries []*Entry
+	)
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		key, value := keyValue(scan.Text())
+		key = strings.ToLower(key)
+		if key == "menu" {
+			key, value = keyValue(value)
+			key = "menu " + strings.ToLower(key)
+		}
+		switch key {
+		case "default":
+			def = value
+		case "timeout":
+			// in tenths of a second
+			if n, err := strconv.Atoi(value); err == nil && n > 0 {
+				conf.Timeout = time.Duration(n) * time.Second / 10
+			}
+		case "label":
+			e = &Entry{ID: value}
+			entries = append(entries, e)
+		case "menu label":
+			if e != nil {
+				e.Title = strings.Replace(value, "^", "", 1)
+			}
+		case "menu default":
+			if e != nil {
+				menudef = e.ID
+			}
+		case "kernel", "linux":
+			if e != nil && len(value) > 0 {
+				e.Linux = rel(dir, value)
+			}
+		case "initrd":
+			if e != nil {
+				e.Initrd = nil
+				for _, fn := range strings.Split(value, ",") {
+					e.Initrd = append(e.Initrd, rel(dir, fn))
+				}
+			}
+		case "fdt", "devicetree":
+			if e != nil {
+				e.Devicetree = rel(dir, value)
+			}
+		case "append":
+			if e == nil {
+				break
+			}
+			e.Options = nil
+			if value == "-" {
+				break
+			}
+			for _, opt := range strings.Fields(value) {
+				if strings.HasPrefix(opt, "initrd=") {
+					e.Initrd = nil
+					for _, fn := range strings.Split(opt[7:], ",") {
+						e.Initrd = append(e.Initrd,
+							rel(dir, fn))
+					}
+				} else {
+					e.Options = append(e.Options, opt)
+				}
+			}
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	if len(menudef) > 0 {
+		def = menudef
+	}
+	for _, e := range entries {
+		if len(e.Linux) == 0 {
+			continue
+		}
+		if e.ID == def {
+			conf.Default = len(conf.Entries)
+		}
+		conf.Entries = append(conf.Entries, e)
+	}
+	return conf, nil
+}
+
+// ReadExtlinux parses the root relative configuration file.
+func ReadExtlinux(root, fn string) (*Config, error) {
+	f, err := os.Open(filepath.Join(root, fn))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseExtlinux(filepath.Dir(fn), f)
+}
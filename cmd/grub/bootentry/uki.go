@@ -0,0 +1,151 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package bootentry
+
+import (
+	"bufio"
+	"debug/pe"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNotUKI = errors.New("not a unified kernel image")
+
+// ParseUKI returns the entry of a Unified Kernel Image at the root
+// relative fn, a PE binary with .linux, .initrd, .cmdline, .osrel and
+// .uname sections.
+func ParseUKI(fn string, r io.ReaderAt) (*Entry, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if f.Section(".linux") == nil {
+		return nil, fmt.Errorf("%s: %w", fn, ErrNotUKI)
+	}
+	e := &Entry{
+		ID:  strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn)),
+		Efi: rel("", fn),
+	}
+	if s, err := text(f, ".cmdline"); err == nil {
+		e.Options = strings.Fields(s)
+	}
+	if s, err := text(f, ".uname"); err == nil {
+		e.Version = s
+	}
+	if s, err := text(f, ".osrel"); err == nil {
+		osrel := make(map[string]string)
+		scan := bufio.NewScanner(strings.NewReader(s))
+		for scan.Scan() {
+			kv := strings.SplitN(scan.Text(), "=", 2)
+			if len(kv) == 2 {
+				osrel[kv[0]] = strings.Trim(kv[1], `"'`)
+			}
+		}
+		for _, k := range []string{"PRETTY_NAME", "NAME", "ID"} {
+			if len(osrel[k]) > 0 {
+				e.Title = osrel[k]
+				break
+			}
+		}
+		if len(e.Version) == 0 {
+			e.Version = osrel["VERSION_ID"]
+		}
+	}
+	return e, nil
+}
+
+// ReadUKIs returns the images of the root relative fn that's either a
+// directory, e.g. "EFI/Linux", or a single image. Images are sorted in
+// descending order of version and file name.
+func ReadUKIs(root, fn string) (*Config, error) {
+	conf := &Config{Format: UKI}
+	fns := []string{fn}
+	fi, err := os.Stat(filepath.Join(root, fn))
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		fis, err := ioutil.ReadDir(filepath.Join(root, fn))
+		if err != nil {
+			return nil, err
+		}
+		fns = fns[:0]
+		for _, fi := range fis {
+			if !fi.IsDir() &&
+				strings.EqualFold(filepath.Ext(fi.Name()), ".efi") {
+				fns = append(fns, filepath.Join(fn, fi.Name()))
+			}
+		}
+	}
+	for _, fn := range fns {
+		f, err := os.Open(filepath.Join(root, fn))
+		if err != nil {
+			return nil, err
+		}
+		e, err := ParseUKI(fn, f)
+		f.Close()
+		if err != nil {
+			if fi.IsDir() {
+				// e.g. systemd-bootx64.efi
+				continue
+			}
+			return nil, err
+		}
+		conf.Entries = append(conf.Entries, e)
+	}
+	SortBLS(conf.Entries)
+	return conf, nil
+}
+
+// stageUKI copies the kernel and initrd of the image to files in dir.
+func stageUKI(fn, dir string) (kernel, initrd string, err error) {
+	f, err := pe.Open(fn)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	b, err := section(f, ".linux")
+	if err != nil {
+		return
+	}
+	kernel = filepath.Join(dir, "vmlinuz")
+	if err = ioutil.WriteFile(kernel, b, 0644); err != nil {
+		return
+	}
+	if b, err = section(f, ".initrd"); err != nil {
+		return kernel, "", nil
+	}
+	initrd = filepath.Join(dir, "initrd")
+	err = ioutil.WriteFile(initrd, b, 0644)
+	return
+}
+
+// section returns the data of the named section less file alignment.
+func section(f *pe.File, name string) ([]byte, error) {
+	s := f.Section(name)
+	if s == nil {
+		return nil, fmt.Errorf("%s: section not found", name)
+	}
+	b, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if s.VirtualSize > 0 && int(s.VirtualSize) < len(b) {
+		b = b[:s.VirtualSize]
+	}
+	return b, nil
+}
+
+// text returns the string of a section less trailing NULs and space.
+func text(f *pe.File, name string) (string, error) {
+	b, err := section(f, name)
+	return strings.TrimRight(string(b), "\x00 \t\n"), err
+}
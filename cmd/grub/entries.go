@@ -0,0 +1,140 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package grub
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/platinasystems/goes/cmd/grub/bootentry"
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
+)
+
+// load runs the grub script, n, or adds the menu entries of a BLS entries
+// directory, extlinux.conf, syslinux.cfg or Unified Kernel Images.
+func (c *Command) load(n string) error {
+	if Goes.EnvMap == nil {
+		Goes.EnvMap = make(map[string]string)
+	}
+	if n == "-" {
+		return c.runScript(n)
+	}
+	// load_env and save_env default to $prefix/grubenv
+	prefix := filepath.Join(c.root, filepath.Dir(n))
+	Goes.EnvMap["prefix"] = prefix
+	Goes.EnvMap["config_directory"] = prefix
+	c.envFile = filepath.Join(c.root, grubenv.File(n))
+	c.format = bootentry.Detect(c.root, n)
+	if len(c.format) == 0 {
+		return c.runScript(n)
+	}
+	conf, err := bootentry.Load(c.root, n)
+	if err != nil {
+		return err
+	}
+	m := menuEntry.R.RootMenu
+	*m.Entries = append(*m.Entries, conf.Menu(c.setEntry)...)
+	Goes.EnvMap["default"] = strconv.Itoa(conf.Default)
+	if conf.Timeout > 0 {
+		// round up to whole seconds
+		s := (conf.Timeout + time.Second - 1) / time.Second
+		Goes.EnvMap["timeout"] = strconv.Itoa(int(s))
+	}
+	return nil
+}
+
+// setEntry defines the kernel, command line and initrd of the selected
+// boot entry as the linux and initrd commands would.
+func (c *Command) setEntry(e *bootentry.Entry) error {
+	dir := filepath.Join(os.TempDir(), "grub")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	kernel, initrd, err := e.Stage(c.GetRoot(), dir)
+	if err != nil {
+		return err
+	}
+	Linux.Kern = kernel
+	Linux.Cmd = e.Options
+	Linux.Resolved = true
+	Initrd.Initrd = initrd
+	return nil
+}
+
+// selectDefault applies the saved, one-shot and fallback entries of the
+// environment block to the default entry. Without a script to load_env,
+// saved_entry replaces the default of other boot configurations.
+func (c *Command) selectDefault() {
+	if len(c.envFile) == 0 {
+		return
+	}
+	env, err := grubenv.Read(c.envFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Println(err)
+		}
+		return
+	}
+	// set by grub-mkconfig scripts that load next_entry themselves
+	c.oneshot = len(Goes.EnvMap["boot_once"]) > 0
+	def := Goes.EnvMap["default"]
+	if saved := env[grubenv.SavedEntry]; def == "saved" ||
+		(len(c.format) > 0 && len(saved) > 0) {
+		def = saved
+	}
+	if next := env[grubenv.NextEntry]; len(next) > 0 {
+		def = next
+		c.oneshot = true
+		Goes.EnvMap["boot_once"] = "true"
+	} else if tries := env.Int(grubenv.BootTries); tries > 0 &&
+		len(env[grubenv.RecordFail]) > 0 {
+		fallback := Goes.EnvMap["fallback"]
+		if len(fallback) == 0 {
+			fallback = env[grubenv.Fallback]
+		}
+		if n := env.Int(grubenv.BootCount); n >= tries &&
+			len(fallback) > 0 {
+			fmt.Printf("%q failed %d times, falling back to %q\n",
+				env[grubenv.BootEntry], n, fallback)
+			def = fallback
+		}
+	}
+	Goes.EnvMap["default"] = def
+}
+
+// recordBoot saves the chosen entry and, if counting, the number of boots
+// that haven't been confirmed by the booted system's "bootctl good", or
+// unset recordfail. A one-shot entry is forgotten instead of counted.
+func (c *Command) recordBoot() {
+	if len(c.envFile) == 0 {
+		return
+	}
+	if _, err := os.Stat(c.envFile); err != nil && !c.oneshot {
+		return
+	}
+	err := grubenv.Update(c.envFile, func(env grubenv.Env) error {
+		env.Set(grubenv.BootEntry, Goes.EnvMap["chosen"])
+		if c.oneshot {
+			env.Set(grubenv.NextEntry, "")
+			return nil
+		}
+		if env.Int(grubenv.BootTries) > 0 {
+			n := env.Int(grubenv.BootCount)
+			if len(env[grubenv.RecordFail]) == 0 {
+				// the last boot was good
+				n = 0
+			}
+			env.Set(grubenv.BootCount, strconv.Itoa(n+1))
+			env.Set(grubenv.RecordFail, "1")
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println(c.envFile, err)
+	}
+}
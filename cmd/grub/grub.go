@@ -26,7 +26,11 @@ import (
 	"github.com/platinasystems/goes/cmd/function"
 	"github.com/platinasystems/goes/cmd/grub/initrd"
 	"github.com/platinasystems/goes/cmd/grub/linux"
+	"github.com/platinasystems/goes/cmd/grub/loadenv"
 	"github.com/platinasystems/goes/cmd/grub/menu"
+	"github.com/platinasystems/goes/cmd/grub/recordfail"
+	"github.com/platinasystems/goes/cmd/grub/savedefault"
+	"github.com/platinasystems/goes/cmd/grub/saveenv"
 	"github.com/platinasystems/goes/cmd/grub/search"
 	"github.com/platinasystems/goes/cmd/grub/set"
 	"github.com/platinasystems/goes/cmd/ifcmd"
@@ -47,6 +51,11 @@ type Command struct {
 	g       *goes.Goes
 	root    string
 	scanner *bufio.Scanner
+	script  string
+	line    int
+	format  string // of bootentry or empty for grub scripts
+	envFile string
+	oneshot bool
 }
 
 var ErrNoDefinedKernelOrMenus = errors.New("No defined kernel or menus")
@@ -72,10 +81,13 @@ var Goes = &goes.Goes{
 		"initrd":           Initrd,
 		"insmod":           nop.Command{C: "insmod"},
 		"linux":            Linux,
+		"load_env":         &loadenv.Command{},
 		"loadfont":         nop.Command{C: "loadfont"},
 		"menuentry":        menuEntry,
 		"play":             nop.Command{C: "play"},
-		"recordfail":       nop.Command{C: "recordfail"},
+		"recordfail":       &recordfail.Command{},
+		"save_env":         &saveenv.Command{},
+		"savedefault":      &savedefault.Command{},
 		"search":           &search.Command{},
 		"serial":           nop.Command{C: "serial"},
 		"set":              &set.Command{},
@@ -108,6 +120,7 @@ func (c *Command) Write(p []byte) (n int, err error) {
 
 func (c *Command) Read(p []byte) (n int, err error) {
 	if c.scanner.Scan() {
+		c.line++
 		t := c.scanner.Text()
 		if c.g.Verbosity >= goes.VerboseDebug {
 			fmt.Println("+", t)
@@ -125,6 +138,14 @@ func (c *Command) Read(p []byte) (n int, err error) {
 	return 0, err
 }
 
+// Location returns the script and line number of the last command read.
+func (c *Command) Location() string {
+	if len(c.script) == 0 {
+		return ""
+	}
+	return fmt.Sprint(c.script, ":", c.line)
+}
+
 func (c *Command) runScript(n string) (err error) {
 	if n != "-" {
 		fn := filepath.Join(c.root, n)
@@ -135,6 +156,7 @@ func (c *Command) runScript(n string) (err error) {
 		defer script.Close()
 
 		c.scanner = bufio.NewScanner(script)
+		c.script, c.line = fn, 0
 
 		Goes.Catline = c
 
@@ -147,8 +169,9 @@ func (c *Command) runScript(n string) (err error) {
 }
 
 func (c *Command) Main(args ...string) (err error) {
-	parm, args := parms.New(args, "-t")
-	flag, args := flags.New(args, "--daemon", "--webserver")
+	parm, args := parms.New(args, "-t", "--listen", "--cert", "--key",
+		"--auth")
+	flag, args := flags.New(args, "--daemon", "--webserver", "-n", "-x")
 
 	c.root = "/boot"
 	if len(args) > 0 {
@@ -160,11 +183,19 @@ func (c *Command) Main(args ...string) (err error) {
 	}
 
 	if flag.ByName["--webserver"] {
-		c.ServeMenus(n)
+		c.ServeMenus(n, parm)
 		return
 	}
 
-	if err := c.runScript(n); err != nil {
+	Goes.Trace = flag.ByName["-x"]
+	if flag.ByName["-n"] {
+		// check the script without running it
+		Goes.NoExec = true
+		defer func() { Goes.NoExec = false }()
+		return c.load(n)
+	}
+
+	if err := c.load(n); err != nil {
 		return err
 	}
 
@@ -180,6 +211,8 @@ func (c *Command) Main(args ...string) (err error) {
 		return ErrNoDefinedKernelOrMenus
 	}
 
+	c.selectDefault()
+
 	err = c.AskKernel(parm, flag)
 	if err != nil {
 		return err
@@ -209,13 +242,22 @@ func (c *Command) Usage() string {
 }
 
 func (c *Command) RunMenu(m *menu.Menu, parm *parms.Parms, flag *flags.Flags) (err error) {
-	for m != nil {
+	// default may be a number, title or id; or a ">" separated path of
+	// these through submenus.
+	path := strings.Split(Goes.EnvMap["default"], ">")
+	var chosen []string
+	for level := 0; m != nil; level++ {
 		fmt.Print(m.NumberedMenu())
 		var menuItem int
 		err = func() error {
-			def := Goes.EnvMap["default"]
-			if def == "" {
-				def = "0"
+			def := "0"
+			if level < len(path) && len(path[level]) > 0 {
+				if i := m.Index(path[level]); i >= 0 {
+					def = strconv.Itoa(i)
+				} else {
+					fmt.Printf("Default %q not found\n",
+						path[level])
+				}
 			}
 			mi, err := c.readline(parm, flag, fmt.Sprintf("Menu item [%s]? ", def), def)
 			if err != nil {
@@ -230,6 +272,10 @@ func (c *Command) RunMenu(m *menu.Menu, parm *parms.Parms, flag *flags.Flags) (e
 		if err != nil {
 			return
 		}
+		if menuItem >= 0 && menuItem < len(*m.Entries) {
+			chosen = append(chosen, (*m.Entries)[menuItem].Name)
+			Goes.EnvMap["chosen"] = strings.Join(chosen, ">")
+		}
 		m, err = m.RunMenu(menuItem, os.Stdin, os.Stdout, os.Stderr)
 		if err != nil {
 			return err
@@ -254,6 +300,7 @@ func (c *Command) AskKernel(parm *parms.Parms, flag *flags.Flags) (err error) {
 		}
 		if strings.HasPrefix(yn, "Y") ||
 			strings.HasPrefix(yn, "y") {
+			c.recordBoot()
 			err := c.g.Main(kexec...)
 			return err
 		}
@@ -310,12 +357,16 @@ func (c *Command) KexecCommand() []string {
 	if k[0] != '/' {
 		k = "/" + k
 	}
-	k = c.GetRoot() + k
+	if !Linux.Resolved {
+		k = c.GetRoot() + k
+	}
 	if len(i) > 0 {
 		if i[0] != '/' {
 			i = "/" + i
 		}
-		i = c.GetRoot() + i
+		if !Linux.Resolved {
+			i = c.GetRoot() + i
+		}
 	}
 	co := false
 	for _, cmd := range Linux.Cmd {
@@ -6,8 +6,12 @@ package grub
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
 )
 
 func TestGrubCommand(t *testing.T) {
@@ -32,3 +36,51 @@ func ExampleMain() {
 	// Output:
 	// Hello world!
 }
+
+func TestBootCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := &Command{g: Goes, envFile: filepath.Join(dir, grubenv.Name)}
+	env := grubenv.Env{
+		grubenv.SavedEntry: "Debian",
+		grubenv.Fallback:   "Rescue",
+		grubenv.BootTries:  "2",
+		grubenv.BootCount:  "1",
+		grubenv.RecordFail: "1",
+	}
+	if err = env.Write(c.envFile); err != nil {
+		t.Fatal(err)
+	}
+	boot := func(expect string) {
+		t.Helper()
+		Goes.EnvMap = map[string]string{"default": "saved"}
+		c.selectDefault()
+		if def := Goes.EnvMap["default"]; def != expect {
+			t.Fatalf("default %q not %q", def, expect)
+		}
+		Goes.EnvMap["chosen"] = expect
+		c.recordBoot()
+	}
+	boot("Debian")
+	boot("Rescue")
+	if env, _ = grubenv.Read(c.envFile); env.Int(grubenv.BootCount) != 3 ||
+		env[grubenv.BootEntry] != "Rescue" {
+		t.Error("unexpected", env)
+	}
+
+	// a good boot resets the count and a one-shot isn't counted
+	env.Set(grubenv.RecordFail, "")
+	env.Set(grubenv.NextEntry, "Test")
+	if err = env.Write(c.envFile); err != nil {
+		t.Fatal(err)
+	}
+	boot("Test")
+	boot("Debian")
+	if env, _ = grubenv.Read(c.envFile); env.Int(grubenv.BootCount) != 1 ||
+		len(env[grubenv.NextEntry]) > 0 {
+		t.Error("unexpected", env)
+	}
+}
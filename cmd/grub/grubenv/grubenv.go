@@ -0,0 +1,199 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package grubenv reads and writes grub environment blocks, the 1KiB
+// grubenv file of saved_entry, next_entry and other persistent variables.
+// The same file records boot counting and fallback state for any boot
+// configuration that grubd runs.
+package grubenv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	Header = "# GRUB Environment Block\n"
+	Size   = 1024
+	Name   = "grubenv"
+)
+
+// These are the variables of boot selection and counting.
+//
+//	saved_entry	the persistent default entry
+//	next_entry	the entry to boot once, then forget
+//	fallback	the entry to boot after boot_tries failures
+//	boot_tries	unconfirmed boots of the default before falling back
+//	boot_count	unconfirmed boots since the last good one
+//	boot_entry	the last booted entry
+//	recordfail	set on boot, unset by the booted system when good
+const (
+	SavedEntry = "saved_entry"
+	NextEntry  = "next_entry"
+	Fallback   = "fallback"
+	BootTries  = "boot_tries"
+	BootCount  = "boot_count"
+	BootEntry  = "boot_entry"
+	RecordFail = "recordfail"
+)
+
+// Vars are the above variables in the order printed and published.
+var Vars = []string{
+	SavedEntry,
+	NextEntry,
+	Fallback,
+	BootTries,
+	BootCount,
+	BootEntry,
+	RecordFail,
+}
+
+var ErrInvalid = errors.New("invalid environment block")
+var ErrTooBig = errors.New("environment block too big")
+
+type Env map[string]string
+
+// File returns the grubenv path adjacent to the given boot configuration,
+// e.g. grub/grubenv of grub/grub.cfg and loader/grubenv of loader/entries.
+func File(cfg string) string {
+	return filepath.Join(filepath.Dir(cfg), Name)
+}
+
+// Parse returns the variables of an environment block.
+func Parse(b []byte) (Env, error) {
+	if !bytes.HasPrefix(b, []byte(Header)) {
+		return nil, ErrInvalid
+	}
+	env := make(Env)
+	for _, line := range strings.Split(string(b[len(Header):]), "\n") {
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq < 1 {
+			continue
+		}
+		env[line[:eq]] = unescape(line[eq+1:])
+	}
+	return env, nil
+}
+
+// Read returns the variables of the named file or an empty Env and an
+// os.IsNotExist error.
+func Read(fn string) (Env, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return make(Env), err
+	}
+	env, err := Parse(b)
+	if err != nil {
+		return make(Env), fmt.Errorf("%s: %w", fn, err)
+	}
+	return env, nil
+}
+
+// Bytes returns the environment block padded with '#' to Size.
+func (env Env) Bytes() ([]byte, error) {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := bytes.NewBufferString(Header)
+	for _, k := range keys {
+		fmt.Fprint(buf, k, "=", escape(env[k]), "\n")
+	}
+	if buf.Len() > Size {
+		return nil, ErrTooBig
+	}
+	buf.Write(bytes.Repeat([]byte{'#'}, Size-buf.Len()))
+	return buf.Bytes(), nil
+}
+
+// Write replaces the contents of the named file in place, so that the
+// block remains where grub may have found it.
+func (env Env) Write(fn string) error {
+	b, err := env.Bytes()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt(b, 0)
+	if err == nil {
+		err = f.Truncate(Size)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Int returns the numeric value of the variable or zero.
+func (env Env) Int(k string) int {
+	i, _ := strconv.Atoi(env[k])
+	return i
+}
+
+// Set the variable or, if empty, remove it.
+func (env Env) Set(k, v string) {
+	if len(v) == 0 {
+		delete(env, k)
+	} else {
+		env[k] = v
+	}
+}
+
+// Update reads the named file, calls f, then writes the result.
+func Update(fn string, f func(Env) error) error {
+	env, err := Read(fn)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = f(env); err != nil {
+		return err
+	}
+	return env.Write(fn)
+}
+
+func escape(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Default returns the file of the load_env and save_env commands, those
+// without --file, i.e. $prefix/grubenv.
+func Default(vars map[string]string) string {
+	return filepath.Join(vars["prefix"], Name)
+}
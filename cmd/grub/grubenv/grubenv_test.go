@@ -0,0 +1,82 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package grubenv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// as written by grub-editenv
+const editenv = Header + `saved_entry=Advanced options>Debian, with Linux 5.10
+next_entry=1
+#`
+
+func TestParse(t *testing.T) {
+	env, err := Parse([]byte(editenv + strings.Repeat("#", 900)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(env, Env{
+		SavedEntry: "Advanced options>Debian, with Linux 5.10",
+		NextEntry:  "1",
+	}) {
+		t.Error("unexpected", env)
+	}
+	if _, err = Parse([]byte("saved_entry=0\n")); err != ErrInvalid {
+		t.Error("expected", ErrInvalid, "not", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grubenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, Name)
+	err = Update(fn, func(env Env) error {
+		env.Set(SavedEntry, `a\b`)
+		env.Set(Fallback, "line\nbreak")
+		env.Set(BootTries, "3")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Update(fn, func(env Env) error {
+		env.Set(BootTries, "")
+		env.Set(BootCount, "1")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != Size || !strings.HasPrefix(string(b), Header+
+		"boot_count=1\nfallback=line\\nbreak\nsaved_entry=a\\\\b\n#") {
+		t.Fatalf("unexpected %q", b)
+	}
+	env, err := Read(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env[SavedEntry] != `a\b` || env[Fallback] != "line\nbreak" ||
+		env.Int(BootCount) != 1 || len(env) != 3 {
+		t.Error("unexpected", env)
+	}
+	big := make(Env)
+	big["x"] = strings.Repeat("x", Size)
+	if _, err = big.Bytes(); err != ErrTooBig {
+		t.Error("expected", ErrTooBig, "not", err)
+	}
+}
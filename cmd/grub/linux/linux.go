@@ -14,6 +14,9 @@ import (
 type Command struct {
 	Kern string
 	Cmd  []string
+	// Resolved if Kern and the initrd are paths on this system rather
+	// than relative to the grub root, e.g. staged boot entries.
+	Resolved bool
 }
 
 func (c Command) String() string { return "linux" }
@@ -43,6 +46,7 @@ func (c *Command) Main(args ...string) error {
 		return fmt.Errorf("%s: missing arguments\n", c)
 	}
 	c.Kern = args[0]
+	c.Resolved = false
 	if len(args) > 1 {
 		c.Cmd = args[1:]
 	}
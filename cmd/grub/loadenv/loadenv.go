@@ -0,0 +1,70 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package loadenv
+
+import (
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct {
+	g *goes.Goes
+}
+
+func (Command) String() string { return "load_env" }
+
+func (Command) Usage() string {
+	return "load_env [--file FILE] [--skip-sig] [VARIABLE]..."
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "load variables from an environment block",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Set all, or the named, variables of the environment block FILE,
+	default $prefix/grubenv.`,
+	}
+}
+
+func (Command) Kind() cmd.Kind { return cmd.DontFork }
+
+func (c *Command) Goes(g *goes.Goes) { c.g = g }
+
+func (c *Command) Main(args ...string) error {
+	parm, args := parms.New(args, []string{"--file", "-f"})
+	_, args = flags.New(args, []string{"--skip-sig", "-s"})
+	if c.g.EnvMap == nil {
+		c.g.EnvMap = make(map[string]string)
+	}
+	fn := parm.ByName["--file"]
+	if len(fn) == 0 {
+		fn = grubenv.Default(c.g.EnvMap)
+	}
+	env, err := grubenv.Read(fn)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		for k, v := range env {
+			c.g.EnvMap[k] = v
+		}
+	}
+	for _, k := range args {
+		if v, found := env[k]; found {
+			c.g.EnvMap[k] = v
+		}
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 
 	"github.com/platinasystems/goes"
@@ -37,6 +38,7 @@ type Menu struct {
 
 type Entry struct {
 	Name    string
+	ID      string // from --id
 	RunFun  func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error
 	Submenu *Menu
 }
@@ -82,6 +84,23 @@ func (m *Menu) NumberedMenu() (s string) {
 	return
 }
 
+// Index returns the position of the entry with the given number, title or
+// id; or -1 if there's no such entry.
+func (m *Menu) Index(s string) int {
+	if i, err := strconv.Atoi(s); err == nil {
+		if i < 0 || i >= len(*m.Entries) {
+			return -1
+		}
+		return i
+	}
+	for i, e := range *m.Entries {
+		if e.Name == s || (len(e.ID) > 0 && e.ID == s) {
+			return i
+		}
+	}
+	return -1
+}
+
 func (c *Command) String() string { return c.C }
 
 func (c *Command) Usage() string {
@@ -124,6 +143,7 @@ DESCRIPTION
 
 func (c *Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List,
 	func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error, error) {
+	loc := g.Location()
 	cl := ls.Cmds[0]
 	// menuentry name [option...] { definition ... ; }
 	if len(cl.Cmds) < 2 {
@@ -151,7 +171,7 @@ func (c *Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List,
 		return nil, nil, fmt.Errorf("%s: %w", c, ErrMenuMissingOpenBrace)
 	}
 
-	_, args = parms.New(args, "--class", "--users", "--hotkey", "--id")
+	parm, args := parms.New(args, "--class", "--users", "--hotkey", "--id")
 	_, args = flags.New(args, "--unrestricted")
 
 	if len(args) < 1 {
@@ -174,6 +194,9 @@ func (c *Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List,
 			newls, err := shellutils.Parse(c.String()+">",
 				g.Catline)
 			if err != nil {
+				if err == io.EOF {
+					err = g.MissingTerminator(c.String(), "}", loc)
+				}
 				return nil, nil, err
 			}
 			ls = *newls
@@ -200,7 +223,7 @@ func (c *Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List,
 	}
 
 	sm := &Menu{Entries: &[]Entry{}}
-	e := Entry{Name: name}
+	e := Entry{Name: name, ID: parm.ByName["--id"]}
 	if c.Nesting {
 		e.Submenu = sm
 	}
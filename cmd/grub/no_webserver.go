@@ -6,6 +6,8 @@
 
 package grub
 
-func (c *Command) ServeMenus(n string) {
+import "github.com/platinasystems/goes/external/parms"
+
+func (c *Command) ServeMenus(n string, parm *parms.Parms) {
 	return
 }
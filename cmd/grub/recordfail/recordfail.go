@@ -0,0 +1,56 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package recordfail
+
+import (
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct {
+	g *goes.Goes
+}
+
+func (Command) String() string { return "recordfail" }
+
+func (Command) Usage() string { return "recordfail" }
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "record a boot attempt",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Set recordfail=1 and, unless booting once, save it in
+	$prefix/grubenv. The booted system unsets it once it's up, e.g.
+	with "bootctl good". This is the same as the function of
+	grub-mkconfig scripts, which take precedence if defined.`,
+	}
+}
+
+func (Command) Kind() cmd.Kind { return cmd.DontFork }
+
+func (c *Command) Goes(g *goes.Goes) { c.g = g }
+
+func (c *Command) Main(args ...string) error {
+	if c.g.EnvMap == nil {
+		c.g.EnvMap = make(map[string]string)
+	}
+	c.g.EnvMap[grubenv.RecordFail] = "1"
+	if len(c.g.EnvMap["boot_once"]) > 0 {
+		return nil
+	}
+	return grubenv.Update(grubenv.Default(c.g.EnvMap),
+		func(env grubenv.Env) error {
+			env.Set(grubenv.RecordFail, "1")
+			return nil
+		})
+}
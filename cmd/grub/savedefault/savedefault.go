@@ -0,0 +1,51 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package savedefault
+
+import (
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct {
+	g *goes.Goes
+}
+
+func (Command) String() string { return "savedefault" }
+
+func (Command) Usage() string { return "savedefault" }
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "save the chosen menu entry as the default",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Unless booting once, save $chosen as saved_entry in
+	$prefix/grubenv. This is the same as the function of grub-mkconfig
+	scripts, which take precedence if defined.`,
+	}
+}
+
+func (Command) Kind() cmd.Kind { return cmd.DontFork }
+
+func (c *Command) Goes(g *goes.Goes) { c.g = g }
+
+func (c *Command) Main(args ...string) error {
+	if len(c.g.EnvMap["boot_once"]) > 0 {
+		return nil
+	}
+	return grubenv.Update(grubenv.Default(c.g.EnvMap),
+		func(env grubenv.Env) error {
+			env.Set(grubenv.SavedEntry, c.g.EnvMap["chosen"])
+			return nil
+		})
+}
@@ -0,0 +1,61 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package saveenv
+
+import (
+	"fmt"
+
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct {
+	g *goes.Goes
+}
+
+func (Command) String() string { return "save_env" }
+
+func (Command) Usage() string {
+	return "save_env [--file FILE] VARIABLE..."
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "save variables to an environment block",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Save the named variables to the environment block FILE, default
+	$prefix/grubenv. Unset, or empty, variables are removed.`,
+	}
+}
+
+func (Command) Kind() cmd.Kind { return cmd.DontFork }
+
+func (c *Command) Goes(g *goes.Goes) { c.g = g }
+
+func (c *Command) Main(args ...string) error {
+	parm, args := parms.New(args, []string{"--file", "-f"})
+	if len(args) == 0 {
+		return fmt.Errorf("VARIABLE: missing")
+	}
+	fn := parm.ByName["--file"]
+	if len(fn) == 0 {
+		fn = grubenv.Default(c.g.EnvMap)
+	}
+	return grubenv.Update(fn, func(env grubenv.Env) error {
+		for _, k := range args {
+			env.Set(k, c.g.EnvMap[k])
+		}
+		return nil
+	})
+}
@@ -5,16 +5,16 @@
 package search
 
 import (
-	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/platinasystems/goes"
 	"github.com/platinasystems/goes/cmd"
 	"github.com/platinasystems/goes/external/flags"
 	"github.com/platinasystems/goes/external/parms"
-	"github.com/platinasystems/goes/external/partitions"
+	"github.com/platinasystems/goes/internal/blockdev"
 	"github.com/platinasystems/goes/lang"
 )
 
@@ -40,15 +40,25 @@ func (Command) Man() lang.Alt {
 	}
 }
 
-const Man = "Search for a filesystem"
+const Man = `Search for a filesystem by UUID (--fs-uuid, the default), label
+(--label) or a file that it has (--file) and set the variable named by --set,
+default "root", to its device. Files are found in the partitions mounted by
+mountd in ` + MountDir + `.`
+
+// MountDir is where mountd mounts each partition by name.
+const MountDir = "/mountd"
 
 func (Command) Kind() cmd.Kind { return cmd.DontFork }
 
 func (c *Command) Goes(g *goes.Goes) { c.g = g }
 
 func (c Command) Main(args ...string) error {
-	parm, args := parms.New(args, "--file", "--label", "--hint", "--uuid", "--set")
-	_, args = flags.New(args, "--no-floppy", "--fs-uuid")
+	parm, args := parms.New(args, "--hint", "--hint-bios", "--hint-efi",
+		"--hint-baremetal", "--hint-ieee1275", "--hint-arc", "--set")
+	flag, args := flags.New(args, "--no-floppy",
+		[]string{"--fs-uuid", "-u"},
+		[]string{"--label", "-l"},
+		[]string{"--file", "-f"})
 
 	v := parm.ByName["--set"]
 
@@ -58,32 +68,28 @@ func (c Command) Main(args ...string) error {
 	if len(args) != 1 {
 		return fmt.Errorf("Unexpected %v\n", args)
 	}
-	f, err := os.Open("/proc/partitions")
+	devs, err := blockdev.Scan()
 	if err != nil {
-		fmt.Printf("opening /proc/partitions: %s\n", err)
 		return err
 	}
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
-		if len(fields) < 4 || fields[0] == "major" {
-			continue
+	d := blockdev.Find(devs, func(d *blockdev.Device) bool {
+		switch {
+		case len(d.FSType) == 0:
+			return false
+		case flag.ByName["--file"]:
+			_, err := os.Stat(filepath.Join(MountDir, d.Name, args[0]))
+			return err == nil
+		case flag.ByName["--label"]:
+			return d.Label == args[0]
+		default:
+			return strings.EqualFold(d.UUID, args[0])
 		}
-		fileName := fields[3]
-		sb, err := partitions.ReadSuperBlock("/dev/" + fileName)
-		if err == nil {
-			u, _ := sb.UUID()
-			if u.String() == args[0] {
-				if c.g.EnvMap == nil {
-					c.g.EnvMap = make(map[string]string)
-				}
-				c.g.EnvMap[v] = "/dev/" + fileName
-				return nil
-			}
+	})
+	if d != nil {
+		if c.g.EnvMap == nil {
+			c.g.EnvMap = make(map[string]string)
 		}
+		c.g.EnvMap[v] = d.Path
 	}
 	return nil
 }
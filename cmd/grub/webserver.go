@@ -1,4 +1,4 @@
-// Copyright © 2018-2020 Platina Systems, Inc. All rights reserved.
+// Copyright © 2018-2021 Platina Systems, Inc. All rights reserved.
 // Use of this source code is governed by the GPL-2 license described in the
 // LICENSE file.
 
@@ -7,136 +7,533 @@
 package grub
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"html"
+	"html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/platinasystems/goes/cmd/grub/menu"
+	"github.com/platinasystems/goes/external/parms"
 )
 
-var pageExists = make(map[string]struct{})
+const (
+	defaultListen = "localhost:8080"
+	csrfField     = "csrf"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrBadCSRF = errors.New("missing or invalid CSRF token")
+var ErrInsecure = errors.New("non-loopback listen requires --cert, --key and --auth")
 
+// webserver serves the menus of a grub script, n, as HTML at / and
+// /entry/PATH, and as JSON at /menu and /boot/PATH, where PATH is the
+// "/" separated menu item numbers through submenus. A POST to /boot/PATH
+// kexecs the kernel of the selected entry.
 type webserver struct {
-	w http.ResponseWriter
+	c      *Command
+	n      string
+	mutex  sync.Mutex
+	users  map[string]string // basic auth: user to password or sha256:HEX
+	tokens []string          // bearer tokens
+	secret []byte            // of CSRF tokens
+}
+
+// webio is the cli stdio of menu scripts; its output is shown with the
+// results.
+type webio struct {
+	bytes.Buffer
 }
 
-func (ws *webserver) Read(p []byte) (n int, err error) {
+func (*webio) Read(p []byte) (n int, err error) {
 	return 0, io.EOF
 }
 
-func (ws *webserver) Write(p []byte) (n int, err error) {
-	s := strings.Replace(html.EscapeString(string(p)), "\n", "<br>", -1)
-	ret, err := ws.w.Write([]byte(s))
-	return ret, err
+// webEntry is a menu item of both HTML and JSON responses. Like grub, a
+// submenu's entries are only defined, and listed, once it's entered.
+type webEntry struct {
+	Index   int        `json:"index"`
+	Name    string     `json:"name"`
+	ID      string     `json:"id,omitempty"`
+	Path    string     `json:"path"`
+	Submenu []webEntry `json:"submenu,omitempty"`
+}
+
+// webBoot is what a selected entry would kexec.
+type webBoot struct {
+	Path    string   `json:"path"`
+	Chosen  string   `json:"chosen"`
+	Kernel  string   `json:"kernel"`
+	Initrd  string   `json:"initrd,omitempty"`
+	Cmdline string   `json:"cmdline"`
+	Kexec   []string `json:"kexec"`
+	Output  string   `json:"output,omitempty"`
+	CSRF    string   `json:"csrf,omitempty"`
 }
 
-func (c *Command) serveKexecMenu(w http.ResponseWriter, r *http.Request) {
-	io.WriteString(w, `<html>`)
-	kexec := c.KexecCommand()
-	if len(kexec) == 0 {
-		fmt.Fprintf(w, "No kernel defined, did you bookmark this URL?<br>")
+type webPage struct {
+	Title   string
+	Error   string
+	Output  string
+	Up      string
+	Entries []webEntry
+	Boot    *webBoot
+	CSRF    string
+}
+
+var webTemplate = template.Must(template.New("grub").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if .Error}}
+<p><b>Error:</b> {{.Error}}</p>
+{{- end}}
+{{- if .Output}}
+<pre>{{.Output}}</pre>
+{{- end}}
+{{- if .Entries}}
+<ol start="0">
+{{- range .Entries}}
+<li><a href="/entry/{{.Path}}">{{.Name}}</a></li>
+{{- end}}
+</ol>
+{{- end}}
+{{- with .Boot}}
+<table>
+<tr><th align="left">Entry</th><td>{{.Chosen}}</td></tr>
+<tr><th align="left">Kernel</th><td>{{.Kernel}}</td></tr>
+<tr><th align="left">Initrd</th><td>{{.Initrd}}</td></tr>
+<tr><th align="left">Command line</th><td>{{.Cmdline}}</td></tr>
+</table>
+<form method="post" action="/boot/{{.Path}}">
+<input type="hidden" name="csrf" value="{{$.CSRF}}">
+<input type="submit" value="Boot">
+</form>
+{{- end}}
+{{- if .Up}}
+<p><a href="{{.Up}}">Back</a></p>
+{{- end}}
+</body>
+</html>
+`))
+
+// ServeMenus until the server fails. With --cert and --key, it serves
+// HTTPS. With --auth FILE, requests must have basic or bearer token
+// credentials listed in FILE as lines of:
+//
+//	basic USER PASSWORD
+//	basic USER sha256:HEX
+//	token TOKEN
+//
+// Without all of these, it only listens on loopback, by default
+// localhost:8080.
+func (c *Command) ServeMenus(n string, parm *parms.Parms) {
+	ws := &webserver{c: c, n: n}
+	ws.secret = make([]byte, 32)
+	if _, err := rand.Read(ws.secret); err != nil {
+		log.Print("csrf secret: ", err)
+		return
+	}
+	if fn := parm.ByName["--auth"]; len(fn) > 0 {
+		if err := ws.readAuth(fn); err != nil {
+			log.Print(err)
+			return
+		}
+	}
+	cert, key := parm.ByName["--cert"], parm.ByName["--key"]
+	if len(key) == 0 {
+		key = cert
+	}
+	listen := parm.ByName["--listen"]
+	if len(listen) == 0 {
+		listen = defaultListen
+	}
+	if len(cert) == 0 || ws.users == nil {
+		if !isLoopback(listen) {
+			log.Print(listen, ": ", ErrInsecure)
+			return
+		}
+		log.Print("warning: serving grub menus on ", listen,
+			" without TLS or authentication")
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", ws.handle(ws.serveRoot))
+	mux.HandleFunc("/entry/", ws.handle(ws.serveEntry))
+	mux.HandleFunc("/menu", ws.handle(ws.serveMenu))
+	mux.HandleFunc("/boot/", ws.handle(ws.serveBoot))
+	srv := &http.Server{
+		Addr:    listen,
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+	var err error
+	if len(cert) > 0 {
+		err = srv.ListenAndServeTLS(cert, key)
 	} else {
-		err := c.g.Main(kexec...)
-		if err != nil {
-			fmt.Fprintf(w, "Failed: %s<br>", html.EscapeString(err.Error()))
-		} else {
-			io.WriteString(w, "Success, so how do you see this?")
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
+		// cannot panic, because this probably is an intentional close
+		log.Printf("Httpserver: ListenAndServe() error: %s", err)
+	}
+}
+
+// isLoopback returns true if the listen address is that of a loopback
+// interface rather than any or all.
+func isLoopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (ws *webserver) readAuth(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ws.users = make(map[string]string)
+	scan := bufio.NewScanner(f)
+	for line := 1; scan.Scan(); line++ {
+		fields := strings.Fields(scan.Text())
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "#"):
+		case fields[0] == "basic" && len(fields) == 3:
+			ws.users[fields[1]] = fields[2]
+		case fields[0] == "token" && len(fields) == 2:
+			ws.tokens = append(ws.tokens, fields[1])
+		default:
+			return fmt.Errorf("%s:%d: invalid", fn, line)
 		}
 	}
-	io.WriteString(w, `</html>`)
+	if err = scan.Err(); err == nil &&
+		len(ws.users) == 0 && len(ws.tokens) == 0 {
+		err = fmt.Errorf("%s: no credentials", fn)
+	}
+	return err
 }
 
-func (c *Command) menuHtml(w http.ResponseWriter, m *menu.Menu, parent []int) {
-	mp := ""
-	sep := "?"
-	for _, i := range parent {
-		mp = mp + sep + "m=" + strconv.Itoa(i)
-		sep = "&"
+// authenticate returns the user, or an empty string for bearer tokens, of
+// an authorized request.
+func (ws *webserver) authenticate(r *http.Request) (string, error) {
+	if ws.users == nil && ws.tokens == nil {
+		return "", nil
 	}
-	if m != nil {
-		for i, v := range *(m.Entries) {
-			fmt.Fprintf(w, `<a href="%s%sm=%d">%s</a>
-<br>
-`, mp, sep, i, v.Name)
+	if s := r.Header.Get("Authorization"); strings.HasPrefix(s, "Bearer ") {
+		token := []byte(strings.TrimPrefix(s, "Bearer "))
+		for _, t := range ws.tokens {
+			if subtle.ConstantTimeCompare(token, []byte(t)) == 1 {
+				return "", nil
+			}
 		}
+		return "", ErrUnauthorized
 	}
-	k := c.KexecCommand()
-	if len(k) > 0 {
-		fmt.Fprintf(w, `<br><a href="kexec">Kexec command: %v</a><br>`, k)
+	user, pass, ok := r.BasicAuth()
+	want, found := ws.users[user]
+	if !ok || !found {
+		return "", ErrUnauthorized
 	}
+	if strings.HasPrefix(want, "sha256:") {
+		sum := sha256.Sum256([]byte(pass))
+		pass = "sha256:" + hex.EncodeToString(sum[:])
+		want = strings.ToLower(want)
+	}
+	if subtle.ConstantTimeCompare([]byte(pass), []byte(want)) != 1 {
+		return "", ErrUnauthorized
+	}
+	return user, nil
 }
 
-//		io.WriteString(w, `<html><img src=http://www.platinasystems.com/wp-content/uploads/2016/10/PLA-Logo-Final-01-1-1-300x36.png><br>`)
+// bearer returns true if the authenticated request has a token, which,
+// unlike basic credentials, a browser doesn't send on its own.
+func (ws *webserver) bearer(r *http.Request) bool {
+	return len(ws.tokens) > 0 &&
+		strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
 
-func (c *Command) serveRootMenu(n string, w http.ResponseWriter, r *http.Request) {
-	ws := &webserver{w: w}
-	Cli.Stdin = ws
-	Cli.Stdout = ws
-	Cli.Stderr = ws
+// csrf returns the token that a browser's boot request must include.
+func (ws *webserver) csrf(user string) string {
+	mac := hmac.New(sha256.New, ws.secret)
+	io.WriteString(mac, user)
+	return hex.EncodeToString(mac.Sum(nil))
+}
 
-	io.WriteString(w, `<html>`)
-	menuPath := r.URL.Query()["m"]
-	if menuPath == nil {
-		menuEntry.Reset()
-		if err := c.runScript(n); err != nil {
-			fmt.Fprintf(w, "Script returned error: %s<br>",
-				html.EscapeString(err.Error()))
-		} else {
-			c.menuHtml(w, menuEntry.R.RootMenu, nil)
-		}
-	} else {
-		mp := make([]int, len(menuPath))
-		err := error(nil)
-		for i := 0; i < len(menuPath); i++ {
-			mp[i], err = strconv.Atoi(menuPath[i])
-			if err != nil {
-				break
+type handler func(w http.ResponseWriter, r *http.Request, user string)
+
+// handle serializes authenticated requests since the menus and kernel
+// are global.
+func (ws *webserver) handle(h handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := ws.authenticate(r)
+		if err != nil {
+			if len(ws.users) > 0 {
+				w.Header().Set("WWW-Authenticate",
+					`Basic realm="grub", charset="UTF-8"`)
 			}
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
 		}
+		ws.mutex.Lock()
+		defer ws.mutex.Unlock()
+		h(w, r, user)
+	}
+}
+
+func wantJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func (ws *webserver) reply(w http.ResponseWriter, r *http.Request, status int,
+	v interface{}, page *webPage) {
+	if wantJSON(r) || page == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	if len(page.Title) == 0 {
+		page.Title = "grub " + ws.n
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	webTemplate.Execute(w, page)
+}
+
+func (ws *webserver) fail(w http.ResponseWriter, r *http.Request, status int,
+	err error, output string) {
+	ws.reply(w, r, status, map[string]string{
+		"error":  err.Error(),
+		"output": output,
+	}, &webPage{Error: err.Error(), Output: output, Up: "/"})
+}
+
+// reload runs the script again to define fresh menus.
+func (ws *webserver) reload() (*menu.Menu, string, error) {
+	out := &webio{}
+	Cli.Stdin = out
+	Cli.Stdout = out
+	Cli.Stderr = out
+	menuEntry.Reset()
+	Linux.Kern, Linux.Cmd, Linux.Resolved = "", nil, false
+	Initrd.Initrd = ""
+	err := ws.c.load(ws.n)
+	return menuEntry.R.RootMenu, out.String(), err
+}
+
+// entries returns the menu tree below the given path.
+func entries(m *menu.Menu, path string) []webEntry {
+	if m == nil {
+		return nil
+	}
+	l := make([]webEntry, 0, len(*m.Entries))
+	for i, e := range *m.Entries {
+		p := strconv.Itoa(i)
+		if len(path) > 0 {
+			p = path + "/" + p
+		}
+		l = append(l, webEntry{
+			Index:   i,
+			Name:    e.Name,
+			ID:      e.ID,
+			Path:    p,
+			Submenu: entries(e.Submenu, p),
+		})
+	}
+	return l
+}
+
+// selectPath reloads the menus then runs each entry of the path, like
+// RunMenu, returning the last.
+func (ws *webserver) selectPath(path string) (*menu.Entry, string, error) {
+	m, output, err := ws.reload()
+	if err != nil {
+		return nil, output, err
+	}
+	var e *menu.Entry
+	var chosen []string
+	out := &webio{}
+	for _, s := range strings.Split(strings.Trim(path, "/"), "/") {
+		i, err := strconv.Atoi(s)
+		if m == nil || err != nil || i < 0 || i >= len(*m.Entries) {
+			return nil, output, fmt.Errorf("%s: %w", path,
+				menu.ErrMenuNotFound)
+		}
+		e = &(*m.Entries)[i]
+		chosen = append(chosen, e.Name)
+		Goes.EnvMap["chosen"] = strings.Join(chosen, ">")
+		err = e.RunFun(out, out, out)
+		output += out.String()
+		out.Reset()
 		if err != nil {
-			fmt.Fprintf(w, "Error parsing menu path: %s</br>",
-				html.EscapeString(err.Error()))
-		} else {
-			e, err := menuEntry.FindEntry(mp...)
-			if err != nil {
-				fmt.Fprintf(w, "Error finding menu path %v: %s</br>",
-					mp, err)
-			} else {
-				if err := e.RunFun(ws, ws, ws); err != nil {
-					fmt.Fprintf(w, "Menu returned error: %s</br>",
-						html.EscapeString(err.Error()))
-				} else {
-					c.menuHtml(w, e.Submenu, mp)
-				}
-			}
+			return nil, output, err
 		}
+		m = e.Submenu
 	}
-	io.WriteString(w, `</html>`)
+	return e, output, nil
 }
 
-func (c *Command) ServeMenus(n string) {
-	srv := &http.Server{Addr: ":8080"}
-	mutex := &sync.Mutex{}
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		mutex.Lock()
-		defer mutex.Unlock()
-		if r.URL.Path == "/" {
-			c.serveRootMenu(n, w, r)
-			return
+// boot returns what the selected entry would kexec.
+func (ws *webserver) boot(path, output, user string) *webBoot {
+	b := &webBoot{
+		Path:   path,
+		Chosen: Goes.EnvMap["chosen"],
+		Kexec:  ws.c.KexecCommand(),
+		Output: output,
+		CSRF:   ws.csrf(user),
+	}
+	for i := 1; i+1 < len(b.Kexec); i++ {
+		switch b.Kexec[i] {
+		case "-k":
+			b.Kernel = b.Kexec[i+1]
+		case "-i":
+			b.Initrd = b.Kexec[i+1]
+		case "-c":
+			b.Cmdline = b.Kexec[i+1]
+		}
+	}
+	return b
+}
+
+func (ws *webserver) serveRoot(w http.ResponseWriter, r *http.Request,
+	user string) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	m, output, err := ws.reload()
+	if err != nil {
+		ws.fail(w, r, http.StatusInternalServerError, err, output)
+		return
+	}
+	ws.reply(w, r, http.StatusOK, entries(m, ""), &webPage{
+		Output:  output,
+		Entries: entries(m, ""),
+	})
+}
+
+// serveMenu returns the JSON menu tree.
+func (ws *webserver) serveMenu(w http.ResponseWriter, r *http.Request,
+	user string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m, output, err := ws.reload()
+	if err != nil {
+		ws.fail(w, r, http.StatusInternalServerError, err, output)
+		return
+	}
+	ws.reply(w, r, http.StatusOK, struct {
+		Default string     `json:"default,omitempty"`
+		Entries []webEntry `json:"entries"`
+		CSRF    string     `json:"csrf"`
+	}{Goes.EnvMap["default"], entries(m, ""), ws.csrf(user)}, nil)
+}
+
+// serveEntry shows a submenu or what the entry would boot with a form to
+// confirm.
+func (ws *webserver) serveEntry(w http.ResponseWriter, r *http.Request,
+	user string) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/entry/"), "/")
+	e, output, err := ws.selectPath(path)
+	if err != nil {
+		ws.fail(w, r, http.StatusNotFound, err, output)
+		return
+	}
+	up := "/"
+	if i := strings.LastIndex(path, "/"); i > 0 {
+		up = "/entry/" + path[:i]
+	}
+	page := &webPage{
+		Title:  e.Name,
+		Output: output,
+		Up:     up,
+		CSRF:   ws.csrf(user),
+	}
+	if e.Submenu != nil {
+		page.Entries = entries(e.Submenu, path)
+		ws.reply(w, r, http.StatusOK, page.Entries, page)
+		return
+	}
+	b := ws.boot(path, output, user)
+	if len(Linux.Kern) > 0 {
+		page.Boot = b
+	}
+	ws.reply(w, r, http.StatusOK, b, page)
+}
+
+// serveBoot returns, with GET, or kexecs, with POST, the kernel of the
+// selected entry. Except with bearer tokens, a POST must have the CSRF
+// token of the menu or preview as a form value or X-CSRF-Token header.
+func (ws *webserver) serveBoot(w http.ResponseWriter, r *http.Request,
+	user string) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/boot/"), "/")
+	switch r.Method {
+	case http.MethodGet, http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodPost && !ws.bearer(r) {
+		token := r.Header.Get(csrfHeader)
+		if len(token) == 0 {
+			token = r.PostFormValue(csrfField)
 		}
-		if r.URL.Path == "/kexec" {
-			c.serveKexecMenu(w, r)
+		if !hmac.Equal([]byte(token), []byte(ws.csrf(user))) {
+			ws.fail(w, r, http.StatusForbidden, ErrBadCSRF, "")
 			return
 		}
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-	})
-	if err := srv.ListenAndServe(); err != nil {
-		// cannot panic, because this probably is an intentional close
-		log.Printf("Httpserver: ListenAndServe() error: %s", err)
 	}
+	e, output, err := ws.selectPath(path)
+	if err != nil {
+		ws.fail(w, r, http.StatusNotFound, err, output)
+		return
+	}
+	if e.Submenu != nil || len(Linux.Kern) == 0 {
+		ws.fail(w, r, http.StatusBadRequest, ErrNoDefinedKernelOrMenus,
+			output)
+		return
+	}
+	b := ws.boot(path, output, user)
+	page := &webPage{Title: e.Name, Output: output, Up: "/"}
+	if r.Method == http.MethodGet {
+		page.Boot, page.CSRF = b, b.CSRF
+		ws.reply(w, r, http.StatusOK, b, page)
+		return
+	}
+	log.Printf("grub: %s booting %q: %v", r.RemoteAddr, b.Chosen, b.Kexec)
+	ws.c.recordBoot()
+	if err = ws.c.g.Main(b.Kexec...); err != nil {
+		ws.fail(w, r, http.StatusInternalServerError, err, output)
+		return
+	}
+	page.Output = "Success, so how do you see this?"
+	ws.reply(w, r, http.StatusOK, b, page)
 }
@@ -0,0 +1,127 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// +build !nowebserver,!bootrom
+
+package grub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWebserver(t *testing.T) {
+	r, _ := os.Getwd()
+	Goes.EnvMap = nil
+	ws := &webserver{
+		c:      &Command{g: Goes, root: r},
+		n:      "testdata/menu.grub",
+		users:  map[string]string{"admin": "secret"},
+		tokens: []string{"t0ken"},
+		secret: []byte("test"),
+	}
+	do := func(h handler, method, target string, body url.Values,
+		header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		var req *http.Request
+		if body != nil {
+			req = httptest.NewRequest(method, target,
+				strings.NewReader(body.Encode()))
+			req.Header.Set("Content-Type",
+				"application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(method, target, nil)
+		}
+		if header != nil {
+			req.SetBasicAuth("admin", "secret")
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		ws.handle(h)(w, req)
+		return w
+	}
+
+	if w := do(ws.serveMenu, "GET", "/menu", nil); w.Code != 401 {
+		t.Error("unauthenticated", w.Code)
+	}
+
+	w := do(ws.serveMenu, "GET", "/menu", nil, "Accept", "application/json")
+	var menu struct {
+		Entries []webEntry
+		CSRF    string
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &menu); err != nil {
+		t.Fatal(err, w.Body)
+	}
+	if len(menu.Entries) != 2 || menu.Entries[0].ID != "linux" ||
+		menu.CSRF != ws.csrf("admin") {
+		t.Fatalf("unexpected %s", w.Body)
+	}
+
+	// submenus are defined as they're entered
+	w = do(ws.serveEntry, "GET", "/entry/1", nil,
+		"Accept", "application/json")
+	var submenu []webEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &submenu); err != nil {
+		t.Fatal(err, w.Body)
+	}
+	if len(submenu) != 1 || submenu[0].Path != "1/0" {
+		t.Fatalf("unexpected %s", w.Body)
+	}
+
+	w = do(ws.serveBoot, "GET", "/boot/1/0", nil,
+		"Accept", "application/json")
+	var boot webBoot
+	if err := json.Unmarshal(w.Body.Bytes(), &boot); err != nil {
+		t.Fatal(err, w.Body)
+	}
+	if boot.Kernel != r+"/vmlinuz" || boot.Initrd != r+"/initrd.img" ||
+		boot.Cmdline != "root=/dev/sda1 single console=ttyS0,115200n8" ||
+		boot.Chosen != "Advanced options>Linux (recovery mode)" {
+		t.Errorf("unexpected %+v", boot)
+	}
+
+	w = do(ws.serveEntry, "GET", "/entry/0", nil, "Accept", "text/html")
+	if s := w.Body.String(); w.Code != 200 ||
+		!strings.Contains(s, "console=ttyS1,115200") ||
+		!strings.Contains(s, `action="/boot/0"`) ||
+		!strings.Contains(s, ws.csrf("admin")) {
+		t.Errorf("unexpected %d %s", w.Code, s)
+	}
+
+	w = do(ws.serveBoot, "POST", "/boot/0", url.Values{"csrf": {"bad"}},
+		"Accept", "text/html")
+	if w.Code != http.StatusForbidden {
+		t.Error("CSRF", w.Code)
+	}
+	w = do(ws.serveBoot, "POST", "/boot/9", nil,
+		"Authorization", "Bearer t0ken")
+	if w.Code != http.StatusNotFound {
+		t.Error("bearer", w.Code, w.Body)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for listen, want := range map[string]bool{
+		defaultListen:    true,
+		"127.0.0.1:8080": true,
+		"[::1]:8080":     true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.1:8080":  false,
+		"example:8080":   false,
+		"localhost":      false,
+	} {
+		if got := isLoopback(listen); got != want {
+			t.Errorf("%s: got %v, want %v", listen, got, want)
+		}
+	}
+}
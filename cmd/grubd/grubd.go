@@ -5,6 +5,7 @@
 package grubd
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -12,21 +13,27 @@ import (
 	"sort"
 	"time"
 
+	redigo "github.com/garyburd/redigo/redis"
 	"github.com/platinasystems/goes"
 	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/cmd/grub/bootentry"
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
+	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/external/redis/publisher"
 	"github.com/platinasystems/goes/lang"
 )
 
 type Command struct {
 	g      *goes.Goes
 	mounts []*bootMnt
+	pub    *publisher.Publisher
 }
 
 type bootMnt struct {
-	mnt     string
-	dir     string
-	err     error
-	hasGrub bool
+	mnt string
+	dir string
+	err error
+	cfg string // grub.cfg or other boot configuration
 }
 
 func (*Command) String() string { return "grubd" }
@@ -57,7 +64,15 @@ func (c *Command) Main(args ...string) (err error) {
 	}
 	t := time.NewTicker(30 * time.Second)
 	defer t.Stop()
+	rescan := watchMounts()
+	restart := make(chan struct{}, 1)
+	if c.pub, err = publisher.New(); err == nil {
+		defer c.pub.Close()
+	} else {
+		c.pub = nil
+	}
 
+scan:
 	for {
 		dirs, err := ioutil.ReadDir(mp)
 		if err != nil {
@@ -87,13 +102,13 @@ func (c *Command) Main(args ...string) (err error) {
 		sort.Slice(c.mounts, func(i, j int) bool {
 			return c.mounts[i].mnt > c.mounts[j].mnt
 		})
+		c.publish()
 
 		for _, m := range c.mounts {
-			if m.hasGrub {
+			if len(m.cfg) > 0 {
 				done := make(chan struct{}, 1)
 				args := []string{"grub", "--daemon"}
-				args = append(args, m.mnt,
-					filepath.Join(m.dir, "grub/grub.cfg"))
+				args = append(args, m.mnt, m.cfg)
 				fmt.Printf("%v\n", args)
 				x := c.g.Fork(args...)
 				x.Stdin = os.Stdin
@@ -103,17 +118,18 @@ func (c *Command) Main(args ...string) (err error) {
 				goes.WG.Add(1)
 				go func() {
 					defer goes.WG.Done()
-					for {
-						select {
-						case <-done:
-							return
-						case <-goes.Stop:
-							p := x.Process
-							if p != nil {
-								p.Kill()
-							}
-							return
-						}
+					select {
+					case <-done:
+						return
+					case <-goes.Stop:
+					case <-rescan:
+						// a new filesystem may have boot
+						// entries
+						restart <- struct{}{}
+					}
+					p := x.Process
+					if p != nil {
+						p.Kill()
 					}
 				}()
 				err := x.Run()
@@ -121,6 +137,12 @@ func (c *Command) Main(args ...string) (err error) {
 					fmt.Printf("grub returned %s\n", err)
 				}
 				close(done)
+				c.publish()
+				select {
+				case <-restart:
+					continue scan
+				default:
+				}
 			}
 		}
 
@@ -128,29 +150,73 @@ func (c *Command) Main(args ...string) (err error) {
 		case <-goes.Stop:
 			return nil
 		case <-t.C:
+		case <-rescan:
 		}
 	}
 }
 
-func (*Command) tryScanFiles(m *bootMnt, done chan *bootMnt) {
-	files, err := ioutil.ReadDir(filepath.Join(m.mnt, m.dir))
-	if err != nil {
-		m.err = err
-		done <- m
+// publish the boot configuration and grubenv state of each mount as
+// grubd.NAME[/DIR].config, .saved_entry, .next_entry, etc.
+func (c *Command) publish() {
+	if c.pub == nil {
 		return
 	}
+	c.pub.Print("delete: grubd.")
+	for _, m := range c.mounts {
+		if len(m.cfg) == 0 {
+			continue
+		}
+		prefix := "grubd." + filepath.Join(filepath.Base(m.mnt), m.dir)
+		c.pub.Print(prefix, ".config: ", m.cfg)
+		env, _ := grubenv.Read(filepath.Join(m.mnt, grubenv.File(m.cfg)))
+		for _, k := range grubenv.Vars {
+			if v := env[k]; len(v) > 0 {
+				c.pub.Print(prefix, ".", k, ": ", v)
+			}
+		}
+	}
+}
 
-	for _, file := range files {
-		name := file.Name()
-		if file.Mode().IsDir() && name == "grub" {
-			if _, err := os.Stat(filepath.Join(m.mnt,
-				m.dir, "grub/grub.cfg")); err == nil {
-				m.hasGrub = true
-			} else {
-				fmt.Printf("os.stat err %s\n", err)
+// watchMounts returns a channel that's signaled as mountd publishes new
+// mounts; it's never signaled if redis isn't available.
+func watchMounts() <-chan struct{} {
+	rescan := make(chan struct{}, 1)
+	psc, err := redis.Subscribe(redis.DefaultHash)
+	if err != nil {
+		return rescan
+	}
+	goes.WG.Add(1)
+	go func() {
+		defer goes.WG.Done()
+		<-goes.Stop
+		psc.Close()
+	}()
+	go func() {
+		for {
+			switch t := psc.Receive().(type) {
+			case redigo.Message:
+				if bytes.HasPrefix(t.Data, []byte("mountd.")) &&
+					bytes.Contains(t.Data, []byte(".dir: ")) {
+					select {
+					case rescan <- struct{}{}:
+					default:
+					}
+				}
+			case error:
+				return
 			}
-			continue
 		}
+	}()
+	return rescan
+}
+
+func (*Command) tryScanFiles(m *bootMnt, done chan *bootMnt) {
+	if _, err := os.Stat(filepath.Join(m.mnt, m.dir)); err != nil {
+		m.err = err
+		done <- m
+		return
 	}
+
+	m.cfg = bootentry.Find(m.mnt, m.dir)
 	done <- m
 }
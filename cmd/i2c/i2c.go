@@ -20,6 +20,8 @@ func (Command) String() string { return "i2c" }
 func (Command) Usage() string {
 	return `
 i2c [EEPROM][BLOCK] BUS.ADDR[.BEGIN][-END, -CNT][/8][/16] [VALUE] [WR-DELAY-SEC]
+i2c [EEPROM][BLOCK] BUS/MUX:CHANNEL[/...]/ADDR[.BEGIN]... [VALUE] [WR-DELAY-SEC]
+i2c detect BUS[/MUX:CHANNEL]...
 `
 }
 
@@ -45,7 +47,15 @@ DESCRIPTION
             i2c 0.76/8             force reads at 8-bits
             i2c 0.76.0/8           force reads at 8-bits
 	    i2c 0.55.0-30/8        reads 0x0-0x30 8-bits at a time
-	    i2c 0.55.0-30/16       reads 0x0-0x30 16-bits at a time`,
+	    i2c 0.55.0-30/16       reads 0x0-0x30 16-bits at a time
+	    i2c 0/70:3/50.0-30     reads 0x0-0x30 of the device behind
+	                           channel 3 of the mux at 0x70
+	    i2c detect 0           lists the devices of bus 0 and behind
+	                           the channels of its PCA954x muxes
+	    i2c detect 0/70:3      lists those behind channel 3
+
+	The mux channels are selected in the same i2cd transaction as the
+	device access then deselected.`,
 	}
 }
 
@@ -70,52 +80,46 @@ func (Command) Main(args ...string) error {
 	if args[0] == "BLOCK" {
 		block, args = 1, args[1:]
 	}
-	if args[0] == "STOP" {
-		sd[0] = 0
-		j[0] = I{true, i2c.Write, 0, 0, sd, int(0x99), int(1), 0}
-		err := DoI2cRpc()
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-	if args[0] == "START" {
-		sd[0] = 0
-		j[0] = I{true, i2c.Write, 0, 0, sd, int(0x99), int(0), 0}
-		err := DoI2cRpc()
-		if err != nil {
-			return err
+	switch args[0] {
+	case "detect":
+		if len(args) != 2 {
+			return fmt.Errorf("BUS: missing")
 		}
-		return nil
-	}
-	if args[0] == "READ" {
-		sd[0] = 0
-		j[0] = I{true, i2c.Write, 0, 0, sd, int(0x98), int(0), 0}
-		err := DoI2cRpc()
+		return detect(args[1])
+	case "STOP":
+		return setStopped(true)
+	case "START":
+		return setStopped(false)
+	case "READ":
+		stop, err := stopped()
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Stop polling bit is 0x%x\n", s[0].D[0])
+		fmt.Printf("Stop polling is %v\n", stop)
 		return nil
 	}
 
 	dValid := len(args) > 1
 
+	spec, err := muxPath(args[0])
+	if err != nil {
+		return err
+	}
 	nc := 2
 	w = 0
-	_, err := fmt.Sscanf(args[0], "%x.%x.%x-%x/%d", &b, &a, &cs[0], &cs[1], &w)
+	_, err = fmt.Sscanf(spec, "%x.%x.%x-%x/%d", &b, &a, &cs[0], &cs[1], &w)
 	if err != nil {
-		_, err = fmt.Sscanf(args[0], "%x.%x.%x-%x", &b, &a, &cs[0], &cs[1])
+		_, err = fmt.Sscanf(spec, "%x.%x.%x-%x", &b, &a, &cs[0], &cs[1])
 		if err != nil {
 			nc = 1
-			_, err = fmt.Sscanf(args[0], "%x.%x.%x/%d", &b, &a, &cs[0], &w)
+			_, err = fmt.Sscanf(spec, "%x.%x.%x/%d", &b, &a, &cs[0], &w)
 			if err != nil {
-				_, err = fmt.Sscanf(args[0], "%x.%x.%x", &b, &a, &cs[0])
+				_, err = fmt.Sscanf(spec, "%x.%x.%x", &b, &a, &cs[0])
 				if err != nil {
 					nc = 0
-					_, err = fmt.Sscanf(args[0], "%x.%x/%d", &b, &a, &w)
+					_, err = fmt.Sscanf(spec, "%x.%x/%d", &b, &a, &w)
 					if err != nil {
-						_, err = fmt.Sscanf(args[0], "%x.%x", &b, &a)
+						_, err = fmt.Sscanf(spec, "%x.%x", &b, &a)
 					}
 				}
 			}
@@ -1,15 +1,16 @@
-// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
 // Use of this source code is governed by the GPL-2 license described in the
 // LICENSE file.
 
-// Package ucd9090 provides access to the UCD9090 Power Sequencer/Monitor chip
 package i2c
 
 import (
-	"net/rpc"
-	"unsafe"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/platinasystems/goes/external/i2c"
+	"github.com/platinasystems/goes/external/i2creq"
 	"github.com/platinasystems/goes/external/log"
 )
 
@@ -30,8 +31,6 @@ type R struct {
 	E error
 }
 
-type I2cReq int
-
 var b = [i2c.BlockMax]byte{0}
 var i = I{false, i2c.RW(0), 0, 0, b, 0, 0, 0}
 var j [MAXOPS]I
@@ -39,12 +38,10 @@ var r = R{b, nil}
 var s [MAXOPS]R
 var x int
 
-var dummy byte
-var regsPointer = unsafe.Pointer(&dummy)
-var regsAddr = uintptr(unsafe.Pointer(&dummy))
+var client *i2creq.Client
 
-var clientA *rpc.Client
-var dialed int = 0
+// mux channels to select before, and deselect after, the ops of j
+var mux []i2c.Hop
 
 func clearJ() {
 	x = 0
@@ -53,21 +50,143 @@ func clearJ() {
 	}
 }
 
-func DoI2cRpc() error {
-	if dialed == 0 {
-		client, err := rpc.DialHTTP("tcp", "127.0.0.1"+":1233")
+func dial() (*i2creq.Client, error) {
+	if client == nil {
+		cl, err := i2creq.Dial()
 		if err != nil {
 			log.Print("dialing:", err)
-			return err
+			return nil, err
+		}
+		client = cl
+	}
+	return client, nil
+}
+
+// DoI2cRpc does the ops in use of j as a transaction of i2cd and sets the
+// data of the corresponding s. The mux channels are deselected even if an
+// op fails.
+func DoI2cRpc() error {
+	defer clearJ()
+	cl, err := dial()
+	if err != nil {
+		return err
+	}
+	tx := new(i2creq.Tx)
+	bus := -1
+	for k := range j {
+		if !j[k].InUse {
+			continue
+		}
+		if bus < 0 {
+			bus = j[k].Bus
+			tx.Ops = append(tx.Ops, selectOps(bus, mux, false)...)
 		}
-		clientA = client
-		dialed = 1
+		tx.Ops = append(tx.Ops, i2creq.Op{
+			Bus:     j[k].Bus,
+			Addr:    j[k].Addr,
+			RW:      j[k].RW,
+			Command: j[k].RegOffset,
+			Size:    j[k].BusSize,
+			Data:    j[k].Data,
+			Delay:   time.Duration(j[k].Delay) * time.Millisecond,
+		})
 	}
-	err := clientA.Call("I2cReq.ReadWrite", &j, &s)
+	if bus >= 0 {
+		tx.Finally = selectOps(bus, mux, true)
+	}
+	reply, err := cl.Do(tx)
 	if err != nil {
 		log.Print("i2cReq error:", err)
 		return err
 	}
-	clearJ()
+	n := len(mux)
+	for k := range j {
+		if j[k].InUse {
+			s[k].D = reply.Data[n]
+			n++
+		}
+	}
+	return nil
+}
+
+// selectOps returns those that select, or deselect, the mux channels.
+func selectOps(bus int, hops []i2c.Hop, deselect bool) []i2creq.Op {
+	ops := make([]i2creq.Op, len(hops))
+	for i, hop := range hops {
+		op := i2creq.Op{
+			Bus:     bus,
+			Addr:    hop.Addr,
+			RW:      i2c.Write,
+			Command: hop.Mask(),
+			Size:    i2c.Byte,
+		}
+		if deselect {
+			op.Command = 0
+			ops[len(hops)-1-i] = op
+		} else {
+			ops[i] = op
+		}
+	}
+	return ops
+}
+
+// muxPath sets the mux channels of BUS/MUX:CHANNEL[/...]/ADDR... and
+// returns BUS.ADDR... for the flat bus parser.
+func muxPath(s string) (string, error) {
+	mux = nil
+	l := strings.Split(s, "/")
+	k := -1
+	for i, e := range l {
+		if strings.IndexByte(e, ':') >= 0 {
+			k = i
+		}
+	}
+	if k < 0 {
+		return s, nil
+	}
+	p, err := i2c.ParseHexPath(strings.Join(l[:k+1], "/") + "/0")
+	if err != nil {
+		return "", err
+	}
+	if k+1 == len(l) {
+		return "", fmt.Errorf("%s: ADDR: missing", s)
+	}
+	mux = p.Mux
+	return l[0] + "." + strings.Join(l[k+1:], "/"), nil
+}
+
+// detect lists the devices that respond on the bus and behind its muxes.
+// Each probe locks the bus, as does i2cd for its transactions, lest
+// another switch the muxes between selection and access.
+func detect(s string) error {
+	p, err := i2c.ParseHexPath(s + "/0")
+	if err != nil {
+		return err
+	}
+	var bus i2c.Bus
+	if err = bus.Open(p.Bus); err != nil {
+		return err
+	}
+	defer bus.Close()
+	i2c.Detect(&bus, p, func(p i2c.Path) {
+		fmt.Println(p)
+	})
 	return nil
 }
+
+// setStopped pauses, or resumes, the polling of other daemons.
+func setStopped(stopped bool) error {
+	cl, err := dial()
+	if err != nil {
+		return err
+	}
+	return cl.SetStopped(stopped)
+}
+
+func stopped() (bool, error) {
+	cl, err := dial()
+	if err != nil {
+		return false, err
+	}
+	return cl.Stopped()
+}
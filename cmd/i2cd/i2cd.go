@@ -1,31 +1,46 @@
-// Copyright © 2015-2020 Platina Systems, Inc. All rights reserved.
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
 // Use of this source code is governed by the GPL-2 license described in the
 // LICENSE file.
 
-// Package ucd9090 provides access to the UCD9090 Power Sequencer/Monitor chip
+// Package i2cd serves the i2c transactions of other daemons and commands
+// through the @i2cd unix socket and, optionally, an authenticated TCP port.
 package i2cd
 
 import (
-	"net/http"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/rpc"
-	"sync"
+	"os"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/platinasystems/goes"
 	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/atsock"
+	"github.com/platinasystems/goes/external/flags"
 	"github.com/platinasystems/goes/external/i2c"
+	"github.com/platinasystems/goes/external/i2creq"
 	"github.com/platinasystems/goes/external/log"
+	"github.com/platinasystems/goes/external/parms"
 	"github.com/platinasystems/goes/external/redis"
+	"github.com/platinasystems/goes/external/redis/publisher"
 	"github.com/platinasystems/goes/lang"
 	"github.com/platinasystems/gpio"
 	"github.com/platinasystems/ioport"
 )
 
+// PublishInterval is the period of the published statistics.
+const PublishInterval = 5 * time.Second
+
 type Command struct{}
 
 func (Command) String() string { return "i2cd" }
 
-func (Command) Usage() string { return "i2cd" }
+func (Command) Usage() string { return "i2cd [-legacy] [-tcp ADDR -token FILE]" }
 
 func (Command) Apropos() lang.Alt {
 	return lang.Alt{
@@ -33,147 +48,242 @@ func (Command) Apropos() lang.Alt {
 	}
 }
 
-func (Command) Kind() cmd.Kind { return cmd.Daemon }
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Serve the i2c transactions of other daemons and commands through the
+	@i2cd unix socket to clients of root or the i2cd user.
+
+	Each transaction is a list of SMBus ops that have exclusive use of
+	their buses until complete. A client waits up to the transaction
+	timeout, default 5s, for buses in use by others. With rollback, the
+	byte and word data registers written by a transaction are restored
+	if a later op fails.
 
-func (c Command) Main(...string) error {
-	i2cReq := &I2cReq{c}
-	rpc.Register(i2cReq)
-	rpc.HandleHTTP()
-	srv := http.Server{
-		Addr: ":1233",
+	The transactions, ops, errors and timeouts of each client and the
+	ops and errors of each bus are published as:
+		i2cd.client.NAME.{tx,ops,errors,timeouts}
+		i2cd.bus.N.{ops,errors}
+
+	The deprecated I2cReq.ReadWrite rpc of HTTP port 1233 remains, as a
+	wrapper of these transactions, until its clients have migrated.
+	Since its clients don't authenticate, it's only served with -legacy
+	and only on the loopback address.
+
+OPTIONS
+	-legacy	serve I2cReq.ReadWrite on ` + LegacyAddr + `
+	-tcp ADDR	also listen on this TCP address
+	-token FILE	the secret that TCP clients must present`,
 	}
-	goes.WG.Add(1)
-	go func() {
-		defer goes.WG.Done()
-		srv.ListenAndServe()
-	}()
+}
+
+func (Command) Kind() cmd.Kind { return cmd.Daemon }
 
+func (c Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-legacy")
+	parm, args := parms.New(args, "-tcp", "-token")
+	if len(args) > 0 {
+		return fmt.Errorf("%v: unexpected", args)
+	}
+	s := newServer(smbus)
+	s.reset = resetMuxes
+	s.flock = flock
+	if fn := parm.ByName["-token"]; len(fn) > 0 {
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		s.token = strings.TrimSpace(string(b))
+	}
+	tcp := parm.ByName["-tcp"]
+	if len(tcp) > 0 && len(s.token) == 0 {
+		return fmt.Errorf("-tcp: requires -token")
+	}
+	ln, err := atsock.Listen(i2creq.Name)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	go s.serve(ln, true)
+	if len(tcp) > 0 {
+		tln, err := net.Listen("tcp", tcp)
+		if err != nil {
+			return err
+		}
+		defer tln.Close()
+		go s.serve(tln, false)
+	}
+	if flag.ByName["-legacy"] {
+		legacy := s.serveLegacy(LegacyAddr)
+		defer legacy.Close()
+	}
+	pub, err := publisher.New()
+	if err != nil {
+		log.Print("err", "publisher: ", err)
+		pub = nil
+	} else {
+		defer pub.Close()
+	}
+	t := time.NewTicker(PublishInterval)
+	defer t.Stop()
 	for {
 		select {
 		case <-goes.Stop:
-			srv.Close()
 			return nil
+		case <-t.C:
+			if pub != nil {
+				s.publish(pub)
+			}
 		}
 	}
 }
 
-const MAXOPS = 30
-
-type I struct {
-	InUse     bool
-	RW        i2c.RW
-	RegOffset uint8
-	BusSize   i2c.SMBusSize
-	Data      [i2c.BlockMax]byte
-	Bus       int
-	Addr      int
-	Delay     int
+// serve each connection with its own rpc server so that a TCP client
+// must authenticate before its first transaction.
+func (s *server) serve(ln net.Listener, local bool) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		if local && !peerAllowed(conn) {
+			log.Print("err", "i2cd: ", ErrPeer)
+			conn.Close()
+			continue
+		}
+		srv := rpc.NewServer()
+		srv.RegisterName("I2c", &I2c{s: s, authed: local})
+		go srv.ServeConn(conn)
+	}
 }
-type R struct {
-	D [i2c.BlockMax]byte
-	E error
+
+var ErrPeer = fmt.Errorf("unix peer %w", i2creq.ErrDenied)
+
+// peerAllowed is true for unix socket clients of root or the i2cd user.
+func peerAllowed(conn net.Conn) bool {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return false
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var cred *syscall.Ucred
+	cerr := raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd),
+			syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if cerr != nil || err != nil {
+		return false
+	}
+	return cred.Uid == 0 || int(cred.Uid) == os.Getuid()
 }
 
-type I2cReq struct {
-	c Command
+// I2c is the rpc service of a connection.
+type I2c struct {
+	s      *server
+	authed bool
 }
 
-var b = [i2c.BlockMax]byte{0}
-var i = I{false, i2c.RW(0), 0, 0, b, 0, 0, 0}
-var j [MAXOPS]I
-var r = R{b, nil}
-var s [MAXOPS]R
-var x int
-var stopped byte = 0
-var mutex = &sync.Mutex{}
+func (t *I2c) Auth(token string, ok *bool) error {
+	*ok = len(t.s.token) > 0 &&
+		subtle.ConstantTimeCompare([]byte(token),
+			[]byte(t.s.token)) == 1
+	if !*ok {
+		return i2creq.ErrDenied
+	}
+	t.authed = true
+	return nil
+}
 
-func (t *I2cReq) ReadWrite(g *[MAXOPS]I, f *[MAXOPS]R) error {
-	mutex.Lock()
-	defer mutex.Unlock()
+func (t *I2c) Do(tx *i2creq.Tx, reply *i2creq.Reply) error {
+	if !t.authed {
+		return i2creq.ErrDenied
+	}
+	if err := t.s.do(tx, reply); err != nil {
+		reply.Err = err.Error()
+	}
+	return nil
+}
 
-	var bus i2c.Bus
-	var data i2c.SMBusData
-	if g[0].Bus == 0x99 {
-		stopped = byte(g[0].Addr)
-		return nil
-	}
-	if g[0].Bus == 0x98 {
-		f[0].D[0] = stopped
-		return nil
-	}
-	for x := 0; x < MAXOPS; x++ {
-		if g[x].InUse == true {
-			err := bus.Open(g[x].Bus)
-			if err != nil {
-				log.Print("Error opening I2C bus")
-				return err
-			}
-			defer bus.Close()
+func (t *I2c) SetStopped(stopped bool, _ *bool) error {
+	if !t.authed {
+		return i2creq.ErrDenied
+	}
+	t.s.mutex.Lock()
+	defer t.s.mutex.Unlock()
+	t.s.stopped = stopped
+	return nil
+}
 
-			err = bus.ForceSlaveAddress(g[x].Addr)
-			if err != nil {
-				log.Print("ERR2")
-				log.Print("Error setting I2C slave address")
-				return err
-			}
-			data[0] = g[x].Data[0]
-			data[1] = g[x].Data[1]
-			data[2] = g[x].Data[2]
-			data[3] = g[x].Data[3]
-			err = bus.Do(g[x].RW, g[x].RegOffset, g[x].BusSize, &data)
-			if err != nil {
-				for y := 0; y < x; y++ {
-					log.Printf("I2C R/W before Error: bus 0x%x addr 0x%x offset 0x%x data 0x%x RW %d BusSize %d delay %d", g[y].Bus, g[y].Addr, g[y].RegOffset, g[y].Data[0], g[y].RW, g[y].BusSize, g[y].Delay)
-				}
-				log.Printf("Error doing I2C R/W: bus 0x%x addr 0x%x offset 0x%x data 0x%x RW %d BusSize %d delay %d", g[x].Bus, g[x].Addr, g[x].RegOffset, data[0], g[x].RW, g[x].BusSize, g[x].Delay)
-				m, _ := redis.Hget(redis.DefaultHash, "machine")
-
-				switch m {
-				case "platina-mk1":
-					d, err := ioport.Inb(0x603)
-					if err == nil {
-						ioport.Outb(0x603, d&0xb0)
-						time.Sleep(10 * time.Microsecond)
-						ioport.Outb(0x603, d|0x40)
-					}
-				case "platina-mk1-bmc":
-					pin, found := gpio.FindPin("FRU_I2C_MUX_RST_L")
-					if found {
-						pin.SetValue(false)
-						time.Sleep(10 * time.Microsecond)
-						pin.SetValue(true)
-					}
-
-					pin, found = gpio.FindPin("MAIN_I2C_MUX_RST_L")
-					if found {
-						pin.SetValue(false)
-						time.Sleep(10 * time.Microsecond)
-						pin.SetValue(true)
-					}
-				default:
-				}
-				return err
-			}
-			f[x].D[0] = data[0]
-			f[x].D[1] = data[1]
-			if g[x].BusSize == i2c.I2CBlockData {
-				for y := 2; y < i2c.BlockMax; y++ {
-					f[x].D[y] = data[y]
-				}
-			}
-			bus.Close()
-			if g[x].Delay > 0 {
-				time.Sleep(time.Duration(g[x].Delay) * time.Millisecond)
-			}
-		}
+func (t *I2c) Stopped(_ bool, stopped *bool) error {
+	if !t.authed {
+		return i2creq.ErrDenied
+	}
+	t.s.mutex.Lock()
+	defer t.s.mutex.Unlock()
+	*stopped = t.s.stopped
+	return nil
+}
+
+func (t *I2c) Stats(_ bool, m *map[string]i2creq.Stats) error {
+	if !t.authed {
+		return i2creq.ErrDenied
 	}
+	*m = t.s.clientStats()
 	return nil
 }
 
-func clearJS() {
-	x = 0
-	for k := 0; k < MAXOPS; k++ {
-		j[k] = i
-		s[k] = r
+// smbus does the op with /dev/i2c-N.
+func smbus(op *i2creq.Op) error {
+	var bus i2c.Bus
+	if err := bus.Open(op.Bus); err != nil {
+		return err
+	}
+	defer bus.Close()
+	if err := bus.ForceSlaveAddress(op.Addr); err != nil {
+		return err
+	}
+	return bus.Do(op.RW, op.Command, op.Size, &op.Data)
+}
+
+// flock returns the bus locked against others, e.g. sensord and i2c
+// detect, that switch its muxes with i2c.Path.Do.
+func flock(n int) (io.Closer, error) {
+	bus := new(i2c.Bus)
+	if err := bus.Open(n); err != nil {
+		return nil, err
+	}
+	if err := bus.Lock(); err != nil {
+		bus.Close()
+		return nil, err
+	}
+	return bus, nil
+}
+
+// resetMuxes after an error lest a mux be left stuck on a bad channel.
+func resetMuxes() {
+	m, _ := redis.Hget(redis.DefaultHash, "machine")
+	switch m {
+	case "platina-mk1":
+		d, err := ioport.Inb(0x603)
+		if err == nil {
+			ioport.Outb(0x603, d&0xb0)
+			time.Sleep(10 * time.Microsecond)
+			ioport.Outb(0x603, d|0x40)
+		}
+	case "platina-mk1-bmc":
+		for _, name := range []string{
+			"FRU_I2C_MUX_RST_L",
+			"MAIN_I2C_MUX_RST_L",
+		} {
+			if pin, found := gpio.FindPin(name); found {
+				pin.SetValue(false)
+				time.Sleep(10 * time.Microsecond)
+				pin.SetValue(true)
+			}
+		}
 	}
 }
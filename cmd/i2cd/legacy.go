@@ -0,0 +1,106 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package i2cd
+
+import (
+	"net/http"
+	"net/rpc"
+	"time"
+
+	"github.com/platinasystems/goes/external/i2c"
+	"github.com/platinasystems/goes/external/i2creq"
+)
+
+// LegacyAddr is that of the HTTP rpc endpoint of I2cReq.ReadWrite, with
+// -legacy. It's loopback only since its clients don't authenticate.
+//
+// Deprecated: clients should use i2creq.
+const LegacyAddr = "127.0.0.1:1233"
+
+const MAXOPS = 30
+
+// I is a legacy op; those with InUse are done in order.
+type I struct {
+	InUse     bool
+	RW        i2c.RW
+	RegOffset uint8
+	BusSize   i2c.SMBusSize
+	Data      [i2c.BlockMax]byte
+	Bus       int
+	Addr      int
+	Delay     int // milliseconds
+}
+
+// R is the result of the respective I.
+type R struct {
+	D [i2c.BlockMax]byte
+	E error
+}
+
+// I2cReq is the legacy rpc service.
+//
+// Deprecated: it's a wrapper of the i2creq transactions that remains
+// until its clients have migrated.
+type I2cReq struct {
+	s *server
+}
+
+// ReadWrite does the ops of g as one transaction. As before, an op of bus
+// 0x99 sets the stopped state to its addr and one of bus 0x98 returns
+// that in f[0].D[0].
+func (t *I2cReq) ReadWrite(g *[MAXOPS]I, f *[MAXOPS]R) error {
+	switch g[0].Bus {
+	case 0x99:
+		t.s.mutex.Lock()
+		t.s.stopped = g[0].Addr != 0
+		t.s.mutex.Unlock()
+		return nil
+	case 0x98:
+		t.s.mutex.Lock()
+		if t.s.stopped {
+			f[0].D[0] = 1
+		}
+		t.s.mutex.Unlock()
+		return nil
+	}
+	tx := &i2creq.Tx{Client: "legacy"}
+	var idx []int
+	for x := range g {
+		if !g[x].InUse {
+			continue
+		}
+		op := i2creq.Op{
+			Bus:     g[x].Bus,
+			Addr:    g[x].Addr,
+			RW:      g[x].RW,
+			Command: g[x].RegOffset,
+			Size:    g[x].BusSize,
+			Delay:   time.Duration(g[x].Delay) * time.Millisecond,
+		}
+		copy(op.Data[:], g[x].Data[:])
+		tx.Ops = append(tx.Ops, op)
+		idx = append(idx, x)
+	}
+	if len(tx.Ops) == 0 {
+		return nil
+	}
+	reply := new(i2creq.Reply)
+	if err := t.s.do(tx, reply); err != nil {
+		return err
+	}
+	for i, x := range idx {
+		copy(f[x].D[:], reply.Data[i][:])
+	}
+	return nil
+}
+
+// serveLegacy the I2cReq rpc over HTTP, as before i2creq.
+func (s *server) serveLegacy(addr string) *http.Server {
+	srv := rpc.NewServer()
+	srv.Register(&I2cReq{s})
+	hs := &http.Server{Addr: addr, Handler: srv}
+	go hs.ListenAndServe()
+	return hs
+}
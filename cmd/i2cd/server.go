@@ -0,0 +1,271 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package i2cd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/platinasystems/goes/external/i2c"
+	"github.com/platinasystems/goes/external/i2creq"
+	"github.com/platinasystems/goes/external/log"
+	"github.com/platinasystems/goes/external/redis/publisher"
+)
+
+type server struct {
+	// op does a single transfer; smbus but for tests.
+	op func(*i2creq.Op) error
+	// reset, if set, is called after a failed op.
+	reset func()
+	// flock, if set, locks a bus among processes, as does i2c.Path.Do,
+	// until closed.
+	flock func(bus int) (io.Closer, error)
+	token string
+
+	mutex   sync.Mutex
+	buses   map[int]chan struct{}
+	clients map[string]*i2creq.Stats
+	busOps  map[int]*i2creq.Stats
+	stopped bool
+	dirty   bool
+}
+
+func newServer(op func(*i2creq.Op) error) *server {
+	return &server{
+		op:      op,
+		buses:   make(map[int]chan struct{}),
+		clients: make(map[string]*i2creq.Stats),
+		busOps:  make(map[int]*i2creq.Stats),
+	}
+}
+
+// do the transaction with exclusive use of its buses.
+func (s *server) do(tx *i2creq.Tx, reply *i2creq.Reply) error {
+	reply.Failed = -1
+	if len(tx.Ops) == 0 {
+		return i2creq.ErrNoOps
+	}
+	timeout := tx.Timeout
+	if timeout <= 0 {
+		timeout = i2creq.DefaultTimeout
+	}
+	var buses []int
+	for _, op := range tx.Ops {
+		buses = append(buses, op.Bus)
+	}
+	for _, op := range tx.Finally {
+		buses = append(buses, op.Bus)
+	}
+	buses = uniq(buses)
+	s.count(tx.Client, func(st *i2creq.Stats) { st.Tx++ })
+	if err := s.lock(buses, timeout); err != nil {
+		s.count(tx.Client, func(st *i2creq.Stats) { st.Timeouts++ })
+		return err
+	}
+	defer s.unlock(buses)
+	if s.flock != nil {
+		for _, bus := range buses {
+			l, err := s.flock(bus)
+			if err != nil {
+				return err
+			}
+			defer l.Close()
+		}
+	}
+	defer s.finally(tx)
+
+	var undo []i2creq.Op
+	reply.Data = make([]i2c.SMBusData, len(tx.Ops))
+	for i := range tx.Ops {
+		op := tx.Ops[i]
+		prev, err := s.save(tx, &op)
+		if err == nil {
+			err = s.do1(tx.Client, &op)
+		}
+		if err == nil && prev != nil {
+			undo = append(undo, *prev)
+		}
+		if err != nil {
+			reply.Failed = i
+			log.Print("err", "i2cd: ", tx.Client, ": ", op.String(),
+				": ", err)
+			if s.reset != nil {
+				s.reset()
+			}
+			if len(undo) > 0 {
+				reply.RolledBack = s.rollback(tx.Client, undo)
+			}
+			return fmt.Errorf("op %d: %s: %w", i, op.String(), err)
+		}
+		reply.Data[i] = op.Data
+		if op.Delay > 0 {
+			time.Sleep(op.Delay)
+		}
+	}
+	return nil
+}
+
+// save returns an op to restore the register that the given op of a
+// rollback transaction would overwrite.
+func (s *server) save(tx *i2creq.Tx, op *i2creq.Op) (*i2creq.Op, error) {
+	if !tx.Rollback || op.RW != i2c.Write ||
+		(op.Size != i2c.ByteData && op.Size != i2c.WordData) {
+		return nil, nil
+	}
+	prev := *op
+	prev.RW = i2c.Read
+	prev.Data = i2c.SMBusData{}
+	prev.Delay = 0
+	if err := s.do1(tx.Client, &prev); err != nil {
+		return nil, err
+	}
+	prev.RW = i2c.Write
+	return &prev, nil
+}
+
+// rollback writes the saved registers in reverse order and returns true
+// if all were restored.
+func (s *server) rollback(client string, undo []i2creq.Op) bool {
+	ok := true
+	for i := len(undo) - 1; i >= 0; i-- {
+		if err := s.do1(client, &undo[i]); err != nil {
+			log.Print("err", "i2cd: ", client, ": rollback ",
+				undo[i].String(), ": ", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// finally does the Finally ops of tx after the others, or their failure
+// and rollback.
+func (s *server) finally(tx *i2creq.Tx) {
+	for i := range tx.Finally {
+		op := tx.Finally[i]
+		if err := s.do1(tx.Client, &op); err != nil {
+			log.Print("err", "i2cd: ", tx.Client, ": ", op.String(),
+				": ", err)
+		}
+	}
+}
+
+func (s *server) do1(client string, op *i2creq.Op) error {
+	err := s.op(op)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st := s.client(client)
+	bst := s.busOps[op.Bus]
+	if bst == nil {
+		bst = new(i2creq.Stats)
+		s.busOps[op.Bus] = bst
+	}
+	st.Ops++
+	bst.Ops++
+	if err != nil {
+		st.Errors++
+		bst.Errors++
+	}
+	s.dirty = true
+	return err
+}
+
+func (s *server) count(client string, f func(*i2creq.Stats)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f(s.client(client))
+	s.dirty = true
+}
+
+// client returns the stats of the named client; call with the mutex held.
+func (s *server) client(name string) *i2creq.Stats {
+	if len(name) == 0 {
+		name = "unknown"
+	}
+	st := s.clients[name]
+	if st == nil {
+		st = new(i2creq.Stats)
+		s.clients[name] = st
+	}
+	return st
+}
+
+func (s *server) clientStats() map[string]i2creq.Stats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	m := make(map[string]i2creq.Stats, len(s.clients))
+	for k, st := range s.clients {
+		m[k] = *st
+	}
+	return m
+}
+
+// lock the buses in ascending order, so that transactions of
+// overlapping buses can't deadlock, or return ErrBusy after timeout.
+func (s *server) lock(buses []int, timeout time.Duration) error {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for i, bus := range buses {
+		select {
+		case s.sem(bus) <- struct{}{}:
+		case <-t.C:
+			s.unlock(buses[:i])
+			return i2creq.ErrBusy
+		}
+	}
+	return nil
+}
+
+func (s *server) unlock(buses []int) {
+	for _, bus := range buses {
+		<-s.sem(bus)
+	}
+}
+
+func (s *server) sem(bus int) chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ch := s.buses[bus]
+	if ch == nil {
+		ch = make(chan struct{}, 1)
+		s.buses[bus] = ch
+	}
+	return ch
+}
+
+func (s *server) publish(pub *publisher.Publisher) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.dirty {
+		return
+	}
+	s.dirty = false
+	for name, st := range s.clients {
+		pfx := "i2cd.client." + name
+		pub.Print(pfx, ".tx: ", st.Tx)
+		pub.Print(pfx, ".ops: ", st.Ops)
+		pub.Print(pfx, ".errors: ", st.Errors)
+		pub.Print(pfx, ".timeouts: ", st.Timeouts)
+	}
+	for bus, st := range s.busOps {
+		pfx := fmt.Sprint("i2cd.bus.", bus)
+		pub.Print(pfx, ".ops: ", st.Ops)
+		pub.Print(pfx, ".errors: ", st.Errors)
+	}
+}
+
+func uniq(l []int) []int {
+	sort.Ints(l)
+	n := 0
+	for i, v := range l {
+		if i == 0 || v != l[n-1] {
+			l[n] = v
+			n++
+		}
+	}
+	return l[:n]
+}
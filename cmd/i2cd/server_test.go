@@ -0,0 +1,219 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package i2cd
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/goes/external/i2c"
+	"github.com/platinasystems/goes/external/i2creq"
+)
+
+// testBus has byte registers of bus, addr, command; writes to the fail
+// register return an error.
+type testBus struct {
+	mutex sync.Mutex
+	regs  map[[3]int]byte
+	fail  [3]int
+}
+
+var errTest = errors.New("test nak")
+
+func (b *testBus) op(op *i2creq.Op) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	k := [3]int{op.Bus, op.Addr, int(op.Command)}
+	if op.RW == i2c.Read {
+		op.Data[0] = b.regs[k]
+		return nil
+	}
+	if k == b.fail {
+		return errTest
+	}
+	b.regs[k] = op.Data[0]
+	return nil
+}
+
+func writeOp(bus int, reg uint8, v byte) i2creq.Op {
+	op := i2creq.Op{
+		Bus:     bus,
+		Addr:    0x50,
+		RW:      i2c.Write,
+		Command: reg,
+		Size:    i2c.ByteData,
+	}
+	op.Data[0] = v
+	return op
+}
+
+func TestRollback(t *testing.T) {
+	b := &testBus{
+		regs: map[[3]int]byte{
+			{0, 0x50, 1}: 0x11,
+			{1, 0x50, 2}: 0x22,
+		},
+		fail: [3]int{1, 0x50, 3},
+	}
+	s := newServer(b.op)
+	for _, rollback := range []bool{false, true} {
+		var reply i2creq.Reply
+		err := s.do(&i2creq.Tx{
+			Client:   "test",
+			Rollback: rollback,
+			Ops: []i2creq.Op{
+				writeOp(0, 1, 0xa1),
+				writeOp(1, 2, 0xa2),
+				writeOp(1, 3, 0xa3),
+			},
+		}, &reply)
+		if !errors.Is(err, errTest) {
+			t.Fatal("expected failure, got", err)
+		}
+		if reply.Failed != 2 || reply.RolledBack != rollback {
+			t.Errorf("rollback %v: failed %d rolled back %v",
+				rollback, reply.Failed, reply.RolledBack)
+		}
+		want := map[bool][2]byte{
+			false: {0xa1, 0xa2},
+			true:  {0x11, 0x22},
+		}[rollback]
+		got := [2]byte{b.regs[[3]int{0, 0x50, 1}],
+			b.regs[[3]int{1, 0x50, 2}]}
+		if got != want {
+			t.Errorf("rollback %v: got %x, want %x",
+				rollback, got, want)
+		}
+		b.regs[[3]int{0, 0x50, 1}] = 0x11
+		b.regs[[3]int{1, 0x50, 2}] = 0x22
+	}
+	st := s.clientStats()["test"]
+	if st.Tx != 2 || st.Errors != 2 {
+		t.Errorf("stats: %+v", st)
+	}
+}
+
+func TestFinally(t *testing.T) {
+	b := &testBus{
+		regs: map[[3]int]byte{{0, 0x50, 9}: 0x01},
+		fail: [3]int{0, 0x50, 3},
+	}
+	s := newServer(b.op)
+	err := s.do(&i2creq.Tx{
+		Client:  "test",
+		Ops:     []i2creq.Op{writeOp(0, 3, 0xa3)},
+		Finally: []i2creq.Op{writeOp(0, 9, 0)},
+	}, new(i2creq.Reply))
+	if !errors.Is(err, errTest) {
+		t.Fatal("expected failure, got", err)
+	}
+	if v := b.regs[[3]int{0, 0x50, 9}]; v != 0 {
+		t.Errorf("finally op not done after failure: %#x", v)
+	}
+}
+
+func TestBusy(t *testing.T) {
+	b := &testBus{regs: make(map[[3]int]byte)}
+	s := newServer(b.op)
+	if err := s.lock([]int{1, 2}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	var reply i2creq.Reply
+	tx := &i2creq.Tx{
+		Client:  "test",
+		Timeout: 10 * time.Millisecond,
+		Ops:     []i2creq.Op{writeOp(0, 1, 1), writeOp(2, 1, 1)},
+	}
+	if err := s.do(tx, &reply); err != i2creq.ErrBusy {
+		t.Fatal("expected busy, got", err)
+	}
+	// bus 0 must have been released after the timeout
+	if err := s.lock([]int{0}, time.Millisecond); err != nil {
+		t.Fatal("bus 0:", err)
+	}
+	s.unlock([]int{0})
+	if st := s.clientStats()["test"]; st.Timeouts != 1 {
+		t.Errorf("stats: %+v", st)
+	}
+	done := make(chan error)
+	tx.Timeout = time.Second
+	go func() { done <- s.do(tx, new(i2creq.Reply)) }()
+	time.Sleep(10 * time.Millisecond)
+	s.unlock([]int{1, 2})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if b.regs[[3]int{2, 0x50, 1}] != 1 {
+		t.Error("bus 2 write missing")
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	b := &testBus{regs: map[[3]int]byte{{3, 0x50, 7}: 0x77}}
+	s := newServer(b.op)
+	svc := &I2cReq{s}
+	var g [MAXOPS]I
+	var f [MAXOPS]R
+	g[0] = I{InUse: true, RW: i2c.Write, RegOffset: 6,
+		BusSize: i2c.ByteData, Bus: 3, Addr: 0x50}
+	g[0].Data[0] = 0x66
+	g[2] = I{InUse: true, RW: i2c.Read, RegOffset: 7,
+		BusSize: i2c.ByteData, Bus: 3, Addr: 0x50}
+	if err := svc.ReadWrite(&g, &f); err != nil {
+		t.Fatal(err)
+	}
+	if b.regs[[3]int{3, 0x50, 6}] != 0x66 || f[2].D[0] != 0x77 {
+		t.Fatalf("regs %x, read %#x", b.regs, f[2].D[0])
+	}
+	if st := s.clientStats()["legacy"]; st.Tx != 1 || st.Ops != 2 {
+		t.Errorf("stats: %+v", st)
+	}
+	g = [MAXOPS]I{{Bus: 0x99, Addr: 1}}
+	if err := svc.ReadWrite(&g, &f); err != nil {
+		t.Fatal(err)
+	}
+	g[0].Bus, f[0].D[0] = 0x98, 0
+	if err := svc.ReadWrite(&g, &f); err != nil || f[0].D[0] != 1 {
+		t.Fatal("stopped", f[0].D[0], err)
+	}
+}
+
+type testFlock struct {
+	held map[int]bool
+	bus  int
+}
+
+func (l *testFlock) Close() error {
+	delete(l.held, l.bus)
+	return nil
+}
+
+func TestFlock(t *testing.T) {
+	b := &testBus{regs: make(map[[3]int]byte)}
+	held := make(map[int]bool)
+	s := newServer(func(op *i2creq.Op) error {
+		if !held[op.Bus] {
+			t.Errorf("bus %d: op without flock", op.Bus)
+		}
+		return b.op(op)
+	})
+	s.flock = func(bus int) (io.Closer, error) {
+		held[bus] = true
+		return &testFlock{held, bus}, nil
+	}
+	err := s.do(&i2creq.Tx{
+		Client: "test",
+		Ops:    []i2creq.Op{writeOp(0, 1, 1), writeOp(2, 1, 1)},
+	}, new(i2creq.Reply))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(held) > 0 {
+		t.Error("flocks held after transaction", held)
+	}
+}
@@ -36,6 +36,7 @@ DESCRIPTION
 }
 
 func (c Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error, error) {
+	loc := g.Location()
 	var ifList, thenList, elseList []func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error
 	curList := &ifList
 	cl := ls.Cmds[0]
@@ -56,6 +57,9 @@ func (c Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func
 		for len(ls.Cmds) == 0 {
 			newls, err := shellutils.Parse("if>", g.Catline)
 			if err != nil {
+				if err == io.EOF {
+					err = g.MissingTerminator("if", "fi", loc)
+				}
 				return nil, nil, err
 			}
 			ls = *newls
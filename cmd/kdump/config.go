@@ -0,0 +1,121 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package kdump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const ConfigFile = "/etc/goes/kdump"
+
+// DefaultAppend is added to the crash kernel's command line so that it
+// runs within the reservation with devices left by the crashed kernel.
+const DefaultAppend = "irqpoll nr_cpus=1 reset_devices"
+
+const DefaultPath = "/var/crash"
+
+type Config struct {
+	Kernel  string
+	Initrd  string
+	Append  string
+	Syscall bool // only kexec_file_load
+	Path    string
+	URL     string
+	Reboot  bool
+}
+
+// LoadConfig returns the default configuration if the file doesn't exist.
+func LoadConfig(fn string) (*Config, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		cfg, _ := ReadConfig(strings.NewReader(""))
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return cfg, err
+	}
+	defer f.Close()
+	cfg, err := ReadConfig(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fn, err)
+	}
+	return cfg, err
+}
+
+func ReadConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{
+		Append: DefaultAppend,
+		Path:   DefaultPath,
+		Reboot: true,
+	}
+	scan := bufio.NewScanner(r)
+	for line := 1; scan.Scan(); line++ {
+		s := scan.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		arg := strings.Join(fields[1:], " ")
+		one := func() error {
+			if len(fields) != 2 {
+				return fmt.Errorf("line %d: expected %s VALUE",
+					line, fields[0])
+			}
+			return nil
+		}
+		switch fields[0] {
+		case "kernel", "initrd", "path", "url", "reboot":
+			if err := one(); err != nil {
+				return nil, err
+			}
+		}
+		switch fields[0] {
+		case "kernel":
+			cfg.Kernel = arg
+		case "initrd":
+			cfg.Initrd = arg
+		case "append":
+			cfg.Append = arg
+		case "syscall":
+			cfg.Syscall = true
+		case "path":
+			if !strings.HasPrefix(arg, "/") {
+				return nil, fmt.Errorf("line %d: %s: not absolute",
+					line, arg)
+			}
+			cfg.Path = arg
+		case "url":
+			u, err := url.Parse(arg)
+			if err != nil || (u.Scheme != "http" &&
+				u.Scheme != "https") {
+				return nil, fmt.Errorf("line %d: %s: not a http url",
+					line, arg)
+			}
+			cfg.URL = arg
+		case "reboot":
+			switch arg {
+			case "yes":
+				cfg.Reboot = true
+			case "no":
+				cfg.Reboot = false
+			default:
+				return nil, fmt.Errorf("line %d: expected reboot yes|no",
+					line)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: %s: unexpected", line,
+				fields[0])
+		}
+	}
+	return cfg, scan.Err()
+}
@@ -0,0 +1,261 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package kdump
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/log"
+	"github.com/platinasystems/goes/external/redis/publisher"
+	"github.com/platinasystems/goes/internal/kexec"
+	"github.com/platinasystems/goes/lang"
+)
+
+const (
+	Vmcore = "/proc/vmcore"
+	Pstore = "/sys/fs/pstore"
+
+	syslogActionReadAll = 3
+	syslogActionSize    = 10
+)
+
+type Command struct {
+	g   *goes.Goes
+	pub *publisher.Publisher
+}
+
+func (*Command) String() string { return "kdump" }
+
+func (*Command) Usage() string { return "kdump [CONFIG]" }
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "load a crash kernel and save its dumps",
+	}
+}
+
+func (*Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	On a normal boot, load the configured crash kernel to run on panic.
+	When run by the crash kernel, i.e. with ` + Vmcore + `, save the
+	crashed kernel's vmcore, its VMCOREINFO, the crash kernel's dmesg
+	and any ` + Pstore + ` records to PATH/TIME or URL/TIME then reboot.
+
+	The CONFIG file, default ` + ConfigFile + `, has lines of:
+
+	kernel FILE	the crash kernel
+	initrd FILE	its initramfs
+	append ARGS...	added to the command line without crashkernel=,
+			default: ` + DefaultAppend + `
+	syscall		only load with kexec_file_load
+	path DIR	where to save dumps, default: ` + DefaultPath + `
+	url URL		HTTP PUT dumps to URL/TIME/NAME instead of PATH
+	reboot yes|no	after saving a dump, default: yes
+
+	The kexec status is published to redis as kdump.loaded,
+	kdump.crash_loaded and kdump.crash_size; and the location of a
+	saved dump as kdump.saved.`,
+	}
+}
+
+func (c *Command) Goes(g *goes.Goes) { c.g = g }
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+func (c *Command) Main(args ...string) error {
+	fn := ConfigFile
+	if len(args) > 0 {
+		fn = args[0]
+	}
+	cfg, err := LoadConfig(fn)
+	if err != nil {
+		return err
+	}
+	if c.pub, err = publisher.New(); err == nil {
+		defer c.pub.Close()
+	} else {
+		c.pub = nil
+	}
+
+	if _, err = os.Stat(Vmcore); err == nil {
+		where, err := Save(cfg, time.Now())
+		if err != nil {
+			log.Print("err", "kdump: ", err)
+		} else {
+			log.Print("kdump: saved ", where)
+			c.publish("saved", where)
+		}
+		if cfg.Reboot {
+			return c.g.Main("reboot")
+		}
+	} else if len(cfg.Kernel) > 0 {
+		if err = Load(cfg); err != nil {
+			log.Print("err", "kdump: ", err)
+		}
+	}
+
+	if st, err := kexec.ReadStatus(); err == nil {
+		c.publish("loaded", st.Loaded)
+		c.publish("crash_loaded", st.CrashLoaded)
+		c.publish("crash_size", st.CrashSize)
+	}
+	<-goes.Stop
+	return nil
+}
+
+func (c *Command) publish(k string, v interface{}) {
+	if c.pub != nil {
+		c.pub.Print("kdump.", k, ": ", v)
+	}
+}
+
+// Load the configured crash kernel.
+func Load(cfg *Config) error {
+	st, err := kexec.ReadStatus()
+	if err == nil && st.CrashSize == 0 {
+		return fmt.Errorf("no crashkernel= reservation")
+	}
+	b, err := ioutil.ReadFile("/proc/cmdline")
+	if err != nil {
+		return err
+	}
+	var args []string
+	for _, arg := range strings.Fields(string(b)) {
+		if !strings.HasPrefix(arg, "crashkernel=") {
+			args = append(args, arg)
+		}
+	}
+	args = append(args, strings.Fields(cfg.Append)...)
+	cmdline := strings.Join(args, " ")
+
+	k, err := os.Open(cfg.Kernel)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	var i *os.File
+	if len(cfg.Initrd) > 0 {
+		if i, err = os.Open(cfg.Initrd); err != nil {
+			return err
+		}
+		defer i.Close()
+	}
+	if cfg.Syscall {
+		return kexec.FileLoadSyscall(k, i, cmdline,
+			kexec.KEXEC_FILE_ON_CRASH)
+	}
+	return kexec.FileLoad(k, i, cmdline, kexec.KEXEC_FILE_ON_CRASH)
+}
+
+// Save the dump to the configured path or URL, returning where.
+func Save(cfg *Config, t time.Time) (string, error) {
+	name := t.UTC().Format("20060102-150405")
+	var put func(fn string, r io.Reader, size int64) error
+	where := filepath.Join(cfg.Path, name)
+	if len(cfg.URL) > 0 {
+		where = strings.TrimSuffix(cfg.URL, "/") + "/" + name
+		put = func(fn string, r io.Reader, size int64) error {
+			return httpPut(where+"/"+fn, r, size)
+		}
+	} else {
+		if err := os.MkdirAll(where, 0700); err != nil {
+			return "", err
+		}
+		put = func(fn string, r io.Reader, _ int64) error {
+			w, err := os.Create(filepath.Join(where, fn))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, r)
+			if err == nil {
+				err = w.Sync()
+			}
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		}
+	}
+	putBytes := func(fn string, b []byte) error {
+		return put(fn, strings.NewReader(string(b)), int64(len(b)))
+	}
+
+	// small, most useful records first in case the vmcore doesn't fit
+	if b, err := dmesg(); err == nil {
+		if err = putBytes("dmesg", b); err != nil {
+			return where, err
+		}
+	}
+	if fis, err := ioutil.ReadDir(Pstore); err == nil {
+		for _, fi := range fis {
+			b, err := ioutil.ReadFile(filepath.Join(Pstore, fi.Name()))
+			if err != nil {
+				continue
+			}
+			if err = putBytes("pstore-"+fi.Name(), b); err != nil {
+				return where, err
+			}
+		}
+	}
+	f, err := os.Open(Vmcore)
+	if err != nil {
+		return where, err
+	}
+	defer f.Close()
+	if b, err := VmcoreInfo(f); err == nil && len(b) > 0 {
+		if err = putBytes("vmcoreinfo", b); err != nil {
+			return where, err
+		}
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return where, err
+	}
+	return where, put("vmcore", f, fi.Size())
+}
+
+// dmesg returns the kernel log of the running, i.e. crash, kernel.
+func dmesg() ([]byte, error) {
+	n, err := syscall.Klogctl(syslogActionSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	n, err = syscall.Klogctl(syslogActionReadAll, b)
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+func httpPut(u string, r io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, u, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s: %s", u, resp.Status)
+	}
+	return nil
+}
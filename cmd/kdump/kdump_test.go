@@ -0,0 +1,74 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package kdump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	cfg, err := ReadConfig(strings.NewReader(`
+# comment
+kernel /boot/vmlinuz-crash
+initrd /boot/initrd-crash
+append irqpoll maxcpus=1
+syscall
+url http://dumps.example.com/crash
+reboot no
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Kernel != "/boot/vmlinuz-crash" ||
+		cfg.Initrd != "/boot/initrd-crash" ||
+		cfg.Append != "irqpoll maxcpus=1" || !cfg.Syscall ||
+		cfg.Path != DefaultPath ||
+		cfg.URL != "http://dumps.example.com/crash" || cfg.Reboot {
+		t.Fatalf("unexpected %+v", cfg)
+	}
+	for _, s := range []string{
+		"path var/crash",
+		"url ftp://dumps.example.com",
+		"reboot maybe",
+		"kernel",
+		"dump all",
+	} {
+		if _, err = ReadConfig(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestNotes(t *testing.T) {
+	bo := binary.LittleEndian
+	buf := new(bytes.Buffer)
+	note := func(name, desc string) {
+		for _, v := range []uint32{
+			uint32(len(name) + 1),
+			uint32(len(desc)),
+			0,
+		} {
+			binary.Write(buf, bo, v)
+		}
+		for _, s := range []string{name + "\x00", desc} {
+			buf.WriteString(s)
+			for buf.Len()%4 != 0 {
+				buf.WriteByte(0)
+			}
+		}
+	}
+	note("CORE", "prstatus")
+	note("VMCOREINFO", "OSRELEASE=5.10.0\nPAGESIZE=4096\n")
+	m := Notes(buf.Bytes(), bo)
+	if s := string(m["VMCOREINFO"]); s != "OSRELEASE=5.10.0\nPAGESIZE=4096\n" {
+		t.Errorf("VMCOREINFO %q", s)
+	}
+	if s := string(m["CORE"]); s != "prstatus" {
+		t.Errorf("CORE %q", s)
+	}
+}
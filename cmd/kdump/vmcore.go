@@ -0,0 +1,57 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package kdump
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+// VmcoreInfo returns the VMCOREINFO note of the crashed kernel, the
+// symbols and offsets that tools need to read its memory, e.g. its log.
+func VmcoreInfo(r io.ReaderAt) ([]byte, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_NOTE {
+			continue
+		}
+		b, err := ioutil.ReadAll(p.Open())
+		if err != nil {
+			return nil, err
+		}
+		if desc, found := Notes(b, f.ByteOrder)["VMCOREINFO"]; found {
+			return desc, nil
+		}
+	}
+	return nil, nil
+}
+
+// Notes returns the descriptors of the ELF notes by name.
+func Notes(b []byte, bo binary.ByteOrder) map[string][]byte {
+	align4 := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	m := make(map[string][]byte)
+	for len(b) >= 12 {
+		namesz := bo.Uint32(b[0:])
+		descsz := bo.Uint32(b[4:])
+		b = b[12:]
+		if uint64(align4(namesz))+uint64(align4(descsz)) >
+			uint64(len(b)) {
+			break
+		}
+		name := b[:namesz]
+		if n := len(name); n > 0 && name[n-1] == 0 {
+			name = name[:n-1]
+		}
+		b = b[align4(namesz):]
+		m[string(name)] = b[:descsz]
+		b = b[align4(descsz):]
+	}
+	return m
+}
@@ -7,6 +7,7 @@ package kexec
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -35,14 +36,56 @@ func (*Command) Apropos() lang.Alt {
 
 func (c *Command) Goes(g *goes.Goes) { c.g = g }
 
+func (*Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Load a kernel and initramfs, or a FIT configuration, to execute on
+	reboot or, with -p, on a crash.
+
+OPTIONS
+	-k KERNEL	kernel file
+	-i INITRAMFS	initramfs file
+	-c CMDLINE	kernel command line; "+..." appends to the current one
+	-l FIT		FIT image
+	-x CONFIG	FIT configuration, default: the image's default
+	-p		load a crash kernel to run on panic, e.g. for kdump;
+			this needs a crashkernel= reservation
+	-s		only use kexec_file_load so the kernel may verify the
+			signature of the new kernel
+	-u		unload the kernel, or with -p, the crash kernel
+	-e		execute the loaded kernel by rebooting
+	-f		execute the loaded kernel without unmounting
+	-S, --status	print whether a kernel and crash kernel are loaded`,
+	}
+}
+
 func (c *Command) Main(args ...string) error {
-	flag, args := flags.New(args, "-e", "-f")
+	flag, args := flags.New(args, "-e", "-f", "-p", "-s", "-u",
+		[]string{"-S", "--status"})
 	parm, args := parms.New(args, "-c", "-i", "-k", "-l", "-x")
 
 	if len(args) > 0 {
 		return fmt.Errorf("%v: unexpected", args)
 	}
 
+	if flag.ByName["-S"] {
+		return printStatus()
+	}
+
+	crash := flag.ByName["-p"]
+	if crash && (flag.ByName["-e"] || flag.ByName["-f"]) {
+		return errors.New("a crash kernel is only executed on panic")
+	}
+
+	if flag.ByName["-u"] {
+		var flags uintptr
+		if crash {
+			flags = kexec.KEXEC_ON_CRASH
+		}
+		return kexec.Unload(flags)
+	}
+
 	kc, err := ioutil.ReadFile("/proc/cmdline")
 	if err != nil {
 		fmt.Printf("Warning: unable to read kernel command line: %v\n",
@@ -50,6 +93,9 @@ func (c *Command) Main(args ...string) error {
 	}
 
 	kcstr := strings.TrimSpace(string(kc))
+	if crash {
+		kcstr = crashCmdline(kcstr)
+	}
 
 	cmdline := parm.ByName["-c"]
 	if cmdline != "" {
@@ -60,15 +106,17 @@ func (c *Command) Main(args ...string) error {
 		cmdline = kcstr
 	}
 
+	l := loader{crash: crash, syscall: flag.ByName["-s"]}
+
 	if image := parm.ByName["-l"]; len(image) > 0 {
-		err = loadFit(image, parm.ByName["-x"], cmdline)
+		err = l.loadFit(image, parm.ByName["-x"], cmdline)
 		if err != nil {
 			return err
 		}
 	}
 
 	if kernel := parm.ByName["-k"]; len(kernel) > 0 {
-		err = loadKernel(kernel, parm.ByName["-i"], cmdline)
+		err = l.loadKernel(kernel, parm.ByName["-i"], cmdline)
 		if err != nil {
 			return err
 		}
@@ -84,7 +132,36 @@ func (c *Command) Main(args ...string) error {
 	return err
 }
 
-func loadFit(image, x, cmdline string) error {
+// crashCmdline returns the current command line without the crashkernel=
+// reservation, which the crash kernel runs within.
+func crashCmdline(s string) string {
+	var l []string
+	for _, arg := range strings.Fields(s) {
+		if !strings.HasPrefix(arg, "crashkernel=") {
+			l = append(l, arg)
+		}
+	}
+	return strings.Join(l, " ")
+}
+
+func printStatus() error {
+	st, err := kexec.ReadStatus()
+	if err != nil {
+		return err
+	}
+	yn := map[bool]string{false: "no", true: "yes"}
+	fmt.Println("loaded:", yn[st.Loaded])
+	fmt.Println("crash loaded:", yn[st.CrashLoaded])
+	fmt.Println("crash size:", st.CrashSize)
+	return nil
+}
+
+type loader struct {
+	crash   bool // load to run on panic
+	syscall bool // only kexec_file_load
+}
+
+func (l loader) loadFit(image, x, cmdline string) error {
 	b, err := ioutil.ReadFile(image)
 	if err != nil {
 		return err
@@ -104,10 +181,36 @@ func loadFit(image, x, cmdline string) error {
 	if config == nil {
 		return fmt.Errorf("Configuration %s not found", x)
 	}
-	return fit.KexecLoadConfig(config, cmdline)
+	if !l.syscall {
+		var flags uintptr
+		if l.crash {
+			flags = kexec.KEXEC_ON_CRASH
+		}
+		return fit.KexecLoadConfigFlags(config, cmdline, flags)
+	}
+	kdat, idat, err := fit.KexecImages(config)
+	if err != nil {
+		return err
+	}
+	// kexec_file_load needs files so copy the verified images to tmpfs
+	k, err := tempFile(kdat)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(k.Name())
+	defer k.Close()
+	var i *os.File
+	if len(idat) > 0 {
+		if i, err = tempFile(idat); err != nil {
+			return err
+		}
+		defer os.Remove(i.Name())
+		defer i.Close()
+	}
+	return kexec.FileLoadSyscall(k, i, cmdline, l.fileFlags())
 }
 
-func loadKernel(kernel, initramfs, cmdline string) error {
+func (l loader) loadKernel(kernel, initramfs, cmdline string) error {
 	k, err := os.Open(kernel)
 	if err != nil {
 		return err
@@ -124,5 +227,31 @@ func loadKernel(kernel, initramfs, cmdline string) error {
 	}
 	defer i.Close()
 
-	return kexec.FileLoad(k, i, cmdline, 0)
+	if l.syscall {
+		return kexec.FileLoadSyscall(k, i, cmdline, l.fileFlags())
+	}
+	return kexec.FileLoad(k, i, cmdline, l.fileFlags())
+}
+
+func (l loader) fileFlags() uintptr {
+	if l.crash {
+		return kexec.KEXEC_FILE_ON_CRASH
+	}
+	return 0
+}
+
+func tempFile(b []byte) (*os.File, error) {
+	f, err := ioutil.TempFile("", "kexec")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.Write(b); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
 }
@@ -0,0 +1,213 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package lsblk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/internal/blockdev"
+	"github.com/platinasystems/goes/lang"
+)
+
+const (
+	defaultColumns = "NAME,MAJ:MIN,RM,SIZE,RO,TYPE,MOUNTPOINT"
+	fsColumns      = "NAME,FSTYPE,LABEL,UUID,MOUNTPOINT"
+)
+
+type Command struct{}
+
+func (Command) String() string { return "lsblk" }
+
+func (Command) Usage() string {
+	return "lsblk [-a] [-b] [-d] [-f] [-J | -P] [-o COLUMN,...] [DEVICE]..."
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "list block devices",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	List the disks of /proc/partitions as a tree of their partitions and
+	the device mapper or md devices that hold them.
+
+OPTIONS
+	-a	include empty devices, e.g. unused loop devices
+	-b	print SIZE in bytes
+	-d	don't print partitions or holders
+	-f	print filesystem columns, ` + fsColumns + `
+	-J	print JSON
+	-P	print KEY="VALUE" pairs, one device per line
+	-o COLUMN,...
+		print these columns instead of ` + defaultColumns + `
+
+COLUMNS
+	NAME MAJ:MIN RM RO SIZE TYPE MODEL SERIAL PTTYPE PTUUID FSTYPE LABEL
+	UUID PARTTYPE PARTLABEL PARTUUID MOUNTPOINT PATH`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-a", "-b", "-d", "-f", "-J", "-P")
+	parm, args := parms.New(args, "-o")
+	columns := defaultColumns
+	if flag.ByName["-f"] {
+		columns = fsColumns
+	}
+	if s := parm.ByName["-o"]; len(s) > 0 {
+		columns = strings.ToUpper(s)
+	}
+	cols := strings.Split(columns, ",")
+
+	devs, err := blockdev.Scan()
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		var selected []*blockdev.Device
+		for _, arg := range args {
+			d := blockdev.Lookup(devs, arg)
+			if d == nil {
+				return fmt.Errorf("%s: not a block device", arg)
+			}
+			selected = append(selected, d)
+		}
+		devs = selected
+	}
+	devs = prune(devs, flag.ByName["-a"], flag.ByName["-d"])
+
+	value := func(d *blockdev.Device, col string) string {
+		if col == "SIZE" && !flag.ByName["-b"] {
+			return size(d.Size)
+		}
+		if col == "TYPE" {
+			return d.Type
+		}
+		return d.Tag(col)
+	}
+
+	switch {
+	case flag.ByName["-J"]:
+		var tree func([]*blockdev.Device) []map[string]interface{}
+		tree = func(devs []*blockdev.Device) []map[string]interface{} {
+			var l []map[string]interface{}
+			for _, d := range devs {
+				m := make(map[string]interface{})
+				for _, col := range cols {
+					var v interface{} = value(d, col)
+					switch {
+					case col == "RM" || col == "RO":
+						v = v == "1"
+					case col == "SIZE" && flag.ByName["-b"]:
+						v = d.Size
+					case v == "":
+						v = nil
+					}
+					m[strings.ToLower(col)] = v
+				}
+				if len(d.Children) > 0 {
+					m["children"] = tree(d.Children)
+				}
+				l = append(l, m)
+			}
+			return l
+		}
+		b, err := json.MarshalIndent(map[string]interface{}{
+			"blockdevices": tree(devs),
+		}, "", "   ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case flag.ByName["-P"]:
+		blockdev.Walk(devs, func(d *blockdev.Device, _ int) bool {
+			for i, col := range cols {
+				if i > 0 {
+					fmt.Print(" ")
+				}
+				fmt.Printf("%s=%q", col, value(d, col))
+			}
+			fmt.Println()
+			return true
+		})
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+		fmt.Fprintln(w, strings.Join(cols, "\t"))
+		var list func([]*blockdev.Device, string, bool)
+		list = func(devs []*blockdev.Device, prefix string, nested bool) {
+			for i, d := range devs {
+				branch, more := "├─", "│ "
+				if i == len(devs)-1 {
+					branch, more = "└─", "  "
+				}
+				for j, col := range cols {
+					if j > 0 {
+						fmt.Fprint(w, "\t")
+					}
+					v := value(d, col)
+					if j == 0 && nested {
+						v = prefix + branch + v
+					}
+					fmt.Fprint(w, v)
+				}
+				fmt.Fprintln(w)
+				next := ""
+				if nested {
+					next = prefix + more
+				}
+				list(d.Children, next, true)
+			}
+		}
+		list(devs, "", false)
+		w.Flush()
+	}
+	return nil
+}
+
+// prune returns a copy of the tree without empty devices unless all and
+// without children if disks.
+func prune(devs []*blockdev.Device, all, disks bool) []*blockdev.Device {
+	var l []*blockdev.Device
+	for _, d := range devs {
+		if d.Size == 0 && !all {
+			continue
+		}
+		c := *d
+		c.Children = nil
+		if !disks {
+			c.Children = prune(d.Children, all, disks)
+		}
+		l = append(l, &c)
+	}
+	return l
+}
+
+// size returns a short, binary prefixed size, e.g. 7.3G
+func size(n uint64) string {
+	const units = "BKMGTPE"
+	f := float64(n)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	s := strconv.FormatFloat(f, 'f', 1, 64)
+	s = strings.TrimSuffix(s, ".0")
+	return s + units[i:i+1]
+}
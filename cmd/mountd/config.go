@@ -0,0 +1,143 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mountd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/platinasystems/goes/internal/blockdev"
+)
+
+const ConfigFile = "/etc/goes/mountd"
+
+type Config struct {
+	// ReadOnly is "all", "removable" or "none"
+	ReadOnly string
+	Entries  []*Entry
+}
+
+type Entry struct {
+	Spec    string
+	Dir     string
+	Options []string
+}
+
+var flagsByOption = map[string]struct {
+	set  bool
+	bits uintptr
+}{
+	"ro":       {true, syscall.MS_RDONLY},
+	"rw":       {false, syscall.MS_RDONLY},
+	"nosuid":   {true, syscall.MS_NOSUID},
+	"suid":     {false, syscall.MS_NOSUID},
+	"nodev":    {true, syscall.MS_NODEV},
+	"dev":      {false, syscall.MS_NODEV},
+	"noexec":   {true, syscall.MS_NOEXEC},
+	"exec":     {false, syscall.MS_NOEXEC},
+	"noatime":  {true, syscall.MS_NOATIME},
+	"relatime": {true, syscall.MS_RELATIME},
+	"sync":     {true, syscall.MS_SYNCHRONOUS},
+	"async":    {false, syscall.MS_SYNCHRONOUS},
+}
+
+// LoadConfig returns an empty configuration if the file doesn't exist.
+func LoadConfig(fn string) (*Config, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return &Config{}, err
+	}
+	defer f.Close()
+	cfg, err := ReadConfig(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fn, err)
+	}
+	return cfg, err
+}
+
+func ReadConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+	scan := bufio.NewScanner(r)
+	for line := 1; scan.Scan(); line++ {
+		s := scan.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "readonly":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: expected readonly all|removable|none", line)
+			}
+			switch fields[1] {
+			case "all", "removable", "none":
+				cfg.ReadOnly = fields[1]
+			default:
+				return nil, fmt.Errorf("line %d: %s: invalid",
+					line, fields[1])
+			}
+		case len(fields) == 2 || len(fields) == 3:
+			e := &Entry{Spec: fields[0], Dir: fields[1]}
+			if e.Dir != "none" && !strings.HasPrefix(e.Dir, "/") {
+				return nil, fmt.Errorf("line %d: %s: not absolute",
+					line, e.Dir)
+			}
+			if len(fields) == 3 {
+				e.Options = strings.Split(fields[2], ",")
+			}
+			cfg.Entries = append(cfg.Entries, e)
+		default:
+			return nil, fmt.Errorf("line %d: %v: unexpected", line,
+				fields)
+		}
+	}
+	return cfg, scan.Err()
+}
+
+// Match returns the first entry for the device.
+func (cfg *Config) Match(d *blockdev.Device) *Entry {
+	for _, e := range cfg.Entries {
+		if blockdev.Lookup([]*blockdev.Device{{
+			Name:      d.Name,
+			Path:      d.Path,
+			UUID:      d.UUID,
+			Label:     d.Label,
+			PartUUID:  d.PartUUID,
+			PartLabel: d.PartLabel,
+		}}, e.Spec) != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// Flags returns the mount flags and filesystem data of the entry options and
+// whether it's read-only given the default.
+func (e *Entry) Flags(ro bool) (uintptr, string, bool) {
+	var flags uintptr
+	var data []string
+	for _, opt := range e.Options {
+		x, found := flagsByOption[opt]
+		switch {
+		case !found:
+			data = append(data, opt)
+		case x.bits == syscall.MS_RDONLY:
+			ro = x.set
+		case x.set:
+			flags |= x.bits
+		default:
+			flags &^= x.bits
+		}
+	}
+	return flags, strings.Join(data, ","), ro
+}
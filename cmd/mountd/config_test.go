@@ -0,0 +1,60 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mountd
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/platinasystems/goes/internal/blockdev"
+)
+
+func TestConfig(t *testing.T) {
+	cfg, err := ReadConfig(strings.NewReader(`
+# comment
+readonly removable
+UUID=5d3b1e0a-7c1f-4e4b-9b8c-0f1e2d3c4b5a /mnt/data rw,noatime,discard
+LABEL=ONIE-BOOT none
+sdc1 /mnt/usb ro
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ReadOnly != "removable" || len(cfg.Entries) != 3 {
+		t.Fatal("unexpected", cfg)
+	}
+	e := cfg.Match(&blockdev.Device{
+		Name: "sda2",
+		UUID: "5D3B1E0A-7C1F-4E4B-9B8C-0F1E2D3C4B5A",
+	})
+	if e == nil || e.Dir != "/mnt/data" {
+		t.Fatal("UUID mismatch", e)
+	}
+	flags, data, ro := e.Flags(true)
+	if flags != syscall.MS_NOATIME || data != "discard" || ro {
+		t.Error("unexpected", flags, data, ro)
+	}
+	if e = cfg.Match(&blockdev.Device{Label: "ONIE-BOOT"}); e == nil ||
+		e.Dir != "none" {
+		t.Error("LABEL mismatch", e)
+	}
+	if e = cfg.Match(&blockdev.Device{Name: "sdc1"}); e == nil ||
+		e.Dir != "/mnt/usb" {
+		t.Error("name mismatch", e)
+	}
+	if cfg.Match(&blockdev.Device{Name: "sdd1"}) != nil {
+		t.Error("unexpected match")
+	}
+	for _, s := range []string{
+		"readonly sometimes",
+		"sda1 relative",
+		"sda1 /mnt ro extra",
+	} {
+		if _, err = ReadConfig(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -16,19 +18,46 @@ import (
 	"github.com/platinasystems/goes"
 	"github.com/platinasystems/goes/cmd"
 	"github.com/platinasystems/goes/external/log"
-	"github.com/platinasystems/goes/external/partitions"
+	"github.com/platinasystems/goes/external/redis/publisher"
+	"github.com/platinasystems/goes/internal/blockdev"
+	"github.com/platinasystems/goes/internal/nl"
 	"github.com/platinasystems/goes/lang"
 )
 
 var ErrUnknownPartition = errors.New("Unable to determine partition type")
+var ErrNotMountable = errors.New("Not a mountable filesystem")
+var ErrUnmounted = errors.New("Unmounted by another")
+
+const (
+	// Without uevents, mountd polls /proc/partitions at this interval;
+	// otherwise, it still rescans at rescanInterval in case of dropped
+	// events.
+	pollInterval   = 2 * time.Second
+	rescanInterval = 30 * time.Second
+	// settleTime coalesces the events of a disk and its partitions.
+	settleTime = 500 * time.Millisecond
+)
 
 type Command struct {
-	partitions map[string]error
+	mounts map[string]*mount // by device name
+	config *Config
+	pub    *publisher.Publisher
+}
+
+type mount struct {
+	name   string
+	dev    string
+	dir    string
+	fstype string
+	uuid   string
+	label  string
+	flags  uintptr
+	err    error
 }
 
 func (*Command) String() string { return "mountd" }
 
-func (*Command) Usage() string { return "mountd" }
+func (*Command) Usage() string { return "mountd [DIR]" }
 
 func (*Command) Apropos() lang.Alt {
 	return lang.Alt{
@@ -36,128 +65,264 @@ func (*Command) Apropos() lang.Alt {
 	}
 }
 
-func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+func (*Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Mount each recognized filesystem in DIR/NAME, default /mountd/NAME, as
+	block devices are added and unmount those that are removed. A
+	filesystem that is unmounted by another stays that way until its
+	device is added again.
 
-func (*Command) mountone(dev, dir string) (err error) {
-	sb, err := partitions.ReadSuperBlock(dev)
-	if err != nil {
-		return err
+	The optional ` + ConfigFile + ` has lines of:
+
+	readonly all|removable|none
+		the default read-only policy (default none)
+
+	SPEC DIR|none [OPTION,...]
+		SPEC is UUID=, LABEL=, PARTUUID=, PARTLABEL= or a device name.
+		DIR replaces DIR/NAME and "none" ignores the device.
+		OPTIONs include ro, rw, nosuid, nodev, noexec, noatime,
+		relatime and sync; others are passed to the filesystem.
+		"ro" or "rw" override the read-only policy.
+
+	For example,
+
+	readonly removable
+	UUID=5d3b1e0a-7c1f-4e4b-9b8c-0f1e2d3c4b5a /mnt/data rw,noatime
+	LABEL=ONIE-BOOT none
+
+	Each mount is published to redis as mountd.NAME.dir, .fstype, .uuid,
+	.label and .ro`,
 	}
-	t := ""
-	if sb != nil {
-		t = sb.Kind()
+}
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+func (c *Command) Main(args ...string) (err error) {
+	mp := "/mountd"
+	if len(args) > 0 {
+		mp = args[0]
 	}
-	if t == "" {
-		return ErrUnknownPartition
+	if _, err = os.Stat(mp); os.IsNotExist(err) {
+		err = os.Mkdir(mp, 0755)
+		if err != nil {
+			log.Print("err", mp, ": ", err)
+		}
 	}
-	err = syscall.Mount(dev, dir, t, 0, "")
-	if err == nil {
-		return nil
+	c.config, err = LoadConfig(ConfigFile)
+	if err != nil {
+		log.Print("err", err)
+		c.config = &Config{}
 	}
-	if err == syscall.EACCES {
-		err = syscall.Mount(dev, dir, t, syscall.MS_RDONLY, "")
+	c.mounts = make(map[string]*mount)
+	if c.pub, err = publisher.New(); err == nil {
+		defer c.pub.Close()
 	}
-	return err
-}
 
-func (c *Command) mountall(mp string) {
-	pp, err := os.Open("/proc/partitions")
+	interval := rescanInterval
+	var events <-chan *nl.Uevent
+	sock, err := nl.NewUeventSock(64)
 	if err != nil {
-		log.Printf("opening /proc/partitions: %s", err)
-		return
+		log.Print("warning", "uevents: ", err)
+		interval = pollInterval
+	} else {
+		defer sock.Close()
+		events = sock.RxCh
 	}
-	defer pp.Close()
-	partMap := make(map[string]bool)
-	partScanner := bufio.NewScanner(pp)
 
-	for partScanner.Scan() {
-		fields := strings.Fields(partScanner.Text())
-		if len(fields) < 4 || fields[0] == "major" {
-			continue
+	c.update(mp)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-goes.Stop:
+			c.unmountall()
+			return nil
+		case <-t.C:
+			c.update(mp)
+		case ev, opened := <-events:
+			if !opened {
+				log.Print("warning", "uevents: ", sock.Err)
+				events = nil
+				t.Stop()
+				t = time.NewTicker(pollInterval)
+				continue
+			}
+			if ev.Subsystem() != "block" {
+				continue
+			}
+			if ev.Action == "add" {
+				c.added(ev.Env["DEVNAME"])
+			}
+			if settle == nil {
+				settle = time.After(settleTime)
+			}
+		case <-settle:
+			settle = nil
+			c.update(mp)
 		}
-		partMap[fields[3]] = true
 	}
+}
 
-	pm, err := os.Open("/proc/mounts")
+// update mounts new filesystems and unmounts those that were removed or
+// replaced.
+func (c *Command) update(mp string) {
+	devs, err := blockdev.Scan()
 	if err != nil {
-		fmt.Printf("opening /proc/mounts: %s\n", err)
+		log.Print("err", err)
 		return
 	}
-	defer pm.Close()
-
-	mountMap := make(map[string]string)
-	mountScanner := bufio.NewScanner(pm)
-	for mountScanner.Scan() {
-		fields := strings.Fields(mountScanner.Text())
-		if len(fields) < 6 {
-			continue
+	present := make(map[string]*blockdev.Device)
+	blockdev.Walk(devs, func(d *blockdev.Device, _ int) bool {
+		if len(d.FSType) > 0 {
+			present[d.Name] = d
 		}
-		mountMap[fields[0]] = fields[1]
-	}
-
-	for part := range partMap {
-		mpd := mp + "/" + part
-		if _, found := c.partitions[mpd]; !found {
-			if _, err := os.Stat(mpd); os.IsNotExist(err) {
-				err := os.Mkdir(mpd, os.FileMode(0555))
-				if err != nil {
-					fmt.Println("mkdir", mpd, "err:", err)
-					continue
-				}
-			}
-			err := c.mountone("/dev/"+part, mpd)
-			if err == nil {
-				fmt.Println("Mounted", "/dev/"+part,
-					mpd)
-			} else {
-				if err != ErrUnknownPartition {
-					fmt.Println("mount", mpd, "err:", err)
-				}
-			}
-			c.partitions[mpd] = err
-		} else {
-			if mountMap["/dev/"+part] != mpd &&
-				c.partitions[mpd] == nil {
-				delete(c.partitions, mpd)
-			}
+		return true
+	})
+	mounted := mountPoints()
+	for name, m := range c.mounts {
+		d := present[name]
+		switch {
+		case d == nil || d.FSType != m.fstype || d.UUID != m.uuid:
+			c.unmount(m)
+		case m.err == nil && len(m.dir) > 0 && !mounted[m.dir]:
+			// unmounted by someone else; leave it that way
+			// until the device is added again
+			fmt.Println("Unmounted by another", m.dev, m.dir)
+			c.unpublish(m)
+			m.err = ErrUnmounted
+		}
+	}
+	names := make([]string, 0, len(present))
+	for name := range present {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, found := c.mounts[name]; !found {
+			c.mounts[name] = c.mount(mp, present[name])
 		}
 	}
 }
 
-func (c *Command) unmountall(mp string) {
-	for mpd, e := range c.partitions {
-		if e == nil {
-			err := syscall.Unmount(mpd, syscall.MNT_DETACH)
-			if err != nil {
-				fmt.Printf("Error unmounting %s: %s\n", mpd, err)
-			}
+func (c *Command) mount(mp string, d *blockdev.Device) *mount {
+	m := &mount{
+		name:   d.Name,
+		dev:    d.Path,
+		dir:    filepath.Join(mp, d.Name),
+		fstype: d.FSType,
+		uuid:   d.UUID,
+		label:  d.Label,
+	}
+	switch d.FSType {
+	case "swap", "crypto_LUKS":
+		m.dir = ""
+		m.err = ErrNotMountable
+		return m
+	}
+	ro := c.config.ReadOnly == "all" ||
+		(c.config.ReadOnly == "removable" && d.Removable) ||
+		d.ReadOnly
+	var data string
+	if e := c.config.Match(d); e != nil {
+		if e.Dir == "none" {
+			m.dir = ""
+			m.err = ErrNotMountable
+			return m
 		}
-		delete(c.partitions, mpd)
+		m.dir = e.Dir
+		var flags uintptr
+		flags, data, ro = e.Flags(ro)
+		m.flags = flags
 	}
+	if ro {
+		m.flags |= syscall.MS_RDONLY
+	}
+	if m.err = os.MkdirAll(m.dir, 0555); m.err != nil {
+		fmt.Println("mkdir", m.dir, "err:", m.err)
+		return m
+	}
+	m.err = syscall.Mount(m.dev, m.dir, m.fstype, m.flags, data)
+	if (m.err == syscall.EACCES || m.err == syscall.EROFS) &&
+		m.flags&syscall.MS_RDONLY == 0 {
+		m.flags |= syscall.MS_RDONLY
+		m.err = syscall.Mount(m.dev, m.dir, m.fstype, m.flags, data)
+	}
+	if m.err != nil {
+		fmt.Println("mount", m.dir, "err:", m.err)
+		return m
+	}
+	fmt.Println("Mounted", m.dev, m.dir)
+	c.publish(m)
+	return m
 }
 
-func (c *Command) Main(args ...string) (err error) {
-	mp := "/mountd"
-	if len(args) > 0 {
-		mp = args[0]
-	}
-	if _, err = os.Stat(mp); os.IsNotExist(err) {
-		err = os.Mkdir(mp, 0755)
+func (c *Command) unmount(m *mount) {
+	if m.err == nil {
+		err := syscall.Unmount(m.dir, syscall.MNT_DETACH)
 		if err != nil {
-			log.Print("err", mp, ": ", err)
+			fmt.Printf("Error unmounting %s: %s\n", m.dir, err)
+		} else {
+			fmt.Println("Unmounted", m.dev, m.dir)
 		}
 	}
-	c.partitions = make(map[string]error)
-	c.mountall(mp)
-	t := time.NewTicker(2 * time.Second)
-	defer t.Stop()
-	for {
-		c.mountall(mp)
-		select {
-		case <-goes.Stop:
-			c.unmountall(mp)
-			return nil
-		case <-t.C:
+	c.forget(m)
+}
+
+func (c *Command) forget(m *mount) {
+	c.unpublish(m)
+	delete(c.mounts, m.name)
+}
+
+// added forgets a device that was unmounted by another so that the next
+// update mounts it again.
+func (c *Command) added(name string) {
+	if m := c.mounts[name]; m != nil && m.err == ErrUnmounted {
+		delete(c.mounts, name)
+	}
+}
+
+func (c *Command) unpublish(m *mount) {
+	if m.err == nil && c.pub != nil {
+		c.pub.Print("delete: mountd.", m.name, ".")
+	}
+}
+
+func (c *Command) publish(m *mount) {
+	if c.pub == nil {
+		return
+	}
+	prefix := "mountd." + m.name
+	c.pub.Print(prefix, ".fstype: ", m.fstype)
+	c.pub.Print(prefix, ".uuid: ", m.uuid)
+	c.pub.Print(prefix, ".label: ", m.label)
+	c.pub.Print(prefix, ".ro: ", m.flags&syscall.MS_RDONLY != 0)
+	// last since grubd watches for this
+	c.pub.Print(prefix, ".dir: ", m.dir)
+}
+
+func (c *Command) unmountall() {
+	for _, m := range c.mounts {
+		c.unmount(m)
+	}
+}
+
+// mountPoints returns the set of mounted directories.
+func mountPoints() map[string]bool {
+	m := make(map[string]bool)
+	f, err := os.Open("/proc/mounts")
+	if err != nil {
+		return m
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) >= 2 {
+			m[fields[1]] = true
 		}
 	}
+	return m
 }
@@ -0,0 +1,105 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mtd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/internal/mtd"
+	"github.com/platinasystems/goes/lang"
+)
+
+type CopyCommand struct{}
+
+func (CopyCommand) String() string { return "flashcp" }
+
+func (CopyCommand) Usage() string { return "flashcp [-v] FILE DEVICE" }
+
+func (CopyCommand) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "copy an image to a NOR flash MTD device",
+	}
+}
+
+func (CopyCommand) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Erase the blocks of the MTD DEVICE needed for FILE, write FILE,
+	then verify it. Use nandwrite for NAND devices.
+
+OPTIONS
+	-v	print progress`,
+	}
+}
+
+func (CopyCommand) Main(args ...string) error {
+	flag, args := flags.New(args, "-v")
+	if len(args) != 2 {
+		return fmt.Errorf("FILE DEVICE: missing or unexpected")
+	}
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	fn, err := mtd.Find(args[1])
+	if err != nil {
+		return err
+	}
+	d, err := mtd.Open(fn, os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if d.IsNand() {
+		return fmt.Errorf("%s: is NAND, use nandwrite", fn)
+	}
+	w := ioutil.Discard
+	if flag.ByName["-v"] {
+		w = os.Stdout
+	}
+	return copyImage(d, d.Info, data, w)
+}
+
+// copyImage erases, writes and verifies the image, printing progress to w.
+func copyImage(n nand, info mtd.Info, data []byte, w io.Writer) error {
+	block := info.EraseSize
+	if uint64(len(data)) > uint64(info.Size) {
+		return fmt.Errorf("image exceeds %d bytes", info.Size)
+	}
+	blocks := (uint32(len(data)) + block - 1) / block
+	for i := uint32(0); i < blocks; i++ {
+		fmt.Fprintf(w, "\rErasing block %d of %d", i+1, blocks)
+		if err := n.Erase(i*block, block); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(w)
+	for off := 0; off < len(data); off += int(block) {
+		end := off + int(block)
+		if end > len(data) {
+			end = len(data)
+		}
+		fmt.Fprintf(w, "\rWriting %d of %d bytes", end, len(data))
+		if _, err := n.WriteAt(data[off:end], int64(off)); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(w)
+	b := make([]byte, len(data))
+	fmt.Fprintln(w, "Verifying")
+	if _, err := n.ReadAt(b, 0); err != nil {
+		return err
+	}
+	if !bytes.Equal(b, data) {
+		return fmt.Errorf("verify failed")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package mtd provides commands to inspect and program MTD devices.
+package mtd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/platinasystems/goes/internal/mtd"
+	"github.com/platinasystems/goes/lang"
+)
+
+type InfoCommand struct{}
+
+func (InfoCommand) String() string { return "mtdinfo" }
+
+func (InfoCommand) Usage() string { return "mtdinfo [DEVICE]..." }
+
+func (InfoCommand) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "print MTD device information",
+	}
+}
+
+func (InfoCommand) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Without arguments, list the MTD devices with their size, erase
+	block size and name. Otherwise, print the geometry and bad block
+	counts of each DEVICE, a /dev/mtdN file, mtdN, N or partition name.`,
+	}
+}
+
+func (InfoCommand) Main(args ...string) error {
+	if len(args) == 0 {
+		l, err := mtd.List()
+		if err != nil {
+			return err
+		}
+		fmt.Println("dev:    size   erasesize  name")
+		for _, a := range l {
+			fmt.Printf("%s: %08x %08x \"%s\"\n", a.Dev, a.Size,
+				a.EraseSize, a.Name)
+		}
+		return nil
+	}
+	for i, arg := range args {
+		fn, err := mtd.Find(arg)
+		if err != nil {
+			return err
+		}
+		a, err := mtd.Read(filepath.Base(fn))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		printAttrs(os.Stdout, a)
+	}
+	return nil
+}
+
+func printAttrs(w io.Writer, a *mtd.Attrs) {
+	blocks := uint64(0)
+	if a.EraseSize > 0 {
+		blocks = a.Size / a.EraseSize
+	}
+	for _, x := range []struct {
+		k string
+		v interface{}
+	}{
+		{"Device", a.Path()},
+		{"Name", a.Name},
+		{"Type", a.Type},
+		{"Eraseblock size", humanBytes(a.EraseSize)},
+		{"Eraseblocks", fmt.Sprint(blocks, " (", humanBytes(a.Size), ")")},
+		{"Minimum I/O unit size", humanBytes(a.WriteSize)},
+		{"OOB size", humanBytes(a.OobSize)},
+		{"Bad blocks", a.BadBlocks},
+		{"ECC failures", a.EccFailures},
+		{"Corrected bits", a.Corrected},
+	} {
+		fmt.Fprintf(w, "%-24s%v\n", x.k+":", x.v)
+	}
+}
+
+func humanBytes(n uint64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprint(n, " bytes, ", n>>20, " MiB")
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprint(n, " bytes, ", n>>10, " KiB")
+	}
+	return fmt.Sprint(n, " bytes")
+}
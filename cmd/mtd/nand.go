@@ -0,0 +1,204 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mtd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/platinasystems/goes/internal/mtd"
+)
+
+// nand is the *mtd.Device interface of nanddump, nandwrite and flashcp
+// so that tests may simulate bad blocks.
+type nand interface {
+	io.ReaderAt
+	io.WriterAt
+	IsBad(off int64) (bool, error)
+	MarkBad(off int64) error
+	ReadOob(b []byte, off int64) error
+	WritePage(off int64, data, oob []byte, mode uint8) error
+	Erase(off, size uint32) error
+}
+
+// Bad block handling of nanddump
+const (
+	SkipBad = "skipbad"
+	PadBad  = "padbad"
+	DumpBad = "dumpbad"
+)
+
+type dumpOpts struct {
+	start, length int64
+	oob           bool
+	bb            string
+}
+
+// dump writes pages, each followed by its OOB if opts.oob, from start to
+// start+length.
+func dump(n nand, info mtd.Info, w io.Writer, opts dumpOpts) error {
+	page, block := int64(info.WriteSize), int64(info.EraseSize)
+	size := int64(info.Size)
+	if opts.start%page != 0 || opts.start > size {
+		return fmt.Errorf("start %#x: not page aligned or beyond %#x",
+			opts.start, size)
+	}
+	end := size
+	if opts.length > 0 {
+		end = opts.start + opts.length
+		// round up to a whole page
+		end = (end + page - 1) / page * page
+		if end > size {
+			end = size
+		}
+	}
+	data := make([]byte, page)
+	oob := make([]byte, info.OobSize)
+	bad := false
+	for off := opts.start; off < end; off += page {
+		if off == opts.start || off%block == 0 {
+			var err error
+			if bad, err = n.IsBad(off - off%block); err != nil {
+				return err
+			}
+			if bad && opts.bb == SkipBad {
+				off += block - off%block - page
+				continue
+			}
+		}
+		if bad && opts.bb == PadBad {
+			fill(data, 0xff)
+			fill(oob, 0xff)
+		} else {
+			_, err := n.ReadAt(data, off)
+			switch {
+			case err == nil:
+			case errors.Is(err, syscall.EUCLEAN):
+				// bit flips that ECC corrected
+			case errors.Is(err, syscall.EBADMSG):
+				fmt.Fprintf(os.Stderr, "%#x: ECC failed\n", off)
+			default:
+				return err
+			}
+			if opts.oob {
+				if err = n.ReadOob(oob, off); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if opts.oob {
+			if _, err := w.Write(oob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type writeOpts struct {
+	start   int64
+	pad     bool
+	oob     bool
+	markBad bool
+	mode    uint8
+}
+
+// write copies pages from r, each followed by its OOB if opts.oob, to the
+// erased blocks from opts.start, skipping bad blocks. A block that fails
+// is marked bad, if opts.markBad, and its data written to the next.
+// write returns the number of flash bytes written.
+func write(n nand, info mtd.Info, r io.Reader, opts writeOpts) (int64,
+	error) {
+	page, block := int64(info.WriteSize), int64(info.EraseSize)
+	size := int64(info.Size)
+	if opts.start%block != 0 {
+		return 0, fmt.Errorf("start %#x: not erase block aligned",
+			opts.start)
+	}
+	chunk := page
+	if opts.oob {
+		chunk += int64(info.OobSize)
+	}
+	buf := make([]byte, block/page*chunk)
+	var written int64
+	off := opts.start
+	for {
+		nb, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return written, err
+		}
+		if rem := int64(nb) % chunk; rem != 0 {
+			if !opts.pad || opts.oob {
+				return written, fmt.Errorf("input isn't a multiple of %d bytes, use -p",
+					chunk)
+			}
+			fill(buf[nb:int64(nb)+chunk-rem], 0xff)
+			nb += int(chunk - rem)
+		}
+		for {
+			if off+block > size {
+				return written, fmt.Errorf("no space left at %#x",
+					off)
+			}
+			bad, err := n.IsBad(off)
+			if err != nil {
+				return written, err
+			}
+			if bad {
+				fmt.Fprintf(os.Stderr, "%#x: skipping bad block\n",
+					off)
+				off += block
+				continue
+			}
+			err = writeBlock(n, off, buf[:nb], page, chunk, opts.mode)
+			if err == nil {
+				break
+			}
+			if !opts.markBad {
+				return written, err
+			}
+			fmt.Fprintln(os.Stderr, err, "marking bad")
+			// clear what was written before marking it bad
+			n.Erase(uint32(off), uint32(block))
+			if err = n.MarkBad(off); err != nil {
+				return written, err
+			}
+			off += block
+		}
+		written += int64(nb) / chunk * page
+		off += block
+		if int64(nb) < int64(len(buf)) {
+			return written, nil
+		}
+	}
+}
+
+func writeBlock(n nand, off int64, b []byte, page, chunk int64,
+	mode uint8) error {
+	for i := int64(0); i < int64(len(b)); i += chunk {
+		data := b[i : i+page]
+		oob := b[i+page : i+chunk]
+		err := n.WritePage(off+i/chunk*page, data, oob, mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fill(b []byte, v byte) {
+	for i := range b {
+		b[i] = v
+	}
+}
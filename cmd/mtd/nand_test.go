@@ -0,0 +1,162 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mtd
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/platinasystems/goes/internal/mtd"
+)
+
+var testInfo = mtd.Info{
+	Type:      mtd.NandFlash,
+	Size:      8 * 4 * 16,
+	EraseSize: 4 * 16,
+	WriteSize: 16,
+	OobSize:   4,
+}
+
+// testNand simulates a NAND of 8 blocks of 4 pages with 4 bytes of OOB.
+type testNand struct {
+	data, oob []byte
+	bad       map[int64]bool
+	fail      map[int64]bool // fail writes to these blocks
+}
+
+func newTestNand() *testNand {
+	n := &testNand{
+		data: make([]byte, testInfo.Size),
+		oob:  make([]byte, testInfo.Size/testInfo.WriteSize*testInfo.OobSize),
+		bad:  make(map[int64]bool),
+		fail: make(map[int64]bool),
+	}
+	fill(n.data, 0xff)
+	fill(n.oob, 0xff)
+	return n
+}
+
+func (n *testNand) block(off int64) int64 {
+	return off - off%int64(testInfo.EraseSize)
+}
+
+func (n *testNand) oobOff(off int64) int64 {
+	return off / int64(testInfo.WriteSize) * int64(testInfo.OobSize)
+}
+
+func (n *testNand) ReadAt(b []byte, off int64) (int, error) {
+	return copy(b, n.data[off:]), nil
+}
+
+func (n *testNand) WriteAt(b []byte, off int64) (int, error) {
+	return copy(n.data[off:], b), nil
+}
+
+func (n *testNand) IsBad(off int64) (bool, error) {
+	return n.bad[n.block(off)], nil
+}
+
+func (n *testNand) MarkBad(off int64) error {
+	n.bad[n.block(off)] = true
+	return nil
+}
+
+func (n *testNand) ReadOob(b []byte, off int64) error {
+	copy(b, n.oob[n.oobOff(off):])
+	return nil
+}
+
+func (n *testNand) WritePage(off int64, data, oob []byte, mode uint8) error {
+	if n.fail[n.block(off)] {
+		return fmt.Errorf("%#x: write failed", off)
+	}
+	copy(n.data[off:], data)
+	copy(n.oob[n.oobOff(off):], oob)
+	return nil
+}
+
+func (n *testNand) Erase(off, size uint32) error {
+	fill(n.data[off:off+size], 0xff)
+	return nil
+}
+
+func TestNand(t *testing.T) {
+	n := newTestNand()
+	n.bad[64] = true // block 1
+	n.fail[128] = true
+
+	// 2.5 blocks of pages with OOB
+	chunk := int(testInfo.WriteSize + testInfo.OobSize)
+	in := make([]byte, 10*chunk)
+	for i := range in {
+		in[i] = byte(i / chunk)
+	}
+	written, err := write(n, testInfo, bytes.NewReader(in), writeOpts{
+		oob:     true,
+		markBad: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 10*16 {
+		t.Error("wrote", written)
+	}
+	if !n.bad[128] {
+		t.Error("failed block not marked bad")
+	}
+	// blocks 0, 3 and 4
+	if n.data[0] != 0 || n.data[3*64] != 4 || n.data[4*64+16] != 9 ||
+		n.data[4*64+32] != 0xff {
+		t.Error("unexpected data")
+	}
+	if n.oob[3*16] != 4 {
+		t.Error("unexpected oob")
+	}
+
+	var out bytes.Buffer
+	err = dump(n, testInfo, &out, dumpOpts{
+		length: 5 * 64,
+		oob:    true,
+		bb:     SkipBad,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 3*4*chunk {
+		t.Fatal("dumped", out.Len())
+	}
+	if !bytes.Equal(out.Bytes()[:10*chunk], in) {
+		t.Error("dump mismatch")
+	}
+
+	out.Reset()
+	err = dump(n, testInfo, &out, dumpOpts{length: 2 * 64, bb: PadBad})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 2*64 || out.Bytes()[64] != 0xff {
+		t.Error("unexpected padbad dump")
+	}
+
+	if _, err = write(n, testInfo, bytes.NewReader(in[:20]),
+		writeOpts{start: 5 * 64}); err == nil {
+		t.Error("wrote a partial page without -p")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	n := newTestNand()
+	img := bytes.Repeat([]byte("flash"), 30)
+	fill(n.data, 0)
+	var buf bytes.Buffer
+	if err := copyImage(n, testInfo, img, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(n.data[:len(img)], img) ||
+		n.data[len(img)] != 0xff || n.data[3*64] != 0 {
+		t.Error("unexpected data")
+	}
+}
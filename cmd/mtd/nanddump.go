@@ -0,0 +1,110 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mtd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/internal/mtd"
+	"github.com/platinasystems/goes/lang"
+)
+
+type DumpCommand struct{}
+
+func (DumpCommand) String() string { return "nanddump" }
+
+func (DumpCommand) Usage() string {
+	return "nanddump [OPTION]... DEVICE"
+}
+
+func (DumpCommand) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "dump the contents of an MTD device",
+	}
+}
+
+func (DumpCommand) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Dump the pages of the MTD DEVICE to stdout or a file.
+
+OPTIONS
+	-f FILE		output file
+	-s START	page aligned start offset
+	-l LENGTH	bytes to dump, rounded up to a whole page
+	-o, --oob	follow each page with its OOB
+	-n, --noecc	read without error correction
+	--bb METHOD	of bad blocks, one of:
+			padbad	  dump 0xff instead (default)
+			skipbad	  omit them
+			dumpbad	  dump them as read`,
+	}
+}
+
+func (DumpCommand) Main(args ...string) error {
+	flag, args := flags.New(args, []string{"-o", "--oob"},
+		[]string{"-n", "--noecc"})
+	parm, args := parms.New(args, "-f", "-s", "-l", "--bb")
+	if len(args) != 1 {
+		return fmt.Errorf("DEVICE: missing or unexpected")
+	}
+	opts := dumpOpts{
+		oob: flag.ByName["-o"],
+		bb:  PadBad,
+	}
+	if s := parm.ByName["--bb"]; len(s) > 0 {
+		switch s {
+		case SkipBad, PadBad, DumpBad:
+			opts.bb = s
+		default:
+			return fmt.Errorf("%s: unknown bad block method", s)
+		}
+	}
+	for _, x := range []struct {
+		name string
+		p    *int64
+	}{
+		{"-s", &opts.start},
+		{"-l", &opts.length},
+	} {
+		if s := parm.ByName[x.name]; len(s) > 0 {
+			i, err := strconv.ParseInt(s, 0, 64)
+			if err != nil || i < 0 {
+				return fmt.Errorf("%s: invalid", s)
+			}
+			*x.p = i
+		}
+	}
+	fn, err := mtd.Find(args[0])
+	if err != nil {
+		return err
+	}
+	d, err := mtd.Open(fn, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if flag.ByName["-n"] {
+		if err = d.SetFileMode(mtd.FileModeRaw); err != nil {
+			return err
+		}
+	}
+	var w io.Writer = os.Stdout
+	if out := parm.ByName["-f"]; len(out) > 0 {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return dump(d, d.Info, w, opts)
+}
@@ -0,0 +1,101 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mtd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/internal/mtd"
+	"github.com/platinasystems/goes/lang"
+)
+
+type WriteCommand struct{}
+
+func (WriteCommand) String() string { return "nandwrite" }
+
+func (WriteCommand) Usage() string {
+	return "nandwrite [OPTION]... DEVICE [FILE]"
+}
+
+func (WriteCommand) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "write an image to an MTD device",
+	}
+}
+
+func (WriteCommand) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Write FILE, or stdin, to the erased MTD DEVICE, skipping bad
+	blocks. Erase the device with flash_eraseall beforehand.
+
+OPTIONS
+	-s START	erase block aligned start offset
+	-p, --pad	pad the last page with 0xff
+	-o, --oob	the image has OOB following each page
+	-a, --autoplace	write OOB to the free bytes of the ECC layout
+	-n, --noecc	write without error correction
+	-m, --markbad	mark blocks bad on write failure and continue`,
+	}
+}
+
+func (WriteCommand) Main(args ...string) error {
+	flag, args := flags.New(args,
+		[]string{"-p", "--pad"},
+		[]string{"-o", "--oob"},
+		[]string{"-a", "--autoplace"},
+		[]string{"-n", "--noecc"},
+		[]string{"-m", "--markbad"})
+	parm, args := parms.New(args, "-s")
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("DEVICE: missing or unexpected")
+	}
+	opts := writeOpts{
+		pad:     flag.ByName["-p"],
+		oob:     flag.ByName["-o"],
+		markBad: flag.ByName["-m"],
+		mode:    mtd.OpsPlaceOob,
+	}
+	switch {
+	case flag.ByName["-n"]:
+		opts.mode = mtd.OpsRaw
+	case flag.ByName["-a"]:
+		opts.mode = mtd.OpsAutoOob
+	}
+	if s := parm.ByName["-s"]; len(s) > 0 {
+		i, err := strconv.ParseInt(s, 0, 64)
+		if err != nil || i < 0 {
+			return fmt.Errorf("%s: invalid", s)
+		}
+		opts.start = i
+	}
+	fn, err := mtd.Find(args[0])
+	if err != nil {
+		return err
+	}
+	d, err := mtd.Open(fn, os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	var r io.Reader = os.Stdin
+	if len(args) > 1 && args[1] != "-" {
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	n, err := write(d, d.Info, r, opts)
+	fmt.Printf("wrote %d bytes to %s\n", n, fn)
+	return err
+}
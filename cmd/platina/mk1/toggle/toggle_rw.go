@@ -53,6 +53,9 @@ func clearJ() {
 	}
 }
 
+// DoI2cRpc does the ops of j with i2cd, which must be run with -legacy.
+//
+// Deprecated: use i2creq.
 func DoI2cRpc() error {
 	if dialed == 0 {
 		client, err := rpc.DialHTTP("tcp", "127.0.0.1"+":1233")
@@ -0,0 +1,167 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package pmbus provides the cli command to access PMBus devices.
+package pmbus
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/i2c"
+	"github.com/platinasystems/goes/internal/pmbus"
+	"github.com/platinasystems/goes/lang"
+)
+
+type Command struct{}
+
+func (Command) String() string { return "pmbus" }
+
+func (Command) Usage() string {
+	return "pmbus [-pec] BUS.ADDR | BUS/MUX:CHANNEL[/...]/ADDR [dump | status | COMMAND [VALUE]]"
+}
+
+func (Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "read/write PMBus devices",
+	}
+}
+
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Dump, read or write the commands of the PMBus device at the hex
+	ADDR of /dev/i2c-BUS, or BUS/MUX:CHANNEL[/...]/ADDR of one behind
+	PCA954x muxes. COMMAND is a name, e.g. READ_VOUT, or code.
+
+	Linear and VOUT_MODE formatted values are in volts, amps, watts,
+	degrees C or RPM; others are hex.
+
+	Examples:
+	    pmbus 1.58                   dump the supported commands
+	    pmbus 1.58 status            decode STATUS_WORD and details
+	    pmbus 1.58 read_vout         print the output voltage
+	    pmbus 1.58 vout_command 12   set the output voltage
+	    pmbus 1.58 clear_faults      send CLEAR_FAULTS
+	    pmbus 1/70:2/58 read_vin     of a PSU behind mux channel 2
+
+OPTIONS
+	-pec	with packet error checking`,
+	}
+}
+
+func (Command) Main(args ...string) error {
+	flag, args := flags.New(args, "-pec")
+	if len(args) == 0 {
+		return fmt.Errorf("BUS.ADDR: missing")
+	}
+	p, err := path(args[0])
+	if err != nil {
+		return err
+	}
+	args = args[1:]
+	return i2c.DoPath(p, func(dev i2c.Device) error {
+		d := &pmbus.Device{Bus: dev}
+		if flag.ByName["-pec"] {
+			if err := d.SetPEC(true); err != nil {
+				return err
+			}
+		}
+		return do(d, args)
+	})
+}
+
+// path parses BUS.ADDR as the i2c command or an i2c.Path.
+func path(s string) (i2c.Path, error) {
+	var p i2c.Path
+	if strings.IndexByte(s, '/') >= 0 {
+		return i2c.ParseHexPath(s)
+	}
+	if _, err := fmt.Sscanf(s, "%x.%x", &p.Bus, &p.Addr); err != nil {
+		return p, fmt.Errorf("%s: invalid BUS.ADDR", s)
+	}
+	return p, nil
+}
+
+func do(d *pmbus.Device, args []string) error {
+	op := "dump"
+	if len(args) > 0 {
+		op, args = args[0], args[1:]
+	}
+	switch op {
+	case "dump":
+		return Dump(os.Stdout, d)
+	case "status":
+		return Status(os.Stdout, d)
+	}
+	c, err := pmbus.Lookup(op)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(args) > 1:
+		return fmt.Errorf("%v: unexpected", args[1:])
+	case len(args) == 1:
+		return d.Set(c, args[0])
+	case c.Size == pmbus.SendByte:
+		return d.Set(c, "")
+	}
+	s, err := d.Get(c)
+	if err != nil {
+		return err
+	}
+	fmt.Println(s)
+	return nil
+}
+
+// Dump prints the value of each readable command that the device supports,
+// i.e. those that it doesn't NAK.
+func Dump(w io.Writer, d *pmbus.Device) error {
+	n := 0
+	for i := range pmbus.Commands {
+		c := &pmbus.Commands[i]
+		if c.Size == pmbus.SendByte {
+			continue
+		}
+		if s, err := d.Get(c); err == nil {
+			fmt.Fprintf(w, "%s: %s\n", c, s)
+			n++
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("no response")
+	}
+	return nil
+}
+
+// Status prints STATUS_WORD and the status commands of its set bits.
+func Status(w io.Writer, d *pmbus.Device) error {
+	sw, err := d.StatusWord()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "STATUS_WORD: %#04x %s\n", uint16(sw), sw)
+	var bits []int
+	for bit := range pmbus.StatusDetail {
+		bits = append(bits, int(bit))
+	}
+	sort.Ints(bits)
+	for _, bit := range bits {
+		if sw&pmbus.StatusWord(bit) == 0 {
+			continue
+		}
+		c, _ := pmbus.Lookup(pmbus.StatusDetail[pmbus.StatusWord(bit)])
+		s, err := d.Get(c)
+		if err != nil {
+			s = err.Error()
+		}
+		fmt.Fprintf(w, "%s: %s\n", c, s)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package sensord polls the i2c sensors of a machine description and
+// publishes their readings and alarms to redis.
+package sensord
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/log"
+	"github.com/platinasystems/goes/external/redis/publisher"
+	"github.com/platinasystems/goes/external/sensor"
+	"github.com/platinasystems/goes/lang"
+)
+
+const ConfigFile = "/etc/goes/sensord"
+
+type Command struct {
+	// Config, if set, is the machine's description of its sensors;
+	// otherwise, that of the CONFIG file is used.
+	Config *sensor.Config
+
+	pub *publisher.Publisher
+}
+
+func (*Command) String() string { return "sensord" }
+
+func (*Command) Usage() string { return "sensord [-n] [CONFIG]" }
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "i2c sensor daemon, publishes to redis",
+	}
+}
+
+func (*Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Poll the i2c sensors described by the machine or the CONFIG file,
+	default: ` + ConfigFile + `, with lines of:
+
+	interval DURATION	between polls, default: 5s
+	device NAME TYPE PATH [shunt OHMS]
+	high READING WARN CRIT [HYSTERESIS]
+	low READING WARN CRIT [HYSTERESIS]
+
+	TYPE is one of lm75, tmp102, ina219, pmbus or max31790. PATH is
+	BUS[/MUX:CHANNEL].../ADDR, e.g. 0/0x70:3/0x48 of a device behind
+	channel 3 of the PCA954x mux at 0x70 of /dev/i2c-0.
+
+	READING is NAME.temp of temperature sensors; NAME.voltage, current
+	and power of the ina219; NAME.vin, iin, vout, iout, temp, fan, pout
+	and pin of PMBus PSUs; and NAME.fan1 through fan6 of the max31790.
+	An alarm is raised when a reading is at or past its WARN or CRIT
+	threshold, "-" to disable, and cleared when HYSTERESIS back from it.
+
+	The readings, alarms and device errors are published as:
+		NAME.READING.units.UNIT: VALUE
+		NAME.READING.alarm: ok | warning | critical
+		NAME.status: ok | ERROR
+
+OPTIONS
+	-n	poll once and print rather than publish`,
+	}
+}
+
+func (*Command) Kind() cmd.Kind { return cmd.Daemon }
+
+func (c *Command) Main(args ...string) error {
+	once := len(args) > 0 && args[0] == "-n"
+	if once {
+		args = args[1:]
+	}
+	cfg := c.Config
+	if cfg == nil || len(args) > 0 {
+		fn := ConfigFile
+		if len(args) > 0 {
+			fn = args[0]
+		}
+		var err error
+		if cfg, err = sensor.LoadConfig(fn); err != nil {
+			return err
+		}
+	}
+	p := &sensor.Poller{
+		Devices:    cfg.Devices,
+		Thresholds: cfg.Thresholds,
+	}
+	if once {
+		p.Poll(func(s string) { fmt.Println(s) })
+		return nil
+	}
+	if len(cfg.Devices) == 0 {
+		<-goes.Stop
+		return nil
+	}
+	var err error
+	if c.pub, err = publisher.New(); err != nil {
+		return err
+	}
+	defer c.pub.Close()
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = sensor.DefaultInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		c.poll(p)
+		select {
+		case <-goes.Stop:
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Command) poll(p *sensor.Poller) {
+	for _, a := range p.Poll(func(s string) { c.pub.Print(s) }) {
+		switch a.Level {
+		case sensor.Critical:
+			log.Print("crit", a)
+		case sensor.Warning:
+			log.Print("warn", a)
+		default:
+			log.Print("note", a)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/platinasystems/goes"
 	"github.com/platinasystems/goes/cmd"
 	"github.com/platinasystems/goes/external/log"
+	"github.com/platinasystems/goes/internal/audit"
 	"github.com/platinasystems/goes/internal/prog"
 	"github.com/platinasystems/goes/lang"
 	"github.com/platinasystems/ssh_key_helper"
@@ -81,18 +82,30 @@ func (c *Command) Main(args ...string) (err error) {
 	}
 
 	srv.Handle(func(s ssh.Session) {
+		var env []string
+		sess := &audit.Session{
+			Name: "ssh",
+			User: s.User(),
+			Addr: s.RemoteAddr().String(),
+		}
 		cmdline := s.Command()
 		if len(cmdline) == 0 {
 			cmdline = []string{"cli"}
+		} else {
+			env = append(env, audit.ExecEnv+"=true")
 		}
 		cmd := prog.Command(cmdline...)
 		ptyReq, winCh, isPty := s.Pty()
 		if isPty {
 			cmd.Env = append(cmd.Env, fmt.Sprintf("TERM=%s", ptyReq.Term))
+			cmd.Env = append(cmd.Env, env...)
 			f, err := pty.Start(cmd)
 			if err != nil {
 				panic(err)
 			}
+			// pty.Start makes the child a session leader
+			startSession(cmd.Process.Pid, sess)
+			defer audit.EndSession(cmd.Process.Pid)
 			goes.WG.Add(1)
 			go func() {
 				defer goes.WG.Done()
@@ -112,14 +125,19 @@ func (c *Command) Main(args ...string) (err error) {
 			}()
 			io.Copy(s, f) // stdout
 		} else {
+			cmd.Env = append(os.Environ(), env...)
 			cmd.Stdin = s // blocks exit - do not know why
 			cmd.Stdout = s
 			cmd.Stderr = s.Stderr()
+			cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 			err := cmd.Start()
 			if err != nil {
 				fmt.Printf("cmd.Start() returns %s\n", err)
 				s.Exit(1)
+				return
 			}
+			startSession(cmd.Process.Pid, sess)
+			defer audit.EndSession(cmd.Process.Pid)
 			err = cmd.Wait()
 			log.Print("sshd wait exited ", err)
 			if err == nil {
@@ -178,3 +196,11 @@ func (c *Command) Main(args ...string) (err error) {
 		}
 	}
 }
+
+// startSession records the authenticated identity of the session for the
+// audit of its commands.
+func startSession(leader int, sess *audit.Session) {
+	if err := audit.StartSession(leader, sess); err != nil {
+		log.Print("sshd: audit: ", err)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/ramr/go-reaper"
 
 	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd/update"
 	"github.com/platinasystems/goes/external/parms"
 	"github.com/platinasystems/goes/internal/assert"
 	"github.com/platinasystems/goes/internal/prog"
@@ -151,6 +152,15 @@ func (c *Command) Main(args ...string) error {
 		}
 	}
 
+	// having started, confirm the goes image installed by update
+	if _, found := c.g.ByName["update"]; found {
+		if _, xerr := os.Stat(update.ConfigFile); xerr == nil {
+			if err = c.g.Main("update", "--good"); err != nil {
+				fmt.Fprintln(os.Stderr, "update:", err)
+			}
+		}
+	}
+
 	if os.Getpid() != 1 {
 		return nil
 	}
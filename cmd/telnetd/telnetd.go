@@ -17,6 +17,7 @@ import (
 
 	"github.com/creack/pty"
 	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/internal/audit"
 	"github.com/platinasystems/goes/internal/telnet/command"
 	"github.com/platinasystems/goes/internal/telnet/option"
 	"github.com/platinasystems/goes/lang"
@@ -84,10 +85,19 @@ func (Command) Main(args ...string) error {
 			pts.Close()
 			continue
 		}
+		// the Setsid child leads the session
+		err = audit.StartSession(proc.Pid, &audit.Session{
+			Name: "telnet",
+			Addr: conn.RemoteAddr().String(),
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "telnetd: audit:", err)
+		}
 		go func() { io.Copy(conn, pts) }()
 		go nullFilteredCopy(pts, conn)
 		go func() {
 			proc.Wait()
+			audit.EndSession(proc.Pid)
 			pts.Close()
 			conn.Close()
 		}()
@@ -0,0 +1,76 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ubi
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// These UBI ioctls aren't in github.com/platinasystems/ubi.
+var (
+	UBI_IOCRMVOL = iow('o', 1, 4)
+	UBI_IOCRSVOL = iow('o', 2, 12) // packed struct ubi_rsvol_req
+	UBI_IOCVOLUP = iow('O', 0, 8)
+)
+
+func iow(t, nr, size uintptr) uintptr {
+	return 1<<30 | size<<16 | t<<8 | nr
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req,
+		uintptr(arg))
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+func openDev(dev int) (*os.File, error) {
+	return os.OpenFile(DevPath(dev), os.O_RDWR, 0)
+}
+
+// rmvol removes the volume.
+func rmvol(dev, id int) error {
+	f, err := openDev(dev)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	vid := int32(id)
+	if err = ioctl(f, UBI_IOCRMVOL, unsafe.Pointer(&vid)); err != nil {
+		return fmt.Errorf("%s: remove volume %d: %w", f.Name(), id, err)
+	}
+	return nil
+}
+
+// rsvol resizes the volume.
+func rsvol(dev, id int, bytes int64) error {
+	f, err := openDev(dev)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var req [12]byte
+	*(*int64)(unsafe.Pointer(&req[0])) = bytes
+	*(*int32)(unsafe.Pointer(&req[8])) = int32(id)
+	if err = ioctl(f, UBI_IOCRSVOL, unsafe.Pointer(&req)); err != nil {
+		return fmt.Errorf("%s: resize volume %d: %w", f.Name(), id,
+			err)
+	}
+	return nil
+}
+
+// volup starts an update of bytes to the open volume that completes once
+// those are written. An update of zero bytes truncates the volume.
+func volup(f *os.File, bytes int64) error {
+	if err := ioctl(f, UBI_IOCVOLUP, unsafe.Pointer(&bytes)); err != nil {
+		return fmt.Errorf("%s: update: %w", f.Name(), err)
+	}
+	return nil
+}
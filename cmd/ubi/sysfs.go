@@ -0,0 +1,204 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ubi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// These are variables for tests.
+var (
+	SysClassUbi = "/sys/class/ubi"
+	DevDir      = "/dev"
+)
+
+// Dev is an attached UBI device.
+type Dev struct {
+	Num       int
+	Mtd       int
+	LebSize   int64
+	TotalLebs int64
+	AvailLebs int64
+	BadPebs   int64
+	MinIO     int64
+	MaxVols   int64
+	Volumes   []*Vol
+}
+
+// Vol is a UBI volume.
+type Vol struct {
+	Dev          int
+	ID           int
+	Name         string
+	Type         string // static or dynamic
+	Bytes        int64
+	ReservedLebs int64
+	Alignment    int64
+	Corrupted    bool
+	UpdMarker    bool
+}
+
+func DevPath(dev int) string {
+	return filepath.Join(DevDir, "ubi"+strconv.Itoa(dev))
+}
+
+func (v *Vol) Path() string {
+	return fmt.Sprint(DevPath(v.Dev), "_", v.ID)
+}
+
+// Devices returns the numbers of the attached UBI devices.
+func Devices() ([]int, error) {
+	fis, err := ioutil.ReadDir(SysClassUbi)
+	if err != nil {
+		return nil, err
+	}
+	var l []int
+	for _, fi := range fis {
+		s := strings.TrimPrefix(fi.Name(), "ubi")
+		if n, err := strconv.Atoi(s); err == nil && s != fi.Name() {
+			l = append(l, n)
+		}
+	}
+	sort.Ints(l)
+	return l, nil
+}
+
+// ParseDev returns the number of /dev/ubiN, ubiN or N.
+func ParseDev(s string) (int, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, DevDir+"/"), "ubi")
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: invalid UBI device", s)
+	}
+	return n, nil
+}
+
+// ReadDev returns the attributes of the device and its volumes.
+func ReadDev(n int) (*Dev, error) {
+	name := "ubi" + strconv.Itoa(n)
+	dir := filepath.Join(SysClassUbi, name)
+	var err error
+	num := func(fn string) int64 {
+		if err != nil {
+			return 0
+		}
+		var i int64
+		i, err = readInt(filepath.Join(dir, fn))
+		return i
+	}
+	d := &Dev{Num: n}
+	d.Mtd = int(num("mtd_num"))
+	d.LebSize = num("eraseblock_size")
+	d.TotalLebs = num("total_eraseblocks")
+	d.AvailLebs = num("avail_eraseblocks")
+	d.BadPebs = num("bad_peb_count")
+	d.MinIO = num("min_io_size")
+	d.MaxVols = num("max_vol_count")
+	if err != nil {
+		return nil, err
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range fis {
+		if !strings.HasPrefix(fi.Name(), name+"_") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(fi.Name(), name+"_"))
+		if err != nil {
+			continue
+		}
+		v, err := readVol(filepath.Join(dir, fi.Name()), n, id)
+		if err != nil {
+			return nil, err
+		}
+		d.Volumes = append(d.Volumes, v)
+	}
+	sort.Slice(d.Volumes, func(i, j int) bool {
+		return d.Volumes[i].ID < d.Volumes[j].ID
+	})
+	return d, nil
+}
+
+func readVol(dir string, dev, id int) (*Vol, error) {
+	v := &Vol{Dev: dev, ID: id}
+	var err error
+	str := func(fn string) string {
+		if err != nil {
+			return ""
+		}
+		var b []byte
+		b, err = ioutil.ReadFile(filepath.Join(dir, fn))
+		return strings.TrimSpace(string(b))
+	}
+	num := func(fn string) int64 {
+		if err != nil {
+			return 0
+		}
+		var i int64
+		i, err = readInt(filepath.Join(dir, fn))
+		return i
+	}
+	v.Name = str("name")
+	v.Type = str("type")
+	v.Bytes = num("data_bytes")
+	v.ReservedLebs = num("reserved_ebs")
+	v.Alignment = num("alignment")
+	v.Corrupted = num("corrupted") != 0
+	v.UpdMarker = num("upd_marker") != 0
+	return v, err
+}
+
+// Volume returns the volume of the device with the given id, if not
+// negative, or name.
+func (d *Dev) Volume(id int, name string) (*Vol, error) {
+	for _, v := range d.Volumes {
+		if (id >= 0 && v.ID == id) || (id < 0 && v.Name == name) {
+			return v, nil
+		}
+	}
+	if id >= 0 {
+		return nil, fmt.Errorf("ubi%d: volume %d: not found", d.Num, id)
+	}
+	return nil, fmt.Errorf("ubi%d: %s: not found", d.Num, name)
+}
+
+func readInt(fn string) (int64, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(b)), 0, 64)
+}
+
+// ParseSize returns the bytes of N, NKiB, NMiB or NGiB.
+func ParseSize(s string) (int64, error) {
+	mul := int64(1)
+	for _, x := range []struct {
+		suffix string
+		mul    int64
+	}{
+		{"KiB", 1 << 10},
+		{"MiB", 1 << 20},
+		{"GiB", 1 << 30},
+	} {
+		if strings.HasSuffix(s, x.suffix) {
+			s = strings.TrimSuffix(s, x.suffix)
+			mul = x.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: invalid size", s)
+	}
+	return n * mul, nil
+}
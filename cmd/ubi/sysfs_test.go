@@ -0,0 +1,84 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ubi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadDev(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ubi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(s string) { SysClassUbi = s }(SysClassUbi)
+	SysClassUbi = dir
+	for fn, s := range map[string]string{
+		"ubi0/mtd_num":             "3",
+		"ubi0/eraseblock_size":     "126976",
+		"ubi0/total_eraseblocks":   "1000",
+		"ubi0/avail_eraseblocks":   "200",
+		"ubi0/bad_peb_count":       "2",
+		"ubi0/min_io_size":         "2048",
+		"ubi0/max_vol_count":       "128",
+		"ubi0/ubi0_1/name":         "data",
+		"ubi0/ubi0_1/type":         "dynamic",
+		"ubi0/ubi0_1/data_bytes":   "1015808",
+		"ubi0/ubi0_1/reserved_ebs": "8",
+		"ubi0/ubi0_1/alignment":    "1",
+		"ubi0/ubi0_1/corrupted":    "0",
+		"ubi0/ubi0_1/upd_marker":   "1",
+	} {
+		fn = filepath.Join(dir, fn)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err = ioutil.WriteFile(fn, []byte(s+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	devs, err := Devices()
+	if err != nil || len(devs) != 1 || devs[0] != 0 {
+		t.Fatal("devices", devs, err)
+	}
+	d, err := ReadDev(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Mtd != 3 || d.LebSize != 126976 || d.AvailLebs != 200 ||
+		len(d.Volumes) != 1 {
+		t.Fatalf("unexpected %+v", d)
+	}
+	v, err := d.Volume(-1, "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != 1 || v.Bytes != 1015808 || !v.UpdMarker ||
+		v.Path() != "/dev/ubi0_1" {
+		t.Errorf("unexpected %+v", v)
+	}
+	if _, err = d.Volume(2, ""); err == nil {
+		t.Error("found volume 2")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"4096":   4096,
+		"64KiB":  64 << 10,
+		"10MiB":  10 << 20,
+		"1GiB":   1 << 30,
+		"0x1000": 4096,
+	} {
+		if n, err := ParseSize(s); err != nil || n != want {
+			t.Error(s, n, err)
+		}
+	}
+	if _, err := ParseSize("10MB"); err == nil {
+		t.Error("parsed 10MB")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ubi
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/lang"
+	"github.com/platinasystems/ubi"
+)
+
+type MkvolCommand struct{}
+
+func (MkvolCommand) String() string { return "ubimkvol" }
+
+func (MkvolCommand) Usage() string {
+	return "ubimkvol UBI-DEVICE -N NAME (-s SIZE | -m) [OPTION]..."
+}
+
+func (MkvolCommand) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "create a UBI volume",
+	}
+}
+
+func (MkvolCommand) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Create a volume on the UBI-DEVICE, /dev/ubiN, ubiN or N.
+
+OPTIONS
+	-N NAME		volume name
+	-s SIZE		volume size in bytes, KiB, MiB or GiB
+	-m		the maximum available size
+	-n ID		volume id, default: the next free
+	-t TYPE		static or dynamic (default)
+	-a ALIGNMENT	volume alignment, default: 1
+
+EXAMPLES
+	ubimkvol /dev/ubi0 -N rootfs -s 64MiB`,
+	}
+}
+
+func (MkvolCommand) Main(args ...string) error {
+	flag, args := flags.New(args, "-m")
+	parm, args := parms.New(args, "-N", "-s", "-n", "-t", "-a")
+	if len(args) != 1 {
+		return fmt.Errorf("UBI-DEVICE: missing or unexpected")
+	}
+	dev, err := ParseDev(args[0])
+	if err != nil {
+		return err
+	}
+	name := parm.ByName["-N"]
+	if len(name) == 0 {
+		return fmt.Errorf("-N NAME: missing")
+	}
+	id, align := int32(ubi.VolNumAuto), int32(1)
+	for _, x := range []struct {
+		name string
+		p    *int32
+	}{
+		{"-n", &id},
+		{"-a", &align},
+	} {
+		if s := parm.ByName[x.name]; len(s) > 0 {
+			i, err := strconv.ParseInt(s, 0, 32)
+			if err != nil || i < 0 {
+				return fmt.Errorf("%s: invalid", s)
+			}
+			*x.p = int32(i)
+		}
+	}
+	static := false
+	switch t := parm.ByName["-t"]; t {
+	case "", "dynamic":
+	case "static":
+		static = true
+	default:
+		return fmt.Errorf("%s: unknown volume type", t)
+	}
+	var size int64
+	switch s := parm.ByName["-s"]; {
+	case flag.ByName["-m"] && len(s) > 0:
+		return fmt.Errorf("-s and -m are exclusive")
+	case flag.ByName["-m"]:
+		d, err := ReadDev(dev)
+		if err != nil {
+			return err
+		}
+		leb := d.LebSize - d.LebSize%int64(align)
+		size = d.AvailLebs * leb
+		if size == 0 {
+			return fmt.Errorf("ubi%d: no space available", dev)
+		}
+	case len(s) > 0:
+		if size, err = ParseSize(s); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("-s SIZE or -m: missing")
+	}
+	err = ubi.Mkvol(dev, id, align, static, size, name)
+	if err != nil {
+		return fmt.Errorf("ubi%d: %s: %w", dev, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ubi
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/platinasystems/goes/lang"
+)
+
+type InfoCommand struct{}
+
+func (InfoCommand) String() string { return "ubinfo" }
+
+func (InfoCommand) Usage() string { return "ubinfo [UBI-DEVICE]..." }
+
+func (InfoCommand) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "print UBI device and volume information",
+	}
+}
+
+func (InfoCommand) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Print the MTD device, eraseblock counts and volumes of each
+	UBI-DEVICE, /dev/ubiN, ubiN or N; default, all attached devices.`,
+	}
+}
+
+func (InfoCommand) Main(args ...string) error {
+	var devs []int
+	if len(args) == 0 {
+		var err error
+		if devs, err = Devices(); err != nil {
+			return err
+		}
+	}
+	for _, arg := range args {
+		dev, err := ParseDev(arg)
+		if err != nil {
+			return err
+		}
+		devs = append(devs, dev)
+	}
+	for i, dev := range devs {
+		d, err := ReadDev(dev)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		d.Print(os.Stdout)
+	}
+	return nil
+}
+
+func (d *Dev) Print(w io.Writer) {
+	fmt.Fprintf(w, "%s: mtd%d\n", DevPath(d.Num), d.Mtd)
+	fmt.Fprintf(w, "  LEB size: %d bytes, minimum I/O: %d bytes\n",
+		d.LebSize, d.MinIO)
+	fmt.Fprintf(w, "  LEBs: %d total, %d available, %d bad PEBs\n",
+		d.TotalLebs, d.AvailLebs, d.BadPebs)
+	fmt.Fprintf(w, "  volumes: %d of %d\n", len(d.Volumes), d.MaxVols)
+	for _, v := range d.Volumes {
+		fmt.Fprintf(w, "  %s: %q %s, %d bytes, %d LEBs", v.Path(),
+			v.Name, v.Type, v.Bytes, v.ReservedLebs)
+		if v.Corrupted {
+			fmt.Fprint(w, ", corrupted")
+		}
+		if v.UpdMarker {
+			fmt.Fprint(w, ", update interrupted")
+		}
+		fmt.Fprintln(w)
+	}
+}
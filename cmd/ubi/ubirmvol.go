@@ -0,0 +1,72 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ubi
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/lang"
+)
+
+type RmvolCommand struct{}
+
+func (RmvolCommand) String() string { return "ubirmvol" }
+
+func (RmvolCommand) Usage() string {
+	return "ubirmvol UBI-DEVICE (-n ID | -N NAME)"
+}
+
+func (RmvolCommand) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "remove a UBI volume",
+	}
+}
+
+func (RmvolCommand) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Remove the volume, by id or name, of the UBI-DEVICE, /dev/ubiN,
+	ubiN or N.`,
+	}
+}
+
+func (RmvolCommand) Main(args ...string) error {
+	parm, args := parms.New(args, "-n", "-N")
+	v, err := volumeArgs(args, parm)
+	if err != nil {
+		return err
+	}
+	return rmvol(v.Dev, v.ID)
+}
+
+// volumeArgs returns the volume of UBI-DEVICE (-n ID | -N NAME).
+func volumeArgs(args []string, parm *parms.Parms) (*Vol, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("UBI-DEVICE: missing or unexpected")
+	}
+	dev, err := ParseDev(args[0])
+	if err != nil {
+		return nil, err
+	}
+	d, err := ReadDev(dev)
+	if err != nil {
+		return nil, err
+	}
+	id, name := -1, parm.ByName["-N"]
+	if s := parm.ByName["-n"]; len(s) > 0 {
+		if len(name) > 0 {
+			return nil, fmt.Errorf("-n and -N are exclusive")
+		}
+		if id, err = strconv.Atoi(s); err != nil || id < 0 {
+			return nil, fmt.Errorf("%s: invalid volume id", s)
+		}
+	} else if len(name) == 0 {
+		return nil, fmt.Errorf("-n ID or -N NAME: missing")
+	}
+	return d.Volume(id, name)
+}
@@ -0,0 +1,52 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ubi
+
+import (
+	"fmt"
+
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/lang"
+)
+
+type RsvolCommand struct{}
+
+func (RsvolCommand) String() string { return "ubirsvol" }
+
+func (RsvolCommand) Usage() string {
+	return "ubirsvol UBI-DEVICE (-n ID | -N NAME) -s SIZE"
+}
+
+func (RsvolCommand) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "resize a UBI volume",
+	}
+}
+
+func (RsvolCommand) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Resize the volume, by id or name, of the UBI-DEVICE, /dev/ubiN,
+	ubiN or N, to SIZE bytes, KiB, MiB or GiB.`,
+	}
+}
+
+func (RsvolCommand) Main(args ...string) error {
+	parm, args := parms.New(args, "-n", "-N", "-s")
+	s := parm.ByName["-s"]
+	if len(s) == 0 {
+		return fmt.Errorf("-s SIZE: missing")
+	}
+	size, err := ParseSize(s)
+	if err != nil {
+		return err
+	}
+	v, err := volumeArgs(args, parm)
+	if err != nil {
+		return err
+	}
+	return rsvol(v.Dev, v.ID, size)
+}
@@ -0,0 +1,106 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ubi
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/lang"
+)
+
+type UpdatevolCommand struct{}
+
+func (UpdatevolCommand) String() string { return "ubiupdatevol" }
+
+func (UpdatevolCommand) Usage() string {
+	return "ubiupdatevol VOLUME (-t | [-s SIZE] FILE)"
+}
+
+func (UpdatevolCommand) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "write an image to a UBI volume",
+	}
+}
+
+func (UpdatevolCommand) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Replace the contents of the UBI VOLUME, e.g. /dev/ubi0_1, with FILE.
+	The volume is marked corrupt until the update completes, so an
+	interrupted update is detected by ubinfo.
+
+OPTIONS
+	-t		truncate, i.e. empty, the volume
+	-s SIZE		bytes of FILE, required if FILE is "-", i.e. stdin`,
+	}
+}
+
+func (UpdatevolCommand) Main(args ...string) error {
+	flag, args := flags.New(args, "-t")
+	parm, args := parms.New(args, "-s")
+	if flag.ByName["-t"] {
+		if len(args) != 1 {
+			return fmt.Errorf("VOLUME: missing or unexpected")
+		}
+		f, err := os.OpenFile(args[0], os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return volup(f, 0)
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("VOLUME FILE: missing or unexpected")
+	}
+	var size int64 = -1
+	if s := parm.ByName["-s"]; len(s) > 0 {
+		var err error
+		if size, err = ParseSize(s); err != nil {
+			return err
+		}
+	}
+	var r io.Reader = os.Stdin
+	if args[1] != "-" {
+		in, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		if size < 0 {
+			fi, err := in.Stat()
+			if err != nil {
+				return err
+			}
+			size = fi.Size()
+		}
+		r = in
+	} else if size < 0 {
+		return fmt.Errorf("-s SIZE: required with stdin")
+	}
+	f, err := os.OpenFile(args[0], os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return updatevol(f, r, size)
+}
+
+// updatevol writes size bytes of r to the volume.
+func updatevol(f *os.File, r io.Reader, size int64) error {
+	if err := volup(f, size); err != nil {
+		return err
+	}
+	n, err := io.CopyN(f, r, size)
+	if err != nil {
+		return fmt.Errorf("%s: update: %d of %d bytes: %w", f.Name(), n,
+			size, err)
+	}
+	return nil
+}
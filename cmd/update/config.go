@@ -0,0 +1,127 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package update
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/platinasystems/goes/internal/fit"
+)
+
+const ConfigFile = "/etc/goes/update"
+
+// Slot is a partition or file with a goes image that's booted by the
+// named grub menu entry.
+type Slot struct {
+	Name   string
+	Target string
+	Entry  string
+}
+
+type Config struct {
+	Slots   []*Slot
+	Grubenv string // the boot pointer
+	URL     string // default image
+	Keys    string // trusted image signature keys
+}
+
+func LoadConfig(fn string) (*Config, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := ReadConfig(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fn, err)
+	}
+	return cfg, err
+}
+
+func ReadConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{Keys: fit.KeyDir}
+	scan := bufio.NewScanner(r)
+	for line := 1; scan.Scan(); line++ {
+		s := scan.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "slot":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: expected slot NAME TARGET ENTRY",
+					line)
+			}
+			if cfg.Slot(fields[1]) != nil {
+				return nil, fmt.Errorf("line %d: %s: duplicate slot",
+					line, fields[1])
+			}
+			cfg.Slots = append(cfg.Slots, &Slot{
+				Name:   fields[1],
+				Target: fields[2],
+				// titles may have spaces
+				Entry: strings.Join(fields[3:], " "),
+			})
+		case "grubenv", "url", "keys":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: expected %s VALUE",
+					line, fields[0])
+			}
+			switch fields[0] {
+			case "grubenv":
+				cfg.Grubenv = fields[1]
+			case "url":
+				cfg.URL = fields[1]
+			case "keys":
+				cfg.Keys = fields[1]
+			}
+		default:
+			return nil, fmt.Errorf("line %d: %s: unexpected", line,
+				fields[0])
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Slots) != 2 {
+		return nil, fmt.Errorf("expected two slots")
+	}
+	if len(cfg.Grubenv) == 0 {
+		return nil, fmt.Errorf("missing grubenv")
+	}
+	return cfg, nil
+}
+
+// Slot returns the named slot or nil.
+func (cfg *Config) Slot(name string) *Slot {
+	for _, slot := range cfg.Slots {
+		if slot.Name == name {
+			return slot
+		}
+	}
+	return nil
+}
+
+// Other returns the slot that isn't the given one, or nil if that's nil
+// since either may be the booted slot.
+func (cfg *Config) Other(slot *Slot) *Slot {
+	if slot == nil {
+		return nil
+	}
+	for _, other := range cfg.Slots {
+		if other != slot {
+			return other
+		}
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package update installs goes images in the inactive of two slots and
+// boots the new image once, keeping it only if start reaches a healthy
+// state.
+package update
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/platinasystems/goes"
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/internal/buildid"
+	"github.com/platinasystems/goes/internal/cmdline"
+	"github.com/platinasystems/goes/internal/fit"
+	"github.com/platinasystems/goes/lang"
+	"github.com/platinasystems/url"
+)
+
+// Trial is the grubenv variable with the name of the slot that's booted
+// once as next_entry and not yet found good.
+const Trial = "goes_trial"
+
+// SlotParam is the kernel parameter that names the booted slot.
+const SlotParam = "goes.slot"
+
+const fdtMagic = 0xd00dfeed
+
+type Command struct {
+	g *goes.Goes
+}
+
+func (*Command) String() string { return "update" }
+
+func (*Command) Usage() string {
+	return "update [-c CONFIG] [OPTION]... [URL]"
+}
+
+func (*Command) Apropos() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: "install a goes image with rollback",
+	}
+}
+
+func (*Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Download a goes or initramfs image from URL, or the configured url,
+	to the inactive slot, verify it, then boot it once with next_entry.
+	"start" runs "update --good" once it reaches a healthy state; this
+	makes the new slot the saved_entry. Otherwise, the next boot, e.g.
+	after a panic or watchdog reset, returns to the old slot.
+
+	A FIT image must be signed by a trusted key of the configured keys
+	directory. Other images must have a detached signature by one of
+	those keys, from --sig or URL.sig, as made by:
+
+		openssl dgst -sha256 -sign KEY -out IMAGE.sig IMAGE
+
+	A checksum, given with --sha256, is checked in addition to, never
+	instead of, the signature. An ELF image must have the Go build id
+	given with --buildid or in URL.buildid.
+
+	The booted slot is named by the goes.slot= kernel parameter or is
+	that with the grubenv boot_entry.
+
+	The CONFIG file, default ` + ConfigFile + `, has lines of:
+
+	slot NAME TARGET ENTRY	a partition or file booted by the grub menu
+				ENTRY; there must be two slots
+	grubenv FILE		the boot pointer, e.g. /boot/grub/grubenv
+	url URL			the default image
+	keys DIR		trusted keys, default: ` + fit.KeyDir + `
+
+OPTIONS
+	-c CONFIG	alternate configuration
+	-S, --status	print the slots and boot variables
+	--good		confirm the booted slot
+	--reboot	reboot after installing
+	--sha256 HEX	expected checksum of the image
+	--sig FILE	detached signature, default: URL.sig
+	--buildid ID	expected build id of an ELF image
+	--slot NAME	install in this slot rather than the inactive one`,
+	}
+}
+
+func (c *Command) Goes(g *goes.Goes) { c.g = g }
+
+func (c *Command) Main(args ...string) error {
+	flag, args := flags.New(args, []string{"-S", "--status"},
+		"--good", "--reboot")
+	parm, args := parms.New(args, "-c", "--sha256", "--sig", "--buildid",
+		"--slot")
+	fn := parm.ByName["-c"]
+	if len(fn) == 0 {
+		fn = ConfigFile
+	}
+	cfg, err := LoadConfig(fn)
+	if err != nil {
+		return err
+	}
+	active := cfg.Active()
+	switch {
+	case flag.ByName["-S"]:
+		return cfg.Status(os.Stdout, active)
+	case flag.ByName["--good"]:
+		return cfg.Good(os.Stdout, active)
+	}
+	u := cfg.URL
+	switch len(args) {
+	case 0:
+		if len(u) == 0 {
+			return fmt.Errorf("URL: missing")
+		}
+	case 1:
+		u = args[0]
+	default:
+		return fmt.Errorf("%v: unexpected", args[1:])
+	}
+	slot := cfg.Other(active)
+	if name := parm.ByName["--slot"]; len(name) > 0 {
+		if slot = cfg.Slot(name); slot == nil {
+			return fmt.Errorf("%s: no such slot", name)
+		}
+	}
+	if slot == nil {
+		return fmt.Errorf("can't tell the booted slot, use --slot")
+	}
+	if slot == active {
+		return fmt.Errorf("%s: is the booted slot", slot.Name)
+	}
+	img := &Image{
+		Sum:     parm.ByName["--sha256"],
+		BuildID: parm.ByName["--buildid"],
+	}
+	if img.Data, err = fetch(u); err != nil {
+		return err
+	}
+	if !isFit(img.Data) {
+		fn := parm.ByName["--sig"]
+		if len(fn) == 0 {
+			fn = u + ".sig"
+		}
+		if img.Sig, err = fetch(fn); err != nil {
+			return fmt.Errorf("signature: %v", err)
+		}
+	}
+	if isElf(img.Data) && len(img.BuildID) == 0 {
+		img.BuildID = fetchField(u + ".buildid")
+	}
+	if err = cfg.Install(os.Stdout, slot, img); err != nil {
+		return err
+	}
+	if flag.ByName["--reboot"] {
+		return c.g.Main("reboot")
+	}
+	return nil
+}
+
+func fetch(u string) ([]byte, error) {
+	r, err := url.Open(u)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// fetchField returns the first field of the URL, e.g. that of
+// "go tool buildid", or an empty string if there isn't one.
+func fetchField(u string) string {
+	b, err := fetch(u)
+	if err != nil {
+		return ""
+	}
+	if fields := strings.Fields(string(b)); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// Active returns the booted slot or nil if unknown.
+func (cfg *Config) Active() *Slot {
+	if _, m, err := cmdline.New(); err == nil {
+		if slot := cfg.Slot(m[SlotParam]); slot != nil {
+			return slot
+		}
+	}
+	env, _ := grubenv.Read(cfg.Grubenv)
+	for _, slot := range cfg.Slots {
+		if slot.Entry == env[grubenv.BootEntry] {
+			return slot
+		}
+	}
+	return nil
+}
+
+// Image is a downloaded image and what's expected of it.
+type Image struct {
+	Data []byte
+	// Sig is the detached signature of an image other than FIT.
+	Sig []byte
+	// Sum, if set, is the SHA-256 checksum of Data.
+	Sum string
+	// BuildID is that of an ELF image.
+	BuildID string
+}
+
+func isFit(data []byte) bool {
+	return len(data) > 4 && binary.BigEndian.Uint32(data) == fdtMagic
+}
+
+func isElf(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("\x7fELF"))
+}
+
+// Install verifies then writes the image in the slot and sets it as the
+// next, one-shot, boot entry.
+func (cfg *Config) Install(w io.Writer, slot *Slot, img *Image) error {
+	if err := cfg.Verify(w, img); err != nil {
+		return err
+	}
+	if err := write(slot.Target, img.Data); err != nil {
+		return err
+	}
+	if err := check(slot.Target, img.Data); err != nil {
+		return err
+	}
+	err := grubenv.Update(cfg.Grubenv, func(env grubenv.Env) error {
+		env.Set(grubenv.NextEntry, slot.Entry)
+		env.Set(Trial, slot.Name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "installed slot %s, boots once as %q\n", slot.Name,
+		slot.Entry)
+	return nil
+}
+
+// Verify requires a valid signature by a trusted key, of a FIT image or
+// detached, the checksum, if given, and the build id of an ELF image.
+func (cfg *Config) Verify(w io.Writer, img *Image) error {
+	if len(img.Sum) > 0 {
+		got := sha256.Sum256(img.Data)
+		if !strings.EqualFold(hex.EncodeToString(got[:]), img.Sum) {
+			return fmt.Errorf("sha256 mismatch")
+		}
+	}
+	kr, err := fit.LoadKeyring(cfg.Keys)
+	if err != nil {
+		return err
+	}
+	if len(kr.Keys) == 0 {
+		return fmt.Errorf("%s: no trusted keys", cfg.Keys)
+	}
+	if isFit(img.Data) {
+		err = verifyFit(w, img.Data, kr)
+	} else if len(img.Sig) == 0 {
+		err = fmt.Errorf("missing signature")
+	} else {
+		var name string
+		if name, err = kr.VerifyDetached(img.Data, img.Sig); err == nil {
+			fmt.Fprintln(w, "signed by:", name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if isElf(img.Data) {
+		id, err := buildid.Read(bytes.NewReader(img.Data))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "build id:", id)
+		if len(img.BuildID) == 0 {
+			return fmt.Errorf("expected build id: missing")
+		}
+		if id != img.BuildID {
+			return fmt.Errorf("build id isn't the expected %s",
+				img.BuildID)
+		}
+	}
+	return nil
+}
+
+// verifyFit requires a valid signature of the default configuration by a
+// trusted key.
+func verifyFit(w io.Writer, data []byte, kr *fit.Keyring) error {
+	f, err := fit.Read(data)
+	if err != nil {
+		return err
+	}
+	conf := f.Configs[f.DefaultConfig]
+	if conf == nil {
+		return fmt.Errorf("%s: no such configuration", f.DefaultConfig)
+	}
+	// The signature covers the image hashes, not the data, so Read's
+	// recorded hash results must all be good, as Verify also checks.
+	for _, i := range conf.ImageList {
+		if len(i.Hashes) == 0 {
+			return fmt.Errorf("%s: %w: missing", i.Name, fit.ErrBadHash)
+		}
+		for _, h := range i.Hashes {
+			if h.Err != nil {
+				return fmt.Errorf("%s/%s: %w", i.Name, h.Name,
+					fit.ErrBadHash)
+			}
+		}
+	}
+	if err = f.Verify(conf.Name, kr); err != nil {
+		return err
+	}
+	// Verify passes unsigned images unless a key is required.
+	sigs, err := f.Signatures(conf)
+	if err != nil {
+		return err
+	}
+	for _, sig := range sigs {
+		if kr.Keys[sig.KeyName] != nil {
+			fmt.Fprintln(w, "signed by:", sig.KeyName)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w by a trusted key", conf.Name, fit.ErrUnsigned)
+}
+
+// write the image to a partition in place, or to a file by rename.
+func write(target string, data []byte) error {
+	fi, err := os.Stat(target)
+	if err == nil && fi.Mode()&os.ModeDevice != 0 {
+		f, err := os.OpenFile(target, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		size, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if size < int64(len(data)) {
+			return fmt.Errorf("%s: image exceeds %d bytes", target,
+				size)
+		}
+		if _, err = f.WriteAt(data, 0); err != nil {
+			return err
+		}
+		return f.Sync()
+	}
+	tmp := filepath.Join(filepath.Dir(target),
+		"."+filepath.Base(target)+".new")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, target)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// check reads back the written image.
+func check(target string, data []byte) error {
+	f, err := os.Open(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(f, int64(len(data))))
+	if err != nil {
+		return err
+	}
+	want := sha256.Sum256(data)
+	if n != int64(len(data)) || !bytes.Equal(h.Sum(nil), want[:]) {
+		return fmt.Errorf("%s: verify failed", target)
+	}
+	return nil
+}
+
+// Good makes the booted slot the default if it was on trial, and resets
+// boot counting. If another slot was on trial, it failed to boot.
+func (cfg *Config) Good(w io.Writer, active *Slot) error {
+	return grubenv.Update(cfg.Grubenv, func(env grubenv.Env) error {
+		env.Set(grubenv.RecordFail, "")
+		env.Set(grubenv.BootCount, "")
+		trial := env[Trial]
+		switch {
+		case len(trial) == 0:
+		case active != nil && trial == active.Name:
+			env.Set(grubenv.SavedEntry, active.Entry)
+			fmt.Fprintf(w, "slot %s is good\n", trial)
+		default:
+			fmt.Fprintf(w, "slot %s failed, rolled back\n", trial)
+		}
+		env.Set(Trial, "")
+		return nil
+	})
+}
+
+func (cfg *Config) Status(w io.Writer, active *Slot) error {
+	env, err := grubenv.Read(cfg.Grubenv)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, slot := range cfg.Slots {
+		var marks []string
+		if slot == active {
+			marks = append(marks, "booted")
+		}
+		if slot.Entry == env[grubenv.SavedEntry] {
+			marks = append(marks, "default")
+		}
+		if slot.Name == env[Trial] {
+			marks = append(marks, "trial")
+		}
+		fmt.Fprintf(w, "slot %s: %s %q", slot.Name, slot.Target,
+			slot.Entry)
+		if len(marks) > 0 {
+			fmt.Fprintf(w, " (%s)", strings.Join(marks, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "grubenv:", cfg.Grubenv)
+	vars := append(append([]string{}, grubenv.Vars...), Trial)
+	for _, k := range vars {
+		if v := env[k]; len(v) > 0 {
+			fmt.Fprintf(w, "%s: %s\n", k, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package update
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/goes/cmd/grub/grubenv"
+	"github.com/platinasystems/goes/internal/fit"
+)
+
+func TestConfig(t *testing.T) {
+	cfg, err := ReadConfig(strings.NewReader(`
+# comment
+slot a /dev/sda2 goes-a
+slot b /dev/sda3 Goes B
+grubenv /boot/grub/grubenv
+url http://images.example.com/goes.itb
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Slots) != 2 || cfg.Slot("b").Entry != "Goes B" ||
+		cfg.Other(cfg.Slot("a")) != cfg.Slot("b") ||
+		cfg.Other(nil) != nil ||
+		cfg.Grubenv != "/boot/grub/grubenv" ||
+		cfg.URL != "http://images.example.com/goes.itb" {
+		t.Fatalf("unexpected %+v", cfg)
+	}
+	for _, s := range []string{
+		"slot a /dev/sda2 goes-a\ngrubenv /boot/grub/grubenv",
+		"slot a /dev/sda2 goes-a\nslot b /dev/sda3 goes-b",
+		"slot a /dev/sda2 goes-a\nslot a /dev/sda3 goes-b",
+		"slot a /dev/sda2\n",
+		"mirror /dev/sda4",
+	} {
+		if _, err = ReadConfig(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &Config{
+		Slots: []*Slot{
+			{"a", filepath.Join(dir, "goes-a"), "goes-a"},
+			{"b", filepath.Join(dir, "goes-b"), "goes-b"},
+		},
+		Grubenv: filepath.Join(dir, "grubenv"),
+		Keys:    filepath.Join(dir, "keys"),
+	}
+	a, b := cfg.Slots[0], cfg.Slots[1]
+	err = grubenv.Env{grubenv.SavedEntry: a.Entry}.Write(cfg.Grubenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("initramfs")
+	h := sha256.Sum256(data)
+	sum := hex.EncodeToString(h[:])
+
+	if err = cfg.Install(ioutil.Discard, b, &Image{
+		Data: data,
+		Sum:  sum,
+	}); err == nil {
+		t.Fatal("installed without trusted keys")
+	}
+	key := writeKey(t, cfg.Keys, "dev")
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := append([]byte{}, sig...)
+	bad[len(bad)-1] ^= 1
+	for _, tc := range []struct {
+		name string
+		img  *Image
+	}{
+		{"checksum only", &Image{Data: data, Sum: sum}},
+		{"bad signature", &Image{Data: data, Sig: bad}},
+		{"wrong checksum", &Image{Data: data, Sig: sig,
+			Sum: "00" + sum[2:]}},
+	} {
+		if err = cfg.Install(ioutil.Discard, b, tc.img); err == nil {
+			t.Fatal("installed with", tc.name)
+		}
+	}
+	img := &Image{Data: data, Sig: sig, Sum: sum}
+	if err = cfg.Install(ioutil.Discard, b, img); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(b.Target); string(got) != "initramfs" {
+		t.Fatalf("slot b %q", got)
+	}
+	env := func() grubenv.Env {
+		env, err := grubenv.Read(cfg.Grubenv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return env
+	}
+	if e := env(); e[grubenv.NextEntry] != b.Entry || e[Trial] != "b" ||
+		e[grubenv.SavedEntry] != a.Entry {
+		t.Fatal("unexpected", e)
+	}
+
+	// the new slot failed and the next boot returned to the old one
+	if err = cfg.Good(ioutil.Discard, a); err != nil {
+		t.Fatal(err)
+	}
+	if e := env(); e[grubenv.SavedEntry] != a.Entry || len(e[Trial]) > 0 {
+		t.Fatal("unexpected", e)
+	}
+
+	if err = cfg.Install(ioutil.Discard, b, img); err != nil {
+		t.Fatal(err)
+	}
+	if err = cfg.Good(ioutil.Discard, b); err != nil {
+		t.Fatal(err)
+	}
+	if e := env(); e[grubenv.SavedEntry] != b.Entry || len(e[Trial]) > 0 {
+		t.Fatal("unexpected", e)
+	}
+}
+
+func TestVerifyBuildID(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &Config{Keys: dir}
+	key := writeKey(t, dir, "dev")
+	h := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := &Image{Data: data, Sig: sig}
+	if err = cfg.Verify(ioutil.Discard, img); err == nil {
+		t.Fatal("verified without expected build id")
+	}
+	img.BuildID = "wrong"
+	if err = cfg.Verify(ioutil.Discard, img); err == nil {
+		t.Fatal("verified with wrong build id")
+	}
+	var out strings.Builder
+	cfg.Verify(&out, img)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "build id: ") {
+			img.BuildID = strings.TrimPrefix(line, "build id: ")
+		}
+	}
+	if err = cfg.Verify(ioutil.Discard, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyFit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &Config{Keys: filepath.Join(dir, "keys")}
+	key := writeKey(t, cfg.Keys, "dev")
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "dev.key"),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &fit.Description{
+		Description:   "test",
+		TimeStamp:     time.Unix(1609459200, 0),
+		DefaultConfig: "conf-1",
+		Images: []*fit.ImageDescription{{
+			Name:        "kernel",
+			Description: "kernel",
+			Type:        "kernel",
+			Arch:        "arm",
+			Os:          "linux",
+			Compression: "none",
+			Load:        "0x80008000",
+			Data:        []byte("not really a kernel"),
+			Hashes:      []string{"sha256"},
+		}},
+		Configs: []*fit.ConfigDescription{{
+			Name:        "conf-1",
+			Description: "signed",
+			Kernel:      "kernel",
+			Sign: &fit.SignDescription{Key: "dev",
+				Hash: "sha256"},
+		}},
+	}
+	data, err := d.Build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cfg.Verify(ioutil.Discard, &Image{Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	// the signature covers the kernel hash, not its data
+	bad := bytes.Replace(data, []byte("not really a kernel"),
+		[]byte("not really a kerneL"), 1)
+	if err = cfg.Verify(ioutil.Discard, &Image{Data: bad}); !errors.Is(err,
+		fit.ErrBadHash) {
+		t.Fatal("expected bad hash, got", err)
+	}
+}
+
+// writeKey returns a new signing key after writing its public key in the
+// directory as NAME.pem.
+func writeKey(t *testing.T, dir, name string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, name+".pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,119 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package watchdog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/platinasystems/goes/cmd/daemons"
+	"github.com/platinasystems/goes/external/redis"
+)
+
+// check returns nil if the condition is met, otherwise, why not; scripts
+// are killed after timeout.
+func (c *Command) check(cond Condition, timeout time.Duration) error {
+	switch cond.Name {
+	case "daemon":
+		return checkDaemons(cond.Args)
+	case "redis":
+		return checkRedis()
+	case "load", "memfree":
+		return checkSysinfo(cond.Name, cond.Limit)
+	case "script":
+		return c.checkScript(cond.Args, timeout)
+	}
+	return fmt.Errorf("unknown condition")
+}
+
+func checkDaemons(names []string) error {
+	running, err := daemons.Names()
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, name := range names {
+		found := false
+		for _, s := range running {
+			if s == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: not running", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkRedis() error {
+	conn, err := redis.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	v, err := conn.Do("PING")
+	if err != nil {
+		return err
+	}
+	if s := fmt.Sprintf("%s", v); s != "PONG" {
+		return fmt.Errorf("PING: %q", s)
+	}
+	return nil
+}
+
+func checkSysinfo(name string, limit float64) error {
+	const scale float64 = 65536.0 // magic SI_LOAD_SHIFT
+	var si syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&si); err != nil {
+		return err
+	}
+	if name == "load" {
+		load := float64(si.Loads[0]) / scale
+		if load > limit {
+			return fmt.Errorf("%.2f", load)
+		}
+		return nil
+	}
+	free := float64(si.Freeram) * float64(si.Unit)
+	if free < limit {
+		return fmt.Errorf("%.0f", free)
+	}
+	return nil
+}
+
+func (c *Command) checkScript(args []string, timeout time.Duration) error {
+	var out bytes.Buffer
+	x := c.g.Fork(args...)
+	x.Stdout = &out
+	x.Stderr = &out
+	if err := x.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- x.Wait() }()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			if s := strings.TrimSpace(out.String()); len(s) > 0 {
+				err = fmt.Errorf("%v: %s", err, s)
+			}
+		}
+		return err
+	case <-t.C:
+		x.Process.Kill()
+		<-done
+		return fmt.Errorf("timeout")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package watchdog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Condition of health gating the keep-alive, e.g. {Name: "load", Limit: 8}.
+type Condition struct {
+	Name string // daemon, redis, load, memfree or script
+	Args []string
+	// Limit is the maximum load average or minimum free bytes.
+	Limit float64
+}
+
+func (c Condition) String() string {
+	s := c.Name
+	switch c.Name {
+	case "load", "memfree":
+		s += " " + strconv.FormatFloat(c.Limit, 'f', -1, 64)
+	}
+	if len(c.Args) > 0 {
+		s += " " + strings.Join(c.Args, " ")
+	}
+	return s
+}
+
+// LoadConfig returns no conditions if the file doesn't exist.
+func LoadConfig(fn string) ([]Condition, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	conds, err := ReadConfig(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fn, err)
+	}
+	return conds, err
+}
+
+// ReadConfig parses lines of these forms where SIZE may have a K, M or G
+// suffix.
+//
+//	daemon NAME...
+//	redis
+//	load MAX
+//	memfree SIZE
+//	script FILE [ARG]...
+func ReadConfig(r io.Reader) ([]Condition, error) {
+	var conds []Condition
+	scan := bufio.NewScanner(r)
+	for line := 1; scan.Scan(); line++ {
+		s := scan.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		c := Condition{Name: fields[0]}
+		args := fields[1:]
+		var err error
+		switch c.Name {
+		case "daemon", "script":
+			if len(args) == 0 {
+				err = fmt.Errorf("%s: missing argument", c.Name)
+			}
+			c.Args = args
+		case "redis":
+			if len(args) > 0 {
+				err = fmt.Errorf("%v: unexpected", args)
+			}
+		case "load", "memfree":
+			if len(args) != 1 {
+				err = fmt.Errorf("%s: expected one limit", c.Name)
+				break
+			}
+			if c.Name == "load" {
+				c.Limit, err = strconv.ParseFloat(args[0], 64)
+			} else {
+				c.Limit, err = parseSize(args[0])
+			}
+			if err != nil || c.Limit <= 0 {
+				err = fmt.Errorf("%s: invalid", args[0])
+			}
+		default:
+			err = fmt.Errorf("%s: unknown condition", c.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		conds = append(conds, c)
+	}
+	return conds, scan.Err()
+}
+
+func parseSize(s string) (float64, error) {
+	mul := float64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		mul = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		mul = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		mul = 1 << 30
+	}
+	if mul > 1 {
+		s = s[:len(s)-1]
+	}
+	u, err := strconv.ParseUint(s, 0, 64)
+	return float64(u) * mul, err
+}
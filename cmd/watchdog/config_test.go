@@ -0,0 +1,65 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package watchdog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	conds, err := ReadConfig(strings.NewReader(`
+# required for the BMC
+daemon redisd i2cd
+redis
+load 7.5
+memfree 8M	# of 512M
+script /etc/goes/health.goes -v
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Condition{
+		{Name: "daemon", Args: []string{"redisd", "i2cd"}},
+		{Name: "redis"},
+		{Name: "load", Limit: 7.5},
+		{Name: "memfree", Limit: 8 << 20},
+		{
+			Name: "script",
+			Args: []string{"/etc/goes/health.goes", "-v"},
+		},
+	}
+	if !reflect.DeepEqual(conds, want) {
+		t.Errorf("%+v", conds)
+	}
+	if s := want[3].String(); s != "memfree 8388608" {
+		t.Error(s)
+	}
+	for _, s := range []string{
+		"daemon",
+		"redis now",
+		"load",
+		"load high",
+		"load -1",
+		"memfree 8X",
+		"memfree 1 2",
+		"script",
+		"reboot",
+	} {
+		if _, err := ReadConfig(strings.NewReader(s)); err == nil {
+			t.Errorf("%q: not an error", s)
+		}
+	}
+}
+
+func TestCheckSysinfo(t *testing.T) {
+	if err := checkSysinfo("load", 1e9); err != nil {
+		t.Error(err)
+	}
+	if err := checkSysinfo("memfree", 1e18); err == nil {
+		t.Error("memfree 1e18: met")
+	}
+}
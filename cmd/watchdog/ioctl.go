@@ -0,0 +1,40 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package watchdog
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// linux/watchdog.h
+const (
+	wdiocSetTimeout    = 0xc0045706 // _IOWR('W', 6, int)
+	wdiocGetTimeout    = 0x80045707 // _IOR('W', 7, int)
+	wdiocSetPretimeout = 0xc0045708 // _IOWR('W', 8, int)
+	wdiocGetPretimeout = 0x80045709 // _IOR('W', 9, int)
+	wdiocGetTimeLeft   = 0x8004570a // _IOR('W', 10, int)
+)
+
+var wdiocNames = map[uintptr]string{
+	wdiocSetTimeout:    "WDIOC_SETTIMEOUT",
+	wdiocGetTimeout:    "WDIOC_GETTIMEOUT",
+	wdiocSetPretimeout: "WDIOC_SETPRETIMEOUT",
+	wdiocGetPretimeout: "WDIOC_GETPRETIMEOUT",
+	wdiocGetTimeLeft:   "WDIOC_GETTIMELEFT",
+}
+
+// wdioc sets or gets the seconds of the given request.
+func wdioc(f *os.File, op uintptr, seconds int) (int, error) {
+	v := int32(seconds)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), op,
+		uintptr(unsafe.Pointer(&v)))
+	if errno != 0 {
+		return 0, fmt.Errorf("%s: %v", wdiocNames[op], errno)
+	}
+	return int(v), nil
+}
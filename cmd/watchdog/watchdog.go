@@ -15,18 +15,28 @@ import (
 
 	"github.com/platinasystems/goes"
 	"github.com/platinasystems/goes/cmd"
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/log"
 	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/external/redis/publisher"
 	"github.com/platinasystems/goes/lang"
 	"github.com/platinasystems/gpio"
 )
 
+const ConfigFile = "/etc/goes/watchdog"
+
 type Command struct {
 	GpioPin string
+	// Config, if set, are the machine's health conditions; otherwise,
+	// those of the -config FILE.
+	Config []Condition
+
+	g *goes.Goes
 }
 
 func (*Command) String() string { return "watchdog" }
 
-func (*Command) Usage() string { return "watchdog [OPTION]... [DEVICE]" }
+func (*Command) Usage() string { return "watchdog [-n] [OPTION]... [DEVICE]" }
 
 func (*Command) Apropos() lang.Alt {
 	return lang.Alt{
@@ -38,27 +48,49 @@ func (*Command) Man() lang.Alt {
 	return lang.Alt{
 		lang.EnUS: `
 DESCRIPTION
-	Periodically write to the watchdog device (default /dev/watchdog).
+	Periodically write to the watchdog device (default /dev/watchdog)
+	while the machine, or -config FILE, health conditions are met.
+	These are lines of:
+
+	daemon NAME...
+		each daemon is running per the goes-daemons supervisor
+	redis
+		redisd responds to PING
+	load MAX
+		the 1 minute load average is at most MAX
+	memfree SIZE
+		free memory is at least SIZE bytes, with optional K, M or G
+		suffix
+	script FILE [ARG]...
+		the goes script exits 0 within the write period
+
+	The watchdog fires if the conditions aren't met for TIMEOUT seconds.
+	The failed condition is logged and published to redis as
+	"watchdog.fault" along with "watchdog.timeleft". A critical message
+	is logged once the time left is within a write period of the
+	pre-timeout.
 
 OPTIONS
+	-n		check the conditions once, print and exit
+	-config FILE	health conditions (default ` + ConfigFile + `)
 	-T TIMEOUT	Reboot after TIMEOUT seconds without a watchdog write
-			(default 60)
+			(default that of the device)
+	-P PRETIMEOUT	Notify the kernel's pre-timeout governor PRETIMEOUT
+			seconds before reboot
 	-t FREQUENCY	Write frequency in seconds
 			(default 30)`,
 	}
 }
 
+func (c *Command) Goes(g *goes.Goes) { c.g = g }
+
 func (*Command) Kind() cmd.Kind { return cmd.Daemon }
 
 func (c *Command) Main(args ...string) error {
-	parm, args := parms.New(args, "-T", "-t")
-	for k, v := range map[string]string{
-		"-T": "60",
-		"-t": "30",
-	} {
-		if len(parm.ByName[k]) == 0 {
-			parm.ByName[k] = v
-		}
+	flag, args := flags.New(args, "-n")
+	parm, args := parms.New(args, "-T", "-t", "-P", "-config")
+	if len(parm.ByName["-t"]) == 0 {
+		parm.ByName["-t"] = "30"
 	}
 
 	period, err := strconv.ParseInt(parm.ByName["-t"], 0, 0)
@@ -69,11 +101,49 @@ func (c *Command) Main(args ...string) error {
 	}
 	freq := time.Duration(period) * time.Second
 
+	settings := make(map[uintptr]int)
+	for _, x := range []struct {
+		name string
+		op   uintptr
+	}{
+		{"-T", wdiocSetTimeout},
+		{"-P", wdiocSetPretimeout},
+	} {
+		if s := parm.ByName[x.name]; len(s) > 0 {
+			i, err := strconv.ParseInt(s, 0, 0)
+			if err != nil || i < 0 || (i == 0 && x.name == "-T") {
+				return fmt.Errorf("%s: invalid %s", s, x.name)
+			}
+			settings[x.op] = int(i)
+		}
+	}
+
+	conds := c.Config
+	if fn := parm.ByName["-config"]; len(fn) > 0 || conds == nil {
+		if len(fn) == 0 {
+			fn = ConfigFile
+		}
+		if conds, err = LoadConfig(fn); err != nil {
+			return err
+		}
+	}
+
+	if flag.ByName["-n"] {
+		for _, cond := range conds {
+			if err := c.check(cond, freq); err != nil {
+				fmt.Print(cond, ": ", err, "\n")
+			} else {
+				fmt.Print(cond, ": ok\n")
+			}
+		}
+		return nil
+	}
+
 	fn := "/dev/watchdog"
-	if n := len(args); n > 0 {
-		fn = args[0]
-	} else if n > 1 {
+	if n := len(args); n > 1 {
 		return fmt.Errorf("%v: unexpected", args[1:])
+	} else if n > 0 {
+		fn = args[0]
 	}
 	f, err := os.OpenFile(fn, os.O_WRONLY, 0)
 	if err != nil {
@@ -85,14 +155,58 @@ func (c *Command) Main(args ...string) error {
 	}
 	defer f.Close()
 
+	// the pretimeout must be less than the timeout so set that first
+	for _, op := range []uintptr{wdiocSetTimeout, wdiocSetPretimeout} {
+		if i, found := settings[op]; found {
+			if _, err = wdioc(f, op, i); err != nil {
+				return err
+			}
+		}
+	}
+	if timeout, err := wdioc(f, wdiocGetTimeout, 0); err == nil &&
+		timeout > 0 && int(period) >= timeout {
+		return fmt.Errorf("%d: period isn't less than the %d timeout",
+			period, timeout)
+	}
+	// the pretimeout is zero if unsupported
+	pretimeout, _ := wdioc(f, wdiocGetPretimeout, 0)
+
 	ticker := time.NewTicker(time.Duration(freq))
 	defer ticker.Stop()
 
+	var fault string
+	warned := false
 	for {
 		select {
 		case <-goes.Stop:
 			return nil
 		case <-ticker.C:
+			why := c.health(conds, freq)
+			if why != fault {
+				if len(why) > 0 {
+					log.Print("err", "not kept alive, ", why)
+					record("watchdog.fault", why)
+				} else {
+					log.Print("info", "kept alive, healthy")
+					record("watchdog.fault", "none")
+				}
+				fault = why
+				warned = false
+			}
+			if len(why) > 0 {
+				left, err := wdioc(f, wdiocGetTimeLeft, 0)
+				if err != nil {
+					continue
+				}
+				record("watchdog.timeleft", left)
+				if !warned && left <= pretimeout+int(period) {
+					log.Print("crit", "reboot in ", left,
+						" seconds, ", why)
+					warned = true
+				}
+				continue
+			}
+
 			if len(c.GpioPin) > 0 {
 				pin, found := gpio.FindPin(c.GpioPin)
 				t, err := pin.Value()
@@ -111,3 +225,24 @@ func (c *Command) Main(args ...string) error {
 		}
 	}
 }
+
+// health returns the first unmet condition and why, or empty if all are
+// met.
+func (c *Command) health(conds []Condition, timeout time.Duration) string {
+	for _, cond := range conds {
+		if err := c.check(cond, timeout); err != nil {
+			return fmt.Sprint(cond, ": ", err)
+		}
+	}
+	return ""
+}
+
+// record the value in redis, if it's available.
+func record(key string, value interface{}) {
+	pub, err := publisher.New()
+	if err != nil {
+		return
+	}
+	defer pub.Close()
+	pub.Print(key, ": ", value)
+}
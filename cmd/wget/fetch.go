@@ -0,0 +1,378 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package wget
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/url"
+)
+
+const (
+	userAgent  = "Platina Go-ES"
+	maxBackoff = 30 * time.Second
+)
+
+var errChecksum = errors.New("checksum mismatch")
+
+// statusError is an unexpected http response.
+type statusError struct {
+	code int
+	url  string
+}
+
+func (err *statusError) Error() string {
+	return fmt.Sprintf("%s: %s", err.url, http.StatusText(err.code))
+}
+
+type fetcher struct {
+	client   *http.Client
+	tries    int
+	timeout  time.Duration
+	resume   bool
+	progress io.Writer
+	tty      bool
+}
+
+func (f *fetcher) init(ca string, insecure bool) error {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if len(ca) > 0 {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: no certificates", ca)
+		}
+	}
+	f.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   f.timeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:       config,
+			TLSHandshakeTimeout:   f.timeout,
+			ResponseHeaderTimeout: f.timeout,
+		},
+	}
+	return nil
+}
+
+// filename returns the default destination of the given URL.
+func filename(src string) string {
+	p := src
+	if u, err := neturl.Parse(src); err == nil {
+		p = u.Path
+	}
+	if base := path.Base(p); base != "." && base != "/" {
+		return base
+	}
+	return "index.html"
+}
+
+// get downloads src to dst, or stdout if dst is "-", with retries.
+func (f *fetcher) get(dst, src, sum string) error {
+	want, err := f.checksum(sum)
+	if err != nil {
+		return err
+	}
+	var last error
+	for try := 1; try <= f.tries; try++ {
+		if try > 1 {
+			d := time.Second << uint(try-2)
+			if d > maxBackoff {
+				d = maxBackoff
+			}
+			f.printf("%s: %v; retrying in %v\n", src, last, d)
+			time.Sleep(d)
+		}
+		var n int64
+		n, last = f.download(dst, src, want, f.resume || try > 1)
+		if last == nil {
+			return nil
+		}
+		if errors.Is(last, errChecksum) && dst != "-" {
+			os.Remove(dst)
+		}
+		if !retryable(last) || (dst == "-" && n > 0) {
+			break
+		}
+	}
+	return last
+}
+
+// retryable returns false for errors that another attempt won't fix.
+func retryable(err error) bool {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return serr.code >= 500 ||
+			serr.code == http.StatusRequestTimeout ||
+			serr.code == http.StatusTooManyRequests
+	}
+	return !os.IsNotExist(err) && !os.IsPermission(err)
+}
+
+// download returns the number of bytes received.
+func (f *fetcher) download(dst, src string, want []byte, resume bool) (int64, error) {
+	var offset int64
+	if resume && dst != "-" {
+		if fi, err := os.Stat(dst); err == nil && fi.Mode().IsRegular() {
+			offset = fi.Size()
+		}
+	}
+	rc, offset, size, err := f.open(src, offset)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	var (
+		w io.Writer
+		h hash.Hash
+	)
+	if dst == "-" {
+		h = sha256.New()
+		w = io.MultiWriter(os.Stdout, h)
+	} else {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if offset > 0 {
+			flags = os.O_WRONLY | os.O_APPEND
+		}
+		file, err := os.OpenFile(dst, flags, 0644)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	p := &progress{
+		fetcher: f,
+		name:    dst,
+		offset:  offset,
+		size:    size,
+	}
+	if dst == "-" {
+		p.name = filename(src)
+	}
+	stalled := time.AfterFunc(f.timeout, func() { rc.Close() })
+	defer stalled.Stop()
+	n, err := io.Copy(w, &stallReader{rc, stalled, f.timeout, p})
+	p.done(err)
+	if err != nil {
+		if !stalled.Stop() {
+			err = fmt.Errorf("stalled for %v", f.timeout)
+		}
+		return n, err
+	}
+	if size > 0 && offset+n < size {
+		return n, io.ErrUnexpectedEOF
+	}
+	if want == nil {
+		return n, nil
+	}
+	var got []byte
+	if h != nil {
+		got = h.Sum(nil)
+	} else if got, err = fileSum(dst); err != nil {
+		return n, err
+	}
+	if !bytes.Equal(got, want) {
+		return n, fmt.Errorf("%s: %w", dst, errChecksum)
+	}
+	return n, nil
+}
+
+// open src for reading from offset, if possible, and return the actual
+// offset and total size; the size is zero if unknown.
+func (f *fetcher) open(src string, offset int64) (io.ReadCloser, int64, int64, error) {
+	fn, u, err := url.FilePathFromUrl(src)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if len(fn) > 0 {
+		file, err := os.Open(fn)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		fi, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, 0, 0, err
+		}
+		if offset > fi.Size() {
+			offset = 0
+		}
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, 0, 0, err
+		}
+		return file, offset, fi.Size(), nil
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "tftp":
+		rc, err := url.OpenUrl(u)
+		return rc, 0, 0, err
+	default:
+		return nil, 0, 0, fmt.Errorf("%s: unsupported scheme", u.Scheme)
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprint("bytes=", offset, "-"))
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		offset = 0
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		if offset == 0 {
+			return nil, 0, 0, &statusError{resp.StatusCode, u.String()}
+		}
+		// already complete
+		return ioutil.NopCloser(strings.NewReader("")), offset, 0, nil
+	default:
+		resp.Body.Close()
+		return nil, 0, 0, &statusError{resp.StatusCode, u.String()}
+	}
+	size := int64(0)
+	if resp.ContentLength > 0 {
+		size = offset + resp.ContentLength
+	}
+	return resp.Body, offset, size, nil
+}
+
+// checksum returns the decoded hex digest or that read from a sidecar URL.
+func (f *fetcher) checksum(sum string) ([]byte, error) {
+	if len(sum) == 0 {
+		return nil, nil
+	}
+	if len(sum) == 2*sha256.Size {
+		if b, err := hex.DecodeString(sum); err == nil {
+			return b, nil
+		}
+	}
+	rc, _, _, err := f.open(sum, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	buf, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return nil, err
+	}
+	// e.g. sha256sum output, "HEX  FILE"
+	fields := strings.Fields(string(buf))
+	if len(fields) > 0 && len(fields[0]) == 2*sha256.Size {
+		if b, err := hex.DecodeString(fields[0]); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: invalid sha256", sum)
+}
+
+func fileSum(fn string) ([]byte, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (f *fetcher) printf(format string, args ...interface{}) {
+	if f.progress != nil {
+		fmt.Fprintf(f.progress, format, args...)
+	}
+}
+
+// stallReader closes the stream if a read doesn't complete in time.
+type stallReader struct {
+	r       io.Reader
+	stalled *time.Timer
+	timeout time.Duration
+	p       *progress
+}
+
+func (r *stallReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.stalled.Reset(r.timeout)
+	r.p.add(n)
+	return n, err
+}
+
+type progress struct {
+	*fetcher
+	name         string
+	offset, size int64
+	n            int64
+	last         time.Time
+}
+
+func (p *progress) add(n int) {
+	p.n += int64(n)
+	if p.progress == nil || !p.tty || time.Since(p.last) < 200*time.Millisecond {
+		return
+	}
+	p.last = time.Now()
+	fmt.Fprint(p.progress, "\r", p, "\033[K")
+}
+
+func (p *progress) done(err error) {
+	if p.progress == nil {
+		return
+	}
+	if p.tty {
+		fmt.Fprint(p.progress, "\r")
+		if err != nil {
+			fmt.Fprint(p.progress, p, "\033[K\n")
+			return
+		}
+	}
+	if err == nil {
+		fmt.Fprint(p.progress, "Saved ", p, "\n")
+	}
+}
+
+func (p *progress) String() string {
+	n := p.offset + p.n
+	if p.size > 0 {
+		return fmt.Sprintf("%s %d / %d bytes (%d%%)", p.name, n, p.size,
+			100*n/p.size)
+	}
+	return fmt.Sprintf("%s %d bytes", p.name, n)
+}
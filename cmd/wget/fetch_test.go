@@ -0,0 +1,114 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package wget
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(content)
+	hexsum := hex.EncodeToString(sum[:])
+	ranges := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		switch r.URL.Path {
+		case "/image":
+			if len(r.Header.Get("Range")) > 0 {
+				ranges++
+			}
+			http.ServeContent(w, r, "image", time.Time{},
+				bytes.NewReader(content))
+		case "/image.sha256":
+			fmt.Fprintln(w, hexsum, " image")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "wget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "image")
+
+	f := &fetcher{tries: 1, timeout: 5 * time.Second}
+	if err = f.init("", false); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Resume", func(t *testing.T) {
+		ioutil.WriteFile(dst, content[:1000], 0644)
+		f.resume = true
+		defer func() { f.resume = false }()
+		if err := f.get(dst, srv.URL+"/image", hexsum); err != nil {
+			t.Fatal(err)
+		}
+		if ranges != 1 {
+			t.Error("expected a range request")
+		}
+		if got, _ := ioutil.ReadFile(dst); !bytes.Equal(got, content) {
+			t.Error("content mismatch")
+		}
+	})
+	t.Run("Sidecar", func(t *testing.T) {
+		if err := f.get(dst, srv.URL+"/image",
+			srv.URL+"/image.sha256"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("Mismatch", func(t *testing.T) {
+		err := f.get(dst, srv.URL+"/image", strings.Repeat("0", 64))
+		if !errors.Is(err, errChecksum) {
+			t.Fatal("unexpected", err)
+		}
+		if _, err = os.Stat(dst); !os.IsNotExist(err) {
+			t.Error("corrupt file wasn't removed")
+		}
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		f.tries = 3
+		defer func() { f.tries = 1 }()
+		err := f.get(dst, srv.URL+"/missing", "")
+		if err == nil || retryable(err) {
+			t.Fatal("unexpected", err)
+		}
+	})
+	t.Run("File", func(t *testing.T) {
+		src := filepath.Join(dir, "src")
+		ioutil.WriteFile(src, content, 0644)
+		if err := f.get(dst, "file://"+src, hexsum); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestFilename(t *testing.T) {
+	for _, x := range []struct{ url, want string }{
+		{"http://server/dir/kernel", "kernel"},
+		{"http://server/", "index.html"},
+		{"http://server", "index.html"},
+		{"tftp://server/initrd.img", "initrd.img"},
+	} {
+		if got := filename(x.url); got != x.want {
+			t.Errorf("%s: got %q, want %q", x.url, got, x.want)
+		}
+	}
+}
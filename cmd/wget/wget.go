@@ -1,4 +1,4 @@
-// Copyright © 2015-2016 Platina Systems, Inc. All rights reserved.
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
 // Use of this source code is governed by the GPL-2 license described in the
 // LICENSE file.
 
@@ -6,17 +6,25 @@ package wget
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"time"
 
-	"github.com/cavaliercoder/grab"
+	"github.com/mattn/go-isatty"
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
 	"github.com/platinasystems/goes/lang"
-	"github.com/platinasystems/url"
 )
 
 type Command struct{}
 
 func (Command) String() string { return "wget" }
 
-func (Command) Usage() string { return "wget URL..." }
+func (Command) Usage() string {
+	return `wget [-c] [-q] [-verify] [-sha256 HEX|URL] [-O FILE] [-tries N]
+	[-timeout DURATION] [-ca-certificate FILE] [-no-check-certificate]
+	URL...`
+}
 
 func (Command) Apropos() lang.Alt {
 	return lang.Alt{
@@ -24,26 +32,117 @@ func (Command) Apropos() lang.Alt {
 	}
 }
 
+func (Command) Man() lang.Alt {
+	return lang.Alt{
+		lang.EnUS: `
+DESCRIPTION
+	Download each URL to a file named by the last element of its path,
+	or "index.html" if the path is empty.
+
+	Supported schemes are http, https, tftp and file; a URL without a
+	scheme is a local file.
+
+	Failed downloads are retried with an exponential backoff. An
+	interrupted http or https download continues from the partial
+	file with a range request if supported by the server.
+
+OPTIONS
+	-O FILE	save to FILE instead; "-" writes to stdout
+	-c	continue a partial download of an existing file
+	-q	quiet, don't print progress
+	-sha256 HEX|URL
+		verify the downloaded file with this checksum or one
+		read from the given sidecar URL
+	-verify	verify with the sidecar of each URL, i.e. URL.sha256
+	-tries N
+		attempt each download up to N times (default 3)
+	-timeout DURATION
+		abandon a stalled connection after DURATION (default 30s)
+	-ca-certificate FILE
+		verify https servers with this PEM bundle instead of the
+		system certificates
+	-no-check-certificate
+		don't verify https servers
+
+	A file that fails checksum verification is removed then downloaded
+	again if tries remain.
+
+EXAMPLES
+	wget -c -verify http://server/goes-amd64.vmlinuz
+	wget -O /boot/initrd.img -sha256 3b4f...e1 tftp://server/initrd.img`,
+	}
+}
+
 func (Command) Main(args ...string) error {
-	// validate command args
+	flag, args := flags.New(args, "-c", "-q", "-verify",
+		"-no-check-certificate")
+	parm, args := parms.New(args, "-O", "-sha256", "-tries", "-timeout",
+		"-ca-certificate")
+
 	if len(args) < 1 {
 		return fmt.Errorf("URL: missing")
 	}
+	if len(parm.ByName["-O"]) > 0 && len(args) > 1 {
+		return fmt.Errorf("-O: requires one URL")
+	}
+	if len(parm.ByName["-sha256"]) > 0 && len(args) > 1 {
+		return fmt.Errorf("-sha256: requires one URL")
+	}
 
-	reqs := make([]*grab.Request, 0)
-	for _, url := range args {
-		req, err := grab.NewRequest(url)
+	f := &fetcher{
+		tries:   3,
+		timeout: 30 * time.Second,
+		resume:  flag.ByName["-c"],
+	}
+	if s := parm.ByName["-tries"]; len(s) > 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fmt.Errorf("-tries: %q invalid", s)
+		}
+		f.tries = n
+	}
+	if s := parm.ByName["-timeout"]; len(s) > 0 {
+		d, err := time.ParseDuration(s)
 		if err != nil {
-			return err
+			return fmt.Errorf("-timeout: %v", err)
 		}
-		reqs = append(reqs, req)
+		f.timeout = d
 	}
-
-	successes, err := url.FetchReqs(0, reqs)
-	if successes == 0 && err != nil {
+	if !flag.ByName["-q"] {
+		f.progress = os.Stderr
+		f.tty = isatty.IsTerminal(os.Stderr.Fd())
+	}
+	if err := f.init(parm.ByName["-ca-certificate"],
+		flag.ByName["-no-check-certificate"]); err != nil {
 		return err
 	}
 
-	fmt.Printf("%d files successfully downloaded.\n", successes)
-	return nil
+	var firstErr error
+	successes := 0
+	for _, src := range args {
+		dst := parm.ByName["-O"]
+		if len(dst) == 0 {
+			dst = filename(src)
+		}
+		sum := parm.ByName["-sha256"]
+		if len(sum) == 0 && flag.ByName["-verify"] {
+			sum = src + ".sha256"
+		}
+		if err := f.get(dst, src, sum); err != nil {
+			if len(args) == 1 {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%s: %v\n", src, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		successes++
+	}
+	if len(args) > 1 && !flag.ByName["-q"] {
+		fmt.Printf("%d of %d files successfully downloaded.\n",
+			successes, len(args))
+	}
+	return firstErr
 }
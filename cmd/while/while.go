@@ -44,6 +44,7 @@ DESCRIPTION
 }
 
 func (c Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error, error) {
+	loc := g.Location()
 	var whileList, doList []func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error
 	curList := &whileList
 	cl := ls.Cmds[0]
@@ -64,6 +65,9 @@ func (c Command) Block(g *goes.Goes, ls shellutils.List) (*shellutils.List, func
 		for len(ls.Cmds) == 0 {
 			newls, err := shellutils.Parse("while>", g.Catline)
 			if err != nil {
+				if err == io.EOF {
+					err = g.MissingTerminator(c.String(), "done", loc)
+				}
 				return nil, nil, err
 			}
 			ls = *newls
@@ -67,7 +67,7 @@ func (g *Goes) Complete(args ...string) (completions []string) {
 //	type -p goes >/dev/null && complete -F _goes -o filenames goes
 func (g *Goes) complete(args ...string) error {
 	for _, s := range g.Complete(args...) {
-		fmt.Println(s)
+		fmt.Fprintln(g.Stdout(), s)
 	}
 	return nil
 }
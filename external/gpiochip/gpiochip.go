@@ -0,0 +1,483 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package gpiochip provides lines of the Linux GPIO character devices,
+// /dev/gpiochipN, with the v2 uAPI of kernels since 5.10.
+package gpiochip
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const MaxLines = 64
+
+type Flag uint64
+
+const (
+	Used Flag = 1 << iota
+	ActiveLow
+	Input
+	Output
+	EdgeRising
+	EdgeFalling
+	OpenDrain
+	OpenSource
+	PullUp
+	PullDown
+	BiasDisabled
+	EventClockRealtime
+
+	Edges = EdgeRising | EdgeFalling
+	Bias  = PullUp | PullDown | BiasDisabled
+	Drive = OpenDrain | OpenSource
+)
+
+// FlagsByName are those of the gpio command and gpiod configuration.
+var FlagsByName = map[string]Flag{
+	"used":          Used,
+	"active-low":    ActiveLow,
+	"input":         Input,
+	"output":        Output,
+	"rising":        EdgeRising,
+	"falling":       EdgeFalling,
+	"both":          Edges,
+	"open-drain":    OpenDrain,
+	"open-source":   OpenSource,
+	"push-pull":     0,
+	"pull-up":       PullUp,
+	"pull-down":     PullDown,
+	"bias-disabled": BiasDisabled,
+	"realtime":      EventClockRealtime,
+}
+
+func (f Flag) String() string {
+	var names []string
+	for name, x := range FlagsByName {
+		if x != 0 && x != Edges && f&x == x {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Line is the chip and offset of a GPIO.
+type Line struct {
+	Chip   string // e.g. gpiochip0
+	Offset int
+}
+
+func (l Line) String() string {
+	return fmt.Sprint(l.Chip, ":", l.Offset)
+}
+
+// LineInfo is that of the kernel's gpio_v2_line_info.
+type LineInfo struct {
+	Offset   int
+	Name     string
+	Consumer string
+	Flags    Flag
+	Debounce time.Duration
+}
+
+// Config of requested lines; Values are those of Output lines with bit 0
+// that of the first requested.
+type Config struct {
+	Flags    Flag
+	Debounce time.Duration
+	Values   uint64
+}
+
+type EventID uint32
+
+const (
+	RisingEdge EventID = iota + 1
+	FallingEdge
+)
+
+func (id EventID) String() string {
+	switch id {
+	case RisingEdge:
+		return "rising"
+	case FallingEdge:
+		return "falling"
+	}
+	return fmt.Sprint("event(", uint32(id), ")")
+}
+
+// Event of an edge on a line requested with EdgeRising and/or
+// EdgeFalling; Time is since boot unless EventClockRealtime.
+type Event struct {
+	Time      time.Duration
+	ID        EventID
+	Offset    int
+	Seqno     uint32
+	LineSeqno uint32
+}
+
+// The following mirror those of linux/gpio.h
+const (
+	nameSz   = 32
+	numAttrs = 10
+
+	attrFlags        = 1
+	attrOutputValues = 2
+	attrDebounce     = 3
+)
+
+type chipInfo struct {
+	name  [nameSz]byte
+	label [nameSz]byte
+	lines uint32
+}
+
+type lineAttr struct {
+	id      uint32
+	padding uint32
+	value   uint64
+}
+
+type lineInfo struct {
+	name     [nameSz]byte
+	consumer [nameSz]byte
+	offset   uint32
+	numAttrs uint32
+	flags    uint64
+	attrs    [numAttrs]lineAttr
+	padding  [4]uint32
+}
+
+type lineConfigAttr struct {
+	attr lineAttr
+	mask uint64
+}
+
+type lineConfig struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [numAttrs]lineConfigAttr
+}
+
+type lineRequest struct {
+	offsets         [MaxLines]uint32
+	consumer        [nameSz]byte
+	config          lineConfig
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+type lineValues struct {
+	bits uint64
+	mask uint64
+}
+
+type lineEvent struct {
+	timestamp uint64
+	id        uint32
+	offset    uint32
+	seqno     uint32
+	lineSeqno uint32
+	padding   [6]uint32
+}
+
+const (
+	iocWrite = 1
+	iocRead  = 2
+	magic    = 0xb4
+
+	getChipInfoIoctl = iocRead<<30 |
+		unsafe.Sizeof(chipInfo{})<<16 | magic<<8 | 0x01
+	getLineInfoIoctl = (iocRead|iocWrite)<<30 |
+		unsafe.Sizeof(lineInfo{})<<16 | magic<<8 | 0x05
+	getLineIoctl = (iocRead|iocWrite)<<30 |
+		unsafe.Sizeof(lineRequest{})<<16 | magic<<8 | 0x07
+	setConfigIoctl = (iocRead|iocWrite)<<30 |
+		unsafe.Sizeof(lineConfig{})<<16 | magic<<8 | 0x0d
+	getValuesIoctl = (iocRead|iocWrite)<<30 |
+		unsafe.Sizeof(lineValues{})<<16 | magic<<8 | 0x0e
+	setValuesIoctl = (iocRead|iocWrite)<<30 |
+		unsafe.Sizeof(lineValues{})<<16 | magic<<8 | 0x0f
+)
+
+func ioctl(fd uintptr, op uintptr, arg unsafe.Pointer) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, op, uintptr(arg))
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+func cstring(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// Chips returns the names of the GPIO character devices in order,
+// e.g. gpiochip0, gpiochip1, ... gpiochip10.
+func Chips() ([]string, error) {
+	fns, err := filepath.Glob("/dev/gpiochip*")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(fns))
+	for i, fn := range fns {
+		names[i] = filepath.Base(fn)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ni, _ := strconv.Atoi(strings.TrimPrefix(names[i], "gpiochip"))
+		nj, _ := strconv.Atoi(strings.TrimPrefix(names[j], "gpiochip"))
+		return ni < nj
+	})
+	return names, nil
+}
+
+// Chip is an open GPIO character device.
+type Chip struct {
+	f     *os.File
+	Name  string
+	Label string
+	Lines int
+}
+
+// Open the chip of the given name, e.g. gpiochip0, number or path.
+func Open(name string) (*Chip, error) {
+	fn := name
+	if _, err := strconv.Atoi(name); err == nil {
+		fn = "/dev/gpiochip" + name
+	} else if !strings.ContainsRune(name, '/') {
+		fn = "/dev/" + name
+	}
+	f, err := os.OpenFile(fn, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	var info chipInfo
+	err = ioctl(f.Fd(), getChipInfoIoctl, unsafe.Pointer(&info))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: chip info: %v", fn, err)
+	}
+	return &Chip{
+		f:     f,
+		Name:  cstring(info.name[:]),
+		Label: cstring(info.label[:]),
+		Lines: int(info.lines),
+	}, nil
+}
+
+func (c *Chip) Close() error { return c.f.Close() }
+
+func (c *Chip) LineInfo(offset int) (*LineInfo, error) {
+	info := lineInfo{offset: uint32(offset)}
+	err := ioctl(c.f.Fd(), getLineInfoIoctl, unsafe.Pointer(&info))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%d: line info: %v", c.Name, offset,
+			err)
+	}
+	li := &LineInfo{
+		Offset:   offset,
+		Name:     cstring(info.name[:]),
+		Consumer: cstring(info.consumer[:]),
+		Flags:    Flag(info.flags),
+	}
+	for _, attr := range info.attrs[:info.numAttrs] {
+		if attr.id == attrDebounce {
+			li.Debounce = time.Duration(uint32(attr.value)) *
+				time.Microsecond
+		}
+	}
+	return li, nil
+}
+
+func (cfg Config) raw(n int) lineConfig {
+	var raw lineConfig
+	raw.flags = uint64(cfg.Flags)
+	all := uint64(1)<<uint(n) - 1
+	if cfg.Flags&Output != 0 {
+		raw.attrs[raw.numAttrs] = lineConfigAttr{
+			attr: lineAttr{
+				id:    attrOutputValues,
+				value: cfg.Values & all,
+			},
+			mask: all,
+		}
+		raw.numAttrs++
+	}
+	if cfg.Debounce > 0 {
+		raw.attrs[raw.numAttrs] = lineConfigAttr{
+			attr: lineAttr{
+				id:    attrDebounce,
+				value: uint64(cfg.Debounce / time.Microsecond),
+			},
+			mask: all,
+		}
+		raw.numAttrs++
+	}
+	return raw
+}
+
+// Request the lines of the given offsets with the consumer label shown by
+// LineInfo until released with Lines.Close.
+func (c *Chip) Request(consumer string, cfg Config, offsets ...int) (*Lines,
+	error) {
+	if len(offsets) == 0 || len(offsets) > MaxLines {
+		return nil, fmt.Errorf("%s: %d lines: invalid", c.Name,
+			len(offsets))
+	}
+	var req lineRequest
+	for i, offset := range offsets {
+		req.offsets[i] = uint32(offset)
+	}
+	copy(req.consumer[:nameSz-1], consumer)
+	req.config = cfg.raw(len(offsets))
+	req.numLines = uint32(len(offsets))
+	err := ioctl(c.f.Fd(), getLineIoctl, unsafe.Pointer(&req))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v: request: %v", c.Name, offsets,
+			err)
+	}
+	// non-blocking so that Close interrupts ReadEvent
+	if err = syscall.SetNonblock(int(req.fd), true); err != nil {
+		syscall.Close(int(req.fd))
+		return nil, err
+	}
+	name := fmt.Sprint(c.Name, ":", offsets)
+	return &Lines{
+		f:       os.NewFile(uintptr(req.fd), name),
+		Offsets: append([]int{}, offsets...),
+	}, nil
+}
+
+// Lines are those requested of a chip; bit N of their values is that of
+// Offsets[N].
+type Lines struct {
+	f       *os.File
+	Offsets []int
+}
+
+func (l *Lines) Close() error { return l.f.Close() }
+
+func (l *Lines) Values() (uint64, error) {
+	v := lineValues{mask: uint64(1)<<uint(len(l.Offsets)) - 1}
+	err := l.ioctl(getValuesIoctl, unsafe.Pointer(&v))
+	return v.bits, err
+}
+
+// SetValues of the Output lines of the mask.
+func (l *Lines) SetValues(bits, mask uint64) error {
+	v := lineValues{bits: bits, mask: mask}
+	return l.ioctl(setValuesIoctl, unsafe.Pointer(&v))
+}
+
+// Reconfigure the lines, e.g. to change direction or bias, without
+// releasing them.
+func (l *Lines) Reconfigure(cfg Config) error {
+	raw := cfg.raw(len(l.Offsets))
+	return l.ioctl(setConfigIoctl, unsafe.Pointer(&raw))
+}
+
+func (l *Lines) ioctl(op uintptr, arg unsafe.Pointer) error {
+	rc, err := l.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioerr error
+	err = rc.Control(func(fd uintptr) {
+		ioerr = ioctl(fd, op, arg)
+	})
+	if err == nil {
+		err = ioerr
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %v", l.f.Name(), err)
+	}
+	return err
+}
+
+// ReadEvent waits for the next edge event of the lines, or until Close.
+func (l *Lines) ReadEvent() (Event, error) {
+	var raw lineEvent
+	b := (*[unsafe.Sizeof(raw)]byte)(unsafe.Pointer(&raw))[:]
+	n, err := l.f.Read(b)
+	if err != nil {
+		return Event{}, err
+	}
+	if n != len(b) {
+		return Event{}, fmt.Errorf("%s: short event", l.f.Name())
+	}
+	return Event{
+		Time:      time.Duration(raw.timestamp),
+		ID:        EventID(raw.id),
+		Offset:    int(raw.offset),
+		Seqno:     raw.seqno,
+		LineSeqno: raw.lineSeqno,
+	}, nil
+}
+
+// ParseLine parses CHIP:OFFSET where CHIP is a name, e.g. gpiochip0, or
+// number.
+func ParseLine(s string) (Line, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return Line{}, fmt.Errorf("%s: expected CHIP:OFFSET", s)
+	}
+	chip := s[:i]
+	if _, err := strconv.Atoi(chip); err == nil {
+		chip = "gpiochip" + chip
+	}
+	offset, err := strconv.Atoi(s[i+1:])
+	if err != nil || offset < 0 || !strings.HasPrefix(chip, "gpiochip") {
+		return Line{}, fmt.Errorf("%s: invalid", s)
+	}
+	return Line{chip, offset}, nil
+}
+
+// Find returns the line of CHIP:OFFSET or that of the given name.
+func Find(name string) (Line, error) {
+	if strings.ContainsRune(name, ':') {
+		return ParseLine(name)
+	}
+	chips, err := Chips()
+	if err != nil {
+		return Line{}, err
+	}
+	for _, chip := range chips {
+		c, err := Open(chip)
+		if err != nil {
+			continue
+		}
+		for offset := 0; offset < c.Lines; offset++ {
+			li, err := c.LineInfo(offset)
+			if err == nil && li.Name == name {
+				c.Close()
+				return Line{chip, offset}, nil
+			}
+		}
+		c.Close()
+	}
+	return Line{}, fmt.Errorf("%s: not found", name)
+}
+
+// Request the line with the given configuration.
+func (l Line) Request(consumer string, cfg Config) (*Lines, error) {
+	c, err := Open(l.Chip)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.Request(consumer, cfg, l.Offset)
+}
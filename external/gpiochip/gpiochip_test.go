@@ -0,0 +1,114 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package gpiochip
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestSizes(t *testing.T) {
+	for _, x := range []struct {
+		name      string
+		got, want uintptr
+	}{
+		{"gpiochip_info", unsafe.Sizeof(chipInfo{}), 68},
+		{"gpio_v2_line_info", unsafe.Sizeof(lineInfo{}), 256},
+		{"gpio_v2_line_config", unsafe.Sizeof(lineConfig{}), 272},
+		{"gpio_v2_line_request", unsafe.Sizeof(lineRequest{}), 592},
+		{"gpio_v2_line_values", unsafe.Sizeof(lineValues{}), 16},
+		{"gpio_v2_line_event", unsafe.Sizeof(lineEvent{}), 48},
+	} {
+		if x.got != x.want {
+			t.Errorf("%s: %d bytes, expected %d", x.name, x.got,
+				x.want)
+		}
+	}
+	if getLineIoctl != 0xc250b407 {
+		t.Errorf("GPIO_V2_GET_LINE_IOCTL %#x", getLineIoctl)
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	for s, want := range map[string]Line{
+		"gpiochip1:7": {"gpiochip1", 7},
+		"0:12":        {"gpiochip0", 12},
+	} {
+		if l, err := ParseLine(s); err != nil || l != want {
+			t.Errorf("%s: %v %v", s, l, err)
+		}
+	}
+	for _, s := range []string{"gpiochip0", "foo:1", "0:-1", "0:x"} {
+		if _, err := ParseLine(s); err == nil {
+			t.Errorf("%s: not an error", s)
+		}
+	}
+	f := Input | ActiveLow | Edges | PullUp
+	if s := f.String(); s != "active-low,falling,input,pull-up,rising" {
+		t.Error(s)
+	}
+}
+
+// mockChip returns the first of those created by the gpio-sim or
+// gpio-mockup modules, e.g. modprobe gpio-mockup gpio_mockup_ranges=-1,8
+func mockChip(t *testing.T) *Chip {
+	chips, _ := Chips()
+	for _, name := range chips {
+		c, err := Open(name)
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(c.Label, "gpio-mockup") ||
+			strings.HasPrefix(c.Label, "gpio-sim") {
+			return c
+		}
+		c.Close()
+	}
+	t.Skip("no gpio-sim or gpio-mockup chip")
+	return nil
+}
+
+func TestMock(t *testing.T) {
+	c := mockChip(t)
+	defer c.Close()
+	l, err := c.Request("gpiochip-test", Config{
+		Flags: Input | Edges | PullDown,
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if li, err := c.LineInfo(0); err != nil {
+		t.Fatal(err)
+	} else if li.Consumer != "gpiochip-test" || li.Flags&Used == 0 {
+		t.Errorf("%+v", li)
+	}
+	if v, err := l.Values(); err != nil || v != 0 {
+		t.Fatal("pull-down:", v, err)
+	}
+	events := make(chan Event, 1)
+	go func() {
+		if e, err := l.ReadEvent(); err == nil {
+			events <- e
+		}
+	}()
+	err = l.Reconfigure(Config{Flags: Input | Edges | PullUp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := l.Values(); err != nil || v != 1 {
+		t.Fatal("pull-up:", v, err)
+	}
+	select {
+	case e := <-events:
+		if e.ID != RisingEdge || e.Offset != 0 {
+			t.Errorf("%+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Error("no rising edge")
+	}
+}
@@ -40,6 +40,14 @@ type Bus struct {
 	features FeatureFlag
 }
 
+// Device is a Bus, or Mock, with which a slave may be selected and
+// accessed.
+type Device interface {
+	ForceSlaveAddress(int) error
+	Do(rw RW, command uint8, size SMBusSize, data *SMBusData) error
+	Close() error
+}
+
 func New(index, address int) (*Bus, error) {
 	bus := new(Bus)
 	err := bus.Open(index)
@@ -112,6 +120,17 @@ func (b *Bus) SetSlaveAddress(n int) error { return chk("set slave address", ioc
 func (b *Bus) ForceSlaveAddress(n int) error {
 	return chk("force slave address", ioctlInt(b, I2C_SLAVE_FORCE, n))
 }
+
+// SetPEC enables, or disables, SMBus packet error checking of the slave's
+// transfers by the adapter.
+func (b *Bus) SetPEC(on bool) error {
+	arg := 0
+	if on {
+		arg = 1
+	}
+	return chk("set pec", ioctlInt(b, I2C_PEC, arg))
+}
+
 func (b *Bus) Set10BitAddressing() error {
 	return chk("set 10bit addressing", ioctlInt(b, I2C_TENBIT, 1))
 }
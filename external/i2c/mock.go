@@ -0,0 +1,132 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package i2c
+
+import "syscall"
+
+// Mock is a Device of simulated slaves so that drivers may be tested
+// without hardware. Transfers with absent slaves fail as a NAK would.
+type Mock struct {
+	Slaves map[int]MockSlave
+	// PEC is set by SetPEC
+	PEC  bool
+	addr int
+}
+
+// MockSlave simulates the SMBus transfers of a device.
+type MockSlave interface {
+	Do(rw RW, command uint8, size SMBusSize, data *SMBusData) error
+}
+
+// Registers simulate a slave of byte and word registers. Send and receive
+// byte transfers, e.g. those of a mux control register, access register 0.
+// Words are little endian as transferred by SMBus.
+type Registers map[uint8]uint16
+
+func (m *Mock) ForceSlaveAddress(addr int) error {
+	m.addr = addr
+	return nil
+}
+
+func (m *Mock) Do(rw RW, command uint8, size SMBusSize, data *SMBusData) error {
+	tag := "write"
+	if rw == Read {
+		tag = "read"
+	}
+	slave, found := m.Slaves[m.addr]
+	if !found {
+		return chk(tag, syscall.ENXIO)
+	}
+	var zero SMBusData
+	if data == nil {
+		data = &zero
+	}
+	return chk(tag, slave.Do(rw, command, size, data))
+}
+
+func (m *Mock) SetPEC(on bool) error {
+	m.PEC = on
+	return nil
+}
+
+func (m *Mock) Close() error { return nil }
+
+func (r Registers) Do(rw RW, command uint8, size SMBusSize, data *SMBusData) error {
+	switch size {
+	case Quick:
+	case Byte:
+		if rw == Write {
+			r[0] = uint16(command)
+		} else {
+			data[0] = uint8(r[0])
+		}
+	case ByteData:
+		if rw == Write {
+			r[command] = uint16(data[0])
+		} else {
+			data[0] = uint8(r[command])
+		}
+	case WordData:
+		if rw == Write {
+			r[command] = uint16(data[1])<<8 | uint16(data[0])
+		} else {
+			data[0], data[1] = uint8(r[command]), uint8(r[command]>>8)
+		}
+	default:
+		return syscall.EOPNOTSUPP
+	}
+	return nil
+}
+
+// Image simulates a slave with a recorded image of each command's bytes
+// as transferred, e.g. little endian words and blocks without their
+// length.
+type Image map[uint8][]byte
+
+func (img Image) Do(rw RW, command uint8, size SMBusSize, data *SMBusData) error {
+	n := map[SMBusSize]int{
+		Quick:     0,
+		Byte:      1,
+		ByteData:  1,
+		WordData:  2,
+		BlockData: -1,
+	}
+	want, found := n[size]
+	if !found {
+		return syscall.EOPNOTSUPP
+	}
+	switch {
+	case size == Quick:
+	case size == Byte && rw == Write:
+		img[0] = []byte{command}
+	case size == Byte:
+		b, found := img[0]
+		if !found {
+			return syscall.EIO
+		}
+		data[0] = b[0]
+	case rw == Write && size == BlockData:
+		if data[0] > SMBusMax {
+			return syscall.EINVAL
+		}
+		img[command] = append([]byte{}, data[1:1+data[0]]...)
+	case rw == Write:
+		img[command] = append([]byte{}, data[:want]...)
+	case size == BlockData:
+		b, found := img[command]
+		if !found || len(b) > SMBusMax {
+			return syscall.EIO
+		}
+		data[0] = uint8(len(b))
+		copy(data[1:], b)
+	default:
+		b, found := img[command]
+		if !found || len(b) < want {
+			return syscall.EIO
+		}
+		copy(data[:], b[:want])
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package i2c
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Hop is a channel of a PCA954x mux.
+type Hop struct {
+	Addr    int
+	Channel int
+}
+
+// Path is the bus, mux channels and address of a device.
+type Path struct {
+	Bus  int
+	Mux  []Hop
+	Addr int
+}
+
+// MuxAddrs are those of PCA954x muxes.
+const (
+	MuxMin = 0x70
+	MuxMax = 0x77
+)
+
+// ParsePath parses BUS[/MUX:CHANNEL].../ADDR of decimal or 0x prefixed
+// hex numbers, e.g. 0/0x70:3/0x50.
+func ParsePath(s string) (Path, error) {
+	return parsePath(s, 0)
+}
+
+// ParseHexPath parses the path of hex numbers, with optional 0x prefix,
+// as given to the i2c command, e.g. 0/70:3/50.
+func ParseHexPath(s string) (Path, error) {
+	return parsePath(s, 16)
+}
+
+func parsePath(s string, base int) (Path, error) {
+	var p Path
+	l := strings.Split(s, "/")
+	if len(l) < 2 {
+		return p, fmt.Errorf("%s: expected BUS/ADDR", s)
+	}
+	var err error
+	if p.Bus, err = parseNum(l[0], base, 0xff); err != nil {
+		return p, fmt.Errorf("%s: bus: %v", s, err)
+	}
+	for _, hs := range l[1 : len(l)-1] {
+		var hop Hop
+		i := strings.IndexByte(hs, ':')
+		if i < 0 {
+			return p, fmt.Errorf("%s: expected MUX:CHANNEL", hs)
+		}
+		hop.Addr, err = parseNum(hs[:i], base, 0x7f)
+		if err == nil {
+			hop.Channel, err = parseNum(hs[i+1:], base, 7)
+		}
+		if err != nil {
+			return p, fmt.Errorf("%s: %v", hs, err)
+		}
+		p.Mux = append(p.Mux, hop)
+	}
+	if p.Addr, err = parseNum(l[len(l)-1], base, 0x7f); err != nil {
+		return p, fmt.Errorf("%s: address: %v", s, err)
+	}
+	return p, nil
+}
+
+func parseNum(s string, base, max int) (int, error) {
+	if base == 16 {
+		s = strings.TrimPrefix(s, "0x")
+	}
+	u, err := strconv.ParseUint(s, base, 32)
+	if err != nil || int(u) > max {
+		return 0, fmt.Errorf("%s: invalid", s)
+	}
+	return int(u), nil
+}
+
+// String returns the path with 0x prefixed addresses, and bus if more
+// than one digit, so that it means the same to ParsePath and ParseHexPath.
+func (p Path) String() string {
+	s := fmt.Sprint(p.Bus)
+	if p.Bus > 9 {
+		s = fmt.Sprintf("%#x", p.Bus)
+	}
+	for _, hop := range p.Mux {
+		s += fmt.Sprintf("/0x%02x:%d", hop.Addr, hop.Channel)
+	}
+	return s + fmt.Sprintf("/0x%02x", p.Addr)
+}
+
+// Behind returns the path of the address behind the channel of the mux
+// at the end of the path.
+func (p Path) Behind(channel, addr int) Path {
+	mux := make([]Hop, len(p.Mux), len(p.Mux)+1)
+	copy(mux, p.Mux)
+	return Path{
+		Bus:  p.Bus,
+		Mux:  append(mux, Hop{p.Addr, channel}),
+		Addr: addr,
+	}
+}
+
+// Mask of the channel in the mux control register.
+func (hop Hop) Mask() uint8 { return 1 << uint(hop.Channel) }
+
+// SelectMux writes the control register of the PCA954x at addr.
+func SelectMux(d Device, addr int, mask uint8) error {
+	if err := d.ForceSlaveAddress(addr); err != nil {
+		return err
+	}
+	return d.Do(Write, mask, Byte, nil)
+}
+
+// Lock the bus for exclusive use among processes until Unlock or Close.
+func (b *Bus) Lock() error {
+	return chk("lock", syscall.Flock(b.fd, syscall.LOCK_EX))
+}
+
+func (b *Bus) Unlock() error {
+	return chk("unlock", syscall.Flock(b.fd, syscall.LOCK_UN))
+}
+
+// Do calls f with the device of the path addressed and its mux channels
+// selected. If d is an *i2c.Bus, it's locked until the channels are
+// deselected so that others can't switch them.
+func (p Path) Do(d Device, f func(Device) error) error {
+	if l, ok := d.(interface {
+		Lock() error
+		Unlock() error
+	}); ok {
+		if err := l.Lock(); err != nil {
+			return err
+		}
+		defer l.Unlock()
+	}
+	for i, hop := range p.Mux {
+		if err := SelectMux(d, hop.Addr, hop.Mask()); err != nil {
+			deselect(d, p.Mux[:i])
+			return fmt.Errorf("mux %02x: %v", hop.Addr, err)
+		}
+	}
+	defer deselect(d, p.Mux)
+	if err := d.ForceSlaveAddress(p.Addr); err != nil {
+		return err
+	}
+	return f(d)
+}
+
+func deselect(d Device, hops []Hop) {
+	for i := len(hops) - 1; i >= 0; i-- {
+		SelectMux(d, hops[i].Addr, 0)
+	}
+}
+
+// DoPath calls f with the device of the path as with Path.Do.
+func DoPath(p Path, f func(Device) error) error {
+	var bus Bus
+	if err := bus.Open(p.Bus); err != nil {
+		return err
+	}
+	defer bus.Close()
+	return p.Do(&bus, f)
+}
+
+// Probe returns true if the addressed device acknowledges, as does
+// i2cdetect: EEPROMs with a read byte, lest a quick write corrupt them,
+// and others with a quick write.
+func Probe(d Device, p Path) bool {
+	return p.Do(d, func(d Device) error {
+		if (p.Addr >= 0x30 && p.Addr <= 0x37) ||
+			(p.Addr >= 0x50 && p.Addr <= 0x5f) {
+			var data SMBusData
+			return d.Do(Read, 0, Byte, &data)
+		}
+		return d.Do(Write, 0, Quick, nil)
+	}) == nil
+}
+
+// MuxChannels returns the number of channels of the PCA9548 or PCA9546
+// at the path, or zero if its control register doesn't behave as one.
+func MuxChannels(d Device, p Path) int {
+	n := 0
+	p.Do(d, func(d Device) error {
+		defer d.Do(Write, 0, Byte, nil)
+		for _, x := range []struct {
+			mask uint8
+			n    int
+		}{
+			{0x01, 4},
+			{0x80, 8},
+		} {
+			var data SMBusData
+			if d.Do(Write, x.mask, Byte, nil) != nil ||
+				d.Do(Read, 0, Byte, &data) != nil ||
+				data[0] != x.mask {
+				break
+			}
+			n = x.n
+		}
+		return nil
+	})
+	return n
+}
+
+// Detect calls found with the path of each device that responds on the
+// segment of the path's bus and mux channels; then, recursively, with
+// those behind the channels of each mux found. The Addr of the given path
+// is ignored.
+func Detect(d Device, p Path, found func(Path)) {
+	seen := make(map[int]bool)
+	detect(d, p, seen, found)
+}
+
+func detect(d Device, p Path, seen map[int]bool, found func(Path)) {
+	var here []int
+	for addr := 0x03; addr <= 0x77; addr++ {
+		if seen[addr] {
+			// on a parent segment, responds on every channel
+			continue
+		}
+		p.Addr = addr
+		if Probe(d, p) {
+			here = append(here, addr)
+			found(p)
+		}
+	}
+	for _, addr := range here {
+		seen[addr] = true
+	}
+	for _, addr := range here {
+		if addr < MuxMin || addr > MuxMax {
+			continue
+		}
+		p.Addr = addr
+		n := MuxChannels(d, p)
+		for ch := 0; ch < n; ch++ {
+			detect(d, p.Behind(ch, 0), seen, found)
+		}
+	}
+	for _, addr := range here {
+		delete(seen, addr)
+	}
+}
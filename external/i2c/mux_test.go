@@ -0,0 +1,157 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package i2c
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// testMux is a PCA9548 with a segment of slaves on each channel.
+type testMux struct {
+	ctl      uint8
+	segments [8]map[int]MockSlave
+}
+
+func (m *testMux) Do(rw RW, command uint8, size SMBusSize, data *SMBusData) error {
+	switch {
+	case size == Quick:
+		return nil
+	case size != Byte:
+		return syscall.EOPNOTSUPP
+	case rw == Write:
+		m.ctl = command
+	default:
+		data[0] = m.ctl
+	}
+	return nil
+}
+
+// testTree is a Device that routes transfers through the selected
+// channels of its muxes.
+type testTree struct {
+	root map[int]MockSlave
+	addr int
+}
+
+func (t *testTree) ForceSlaveAddress(addr int) error {
+	t.addr = addr
+	return nil
+}
+
+func (t *testTree) Close() error { return nil }
+
+func (t *testTree) lookup(segment map[int]MockSlave) MockSlave {
+	if s, found := segment[t.addr]; found {
+		return s
+	}
+	for _, s := range segment {
+		if m, ok := s.(*testMux); ok {
+			for ch, seg := range m.segments {
+				if m.ctl&(1<<uint(ch)) != 0 {
+					if s := t.lookup(seg); s != nil {
+						return s
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (t *testTree) Do(rw RW, command uint8, size SMBusSize, data *SMBusData) error {
+	s := t.lookup(t.root)
+	if s == nil {
+		return syscall.ENXIO
+	}
+	var zero SMBusData
+	if data == nil {
+		data = &zero
+	}
+	return s.Do(rw, command, size, data)
+}
+
+func TestParsePath(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		parse func(string) (Path, error)
+		want  Path
+	}{
+		{"10/0x70:3/0x71:7/80", ParsePath,
+			Path{10, []Hop{{0x70, 3}, {0x71, 7}}, 80}},
+		{"10/70:3/0x71:7/50", ParseHexPath,
+			Path{0x10, []Hop{{0x70, 3}, {0x71, 7}}, 0x50}},
+	} {
+		p, err := tc.parse(tc.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p, tc.want) {
+			t.Errorf("%s: got %+v", tc.s, p)
+		}
+		for _, parse := range []func(string) (Path, error){
+			ParsePath,
+			ParseHexPath,
+		} {
+			if q, err := parse(p.String()); err != nil ||
+				!reflect.DeepEqual(q, p) {
+				t.Errorf("%s: got %+v, %v", p, q, err)
+			}
+		}
+	}
+	for _, bad := range []string{"1", "1/0x70/0x50", "1/0x70:8/0x50",
+		"1/0x80", "1/128"} {
+		if _, err := ParsePath(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	inner := &testMux{}
+	inner.segments[2] = map[int]MockSlave{0x48: Registers{}}
+	outer := &testMux{}
+	outer.segments[0] = map[int]MockSlave{0x50: Registers{}}
+	outer.segments[3] = map[int]MockSlave{
+		0x50: Registers{},
+		0x71: inner,
+	}
+	tree := &testTree{root: map[int]MockSlave{
+		0x20: Registers{},
+		0x70: outer,
+	}}
+	var got []string
+	Detect(tree, Path{Bus: 1}, func(p Path) {
+		got = append(got, p.String())
+	})
+	want := []string{
+		"1/0x20",
+		"1/0x70",
+		"1/0x70:0/0x50",
+		"1/0x70:3/0x50",
+		"1/0x70:3/0x71",
+		"1/0x70:3/0x71:2/0x48",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q", got)
+	}
+	if outer.ctl != 0 || inner.ctl != 0 {
+		t.Error("muxes left selected")
+	}
+
+	p, _ := ParseHexPath("1/70:3/71:2/48")
+	err := p.Do(tree, func(d Device) error {
+		var data SMBusData
+		data[0] = 0x5a
+		return d.Do(Write, 1, ByteData, &data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := inner.segments[2][0x48].(Registers)[1]; v != 0x5a {
+		t.Errorf("got %#x", v)
+	}
+}
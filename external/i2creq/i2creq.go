@@ -0,0 +1,219 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package i2creq is the request/response API of the i2cd service and its
+// client. Daemons use a Client rather than opening /dev/i2c-N so that i2cd
+// may arbitrate the buses among them.
+package i2creq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/platinasystems/goes/external/atsock"
+	"github.com/platinasystems/goes/external/i2c"
+)
+
+// Name is that of the i2cd abstract unix socket, "@i2cd".
+const Name = "i2cd"
+
+// DefaultTimeout is the time to wait for busy buses.
+const DefaultTimeout = 5 * time.Second
+
+var (
+	ErrBusy   = errors.New("bus busy")
+	ErrDenied = errors.New("permission denied")
+	ErrNoOps  = errors.New("no operations")
+)
+
+// Op is an SMBus transfer with the device at Addr of /dev/i2c-Bus.
+type Op struct {
+	Bus     int
+	Addr    int
+	RW      i2c.RW
+	Command uint8
+	Size    i2c.SMBusSize
+	Data    i2c.SMBusData
+	// Delay after the op, e.g. for an EEPROM write.
+	Delay time.Duration
+}
+
+func (op *Op) String() string {
+	rw := "write"
+	if op.RW == i2c.Read {
+		rw = "read"
+	}
+	return fmt.Sprintf("%s bus %d addr %#x command %#x size %d",
+		rw, op.Bus, op.Addr, op.Command, op.Size)
+}
+
+// Tx is an atomic transaction; no other client may use its buses until
+// the ops complete or one fails.
+type Tx struct {
+	// Client names the requester in statistics, default: the program
+	Client  string
+	Timeout time.Duration
+	// Rollback restores the registers written by byte and word data
+	// ops if a later op fails.
+	Rollback bool
+	Ops      []Op
+	// Finally has ops done after Ops, with the buses still locked,
+	// whether or not those succeed; e.g. to deselect mux channels.
+	// Their data isn't returned and their errors are only logged.
+	Finally []Op
+}
+
+// Reply has the data of each op or the error of the failed op.
+type Reply struct {
+	Data []i2c.SMBusData
+	// Failed is the index of the failed op or -1.
+	Failed int
+	// RolledBack is true if the ops before Failed were undone.
+	RolledBack bool
+	Err        string
+}
+
+// Stats are the counters of a client or bus.
+type Stats struct {
+	Tx       uint64
+	Ops      uint64
+	Errors   uint64
+	Timeouts uint64
+}
+
+// Client of i2cd.
+type Client struct {
+	*rpc.Client
+	Name string
+}
+
+// Dial the unix socket of the local i2cd.
+func Dial() (*Client, error) {
+	cl, err := atsock.NewRpcClient(Name)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: cl, Name: defaultName()}, nil
+}
+
+// DialTCP connects to an i2cd listening on addr and authenticates with
+// its token.
+func DialTCP(addr, token string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{Client: rpc.NewClient(conn), Name: defaultName()}
+	if err = c.Call("I2c.Auth", token, new(bool)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// defaultName is that of the daemon or command, i.e. its argv[0].
+func defaultName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// Do the transaction. If an op fails, reply.Failed is its index.
+func (c *Client) Do(tx *Tx) (*Reply, error) {
+	if len(tx.Client) == 0 {
+		tx.Client = c.Name
+	}
+	reply := new(Reply)
+	if err := c.Call("I2c.Do", tx, reply); err != nil {
+		return reply, err
+	}
+	return reply, reply.Error()
+}
+
+// Error returns the error of the reply, if any.
+func (reply *Reply) Error() error {
+	if len(reply.Err) == 0 {
+		return nil
+	}
+	for _, err := range []error{ErrBusy, ErrDenied, ErrNoOps} {
+		if reply.Err == err.Error() {
+			return err
+		}
+	}
+	return errors.New(reply.Err)
+}
+
+// Read returns the data of a single read.
+func (c *Client) Read(bus, addr int, command uint8,
+	size i2c.SMBusSize) (i2c.SMBusData, error) {
+	reply, err := c.Do(&Tx{Ops: []Op{{
+		Bus:     bus,
+		Addr:    addr,
+		RW:      i2c.Read,
+		Command: command,
+		Size:    size,
+	}}})
+	if err != nil {
+		return i2c.SMBusData{}, err
+	}
+	return reply.Data[0], nil
+}
+
+// Write a single op.
+func (c *Client) Write(bus, addr int, command uint8, size i2c.SMBusSize,
+	data i2c.SMBusData) error {
+	_, err := c.Do(&Tx{Ops: []Op{{
+		Bus:     bus,
+		Addr:    addr,
+		RW:      i2c.Write,
+		Command: command,
+		Size:    size,
+		Data:    data,
+	}}})
+	return err
+}
+
+func (c *Client) ReadByteData(bus, addr int, reg uint8) (uint8, error) {
+	data, err := c.Read(bus, addr, reg, i2c.ByteData)
+	return data[0], err
+}
+
+func (c *Client) WriteByteData(bus, addr int, reg, v uint8) error {
+	var data i2c.SMBusData
+	data[0] = v
+	return c.Write(bus, addr, reg, i2c.ByteData, data)
+}
+
+func (c *Client) ReadWordData(bus, addr int, reg uint8) (uint16, error) {
+	data, err := c.Read(bus, addr, reg, i2c.WordData)
+	return uint16(data[1])<<8 | uint16(data[0]), err
+}
+
+func (c *Client) WriteWordData(bus, addr int, reg uint8, v uint16) error {
+	var data i2c.SMBusData
+	data[0], data[1] = uint8(v), uint8(v>>8)
+	return c.Write(bus, addr, reg, i2c.WordData, data)
+}
+
+// SetStopped asks polling daemons to pause, true, or resume, false.
+func (c *Client) SetStopped(stopped bool) error {
+	return c.Call("I2c.SetStopped", stopped, new(bool))
+}
+
+// Stopped returns true if polling daemons should pause.
+func (c *Client) Stopped() (bool, error) {
+	var stopped bool
+	err := c.Call("I2c.Stopped", false, &stopped)
+	return stopped, err
+}
+
+// Stats returns the counters of each client.
+func (c *Client) Stats() (map[string]Stats, error) {
+	m := make(map[string]Stats)
+	err := c.Call("I2c.Stats", false, &m)
+	return m, err
+}
@@ -0,0 +1,186 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package partitions
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/platinasystems/goes/internal/magic/gpt"
+	"github.com/satori/go.uuid"
+)
+
+var ErrNoGPT = errors.New("no valid GPT header")
+
+// GPT is a GUID Partition Table.
+type GPT struct {
+	DiskGUID   uuid.UUID
+	SectorSize int
+	// HeaderLBA is 1 unless the primary header is corrupt and this was
+	// read from the backup at the last LBA.
+	HeaderLBA      uint64
+	AlternateLBA   uint64
+	FirstUsableLBA uint64
+	LastUsableLBA  uint64
+	Partitions     []*GPTPartition
+}
+
+// GPTPartition is a used GPT entry.
+type GPTPartition struct {
+	// Number is the 1 based entry index and so the kernel's partition
+	// number, e.g. sda2 or mmcblk0p2.
+	Number     int
+	Type       uuid.UUID
+	UUID       uuid.UUID // PARTUUID
+	FirstLBA   uint64
+	LastLBA    uint64
+	Attributes uint64
+	Name       string // PARTLABEL
+}
+
+// GPTPartitionTypes names well known partition type GUIDs.
+var GPTPartitionTypes = map[string]string{
+	"c12a7328-f81f-11d2-ba4b-00a0c93ec93b": "EFI System",
+	"21686148-6449-6e6f-744e-656564454649": "BIOS boot",
+	"ebd0a0a2-b9e5-4433-87c0-68b6b72699c7": "Microsoft basic data",
+	"0fc63daf-8483-4772-8e79-3d69d8477de4": "Linux filesystem",
+	"0657fd6d-a4ab-43c4-84e5-0933c84b4f4f": "Linux swap",
+	"e6d6d379-f507-44c2-a23c-238f2a3df928": "Linux LVM",
+	"a19d880f-05fc-4d3b-a006-743f0f84911e": "Linux RAID",
+	"ca7d7ccb-63ed-4c53-861c-1742536059cc": "Linux LUKS",
+	"4f68bce3-e8cd-4db1-96e7-fbcaf984b709": "Linux root (x86-64)",
+	"b921b045-1df0-41c3-af44-4c6f280d3fae": "Linux root (ARM-64)",
+	"69dad710-2ce4-4e3c-b16c-21a1d49abed3": "Linux root (ARM)",
+	"933ac7e1-2eb4-4f13-b844-0e14e2aef915": "Linux home",
+	"bc13c2ff-59e6-4262-a352-b275fd6f7172": "Linux extended boot",
+	"7412f7d5-a156-4b13-81dc-867174929325": "ONIE boot",
+	"d4e6e2cd-4469-46f3-b5cb-1bff57afc149": "ONIE config",
+}
+
+// TypeName returns the name of the partition type or its GUID if unknown.
+func (p *GPTPartition) TypeName() string {
+	s := p.Type.String()
+	if name, found := GPTPartitionTypes[s]; found {
+		return name
+	}
+	return s
+}
+
+// Sectors returns the size of the partition in logical blocks.
+func (p *GPTPartition) Sectors() uint64 {
+	return p.LastLBA - p.FirstLBA + 1
+}
+
+// ReadGPT returns the partition table of the given disk.
+func ReadGPT(dev string) (*GPT, error) {
+	f, err := os.Open(dev)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGPT(f, size)
+}
+
+// ParseGPT returns the partition table of a disk image of the given size.
+// If the primary header or its entries are corrupt, it tries the backup at
+// the last LBA.
+func ParseGPT(r io.ReaderAt, size int64) (*GPT, error) {
+	for _, ss := range gpt.SectorSizes {
+		lbas := []int64{1}
+		if n := size / int64(ss); n > 2 {
+			lbas = append(lbas, n-1)
+		}
+		var first error
+		for _, lba := range lbas {
+			t, err := parseGPT(r, ss, lba)
+			if err == nil {
+				return t, nil
+			}
+			if err != ErrNoGPT && first == nil {
+				first = fmt.Errorf("LBA %d: %v", lba, err)
+			}
+		}
+		if first != nil {
+			return nil, first
+		}
+	}
+	return nil, ErrNoGPT
+}
+
+func parseGPT(r io.ReaderAt, ss int, lba int64) (*GPT, error) {
+	b := make([]byte, ss)
+	if _, err := r.ReadAt(b, lba*int64(ss)); err != nil {
+		if err == io.EOF {
+			return nil, ErrNoGPT
+		}
+		return nil, err
+	}
+	h := gpt.Valid(b, 0)
+	if h == nil {
+		return nil, ErrNoGPT
+	}
+	le := binary.LittleEndian
+	t := &GPT{
+		SectorSize:     ss,
+		HeaderLBA:      le.Uint64(h[24:]),
+		AlternateLBA:   le.Uint64(h[32:]),
+		FirstUsableLBA: le.Uint64(h[40:]),
+		LastUsableLBA:  le.Uint64(h[48:]),
+		DiskGUID:       guid(h[56:]),
+	}
+	if t.HeaderLBA != uint64(lba) {
+		return nil, fmt.Errorf("header LBA %d: unexpected",
+			t.HeaderLBA)
+	}
+	entriesLBA := le.Uint64(h[72:])
+	n := int(le.Uint32(h[80:]))
+	sz := int(le.Uint32(h[84:]))
+	if sz < 128 || sz%8 != 0 || n < 0 || n*sz > 1<<20 {
+		return nil, fmt.Errorf("%d entries of %d bytes: invalid", n, sz)
+	}
+	entries := make([]byte, n*sz)
+	if _, err := r.ReadAt(entries, int64(entriesLBA)*int64(ss)); err != nil {
+		return nil, fmt.Errorf("entries: %v", err)
+	}
+	if crc32.ChecksumIEEE(entries) != le.Uint32(h[88:]) {
+		return nil, fmt.Errorf("entries: CRC mismatch")
+	}
+	for i := 0; i < n; i++ {
+		e := entries[i*sz : (i+1)*sz]
+		p := &GPTPartition{
+			Number:     i + 1,
+			Type:       guid(e[0:]),
+			UUID:       guid(e[16:]),
+			FirstLBA:   le.Uint64(e[32:]),
+			LastLBA:    le.Uint64(e[40:]),
+			Attributes: le.Uint64(e[48:]),
+			Name:       strings.TrimRight(utf16le(e[56:128]), " "),
+		}
+		if p.Type == uuid.Nil {
+			continue
+		}
+		t.Partitions = append(t.Partitions, p)
+	}
+	return t, nil
+}
+
+// guid returns the UUID of a mixed endian GUID.
+func guid(b []byte) uuid.UUID {
+	var u uuid.UUID
+	u[0], u[1], u[2], u[3] = b[3], b[2], b[1], b[0]
+	u[4], u[5] = b[5], b[4]
+	u[6], u[7] = b[7], b[6]
+	copy(u[8:], b[8:16])
+	return u
+}
@@ -5,18 +5,34 @@
 package partitions
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"io"
 	"os"
+	"strings"
+	"unicode/utf16"
 
 	"github.com/platinasystems/goes/internal/magic"
+	"github.com/platinasystems/goes/internal/magic/btrfs"
+	"github.com/platinasystems/goes/internal/magic/f2fs"
+	"github.com/platinasystems/goes/internal/magic/luks"
+	"github.com/platinasystems/goes/internal/magic/swap"
+	"github.com/platinasystems/goes/internal/magic/ubifs"
+	"github.com/platinasystems/goes/internal/magic/xfs"
 	"github.com/satori/go.uuid"
 )
 
 var ErrNotFilesystem = errors.New("not a filesystem")
 var ErrNotSupported = errors.New("filesystem feature not supported")
 
+// SniffLen is enough to probe every known superblock; the btrfs superblock
+// is at 64KiB.
+const SniffLen = 0x11000
+
 type superBlock interface {
 	UUID() (uuid.UUID, error)
+	Label() string
 	Kind() string
 }
 
@@ -28,37 +44,74 @@ func (sb *unknownSB) UUID() (uuid.UUID, error) {
 	return uuid.Nil, ErrNotSupported
 }
 
+func (sb *unknownSB) Label() string { return "" }
+
 func (sb *unknownSB) Kind() string {
 	return sb.kind
 }
 
 type ext234 struct {
-	sUUID uuid.UUID
-	kind  string
+	sUUID  uuid.UUID
+	sLabel string
+	kind   string
 }
 
 const (
-	ext234SUUIDOff = 0x468
-	ext234SUUIDLen = 16
+	ext234SUUIDOff  = 0x468
+	ext234SUUIDLen  = 16
+	ext234SLabelOff = 0x478
+	ext234SLabelLen = 16
 )
 
 func (sb *ext234) UUID() (uuid.UUID, error) {
 	return sb.sUUID, nil
 }
 
+func (sb *ext234) Label() string { return sb.sLabel }
+
 func (sb *ext234) Kind() string {
 	return sb.kind
 }
 
+// probedSB is the superblock of other filesystems, some of which don't have
+// a UUID.
+type probedSB struct {
+	sUUID  uuid.UUID
+	sLabel string
+	kind   string
+}
+
+func (sb *probedSB) UUID() (uuid.UUID, error) {
+	if sb.sUUID == uuid.Nil {
+		return uuid.Nil, ErrNotSupported
+	}
+	return sb.sUUID, nil
+}
+
+func (sb *probedSB) Label() string { return sb.sLabel }
+
+func (sb *probedSB) Kind() string {
+	return sb.kind
+}
+
+const (
+	vfatLabelOff   = 0x2b
+	vfat32LabelOff = 0x47
+	vfatLabelLen   = 11
+	vfat32TypeOff  = 0x52
+	iso9660LblOff  = 0x8028
+	iso9660LblLen  = 32
+)
+
 func ReadSuperBlock(dev string) (superBlock, error) {
 	f, err := os.Open(dev)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	fsHeader := make([]byte, 0x10000)
-	_, err = f.Read(fsHeader)
-	if err != nil {
+	fsHeader := make([]byte, SniffLen)
+	_, err = io.ReadFull(f, fsHeader)
+	if err != nil && err != io.ErrUnexpectedEOF {
 		return nil, err
 	}
 
@@ -69,12 +122,96 @@ func ReadSuperBlock(dev string) (superBlock, error) {
 		return nil, ErrNotFilesystem
 	}
 
-	if partitionType == "ext2" || partitionType == "ext3" || partitionType == "ext4" {
+	return NewSuperBlock(partitionType, fsHeader), nil
+}
+
+// NewSuperBlock returns the superblock of the given kind, as identified by
+// magic.IdentifyPartition, from the first SniffLen bytes of a device.
+func NewSuperBlock(kind string, b []byte) superBlock {
+	if len(b) < SniffLen {
+		b = append(b, make([]byte, SniffLen-len(b))...)
+	}
+	switch kind {
+	case "ext2", "ext3", "ext4":
 		sb := &ext234{}
-		sb.sUUID = uuid.FromBytesOrNil(fsHeader[ext234SUUIDOff : ext234SUUIDOff+ext234SUUIDLen])
-		sb.kind = partitionType
-		return sb, nil
+		sb.sUUID = uuid.FromBytesOrNil(b[ext234SUUIDOff : ext234SUUIDOff+ext234SUUIDLen])
+		sb.sLabel = cstring(b[ext234SLabelOff : ext234SLabelOff+ext234SLabelLen])
+		sb.kind = kind
+		return sb
+	case "xfs":
+		return &probedSB{
+			sUUID:  uuid.FromBytesOrNil(b[xfs.UUIDOff : xfs.UUIDOff+16]),
+			sLabel: cstring(b[xfs.LabelOff : xfs.LabelOff+xfs.LabelLen]),
+			kind:   kind,
+		}
+	case "btrfs":
+		return &probedSB{
+			sUUID:  uuid.FromBytesOrNil(b[btrfs.UUIDOff : btrfs.UUIDOff+16]),
+			sLabel: cstring(b[btrfs.LabelOff : btrfs.LabelOff+btrfs.LabelLen]),
+			kind:   kind,
+		}
+	case "f2fs":
+		return &probedSB{
+			sUUID:  uuid.FromBytesOrNil(b[f2fs.UUIDOff : f2fs.UUIDOff+16]),
+			sLabel: utf16le(b[f2fs.LabelOff : f2fs.LabelOff+2*f2fs.LabelLen]),
+			kind:   kind,
+		}
+	case "ubifs":
+		return &probedSB{
+			sUUID: uuid.FromBytesOrNil(b[ubifs.UUIDOff : ubifs.UUIDOff+ubifs.UUIDLen]),
+			kind:  kind,
+		}
+	case "swap":
+		sb := &probedSB{kind: kind}
+		sz := swap.PageSize(b)
+		if sz > 0 && string(b[sz-swap.MagicLen:sz]) == swap.MagicV1 {
+			sb.sUUID = uuid.FromBytesOrNil(b[swap.UUIDOff : swap.UUIDOff+16])
+			sb.sLabel = cstring(b[swap.LabelOff : swap.LabelOff+swap.LabelLen])
+		}
+		return sb
+	case "crypto_LUKS":
+		sb := &probedSB{kind: kind}
+		sb.sUUID, _ = uuid.FromString(cstring(b[luks.UUIDOff : luks.UUIDOff+luks.UUIDLen]))
+		if luks.Version(b) == 2 {
+			sb.sLabel = cstring(b[luks.LabelOff : luks.LabelOff+luks.LabelLen])
+		}
+		return sb
+	case "vfat":
+		off := vfatLabelOff
+		if bytes.HasPrefix(b[vfat32TypeOff:], []byte("FAT32")) {
+			off = vfat32LabelOff
+		}
+		label := cstring(b[off : off+vfatLabelLen])
+		if label == "NO NAME" {
+			label = ""
+		}
+		return &probedSB{sLabel: label, kind: kind}
+	case "iso9660":
+		return &probedSB{
+			sLabel: cstring(b[iso9660LblOff : iso9660LblOff+iso9660LblLen]),
+			kind:   kind,
+		}
+	}
+	return &unknownSB{kind: kind}
+}
+
+// cstring returns the NUL terminated or space padded string.
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
 	}
+	return strings.TrimRight(string(b), " ")
+}
 
-	return &unknownSB{kind: partitionType}, nil
+// utf16le returns the NUL terminated UTF-16LE string.
+func utf16le(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
 }
@@ -0,0 +1,113 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package partitions
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/platinasystems/goes/internal/magic"
+)
+
+const testdata = "../../internal/magic"
+
+func TestSuperBlock(t *testing.T) {
+	const u = "5d3b1e0a-7c1f-4e4b-9b8c-0f1e2d3c4b5a"
+	for _, x := range []struct {
+		file, kind, uuid, label string
+	}{
+		{"xfs-sb.dat", "xfs", u, "root"},
+		{"btrfs-sb.dat", "btrfs", u, "pool"},
+		{"f2fs-sb.dat", "f2fs", u, "data"},
+		{"ubifs-sb.dat", "ubifs", u, ""},
+		{"luks-sb.dat", "crypto_LUKS", u, "crypted"},
+		{"squashfs-sb.dat", "squashfs", "", ""},
+		{"swap-sb.dat", "swap", "2b1c7ec4-6f3c-4b7c-9c1a-3d2f8f0e5a11",
+			"goes-swap"},
+	} {
+		sb, err := ReadSuperBlock(filepath.Join(testdata, x.file))
+		if err != nil {
+			t.Error(x.file, err)
+			continue
+		}
+		if sb.Kind() != x.kind {
+			t.Error(x.file, "kind", sb.Kind())
+		}
+		id, err := sb.UUID()
+		if len(x.uuid) == 0 {
+			if err != ErrNotSupported {
+				t.Error(x.file, "unexpected uuid", id)
+			}
+		} else if err != nil || id.String() != x.uuid {
+			t.Error(x.file, "uuid", id, err)
+		}
+		if sb.Label() != x.label {
+			t.Errorf("%s: label %q", x.file, sb.Label())
+		}
+	}
+	if _, err := ReadSuperBlock(filepath.Join(testdata, "gpt.dat")); err != ErrNotFilesystem {
+		t.Error("gpt.dat:", err)
+	}
+}
+
+func TestGPT(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join(testdata, "gpt.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if magic.IdentifyPartitionMap(b) != "gpt" {
+		t.Fatal("not gpt")
+	}
+	check := func(name string, b []byte, lba uint64) {
+		g, err := ParseGPT(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if g.HeaderLBA != lba || g.SectorSize != 512 ||
+			g.DiskGUID.String() != "9b2a7c3e-4d5f-4a6b-8c7d-0e1f2a3b4c5d" {
+			t.Error(name, "header", g)
+		}
+		if len(g.Partitions) != 3 {
+			t.Fatal(name, "partitions", len(g.Partitions))
+		}
+		p := g.Partitions[1]
+		if p.Number != 2 || p.Name != "ONIE-BOOT" ||
+			p.TypeName() != "ONIE boot" ||
+			p.UUID.String() != "1c2d3e4f-5a6b-4c7d-8e9f-0a1b2c3d4e5f" ||
+			p.FirstLBA != 206848 || p.Sectors() != 262144 {
+			t.Error(name, "partition", p)
+		}
+	}
+	check("primary", b, 1)
+
+	// Add a backup header and entries at the end of a 1MiB image, then
+	// corrupt the primary.
+	img := make([]byte, 1<<20)
+	copy(img, b)
+	last := uint64(len(img)/512 - 1)
+	h := make([]byte, 92)
+	copy(h, b[512:])
+	binary.LittleEndian.PutUint64(h[24:], last)
+	binary.LittleEndian.PutUint64(h[32:], 1)
+	binary.LittleEndian.PutUint64(h[72:], last-32)
+	binary.LittleEndian.PutUint32(h[16:], 0)
+	binary.LittleEndian.PutUint32(h[16:], crc32.ChecksumIEEE(h))
+	copy(img[(last-32)*512:], b[1024:1024+128*128])
+	copy(img[last*512:], h)
+	img[1024+56]++
+	check("backup", img, last)
+
+	img[last*512]++
+	if _, err = ParseGPT(bytes.NewReader(img), int64(len(img))); err == nil {
+		t.Error("expected CRC error")
+	}
+	if _, err = ParseGPT(bytes.NewReader(b[:4096]), 4096); err == nil {
+		t.Error("expected error for truncated entries")
+	}
+}
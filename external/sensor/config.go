@@ -0,0 +1,145 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package sensor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/goes/external/i2c"
+)
+
+const DefaultInterval = 5 * time.Second
+
+// Config is a machine's description of its sensors.
+type Config struct {
+	Interval   time.Duration
+	Devices    []Device
+	Thresholds []Threshold
+}
+
+// LoadConfig returns an empty configuration if the file doesn't exist.
+func LoadConfig(fn string) (*Config, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Config{Interval: DefaultInterval}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := ReadConfig(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", fn, err)
+	}
+	return cfg, err
+}
+
+// ReadConfig parses lines of these forms where thresholds are of a
+// device reading, e.g. "cpu.temp", and "-" disables a WARN or CRIT.
+//
+//	interval DURATION
+//	device NAME TYPE BUS[/MUX:CHANNEL].../ADDR [shunt OHMS]
+//	high READING WARN CRIT [HYSTERESIS]
+//	low READING WARN CRIT [HYSTERESIS]
+func ReadConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{Interval: DefaultInterval}
+	names := make(map[string]bool)
+	scan := bufio.NewScanner(r)
+	for line := 1; scan.Scan(); line++ {
+		s := scan.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "interval":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: expected interval DURATION",
+					line)
+			}
+			d, err := time.ParseDuration(fields[1])
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("line %d: %s: invalid",
+					line, fields[1])
+			}
+			cfg.Interval = d
+		case "device":
+			if len(fields) != 4 && len(fields) != 6 {
+				return nil, fmt.Errorf("line %d: expected device NAME TYPE PATH [shunt OHMS]",
+					line)
+			}
+			d := Device{Name: fields[1], Type: fields[2]}
+			if names[d.Name] {
+				return nil, fmt.Errorf("line %d: %s: duplicate",
+					line, d.Name)
+			}
+			if _, found := Drivers[d.Type]; !found {
+				return nil, fmt.Errorf("line %d: %s: unknown type",
+					line, d.Type)
+			}
+			var err error
+			if d.Path, err = i2c.ParsePath(fields[3]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			if len(fields) == 6 {
+				f, err := strconv.ParseFloat(fields[5], 64)
+				if fields[4] != "shunt" || err != nil || f <= 0 {
+					return nil, fmt.Errorf("line %d: %s %s: invalid",
+						line, fields[4], fields[5])
+				}
+				d.Shunt = f
+			}
+			names[d.Name] = true
+			cfg.Devices = append(cfg.Devices, d)
+		case "high", "low":
+			if len(fields) != 4 && len(fields) != 5 {
+				return nil, fmt.Errorf("line %d: expected %s READING WARN CRIT [HYSTERESIS]",
+					line, fields[0])
+			}
+			t := Threshold{
+				Reading: fields[1],
+				High:    fields[0] == "high",
+			}
+			var v [3]float64
+			for i, s := range fields[2:] {
+				if s == "-" && i < 2 {
+					v[i] = math.NaN()
+					continue
+				}
+				f, err := strconv.ParseFloat(s, 64)
+				if err != nil || (i == 2 && f < 0) {
+					return nil, fmt.Errorf("line %d: %s: invalid",
+						line, s)
+				}
+				v[i] = f
+			}
+			t.Warn, t.Crit, t.Hysteresis = v[0], v[1], v[2]
+			cfg.Thresholds = append(cfg.Thresholds, t)
+		default:
+			return nil, fmt.Errorf("line %d: %s: unknown", line,
+				fields[0])
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	for _, t := range cfg.Thresholds {
+		i := strings.LastIndexByte(t.Reading, '.')
+		if i < 0 || !names[t.Reading[:i]] {
+			return nil, fmt.Errorf("%s: no such device", t.Reading)
+		}
+	}
+	return cfg, nil
+}
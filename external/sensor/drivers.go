@@ -0,0 +1,155 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package sensor
+
+import (
+	"fmt"
+
+	"github.com/platinasystems/goes/internal/pmbus"
+)
+
+// Driver returns the readings of the selected device. Reading names are
+// relative to the device, e.g. "temp" or "fan1".
+type Driver func(r *Regs, d *Device) ([]Reading, error)
+
+// Drivers by Device.Type; machines may add their own.
+var Drivers = map[string]Driver{
+	"lm75":     lm75,
+	"tmp102":   tmp102,
+	"ina219":   ina219,
+	"pmbus":    psu,
+	"max31790": max31790,
+}
+
+// Units of readings.
+const (
+	Celsius = "C"
+	Volts   = "V"
+	Amps    = "A"
+	Watts   = "W"
+	RPM     = "RPM"
+)
+
+// lm75 has a 9-bit, 0.5°C temperature, left justified in register 0.
+func lm75(r *Regs, d *Device) ([]Reading, error) {
+	w, err := r.BigWord(0)
+	if err != nil {
+		return nil, err
+	}
+	return []Reading{{"temp", float64(int16(w)>>7) * 0.5, Celsius}}, nil
+}
+
+// tmp102 has a 12-bit, 0.0625°C temperature, left justified in register 0.
+func tmp102(r *Regs, d *Device) ([]Reading, error) {
+	w, err := r.BigWord(0)
+	if err != nil {
+		return nil, err
+	}
+	return []Reading{{"temp", float64(int16(w)>>4) * 0.0625, Celsius}}, nil
+}
+
+// DefaultShunt is the current sense resistor of INA219 evaluation boards.
+const DefaultShunt = 0.1
+
+// ina219 has the shunt voltage in 10µV and bus voltage in 4mV units; the
+// current and power are calculated rather than calibrated.
+func ina219(r *Regs, d *Device) ([]Reading, error) {
+	shunt, err := r.BigWord(1)
+	if err != nil {
+		return nil, err
+	}
+	bus, err := r.BigWord(2)
+	if err != nil {
+		return nil, err
+	}
+	ohms := d.Shunt
+	if ohms <= 0 {
+		ohms = DefaultShunt
+	}
+	v := float64(bus>>3) * 0.004
+	i := float64(int16(shunt)) * 10e-6 / ohms
+	return []Reading{
+		{"voltage", v, Volts},
+		{"current", i, Amps},
+		{"power", v * i, Watts},
+	}, nil
+}
+
+// PMBus commands of PSU telemetry
+const (
+	pmbusVoutMode  = 0x20
+	pmbusReadVin   = 0x88
+	pmbusReadIin   = 0x89
+	pmbusReadVout  = 0x8b
+	pmbusReadIout  = 0x8c
+	pmbusReadTemp1 = 0x8d
+	pmbusReadFan1  = 0x90
+	pmbusReadPout  = 0x96
+	pmbusReadPin   = 0x97
+)
+
+// psu reads the PMBus telemetry of a power supply. All but VOUT are
+// LINEAR11; VOUT is LINEAR16 with the exponent of VOUT_MODE.
+func psu(r *Regs, d *Device) ([]Reading, error) {
+	mode, err := r.Byte(pmbusVoutMode)
+	if err != nil {
+		return nil, err
+	}
+	vout := pmbus.VoutMode(mode)
+	if vout.Mode() != pmbus.ModeLinear {
+		return nil, fmt.Errorf("VOUT_MODE %s: unsupported", vout)
+	}
+	var rs []Reading
+	for _, x := range []struct {
+		name string
+		reg  uint8
+		unit string
+	}{
+		{"vin", pmbusReadVin, Volts},
+		{"iin", pmbusReadIin, Amps},
+		{"vout", pmbusReadVout, Volts},
+		{"iout", pmbusReadIout, Amps},
+		{"temp", pmbusReadTemp1, Celsius},
+		{"fan", pmbusReadFan1, RPM},
+		{"pout", pmbusReadPout, Watts},
+		{"pin", pmbusReadPin, Watts},
+	} {
+		w, err := r.Word(x.reg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", x.name, err)
+		}
+		v := pmbus.Linear11(w)
+		if x.reg == pmbusReadVout {
+			v = pmbus.Linear16(w, vout.Exponent())
+		}
+		rs = append(rs, Reading{x.name, v, x.unit})
+	}
+	return rs, nil
+}
+
+// max31790 has six 11-bit tachometer counts, left justified from register
+// 0x18, of the default speed range of 4 revolutions and 2 pulses per
+// revolution.
+func max31790(r *Regs, d *Device) ([]Reading, error) {
+	const (
+		tach    = 0x18
+		sr      = 4
+		np      = 2
+		stopped = 0x7ff
+	)
+	var rs []Reading
+	for i := 0; i < 6; i++ {
+		w, err := r.BigWord(uint8(tach + 2*i))
+		if err != nil {
+			return nil, err
+		}
+		rpm := 0.0
+		if count := w >> 5; count != 0 && count != stopped {
+			rpm = 60 * sr * 8192 / float64(np*count)
+		}
+		rs = append(rs, Reading{fmt.Sprint("fan", i+1), rpm, RPM})
+	}
+	return rs, nil
+}
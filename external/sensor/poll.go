@@ -0,0 +1,114 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package sensor
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/platinasystems/goes/external/i2c"
+)
+
+// Poller reads the described devices and checks their thresholds.
+type Poller struct {
+	Devices    []Device
+	Thresholds []Threshold
+	// Open, if set, replaces that of /dev/i2c-N, e.g. with an i2c.Mock.
+	Open func(bus int) (i2c.Device, error)
+
+	levels map[string]Level
+	last   map[string]string
+}
+
+// Alarm is a change of a reading's level.
+type Alarm struct {
+	Reading
+	Level Level
+	Last  Level
+}
+
+func (a Alarm) String() string {
+	return fmt.Sprintf("%s %s: %s %s", a.Name, a.Level,
+		strconv.FormatFloat(a.Value, 'f', -1, 64), a.Unit)
+}
+
+// Poll the devices and call print with each changed "KEY: VALUE" of
+// these forms.
+//
+//	NAME.READING.units.UNIT: VALUE
+//	NAME.READING.alarm: ok | warning | critical
+//	NAME.status: ok | ERROR
+//
+// Poll returns the alarms that changed level.
+func (p *Poller) Poll(print func(string)) []Alarm {
+	if p.levels == nil {
+		p.levels = make(map[string]Level)
+		p.last = make(map[string]string)
+	}
+	open := p.Open
+	if open == nil {
+		open = Open
+	}
+	set := func(k, v string) {
+		if p.last[k] != v {
+			p.last[k] = v
+			print(k + ": " + v)
+		}
+	}
+	var alarms []Alarm
+	buses := make(map[int]i2c.Device)
+	defer func() {
+		for _, bus := range buses {
+			bus.Close()
+		}
+	}()
+	for i := range p.Devices {
+		d := &p.Devices[i]
+		bus, found := buses[d.Path.Bus]
+		if !found {
+			var err error
+			if bus, err = open(d.Path.Bus); err != nil {
+				set(d.Name+".status", err.Error())
+				continue
+			}
+			buses[d.Path.Bus] = bus
+		}
+		rs, err := d.Read(bus)
+		if err != nil {
+			set(d.Name+".status", err.Error())
+			continue
+		}
+		set(d.Name+".status", "ok")
+		for _, r := range rs {
+			set(r.Name+".units."+r.Unit,
+				strconv.FormatFloat(r.Value, 'f', 3, 64))
+			k := r.Name + ".alarm"
+			last, l, checked := p.levels[k], OK, false
+			for j := range p.Thresholds {
+				t := &p.Thresholds[j]
+				if t.Reading != r.Name {
+					continue
+				}
+				checked = true
+				// each threshold holds its own hysteresis
+				tk := fmt.Sprint(k, ".", j)
+				tl := t.Check(p.levels[tk], r.Value)
+				p.levels[tk] = tl
+				if tl > l {
+					l = tl
+				}
+			}
+			if !checked {
+				continue
+			}
+			p.levels[k] = l
+			set(k, l.String())
+			if l != last {
+				alarms = append(alarms, Alarm{r, l, last})
+			}
+		}
+	}
+	return alarms
+}
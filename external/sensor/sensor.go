@@ -0,0 +1,96 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package sensor polls the i2c devices of a machine description, converts
+// their registers to engineering units and checks thresholds.
+package sensor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/platinasystems/goes/external/i2c"
+)
+
+// Device is the type and path of an i2c sensor.
+type Device struct {
+	Name string
+	Type string // a key of Drivers
+	Path i2c.Path
+	// Shunt resistance of current monitors, ohms
+	Shunt float64
+}
+
+// Reading is a converted sensor value, e.g. psu0.vout of 12.02 V.
+type Reading struct {
+	Name  string
+	Value float64
+	Unit  string
+}
+
+func (d *Device) String() string {
+	return fmt.Sprint(d.Name, " ", d.Type, " ", d.Path)
+}
+
+// Open returns /dev/i2c-N; the poller's Open may be replaced with one that
+// returns a Mock.
+func Open(bus int) (i2c.Device, error) {
+	b := new(i2c.Bus)
+	if err := b.Open(bus); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Read the device with the given bus, selecting its mux channels as
+// i2c.Path.Do.
+func (d *Device) Read(bus i2c.Device) ([]Reading, error) {
+	drv, found := Drivers[d.Type]
+	if !found {
+		return nil, fmt.Errorf("%s: %s: unknown type", d.Name, d.Type)
+	}
+	var rs []Reading
+	err := d.Path.Do(bus, func(dev i2c.Device) (err error) {
+		rs, err = drv(&Regs{dev}, d)
+		return
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", d.Name, err)
+	}
+	for i := range rs {
+		rs[i].Name = d.Name + "." + rs[i].Name
+	}
+	return rs, nil
+}
+
+// Regs reads the registers of the selected device.
+type Regs struct {
+	bus i2c.Device
+}
+
+func (r *Regs) Byte(reg uint8) (uint8, error) {
+	var data i2c.SMBusData
+	err := r.bus.Do(i2c.Read, reg, i2c.ByteData, &data)
+	return data[0], err
+}
+
+// Word returns a little endian SMBus word, e.g. of PMBus devices.
+func (r *Regs) Word(reg uint8) (uint16, error) {
+	var data i2c.SMBusData
+	err := r.bus.Do(i2c.Read, reg, i2c.WordData, &data)
+	return uint16(data[1])<<8 | uint16(data[0]), err
+}
+
+// BigWord returns a big endian word, as of LM75 and INA219 registers.
+func (r *Regs) BigWord(reg uint8) (uint16, error) {
+	w, err := r.Word(reg)
+	return w<<8 | w>>8, err
+}
+
+// Sort readings by name.
+func Sort(rs []Reading) {
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Name < rs[j].Name
+	})
+}
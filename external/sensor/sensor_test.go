@@ -0,0 +1,197 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package sensor
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/platinasystems/goes/external/i2c"
+)
+
+const testConfig = `
+interval 1s
+device cpu lm75 0/0x48
+device board tmp102 0/0x70:3/0x49	# behind mux channel 3
+device psu0 pmbus 1/0x58
+device p12v ina219 1/0x40 shunt 0.01
+device fans max31790 1/0x20
+high cpu.temp 70 80 5
+low psu0.vout 11.5 - 0.1
+high psu0.vout 12.5 13
+`
+
+// behind is a slave that only responds when its mux channel is selected.
+type behind struct {
+	mux  i2c.Registers
+	mask uint16
+	i2c.MockSlave
+}
+
+func (b *behind) Do(rw i2c.RW, command uint8, size i2c.SMBusSize,
+	data *i2c.SMBusData) error {
+	if b.mux[0] != b.mask {
+		return syscall.ENXIO
+	}
+	return b.MockSlave.Do(rw, command, size, data)
+}
+
+// be is the SMBus word of a big endian register.
+func be(w uint16) uint16 { return w<<8 | w>>8 }
+
+func testBuses() map[int]*i2c.Mock {
+	mux := i2c.Registers{}
+	return map[int]*i2c.Mock{
+		0: {Slaves: map[int]i2c.MockSlave{
+			0x48: i2c.Registers{0: be(0x3200)}, // 50°C
+			0x70: mux,
+			0x49: &behind{mux, 1 << 3,
+				i2c.Registers{0: be(0x1910)}}, // 25.0625°C
+		}},
+		1: {Slaves: map[int]i2c.MockSlave{
+			0x58: i2c.Registers{
+				pmbusVoutMode:  0x17,   // 2^-9
+				pmbusReadVin:   0xf8e6, // 230 * 2^-1 = 115
+				pmbusReadIin:   0xd280, // 640 * 2^-6 = 10
+				pmbusReadVout:  0x1800, // 6144 * 2^-9 = 12
+				pmbusReadIout:  0x0014, // 20
+				pmbusReadTemp1: 0x0028, // 40
+				pmbusReadFan1:  0x1bb8, // 952 * 2^3 = 7616
+				pmbusReadPout:  0x00f0, // 240
+				pmbusReadPin:   0x0104, // 260
+			},
+			0x40: i2c.Registers{
+				1: be(1000),      // 10mV / 0.01Ω = 1A
+				2: be(3000 << 3), // 12V
+			},
+			0x20: i2c.Registers{
+				0x18: be(1024 << 5), // 60*4*8192/(2*1024) = 960
+				0x1a: be(0x7ff << 5),
+			},
+		}},
+	}
+}
+
+func TestConfig(t *testing.T) {
+	cfg, err := ReadConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Devices) != 5 || len(cfg.Thresholds) != 3 {
+		t.Fatalf("%+v", cfg)
+	}
+	board := cfg.Devices[1]
+	if !reflect.DeepEqual(board.Path.Mux, []i2c.Hop{{Addr: 0x70, Channel: 3}}) ||
+		board.Path.Addr != 0x49 || board.Path.String() != "0/0x70:3/0x49" {
+		t.Errorf("board: %+v", board)
+	}
+	if cfg.Devices[3].Shunt != 0.01 {
+		t.Error("shunt:", cfg.Devices[3].Shunt)
+	}
+	if th := cfg.Thresholds[1]; !math.IsNaN(th.Crit) || th.High {
+		t.Errorf("low: %+v", th)
+	}
+	for _, bad := range []string{
+		"device x lm99 0/0x48",
+		"device x lm75 0",
+		"device x lm75 0/0x70:9/0x48",
+		"device x lm75 0/0x48\ndevice x lm75 0/0x49",
+		"high y.temp 1 2",
+		"interval -1s",
+	} {
+		if _, err := ReadConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	cfg, err := ReadConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buses := testBuses()
+	p := &Poller{
+		Devices:    cfg.Devices,
+		Thresholds: cfg.Thresholds,
+		Open: func(bus int) (i2c.Device, error) {
+			if m, found := buses[bus]; found {
+				return m, nil
+			}
+			return nil, syscall.ENOENT
+		},
+	}
+	got := make(map[string]string)
+	print := func(s string) {
+		kv := strings.SplitN(s, ": ", 2)
+		got[kv[0]] = kv[1]
+	}
+	p.Poll(print)
+	for k, v := range map[string]string{
+		"cpu.status":           "ok",
+		"cpu.temp.units.C":     "50.000",
+		"cpu.temp.alarm":       "ok",
+		"board.temp.units.C":   "25.062",
+		"psu0.vin.units.V":     "115.000",
+		"psu0.iin.units.A":     "10.000",
+		"psu0.vout.units.V":    "12.000",
+		"psu0.vout.alarm":      "ok",
+		"psu0.fan.units.RPM":   "7616.000",
+		"psu0.pin.units.W":     "260.000",
+		"p12v.voltage.units.V": "12.000",
+		"p12v.current.units.A": "1.000",
+		"p12v.power.units.W":   "12.000",
+		"fans.fan1.units.RPM":  "960.000",
+		"fans.fan2.units.RPM":  "0.000",
+	} {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+	if mux := buses[0].Slaves[0x70].(i2c.Registers); mux[0] != 0 {
+		t.Error("mux left selected:", mux[0])
+	}
+
+	cpu := buses[0].Slaves[0x48].(i2c.Registers)
+	for _, x := range []struct {
+		temp  uint16
+		level Level
+	}{
+		{71, Warning},
+		{67, Warning}, // within hysteresis
+		{85, Critical},
+		{76, Critical},
+		{74, Warning},
+		{64, OK},
+	} {
+		cpu[0] = be(x.temp << 8)
+		got = make(map[string]string)
+		alarms := p.Poll(print)
+		if got["cpu.temp.alarm"] != "" &&
+			got["cpu.temp.alarm"] != x.level.String() {
+			t.Errorf("%d: got %s, want %s", x.temp,
+				got["cpu.temp.alarm"], x.level)
+		}
+		if p.levels["cpu.temp.alarm"] != x.level {
+			t.Errorf("%d: level %s, want %s", x.temp,
+				p.levels["cpu.temp.alarm"], x.level)
+		}
+		for _, a := range alarms {
+			if a.Name == "cpu.temp" && a.Level != x.level {
+				t.Errorf("%d: alarm %s", x.temp, a)
+			}
+		}
+	}
+
+	delete(buses[1].Slaves, 0x58)
+	got = make(map[string]string)
+	p.Poll(print)
+	if !strings.Contains(got["psu0.status"], "read") {
+		t.Error("psu0.status:", got["psu0.status"])
+	}
+}
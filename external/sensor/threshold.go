@@ -0,0 +1,65 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package sensor
+
+import "math"
+
+// Level of an alarm.
+type Level int
+
+const (
+	OK Level = iota
+	Warning
+	Critical
+)
+
+func (l Level) String() string {
+	switch l {
+	case OK:
+		return "ok"
+	case Warning:
+		return "warning"
+	case Critical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// Threshold of a reading, e.g. "cpu.temp". If High, alarms are raised at
+// or above Warn and Crit; otherwise at or below. An alarm is cleared once
+// the reading is Hysteresis past its threshold. NaN disables a threshold.
+type Threshold struct {
+	Reading    string
+	High       bool
+	Warn       float64
+	Crit       float64
+	Hysteresis float64
+}
+
+// Check returns the level of the value given that of the last.
+func (t *Threshold) Check(last Level, v float64) Level {
+	past := func(limit, h float64) bool {
+		if math.IsNaN(limit) {
+			return false
+		}
+		if t.High {
+			return v >= limit-h
+		}
+		return v <= limit+h
+	}
+	held := func(l Level) float64 {
+		if last >= l {
+			return t.Hysteresis
+		}
+		return 0
+	}
+	switch {
+	case past(t.Crit, held(Critical)):
+		return Critical
+	case past(t.Warn, held(Warning)):
+		return Warning
+	}
+	return OK
+}
@@ -20,15 +20,15 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 	"unicode/utf8"
 
 	"github.com/platinasystems/goes/cmd"
 	"github.com/platinasystems/goes/external/flags"
-	"github.com/platinasystems/goes/external/parms"
+	"github.com/platinasystems/goes/internal/audit"
 	"github.com/platinasystems/goes/internal/prog"
 	"github.com/platinasystems/goes/internal/shellutils"
 	"github.com/platinasystems/goes/lang"
-	"github.com/platinasystems/url"
 )
 
 const (
@@ -63,6 +63,12 @@ type Goes struct {
 	Status    error
 	Verbosity int
 
+	// NoExec builds command lists without running them and records
+	// problems that would otherwise be found at run time; Trace prints
+	// each expanded command with its source location before running it.
+	NoExec, Trace bool
+	Problems      []error
+
 	cache  cache
 	parent *Goes
 
@@ -71,6 +77,11 @@ type Goes struct {
 	FunctionMap map[string]Function
 
 	inTest bool
+
+	// stdin, stdout and stderr are the redirected descriptors of an
+	// in-process command.
+	stdin          io.Reader
+	stdout, stderr io.Writer
 }
 
 type Function struct {
@@ -187,6 +198,10 @@ func (g *Goes) isRedirected(stdin io.Reader, stdout io.Writer, stderr io.Writer)
 }
 
 func (g *Goes) ProcessCommand(cl shellutils.Cmdline, closers *[]io.Closer) (func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error, error) {
+	loc := g.Location()
+	if g.NoExec {
+		g.check(cl, loc)
+	}
 	runfun := func(stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
 		envMap, args := cl.Slice(func(k string) string {
 			v, def := g.EnvMap[k]
@@ -195,6 +210,29 @@ func (g *Goes) ProcessCommand(cl shellutils.Cmdline, closers *[]io.Closer) (func
 			}
 			return os.Getenv(k)
 		})
+		if g.Trace {
+			g.trace(stderr, loc, envMap, args)
+		}
+		rds, args, err := parseRedirections(args)
+		if err != nil {
+			return err
+		}
+		std := newStdio(stdin, stdout, stderr)
+		if err = g.redirect(std, rds, closers); err != nil {
+			return err
+		}
+		in, err := std.stdin()
+		if err != nil {
+			return err
+		}
+		out, err := std.stdout()
+		if err != nil {
+			return err
+		}
+		errout, err := std.stderr()
+		if err != nil {
+			return err
+		}
 		// Add to our context environment if this command only set variables
 		if len(args) == 0 {
 			if len(envMap) != 0 {
@@ -213,7 +251,7 @@ func (g *Goes) ProcessCommand(cl shellutils.Cmdline, closers *[]io.Closer) (func
 		// check for function invocation
 
 		if f, x := g.FunctionMap[name]; x {
-			return f.RunFun(stdin, stdout, stderr)
+			return f.RunFun(in, out, errout)
 		}
 		// check for built in command
 		if v := g.ByName[name]; v != nil {
@@ -233,92 +271,20 @@ func (g *Goes) ProcessCommand(cl shellutils.Cmdline, closers *[]io.Closer) (func
 				if method, found := v.(goeser); found {
 					method.Goes(g)
 				}
-				return g.Main(args...)
+				return g.inProcess(std, func() error {
+					return g.Main(args...)
+				})
 			}
 		} else if builtin, found := g.Builtins()[name]; found {
-			return builtin(args[1:]...)
+			return g.inProcess(std, func() error {
+				return builtin(args[1:]...)
+			})
 		} else {
 			return fmt.Errorf("%s: command not found", name)
 		}
-		in := stdin
-		if !g.isStdinRedirected(stdin) {
-			var iparm *parms.Parms
-			iparm, args = parms.New(args, "<", "<<", "<<-")
-			if fn := iparm.ByName["<"]; len(fn) > 0 {
-				rc, err := url.Open(fn)
-				if err != nil {
-					return err
-				}
-				in = rc
-				*closers = append(*closers, rc)
-			} else if len(iparm.ByName["<<"]) > 0 ||
-				len(iparm.ByName["<<-"]) > 0 {
-				var trim bool
-				lbl := iparm.ByName["<<"]
-				if len(lbl) == 0 {
-					lbl = iparm.ByName["<<-"]
-					trim = true
-				}
-				r, w, err := os.Pipe()
-				if err != nil {
-					return err
-				}
-				in = r
-				*closers = append(*closers, r)
-				WG.Add(1)
-				go func(w io.WriteCloser, lbl string) {
-					defer WG.Done()
-					defer w.Close()
-					prompt := "<<" + fn + " "
-					for {
-						g.Catline.Write([]byte(prompt))
-						buf := make([]byte, 1024)
-						n, err := g.Catline.Read(buf)
-						s := string(buf[0:n])
-						if err != nil || s == lbl {
-							break
-						}
-						if trim {
-							s = strings.TrimLeft(s, " \t")
-						}
-						fmt.Fprintln(w, s)
-					}
-				}(w, lbl)
-			}
-		}
-		out := stdout
-		if !g.isStdoutRedirected(stdout) {
-			var oparm *parms.Parms
-			oparm, args = parms.New(args, ">", ">>", ">>>", ">>>>")
-			if fn := oparm.ByName[">"]; len(fn) > 0 {
-				wc, err := url.Create(fn)
-				if err != nil {
-					return err
-				}
-				out = wc
-				*closers = append(*closers, wc)
-			} else if fn = oparm.ByName[">>"]; len(fn) > 0 {
-				wc, err := url.Append(fn)
-				if err != nil {
-					return err
-				}
-				out = wc
-				*closers = append(*closers, wc)
-			} else if fn := oparm.ByName[">>>"]; len(fn) > 0 {
-				wc, err := url.Create(fn)
-				if err != nil {
-					return err
-				}
-				out = io.MultiWriter(os.Stdout, wc)
-				*closers = append(*closers, wc)
-			} else if fn := oparm.ByName[">>"]; len(fn) > 0 {
-				wc, err := url.Append(fn)
-				if err != nil {
-					return err
-				}
-				out = io.MultiWriter(os.Stdout, wc)
-				*closers = append(*closers, wc)
-			}
+		extra, err := std.extraFiles()
+		if err != nil {
+			return err
 		}
 		var envStr []string
 		if len(envMap) != 0 {
@@ -339,7 +305,8 @@ func (g *Goes) ProcessCommand(cl shellutils.Cmdline, closers *[]io.Closer) (func
 		}
 		x.Stdin = in
 		x.Stdout = out
-		x.Stderr = stderr
+		x.Stderr = errout
+		x.ExtraFiles = extra
 
 		if err := x.Start(); err != nil {
 			err = fmt.Errorf("child: %v: %v", x.Args, err)
@@ -453,7 +420,7 @@ func (g *Goes) Fork(args ...string) *exec.Cmd {
 //
 // If the command is a daemon, this fork exec's itself twice to disassociate
 // the daemon from the tty and initiating process.
-func (g *Goes) Main(args ...string) error {
+func (g *Goes) Main(args ...string) (err error) {
 	Stop = make(chan struct{})
 	if strings.HasSuffix(os.Args[0], ".test") {
 		g.inTest = true
@@ -481,6 +448,15 @@ func (g *Goes) Main(args ...string) error {
 			args = args[1:]
 		}
 	}
+	if len(os.Getenv(audit.ExecEnv)) > 0 {
+		// a remotely executed command, e.g. ssh HOST COMMAND
+		os.Unsetenv(audit.ExecEnv)
+		// sshd records the session just after starting this
+		audit.WaitSession(time.Second)
+		start := time.Now()
+		cmdline := strings.Join(args, " ")
+		defer func() { audit.Log(cmdline, start, err) }()
+	}
 
 	var v cmd.Cmd
 	var k cmd.Kind
@@ -496,7 +472,8 @@ func (g *Goes) Main(args ...string) error {
 		if clifound {
 			cli.(goeser).Goes(g)
 		}
-		cliFlags, cliArgs := flags.New(args, "-debug", "-f", "-no-liner", "-x")
+		cliFlags, cliArgs := flags.New(args, "-debug", "-f", "-n", "-no-liner",
+			"-x")
 		if cliFlags.ByName["-debug"] && g.Verbosity < VerboseDebug {
 			g.Verbosity = VerboseDebug
 		}
@@ -521,13 +498,14 @@ func (g *Goes) Main(args ...string) error {
 			// only check for script if args[0] isn't a command
 			buf, err := ioutil.ReadFile(cliArgs[0])
 			if cliArgs[0] == "-" || (err == nil && utf8.Valid(buf) &&
-				bytes.HasPrefix(buf, []byte("#!/usr/bin/goes"))) {
+				(cliFlags.ByName["-n"] ||
+					bytes.HasPrefix(buf, []byte("#!/usr/bin/goes")))) {
 				// e.g. /usr/bin/goes SCRIPT
 				if cli == nil {
 					g.Status = fmt.Errorf("has no cli")
 					return g.Status
 				}
-				for _, t := range []string{"-f", "-x"} {
+				for _, t := range []string{"-f", "-n", "-x"} {
 					if cliFlags.ByName[t] {
 						cliArgs = append(cliArgs, t)
 					}
@@ -602,7 +580,7 @@ func (g *Goes) Main(args ...string) error {
 		return err
 	}
 
-	err := v.Main(args[1:]...)
+	err = v.Main(args[1:]...)
 	if err != nil && !k.IsDaemon() {
 		name := args[0]
 		if len(name) == 0 {
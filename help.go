@@ -27,7 +27,7 @@ func (g *Goes) Help(args ...string) string {
 func (g *Goes) help(args ...string) error {
 	h := g.Help(args...)
 	if len(h) > 0 {
-		fmt.Println(h)
+		fmt.Fprintln(g.Stdout(), h)
 	}
 	return nil
 }
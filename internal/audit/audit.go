@@ -0,0 +1,243 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package audit records interactive commands with their session's user,
+// source address, time, exit status and duration.
+//
+// Auditing is enabled by the presence of the configuration file,
+// /etc/goes/audit, which may be empty or have these KEY=VALUE lines.
+//
+//	file=/var/log/goes/audit.log
+//	maxsize=1048576
+//	redis=false
+//	syslog=false
+//
+// With redis=true, each JSON encoded record is also published to the "audit"
+// redis channel. With syslog=true, records are also logged to the auth
+// facility.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/platinasystems/goes/external/log"
+	"github.com/platinasystems/goes/external/redis"
+)
+
+// ExecEnv is set by sshd for a remotely executed command rather than an
+// interactive cli. It only asks for the command to be audited; the
+// session's identity is that recorded in SessionDir.
+const ExecEnv = "GOES_SESSION_EXEC"
+
+const (
+	ConfigFile     = "/etc/goes/audit"
+	DefaultFile    = "/var/log/goes/audit.log"
+	DefaultMaxSize = 1 << 20
+	Channel        = "audit"
+)
+
+type Config struct {
+	File    string
+	MaxSize int64
+	Redis   bool
+	Syslog  bool
+}
+
+// Record is an audited command.
+type Record struct {
+	Time     time.Time     `json:"time"`
+	User     string        `json:"user"`
+	Session  string        `json:"session"`
+	Addr     string        `json:"addr,omitempty"`
+	Tty      string        `json:"tty,omitempty"`
+	Pid      int           `json:"pid"`
+	Command  string        `json:"command"`
+	Exit     int           `json:"exit"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+var cache struct {
+	once   sync.Once
+	config *Config
+	mutex  sync.Mutex
+}
+
+// LoadConfig returns nil if auditing isn't enabled.
+func LoadConfig(fn string) (*Config, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	config := &Config{
+		File:    DefaultFile,
+		MaxSize: DefaultMaxSize,
+	}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if len(s) == 0 || s[0] == '#' {
+			continue
+		}
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("%s:%d: %q: missing '='",
+				fn, line, s)
+		}
+		k, v := strings.TrimSpace(s[:eq]), strings.TrimSpace(s[eq+1:])
+		switch k {
+		case "file":
+			config.File = v
+		case "maxsize":
+			config.MaxSize, err = strconv.ParseInt(v, 0, 64)
+		case "redis":
+			config.Redis, err = strconv.ParseBool(v)
+		case "syslog":
+			config.Syslog, err = strconv.ParseBool(v)
+		default:
+			err = fmt.Errorf("unknown")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %v", fn, line, k, err)
+		}
+	}
+	return config, scanner.Err()
+}
+
+// Enabled returns the cached configuration or nil if auditing is disabled.
+func Enabled() *Config {
+	cache.once.Do(func() {
+		config, err := LoadConfig(ConfigFile)
+		if err != nil {
+			log.Print("auth", "err", err)
+		}
+		cache.config = config
+	})
+	return cache.config
+}
+
+// New returns a record of the command run by the current session.
+func New(command string, start time.Time, err error) *Record {
+	r := &Record{
+		Time:     start,
+		Session:  "console",
+		Pid:      os.Getpid(),
+		Command:  command,
+		Duration: time.Since(start),
+	}
+	if sess := CurrentSession(); sess != nil {
+		r.Session, r.User, r.Addr = sess.Name, sess.User, sess.Addr
+	}
+	if len(r.User) == 0 {
+		// the real, not effective or environment's, user
+		uid := strconv.Itoa(os.Getuid())
+		r.User = uid
+		if u, err := user.LookupId(uid); err == nil {
+			r.User = u.Username
+		}
+	}
+	if tty, err := os.Readlink("/proc/self/fd/0"); err == nil &&
+		strings.HasPrefix(tty, "/dev/") {
+		r.Tty = tty
+	}
+	if err != nil {
+		r.Exit = 1
+		if xerr, ok := err.(*exec.ExitError); ok {
+			r.Exit = xerr.ExitCode()
+		}
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// Log records the command if auditing is enabled.
+func Log(command string, start time.Time, err error) {
+	config := Enabled()
+	if config == nil {
+		return
+	}
+	if err := New(command, start, err).Write(config); err != nil {
+		log.Print("auth", "err", "audit: ", err)
+	}
+}
+
+// Write the record to the configured file, syslog and redis channel.
+func (r *Record) Write(config *Config) error {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if config.Syslog {
+		log.Print("auth", "info", r)
+	}
+	if config.Redis {
+		if conn, err := redis.Connect(); err == nil {
+			conn.Do("PUBLISH", Channel, string(buf))
+			conn.Close()
+		}
+	}
+	if len(config.File) == 0 {
+		return nil
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if err = os.MkdirAll(filepath.Dir(config.File), 0700); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(config.File); err == nil &&
+		config.MaxSize > 0 && fi.Size() >= config.MaxSize {
+		os.Rename(config.File, config.File+".1")
+	}
+	f, err := os.OpenFile(config.File,
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(buf, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (r *Record) String() string {
+	s := fmt.Sprint(r.User, "@", r.Session)
+	if len(r.Addr) > 0 {
+		s += fmt.Sprint("(", r.Addr, ")")
+	}
+	return fmt.Sprintf("%s exit=%d duration=%s: %s", s, r.Exit,
+		r.Duration.Round(time.Millisecond),
+		strings.Replace(r.Command, "\n", "; ", -1))
+}
+
+// Read calls f with each record of r until f returns false.
+func Read(r io.Reader, f func(*Record) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		rec := new(Record)
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			continue
+		}
+		if !f(rec) {
+			break
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,147 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package audit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "audit")
+	if config, err := LoadConfig(fn); config != nil || err != nil {
+		t.Fatal("missing config:", config, err)
+	}
+	ioutil.WriteFile(fn, []byte("# comment\nfile=/tmp/x\nredis=true\n"),
+		0644)
+	config, err := LoadConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.File != "/tmp/x" || !config.Redis || config.Syslog ||
+		config.MaxSize != DefaultMaxSize {
+		t.Error("unexpected", *config)
+	}
+	ioutil.WriteFile(fn, []byte("bogus=1\n"), 0644)
+	if _, err = LoadConfig(fn); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := &Config{
+		File:    filepath.Join(dir, "log", "audit.log"),
+		MaxSize: 100,
+	}
+	testSessionDir(t, dir)
+	sid, err := getsid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = StartSession(sid, &Session{
+		Name: "ssh",
+		User: "root",
+		Addr: "10.0.0.1:2222",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer EndSession(sid)
+	start := time.Now()
+	for _, err := range []error{nil, errors.New("failed")} {
+		if err := New("echo hello", start, err).Write(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the second record should have rotated the first
+	for _, x := range []struct {
+		fn   string
+		exit int
+	}{
+		{config.File + ".1", 0},
+		{config.File, 1},
+	} {
+		f, err := os.Open(x.fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		Read(f, func(r *Record) bool {
+			n++
+			if r.User != "root" || r.Session != "ssh" ||
+				r.Addr != "10.0.0.1:2222" ||
+				r.Command != "echo hello" || r.Exit != x.exit {
+				t.Error(x.fn, "unexpected", r)
+			}
+			return true
+		})
+		f.Close()
+		if n != 1 {
+			t.Error(x.fn, "has", n, "records")
+		}
+	}
+}
+
+// testSessionDir trusts the test's own session records.
+func testSessionDir(t *testing.T, dir string) {
+	sessionDir = filepath.Join(dir, "sessions")
+	trustedUid = uint32(os.Getuid())
+	t.Cleanup(func() {
+		sessionDir = SessionDir
+		trustedUid = 0
+	})
+}
+
+func TestSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testSessionDir(t, dir)
+	sid, err := getsid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the environment isn't trusted
+	os.Setenv("GOES_SESSION_USER", "someone")
+	defer os.Unsetenv("GOES_SESSION_USER")
+	r := New("true", time.Now(), nil)
+	if r.Session != "console" || r.User == "someone" {
+		t.Error("unexpected", r)
+	}
+	if err = StartSession(sid, &Session{Name: "telnet"}); err != nil {
+		t.Fatal(err)
+	}
+	if r = New("true", time.Now(), nil); r.Session != "telnet" ||
+		len(r.User) == 0 {
+		t.Error("unexpected", r)
+	}
+	// nor are records writable by others
+	fn := filepath.Join(sessionDir, strconv.Itoa(sid))
+	os.Chmod(fn, 0666)
+	if s := CurrentSession(); s != nil {
+		t.Error("trusted", fn)
+	}
+	EndSession(sid)
+	if s := WaitSession(20 * time.Millisecond); s != nil {
+		t.Error("ended", s)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SessionDir has the Session of each remote login, by the process id of
+// its leader, as written by sshd and telnetd. Unlike the environment, a
+// user can't forge these since the directory and its files must belong
+// to root and be writable by none else.
+const SessionDir = "/run/goes/sessions"
+
+var (
+	sessionDir = SessionDir
+	// trustedUid owns the session records; root but for tests.
+	trustedUid = uint32(0)
+)
+
+// Session is the authenticated identity of a remote login.
+type Session struct {
+	Name string `json:"name"` // ssh or telnet
+	User string `json:"user,omitempty"`
+	Addr string `json:"addr,omitempty"`
+}
+
+// StartSession records the session of the leader, a child started with
+// Setsid. Call EndSession after it exits.
+func StartSession(leader int, s *Session) error {
+	if err := os.MkdirAll(sessionDir, 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	fn := filepath.Join(sessionDir, strconv.Itoa(leader))
+	tmp := fn + ".new"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+func EndSession(leader int) {
+	os.Remove(filepath.Join(sessionDir, strconv.Itoa(leader)))
+}
+
+// CurrentSession returns the recorded session of the calling process or
+// nil if it isn't that of a remote login.
+func CurrentSession() *Session {
+	sid, err := getsid()
+	if err != nil {
+		return nil
+	}
+	if !trusted(sessionDir) {
+		return nil
+	}
+	fn := filepath.Join(sessionDir, strconv.Itoa(sid))
+	if !trusted(fn) {
+		return nil
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil
+	}
+	s := new(Session)
+	if json.Unmarshal(b, s) != nil {
+		return nil
+	}
+	return s
+}
+
+// WaitSession returns the current session once its leader's daemon has
+// recorded it, or nil after the timeout; e.g. for a remotely executed
+// command that may finish before then.
+func WaitSession(timeout time.Duration) *Session {
+	for deadline := time.Now().Add(timeout); ; {
+		if s := CurrentSession(); s != nil {
+			return s
+		}
+		if time.Now().After(deadline) {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func trusted(fn string) bool {
+	fi, err := os.Lstat(fn)
+	if err != nil {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && st.Uid == trustedUid && fi.Mode()&0022 == 0 &&
+		fi.Mode()&os.ModeSymlink == 0
+}
+
+// getsid returns the session id, field 6 of /proc/self/stat.
+func getsid() (int, error) {
+	b, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+	// the command, field 2, is parenthesized and may have spaces
+	s := string(b)
+	i := strings.LastIndexByte(s, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("/proc/self/stat: invalid")
+	}
+	fields := strings.Fields(s[i+1:])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("/proc/self/stat: invalid")
+	}
+	return strconv.Atoi(fields[3])
+}
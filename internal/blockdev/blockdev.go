@@ -0,0 +1,448 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package blockdev is an inventory of block devices from sysfs and their
+// partition tables and filesystems.
+package blockdev
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/platinasystems/goes/external/partitions"
+	"github.com/platinasystems/goes/internal/magic"
+)
+
+// These are variables for tests.
+var (
+	SysBlock       = "/sys/block"
+	ProcPartitions = "/proc/partitions"
+	MountInfo      = "/proc/self/mountinfo"
+	DevDir         = "/dev"
+)
+
+// Device is a disk, partition or virtual block device.
+type Device struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	MajMin string `json:"maj:min"`
+	// Type is disk, part, dm, md, loop, mtd or rom
+	Type      string `json:"type"`
+	Size      uint64 `json:"size"`
+	Removable bool   `json:"rm"`
+	ReadOnly  bool   `json:"ro"`
+	Model     string `json:"model,omitempty"`
+	Serial    string `json:"serial,omitempty"`
+	// PTType is "gpt" or "dos" for a partitioned disk and PTUUID is its
+	// GPT disk GUID or MBR signature.
+	PTType string `json:"pttype,omitempty"`
+	PTUUID string `json:"ptuuid,omitempty"`
+	FSType string `json:"fstype,omitempty"`
+	UUID   string `json:"uuid,omitempty"`
+	Label  string `json:"label,omitempty"`
+	// PartUUID, PartLabel and PartType are from the parent's table.
+	PartUUID   string    `json:"partuuid,omitempty"`
+	PartLabel  string    `json:"partlabel,omitempty"`
+	PartType   string    `json:"parttype,omitempty"`
+	MountPoint string    `json:"mountpoint,omitempty"`
+	Children   []*Device `json:"children,omitempty"`
+
+	number  int
+	holders []string
+	sys     string
+	gpt     *partitions.GPT
+	mbr     []byte
+}
+
+// Scan returns the tree of block devices listed in /proc/partitions. The
+// top level are disks or virtual devices without slaves; the children of
+// a disk are its partitions; and the children of each are its holders,
+// e.g. device mapper or md devices.
+func Scan() ([]*Device, error) {
+	names, err := procPartitions()
+	if err != nil {
+		return nil, err
+	}
+	mounts := mountPoints()
+	byName := make(map[string]*Device)
+	var all []*Device
+	for _, name := range names {
+		d := newDevice(name)
+		if d == nil {
+			continue
+		}
+		d.MountPoint = mounts[d.MajMin]
+		byName[name] = d
+		all = append(all, d)
+	}
+	for _, d := range all {
+		if d.Type != "part" {
+			d.probe(nil)
+		}
+	}
+	for _, d := range all {
+		if d.Type == "part" {
+			if p := byName[parentName(d.sys)]; p != nil {
+				d.probe(p)
+			}
+		}
+	}
+	held := make(map[string]bool)
+	var top []*Device
+	for _, d := range all {
+		if d.Type == "part" {
+			if p := byName[parentName(d.sys)]; p != nil {
+				p.Children = append(p.Children, d)
+			}
+		}
+		for _, h := range d.holders {
+			if hd := byName[h]; hd != nil {
+				d.Children = append(d.Children, hd)
+				held[h] = true
+			}
+		}
+	}
+	for _, d := range all {
+		if d.Type != "part" && !held[d.Name] {
+			top = append(top, d)
+		}
+	}
+	for _, d := range all {
+		sort.Slice(d.Children, func(i, j int) bool {
+			return less(d.Children[i], d.Children[j])
+		})
+	}
+	sort.Slice(top, func(i, j int) bool { return less(top[i], top[j]) })
+	return top, nil
+}
+
+// Walk calls f for each device of the tree, parents first, until it returns
+// false. A holder of several devices is visited once for each.
+func Walk(devs []*Device, f func(d *Device, depth int) bool) bool {
+	var walk func([]*Device, int) bool
+	walk = func(devs []*Device, depth int) bool {
+		for _, d := range devs {
+			if !f(d, depth) || !walk(d.Children, depth+1) {
+				return false
+			}
+		}
+		return true
+	}
+	return walk(devs, 0)
+}
+
+// Find returns the first device for which f is true.
+func Find(devs []*Device, f func(*Device) bool) *Device {
+	var found *Device
+	Walk(devs, func(d *Device, _ int) bool {
+		if f(d) {
+			found = d
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// Lookup returns the device with the given name, path, or NAME=VALUE tag
+// where NAME is UUID, LABEL, PARTUUID or PARTLABEL.
+func Lookup(devs []*Device, s string) *Device {
+	if eq := strings.Index(s, "="); eq > 0 {
+		tag, v := s[:eq], strings.Trim(s[eq+1:], `"`)
+		return Find(devs, func(d *Device) bool {
+			return d.Tag(tag) != "" && strings.EqualFold(d.Tag(tag), v)
+		})
+	}
+	return Find(devs, func(d *Device) bool {
+		return d.Name == s || d.Path == s
+	})
+}
+
+// Tag returns the named blkid style tag of the device.
+func (d *Device) Tag(name string) string {
+	switch strings.ToUpper(name) {
+	case "NAME":
+		return d.Name
+	case "DEVNAME", "PATH":
+		return d.Path
+	case "MAJ:MIN":
+		return d.MajMin
+	case "TYPE", "FSTYPE":
+		return d.FSType
+	case "UUID":
+		return d.UUID
+	case "LABEL":
+		return d.Label
+	case "PARTUUID":
+		return d.PartUUID
+	case "PARTLABEL":
+		return d.PartLabel
+	case "PARTTYPE":
+		return d.PartType
+	case "PTTYPE":
+		return d.PTType
+	case "PTUUID":
+		return d.PTUUID
+	case "MODEL":
+		return d.Model
+	case "SERIAL":
+		return d.Serial
+	case "MOUNTPOINT":
+		return d.MountPoint
+	case "SIZE":
+		return strconv.FormatUint(d.Size, 10)
+	case "RM":
+		return bit(d.Removable)
+	case "RO":
+		return bit(d.ReadOnly)
+	case "DEVTYPE":
+		return d.Type
+	}
+	return ""
+}
+
+func bit(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func less(a, b *Device) bool {
+	if len(a.Name) != len(b.Name) && a.number > 0 && b.number > 0 {
+		return a.number < b.number
+	}
+	return a.Name < b.Name
+}
+
+func procPartitions() ([]string, error) {
+	f, err := os.Open(ProcPartitions)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var names []string
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) < 4 || fields[0] == "major" {
+			continue
+		}
+		names = append(names, fields[3])
+	}
+	return names, scan.Err()
+}
+
+// mountPoints maps MAJ:MIN to the first mount point.
+func mountPoints() map[string]string {
+	m := make(map[string]string)
+	f, err := os.Open(MountInfo)
+	if err != nil {
+		return m
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		if _, found := m[fields[2]]; !found {
+			m[fields[2]] = unescape(fields[4])
+		}
+	}
+	return m
+}
+
+// unescape the octal escapes of mountinfo, e.g. \040 for space.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// sysPath returns the sysfs directory of a device listed in
+// /proc/partitions; partitions are subdirectories of their disk.
+func sysPath(name string) string {
+	dir := filepath.Join(SysBlock, name)
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+	disks, _ := ioutil.ReadDir(SysBlock)
+	for _, disk := range disks {
+		dir = filepath.Join(SysBlock, disk.Name(), name)
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+func parentName(sys string) string {
+	return filepath.Base(filepath.Dir(sys))
+}
+
+func readSys(dir, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func newDevice(name string) *Device {
+	sys := sysPath(name)
+	if len(sys) == 0 {
+		return nil
+	}
+	d := &Device{
+		Name:   name,
+		Path:   filepath.Join(DevDir, name),
+		MajMin: readSys(sys, "dev"),
+		sys:    sys,
+	}
+	if n, err := strconv.ParseUint(readSys(sys, "size"), 0, 64); err == nil {
+		d.Size = n * 512
+	}
+	d.ReadOnly = readSys(sys, "ro") == "1"
+	if n := readSys(sys, "partition"); len(n) > 0 {
+		d.Type = "part"
+		d.number, _ = strconv.Atoi(n)
+		d.Removable = readSys(filepath.Dir(sys), "removable") == "1"
+	} else {
+		d.Removable = readSys(sys, "removable") == "1"
+		switch {
+		case strings.HasPrefix(name, "dm-"):
+			d.Type = "dm"
+			if s := readSys(sys, "dm/name"); len(s) > 0 {
+				d.Path = filepath.Join(DevDir, "mapper", s)
+			}
+		case strings.HasPrefix(name, "md"):
+			d.Type = "md"
+		case strings.HasPrefix(name, "loop"):
+			d.Type = "loop"
+		case strings.HasPrefix(name, "mtdblock"):
+			d.Type = "mtd"
+		case strings.HasPrefix(name, "sr"):
+			d.Type = "rom"
+		default:
+			d.Type = "disk"
+		}
+		d.Model = readSys(sys, "device/model")
+		if len(d.Model) == 0 {
+			d.Model = readSys(sys, "device/name")
+		}
+		if v := readSys(sys, "device/vendor"); len(v) > 0 &&
+			!strings.HasPrefix(d.Model, v) {
+			d.Model = v + " " + d.Model
+		}
+		d.Serial = serial(sys)
+	}
+	if fis, err := ioutil.ReadDir(filepath.Join(sys, "holders")); err == nil {
+		for _, fi := range fis {
+			d.holders = append(d.holders, fi.Name())
+		}
+	}
+	return d
+}
+
+// serial returns the device serial number from sysfs or SCSI VPD page 0x80.
+func serial(sys string) string {
+	if s := readSys(sys, "device/serial"); len(s) > 0 {
+		return s
+	}
+	b, err := ioutil.ReadFile(filepath.Join(sys, "device/vpd_pg80"))
+	if err != nil || len(b) < 4 {
+		return ""
+	}
+	n := int(binary.BigEndian.Uint16(b[2:]))
+	if n > len(b)-4 {
+		n = len(b) - 4
+	}
+	return strings.TrimSpace(string(b[4 : 4+n]))
+}
+
+// probe reads the partition table or filesystem of the device and, for a
+// partition, its entry in the parent's table.
+func (d *Device) probe(parent *Device) {
+	f, err := os.Open(d.Path)
+	if err != nil && d.Type == "dm" {
+		f, err = os.Open(filepath.Join(DevDir, d.Name))
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	b := make([]byte, partitions.SniffLen)
+	if _, err = io.ReadFull(f, b); err != nil &&
+		err != io.ErrUnexpectedEOF {
+		return
+	}
+	switch magic.IdentifyPartitionMap(b) {
+	case "gpt":
+		d.PTType = "gpt"
+		if t, err := partitions.ParseGPT(f, int64(d.Size)); err == nil {
+			d.PTUUID = t.DiskGUID.String()
+			d.gpt = t
+		}
+	case "mbr":
+		d.PTType = "dos"
+		d.PTUUID = fmt.Sprintf("%08x",
+			binary.LittleEndian.Uint32(b[mbrSignatureOff:]))
+		d.mbr = b[:512]
+	default:
+		d.FSType = magic.IdentifyPartition(b)
+		if len(d.FSType) > 0 {
+			sb := partitions.NewSuperBlock(d.FSType, b)
+			if u, err := sb.UUID(); err == nil {
+				d.UUID = u.String()
+			}
+			d.Label = sb.Label()
+		}
+	}
+	if parent == nil {
+		return
+	}
+	switch {
+	case parent.gpt != nil:
+		for _, p := range parent.gpt.Partitions {
+			if p.Number == d.number {
+				d.PartUUID = p.UUID.String()
+				d.PartLabel = p.Name
+				d.PartType = p.Type.String()
+			}
+		}
+	case parent.mbr != nil:
+		d.PartUUID = fmt.Sprintf("%s-%02x", parent.PTUUID, d.number)
+		if d.number >= 1 && d.number <= 4 {
+			d.PartType = fmt.Sprintf("0x%x",
+				parent.mbr[mbrPartitionsOff+16*(d.number-1)+4])
+		}
+	}
+}
+
+const (
+	mbrSignatureOff  = 0x1b8
+	mbrPartitionsOff = 0x1be
+)
@@ -0,0 +1,121 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package blockdev
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const magicdata = "../magic"
+
+func TestScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blockdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	SysBlock = filepath.Join(dir, "sys/block")
+	ProcPartitions = filepath.Join(dir, "partitions")
+	MountInfo = filepath.Join(dir, "mountinfo")
+	DevDir = filepath.Join(dir, "dev")
+
+	write := func(fn, s string) {
+		fn = filepath.Join(dir, fn)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	image := func(dev, dat string) {
+		b, err := ioutil.ReadFile(filepath.Join(magicdata, dat))
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(filepath.Join("dev", dev), string(b))
+	}
+	for fn, s := range map[string]string{
+		"sys/block/sda/dev":               "8:0",
+		"sys/block/sda/size":              "4194304",
+		"sys/block/sda/removable":         "0",
+		"sys/block/sda/device/vendor":     "ATA",
+		"sys/block/sda/device/model":      "SSD 32GB",
+		"sys/block/sda/device/vpd_pg80":   "\x00\x80\x00\x08SN012345",
+		"sys/block/sda/sda1/dev":          "8:1",
+		"sys/block/sda/sda1/size":         "204800",
+		"sys/block/sda/sda1/partition":    "1",
+		"sys/block/sda/sda3/dev":          "8:3",
+		"sys/block/sda/sda3/size":         "3694592",
+		"sys/block/sda/sda3/partition":    "3",
+		"sys/block/sda/sda3/holders/dm-0": "",
+		"sys/block/dm-0/dev":              "253:0",
+		"sys/block/dm-0/size":             "3690496",
+		"sys/block/dm-0/dm/name":          "cryptroot",
+		"sys/block/loop0/dev":             "7:0",
+		"sys/block/loop0/size":            "0",
+		"partitions": `major minor  #blocks  name
+
+   8        0    2097152 sda
+   8        1     102400 sda1
+   8        3    1847296 sda3
+ 253        0    1845248 dm-0
+   7        0          0 loop0
+`,
+		"mountinfo": `22 1 253:0 / / rw,relatime - btrfs /dev/mapper/cryptroot rw
+23 22 8:1 / /boot/efi\040x rw,relatime - xfs /dev/sda1 rw
+`,
+	} {
+		write(fn, s)
+	}
+	image("sda", "gpt.dat")
+	image("sda1", "xfs-sb.dat")
+	image("sda3", "luks-sb.dat")
+	image("dm-0", "btrfs-sb.dat")
+
+	devs, err := Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 2 || devs[0].Name != "loop0" || devs[1].Name != "sda" {
+		t.Fatal("unexpected top", devs)
+	}
+	sda := devs[1]
+	if sda.Type != "disk" || sda.Size != 4194304*512 ||
+		sda.Model != "ATA SSD 32GB" || sda.Serial != "SN012345" ||
+		sda.PTType != "gpt" ||
+		sda.PTUUID != "9b2a7c3e-4d5f-4a6b-8c7d-0e1f2a3b4c5d" {
+		t.Errorf("unexpected disk %+v", sda)
+	}
+	if len(sda.Children) != 2 {
+		t.Fatal("unexpected partitions", sda.Children)
+	}
+	sda1, sda3 := sda.Children[0], sda.Children[1]
+	if sda1.FSType != "xfs" || sda1.Label != "root" ||
+		sda1.PartLabel != "EFI System" ||
+		sda1.PartUUID != "0b0e3f5d-1e7c-4b4e-8c9b-5a4b3c2d1e0f" ||
+		sda1.MountPoint != "/boot/efi x" {
+		t.Errorf("unexpected sda1 %+v", sda1)
+	}
+	if sda3.FSType != "crypto_LUKS" || sda3.PartLabel != "root" ||
+		len(sda3.Children) != 1 {
+		t.Fatalf("unexpected sda3 %+v", sda3)
+	}
+	dm := sda3.Children[0]
+	if dm.Type != "dm" || dm.FSType != "btrfs" || dm.MountPoint != "/" ||
+		dm.Path != filepath.Join(DevDir, "mapper/cryptroot") {
+		t.Errorf("unexpected dm-0 %+v", dm)
+	}
+	if d := Lookup(devs, "LABEL=pool"); d != dm {
+		t.Error("LABEL=pool", d)
+	}
+	if d := Lookup(devs, "PARTUUID=0B0E3F5D-1E7C-4B4E-8C9B-5A4B3C2D1E0F"); d != sda1 {
+		t.Error("PARTUUID", d)
+	}
+	if d := Lookup(devs, filepath.Join(DevDir, "sda3")); d != sda3 {
+		t.Error("path", d)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"debug/elf"
 	"fmt"
+	"io"
 )
 
 const (
@@ -47,6 +48,20 @@ func New(fn string) (string, error) {
 		return "", err
 	}
 	defer f.Close()
+	return fromElf(f, fn)
+}
+
+// Read returns the BuildId of a program image, e.g. one in memory with
+// bytes.NewReader.
+func Read(r io.ReaderAt) (string, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return "", err
+	}
+	return fromElf(f, "image")
+}
+
+func fromElf(f *elf.File, fn string) (string, error) {
 	section := f.Section(".note.go.buildid")
 	if section == nil {
 		return "", fmt.Errorf("%s: no note section", fn)
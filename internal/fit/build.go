@@ -0,0 +1,490 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fit
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Description of a FIT to Build.
+type Description struct {
+	Description   string
+	TimeStamp     time.Time
+	DefaultConfig string
+	Images        []*ImageDescription
+	Configs       []*ConfigDescription
+}
+
+type ImageDescription struct {
+	Name        string
+	Description string
+	Type        string
+	Arch        string
+	Os          string
+	Compression string
+	Load, Entry string // hex addresses, may be empty
+	Data        []byte
+	Hashes      []string // e.g. sha256, crc32
+	Sign        *SignDescription
+}
+
+type ConfigDescription struct {
+	Name        string
+	Description string
+	Kernel      string
+	Fdt         string
+	Ramdisk     string
+	Sign        *SignDescription
+}
+
+type SignDescription struct {
+	Key     string // key name; KEYDIR/NAME.key is the PEM private key
+	Hash    string // sha256 (default) or sha384
+	Padding string // pkcs-1.5 (default) or pss
+}
+
+// ReadDescription parses a FIT description like this.
+//
+//	description = goes machine image
+//	default = conf-1
+//
+//	image kernel
+//		type = kernel
+//		arch = arm
+//		os = linux
+//		load = 0x80008000
+//		entry = 0x80008000
+//		data = zImage
+//		hash = sha256 crc32
+//
+//	config conf-1
+//		kernel = kernel
+//		sign = dev-key sha256 pss
+//
+// Relative data file names are opened from dir.
+func ReadDescription(r io.Reader, dir string) (*Description, error) {
+	d := &Description{TimeStamp: time.Now()}
+	var (
+		image  *ImageDescription
+		config *ConfigDescription
+	)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		s := scanner.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: %s", line,
+				fmt.Sprintf(format, args...))
+		}
+		if fields := strings.Fields(s); !strings.Contains(s, "=") {
+			if len(fields) != 2 {
+				return nil, fail("%q: expected image or config NAME",
+					s)
+			}
+			switch fields[0] {
+			case "image":
+				image = &ImageDescription{
+					Name:        fields[1],
+					Description: fields[1],
+					Compression: "none",
+				}
+				config = nil
+				d.Images = append(d.Images, image)
+			case "config":
+				config = &ConfigDescription{
+					Name:        fields[1],
+					Description: fields[1],
+				}
+				image = nil
+				d.Configs = append(d.Configs, config)
+			default:
+				return nil, fail("%q: unknown section", fields[0])
+			}
+			continue
+		}
+		eq := strings.Index(s, "=")
+		k := strings.TrimSpace(s[:eq])
+		v := strings.TrimSpace(s[eq+1:])
+		var err error
+		switch {
+		case image != nil:
+			switch k {
+			case "description":
+				image.Description = v
+			case "type":
+				image.Type = v
+			case "arch":
+				image.Arch = v
+			case "os":
+				image.Os = v
+			case "compression":
+				image.Compression = v
+			case "load":
+				image.Load = v
+			case "entry":
+				image.Entry = v
+			case "data":
+				if !filepath.IsAbs(v) {
+					v = filepath.Join(dir, v)
+				}
+				image.Data, err = ioutil.ReadFile(v)
+			case "hash":
+				image.Hashes = strings.Fields(v)
+			case "sign":
+				image.Sign, err = parseSign(v)
+			default:
+				err = fmt.Errorf("unknown image property")
+			}
+		case config != nil:
+			switch k {
+			case "description":
+				config.Description = v
+			case "kernel":
+				config.Kernel = v
+			case "fdt":
+				config.Fdt = v
+			case "ramdisk":
+				config.Ramdisk = v
+			case "sign":
+				config.Sign, err = parseSign(v)
+			default:
+				err = fmt.Errorf("unknown config property")
+			}
+		default:
+			switch k {
+			case "description":
+				d.Description = v
+			case "default":
+				d.DefaultConfig = v
+			case "timestamp":
+				var sec int64
+				sec, err = strconv.ParseInt(v, 0, 64)
+				d.TimeStamp = time.Unix(sec, 0)
+			default:
+				err = fmt.Errorf("unknown property")
+			}
+		}
+		if err != nil {
+			return nil, fail("%s: %v", k, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(d.DefaultConfig) == 0 && len(d.Configs) > 0 {
+		d.DefaultConfig = d.Configs[0].Name
+	}
+	return d, nil
+}
+
+// parseSign parses "KEY [HASH] [PADDING]"
+func parseSign(s string) (*SignDescription, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("missing key name")
+	}
+	sign := &SignDescription{Key: fields[0], Hash: "sha256"}
+	for _, field := range fields[1:] {
+		switch field {
+		case "sha256", "sha384":
+			sign.Hash = field
+		case "pkcs-1.5", "pss":
+			sign.Padding = field
+		default:
+			return nil, fmt.Errorf("%q: %w", field, ErrUnsupported)
+		}
+	}
+	return sign, nil
+}
+
+// LoadSigner returns the private key of a PEM file.
+func LoadSigner(fn string) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", fn)
+	}
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T: %w", fn, key, ErrUnsupported)
+	}
+	if err = checkPublicKey(signer.Public()); err != nil {
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	return signer, nil
+}
+
+// Build returns the flattened FIT of the description. The signing keys are
+// loaded from keydir by name.
+func (d *Description) Build(keydir string) ([]byte, error) {
+	images := make(map[string]*ImageDescription)
+	root := &wnode{}
+	root.str("description", d.Description)
+	root.cell("#address-cells", 1)
+	root.cell("timestamp", uint32(d.TimeStamp.Unix()))
+	inodes := root.child("images")
+	var pending []*signing
+	for _, i := range d.Images {
+		if len(i.Type) == 0 || len(i.Arch) == 0 || i.Data == nil {
+			return nil, fmt.Errorf("image %s: needs type, arch and data",
+				i.Name)
+		}
+		images[i.Name] = i
+		n := inodes.child(i.Name)
+		n.str("description", i.Description)
+		n.str("type", i.Type)
+		n.str("arch", i.Arch)
+		if len(i.Os) > 0 {
+			n.str("os", i.Os)
+		}
+		n.str("compression", i.Compression)
+		for _, x := range []struct{ name, v string }{
+			{"load", i.Load},
+			{"entry", i.Entry},
+		} {
+			if len(x.v) == 0 {
+				continue
+			}
+			addr, err := strconv.ParseUint(x.v, 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("image %s: %s: %v",
+					i.Name, x.name, err)
+			}
+			n.cell(x.name, uint32(addr))
+		}
+		n.prop("data", i.Data)
+		for j, algo := range i.Hashes {
+			v, err := digest(algo, i.Data)
+			if err != nil {
+				return nil, fmt.Errorf("image %s: %w", i.Name, err)
+			}
+			h := n.child(fmt.Sprint("hash-", j+1))
+			h.str("algo", algo)
+			h.prop("value", v)
+		}
+		if i.Sign != nil {
+			s, err := newSigning(n, i.Sign, keydir)
+			if err != nil {
+				return nil, fmt.Errorf("image %s: %w", i.Name, err)
+			}
+			s.image = i
+			pending = append(pending, s)
+		}
+	}
+	cnodes := root.child("configurations")
+	if len(d.DefaultConfig) > 0 {
+		cnodes.str("default", d.DefaultConfig)
+	}
+	for _, c := range d.Configs {
+		n := cnodes.child(c.Name)
+		n.str("description", c.Description)
+		hashed := []string{"/", "/configurations/" + c.Name}
+		for _, x := range []struct{ name, v string }{
+			{"kernel", c.Kernel},
+			{"fdt", c.Fdt},
+			{"ramdisk", c.Ramdisk},
+		} {
+			if len(x.v) == 0 {
+				continue
+			}
+			i, found := images[x.v]
+			if !found {
+				return nil, fmt.Errorf("config %s: %s: image %q not found",
+					c.Name, x.name, x.v)
+			}
+			n.str(x.name, x.v)
+			hashed = append(hashed, "/images/"+x.v)
+			for j := range i.Hashes {
+				hashed = append(hashed,
+					fmt.Sprint("/images/", x.v, "/hash-", j+1))
+			}
+		}
+		if c.Sign != nil {
+			s, err := newSigning(n, c.Sign, keydir)
+			if err != nil {
+				return nil, fmt.Errorf("config %s: %w", c.Name, err)
+			}
+			var nodes []byte
+			for _, p := range hashed {
+				nodes = append(nodes, p...)
+				nodes = append(nodes, 0)
+			}
+			s.node.prop("hashed-nodes", nodes)
+			s.strings = s.node.prop("hashed-strings", make([]byte, 8))
+			s.config = c
+			pending = append(pending, s)
+		}
+	}
+	b, sizeStrings := root.flatten()
+	if len(pending) == 0 {
+		return b, nil
+	}
+	for _, s := range pending {
+		if s.strings != nil {
+			binary.BigEndian.PutUint32(b[s.strings.offset+4:],
+				uint32(sizeStrings))
+		}
+	}
+	// sign with the patched blob; the excluded signature values don't
+	// change its layout
+	f, err := Read(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range pending {
+		var data []byte
+		if s.image != nil {
+			data = s.image.Data
+		} else {
+			cfg := f.Configs[s.config.Name]
+			sig, err := f.parseSignature(
+				cfg.node.Children["signature-1"])
+			if err != nil {
+				return nil, err
+			}
+			if data, err = f.configData(cfg, sig); err != nil {
+				return nil, fmt.Errorf("config %s: %w",
+					s.config.Name, err)
+			}
+		}
+		v, err := s.sign(data)
+		if err != nil {
+			return nil, err
+		}
+		copy(b[s.value.offset:], v)
+	}
+	return b, nil
+}
+
+func digest(algo string, data []byte) ([]byte, error) {
+	switch algo {
+	case "sha1":
+		sum := sha1.Sum(data)
+		return sum[:], nil
+	case "sha256":
+		sum := sha256.Sum256(data)
+		return sum[:], nil
+	case "md5":
+		sum := md5.Sum(data)
+		return sum[:], nil
+	case "crc32":
+		v := make([]byte, 4)
+		binary.BigEndian.PutUint32(v, crc32.ChecksumIEEE(data))
+		return v, nil
+	}
+	return nil, fmt.Errorf("hash %q: %w", algo, ErrUnsupported)
+}
+
+// signing is a pending signature node.
+type signing struct {
+	node    *wnode
+	value   *wprop
+	strings *wprop
+	signer  crypto.Signer
+	hash    crypto.Hash
+	padding string
+	image   *ImageDescription
+	config  *ConfigDescription
+}
+
+func newSigning(parent *wnode, sd *SignDescription, keydir string) (*signing, error) {
+	signer, err := LoadSigner(filepath.Join(keydir, sd.Key+".key"))
+	if err != nil {
+		return nil, err
+	}
+	s := &signing{
+		node:    parent.child("signature-1"),
+		signer:  signer,
+		hash:    crypto.SHA256,
+		padding: sd.Padding,
+	}
+	if sd.Hash == "sha384" {
+		s.hash = crypto.SHA384
+	}
+	var algo string
+	size := 64
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		algo = fmt.Sprint(sd.Hash, ",rsa", pub.N.BitLen())
+		size = pub.Size()
+	case *ecdsa.PublicKey:
+		if len(sd.Padding) > 0 {
+			return nil, fmt.Errorf("%s: padding with ecdsa: %w",
+				sd.Key, ErrUnsupported)
+		}
+		algo = sd.Hash + ",ecdsa256"
+	}
+	s.node.str("algo", algo)
+	s.node.str("key-name-hint", sd.Key)
+	if len(sd.Padding) > 0 {
+		s.node.str("padding", sd.Padding)
+	}
+	s.value = s.node.prop("value", make([]byte, size))
+	return s, nil
+}
+
+func (s *signing) sign(data []byte) ([]byte, error) {
+	h := s.hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+	switch priv := s.signer.(type) {
+	case *rsa.PrivateKey:
+		if s.padding == "pss" {
+			return rsa.SignPSS(rand.Reader, priv, s.hash, digest,
+				&rsa.PSSOptions{
+					SaltLength: rsa.PSSSaltLengthEqualsHash,
+				})
+		}
+		return rsa.SignPKCS1v15(rand.Reader, priv, s.hash, digest)
+	case *ecdsa.PrivateKey:
+		r, ss, err := ecdsa.Sign(rand.Reader, priv, digest)
+		if err != nil {
+			return nil, err
+		}
+		// U-Boot's raw r || s
+		return append(r.FillBytes(make([]byte, 32)),
+			ss.FillBytes(make([]byte, 32))...), nil
+	}
+	return nil, fmt.Errorf("%T: %w", s.signer, ErrUnsupported)
+}
@@ -0,0 +1,121 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fit
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDescription = `
+description = build test
+timestamp = 1609459200
+
+image kernel
+	description = not really a kernel
+	type = kernel
+	arch = arm64
+	os = linux
+	load = 0x80080000
+	entry = 0x80080000
+	data = Image
+	hash = sha256 crc32
+	sign = dev-ecdsa256
+
+image initrd
+	type = ramdisk
+	arch = arm64
+	data = initrd.img
+	hash = sha1
+
+config conf-1
+	kernel = kernel
+	ramdisk = initrd
+	sign = dev-ecdsa256
+`
+
+func TestBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kernel := bytes.Repeat([]byte("kernel"), 1000)
+	ioutil.WriteFile(filepath.Join(dir, "Image"), kernel, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "initrd.img"), []byte("initrd"),
+		0644)
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "dev-ecdsa256.key"),
+		pem.EncodeToMemory(&pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: der,
+		}), 0600)
+
+	d, err := ReadDescription(strings.NewReader(testDescription), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := d.Build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != len(b) {
+		t.Error("unstable layout")
+	}
+	f, err := Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.DefaultConfig != "conf-1" || f.Description != "build test" {
+		t.Error("unexpected", f.DefaultConfig, f.Description)
+	}
+	i := f.Images["kernel"]
+	if i == nil || !bytes.Equal(i.Data, kernel) ||
+		i.LoadAddr != 0x80080000 || len(i.Hashes) != 2 {
+		t.Fatal("unexpected kernel", i)
+	}
+	for _, h := range append(i.Hashes, f.Images["initrd"].Hashes...) {
+		if h.Err != nil {
+			t.Error(h.Name, h.Err)
+		}
+	}
+	kr := NewKeyring()
+	kr.Add(&Key{
+		Name:     "dev-ecdsa256",
+		Required: "conf",
+		Public:   priv.Public(),
+	})
+	if err = f.Verify("conf-1", kr); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ReadDescription(strings.NewReader("image\n"), dir); err == nil {
+		t.Error("expected error for missing image name")
+	}
+	if _, err = ReadDescription(strings.NewReader("config c\nbogus = 1\n"),
+		dir); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Error("unexpected", err)
+	}
+}
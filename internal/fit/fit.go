@@ -12,6 +12,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"hash/crc32"
+	"sort"
 	"strings"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 type Fit struct {
 	Debug         bool
 	fdt           *fdt.Tree
+	blob          []byte
 	Description   string
 	AddressCells  uint32
 	TimeStamp     time.Time
@@ -30,10 +32,12 @@ type Fit struct {
 }
 
 type Config struct {
+	Name        string
 	Description string
 	ImageList   []*Image
 	BaseAddr    uint64
 	NextAddr    uint64
+	node        *fdt.Node
 }
 
 type Image struct {
@@ -45,6 +49,16 @@ type Image struct {
 	Compression string
 	LoadAddr    uint64
 	Data        []byte
+	Hashes      []Hash
+	node        *fdt.Node
+}
+
+// Hash is the validation result of an image hash node.
+type Hash struct {
+	Name  string
+	Algo  string
+	Value []byte
+	Err   error
 }
 
 func (f *Fit) getProperty(n *fdt.Node, propName string) []byte {
@@ -130,26 +144,42 @@ func (f *Fit) validateHash(n *fdt.Node, i *Image) (err error) {
 	return
 }
 
+// validateHashes records the result of each hash node and returns the
+// first error.
 func (f *Fit) validateHashes(n *fdt.Node, i *Image) (err error) {
-	for _, c := range n.Children {
-		if strings.HasPrefix(c.Name, "hash") {
-			err = f.validateHash(c, i)
-			if err != nil {
-				return err
-			}
+	names := make([]string, 0, len(n.Children))
+	for name := range n.Children {
+		if strings.HasPrefix(name, "hash") {
+			names = append(names, name)
 		}
 	}
-	return nil
+	sort.Strings(names)
+	for _, name := range names {
+		c := n.Children[name]
+		h := Hash{
+			Name:  name,
+			Algo:  f.fdt.PropString(f.getProperty(c, "algo")),
+			Value: f.getProperty(c, "value"),
+		}
+		h.Err = f.validateHash(c, i)
+		i.Hashes = append(i.Hashes, h)
+		if h.Err != nil && err == nil {
+			err = h.Err
+		}
+	}
+	return err
 }
 
 func (f *Fit) parseImage(cfg *Config, imageName string) {
-	i := f.Images[imageName]
-
+	i, found := f.Images[imageName]
+	if !found {
+		return
+	}
 	cfg.ImageList = append(cfg.ImageList, i)
 }
 
 func (f *Fit) parseConfiguration(whichconf string) (err error) {
-	cfg := Config{}
+	cfg := Config{Name: whichconf}
 
 	conf := f.fdt.RootNode.Children["configurations"]
 
@@ -171,6 +201,7 @@ func (f *Fit) parseConfiguration(whichconf string) (err error) {
 	}
 
 	cfg.ImageList = []*Image{}
+	cfg.node = conf
 
 	kernel := f.fdt.PropString(conf.Properties["kernel"])
 	fdt := f.fdt.PropString(conf.Properties["fdt"])
@@ -188,9 +219,31 @@ func (f *Fit) parseConfiguration(whichconf string) (err error) {
 	return nil
 }
 
+// Parse panics if the blob is malformed or has an incorrect image hash.
 func Parse(b []byte) (f *Fit) {
+	return parse(b, true)
+}
+
+// Read returns an error if the blob is malformed; incorrect image hashes
+// are recorded rather than returned.
+func Read(b []byte) (f *Fit, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f = nil
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	return parse(b, false), nil
+}
+
+func parse(b []byte, strict bool) (f *Fit) {
 	fit := Fit{Debug: false}
 	f = &fit
+	f.blob = b
 	f.fdt = &fdt.Tree{Debug: false, IsLittleEndian: false}
 	err := f.fdt.Parse(b)
 	if err != nil {
@@ -207,6 +260,7 @@ func Parse(b []byte) (f *Fit) {
 	for _, image := range images.Children {
 		i := Image{}
 		i.Name = image.Name
+		i.node = image
 		i.Description = f.fdt.PropString(f.getProperty(image, "description"))
 		i.Type = f.fdt.PropString(f.getProperty(image, "type"))
 		i.Arch = f.fdt.PropString(f.getProperty(image, "arch"))
@@ -215,7 +269,7 @@ func Parse(b []byte) (f *Fit) {
 		i.Data = f.getProperty(image, "data")
 
 		err := f.validateHashes(image, &i)
-		if err != nil {
+		if err != nil && strict {
 			panic(err)
 		}
 		load := f.fdt.PropUint32Slice(image.Properties["load"])
@@ -9,9 +9,36 @@ import (
 	"github.com/platinasystems/goes/internal/kexec"
 )
 
+// KexecLoadConfig loads the configuration's kernel and ramdisk after
+// verifying their signatures with the keys in KeyDir.
 func (f *Fit) KexecLoadConfig(conf *Config, cmdline string) (err error) {
-	kdat := []byte{}
-	idat := []byte{}
+	return f.KexecLoadConfigFlags(conf, cmdline, 0)
+}
+
+// KexecLoadConfigFlags is KexecLoadConfig with kexec_load flags, e.g.
+// kexec.KEXEC_ON_CRASH.
+func (f *Fit) KexecLoadConfigFlags(conf *Config, cmdline string,
+	flags uintptr) (err error) {
+	kdat, idat, err := f.KexecImages(conf)
+	if err != nil {
+		return err
+	}
+	return kexec.LoadSlices(kdat, idat, cmdline, flags)
+}
+
+// KexecImages returns the configuration's kernel and ramdisk after
+// verifying their signatures with the keys in KeyDir.
+func (f *Fit) KexecImages(conf *Config) (kdat, idat []byte, err error) {
+	kr, err := LoadKeyring(KeyDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = f.Verify(conf.Name, kr); err != nil {
+		return nil, nil, err
+	}
+
+	kdat = []byte{}
+	idat = []byte{}
 
 	for _, image := range conf.ImageList {
 		if image.Type == "kernel" {
@@ -23,5 +50,5 @@ func (f *Fit) KexecLoadConfig(conf *Config, cmdline string) (err error) {
 		}
 	}
 
-	return kexec.LoadSlices(kdat, idat, cmdline, 0)
+	return kdat, idat, nil
 }
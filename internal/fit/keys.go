@@ -0,0 +1,262 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/platinasystems/fdt"
+)
+
+// KeyDir has the trusted public keys as PEM files, KEY-NAME.pem or .crt,
+// and/or U-Boot style key nodes in *.dtb files. If KeyDir has a file named
+// "required", its content, "conf" or "image", is the default policy of
+// keys that don't have one.
+const KeyDir = "/etc/goes/keys"
+
+// Key is a trusted signature verification key.
+type Key struct {
+	Name string
+	// Required is "conf" or "image" if every configuration or image
+	// must be signed by this key.
+	Required string
+	Public   crypto.PublicKey
+}
+
+// Keyring is a set of trusted keys.
+type Keyring struct {
+	Keys map[string]*Key
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{Keys: make(map[string]*Key)}
+}
+
+func (kr *Keyring) Add(k *Key) { kr.Keys[k.Name] = k }
+
+// Names returns the sorted key names.
+func (kr *Keyring) Names() []string {
+	names := make([]string, 0, len(kr.Keys))
+	for name := range kr.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Required returns true if any key requires signed configurations or images.
+func (kr *Keyring) Required(what string) bool {
+	if kr == nil {
+		return false
+	}
+	for _, k := range kr.Keys {
+		if k.Required == what {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyDetached returns the name of the key that signed the SHA-256
+// digest of data, as by "openssl dgst -sha256 -sign KEY -out SIG", with
+// PKCS #1 v1.5 for RSA keys or ASN.1 for ECDSA keys.
+func (kr *Keyring) VerifyDetached(data, sig []byte) (string, error) {
+	if kr == nil || len(kr.Keys) == 0 {
+		return "", ErrUnknownKey
+	}
+	digest := sha256.Sum256(data)
+	for _, name := range kr.Names() {
+		switch pub := kr.Keys[name].Public.(type) {
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:],
+				sig) == nil {
+				return name, nil
+			}
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(pub, digest[:], sig) {
+				return name, nil
+			}
+		}
+	}
+	return "", ErrBadSignature
+}
+
+// LoadKeyring returns the keys of the given directory; it's empty if the
+// directory doesn't exist.
+func LoadKeyring(dir string) (*Keyring, error) {
+	kr := NewKeyring()
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return kr, err
+	}
+	required := ""
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "required")); err == nil {
+		required = strings.TrimSpace(string(b))
+		if required != "conf" && required != "image" {
+			return nil, fmt.Errorf("%s/required: %q invalid",
+				dir, required)
+		}
+	}
+	for _, fi := range fis {
+		fn := filepath.Join(dir, fi.Name())
+		ext := filepath.Ext(fi.Name())
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		switch ext {
+		case ".pem", ".crt":
+			pub, err := ParsePublicKey(b)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn, err)
+			}
+			kr.Add(&Key{
+				Name:   strings.TrimSuffix(fi.Name(), ext),
+				Public: pub,
+			})
+		case ".dtb":
+			if err = kr.LoadDtb(b); err != nil {
+				return nil, fmt.Errorf("%s: %w", fn, err)
+			}
+		}
+	}
+	if len(required) > 0 {
+		for _, k := range kr.Keys {
+			if len(k.Required) == 0 {
+				k.Required = required
+			}
+		}
+	}
+	return kr, nil
+}
+
+// ParsePublicKey returns the RSA or ECDSA P-256 key of a PEM encoded public
+// key or certificate.
+func ParsePublicKey(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+	var (
+		pub interface{}
+		err error
+	)
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			pub = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = checkPublicKey(pub); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+func checkPublicKey(pub interface{}) error {
+	switch t := pub.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if t.Curve != elliptic.P256() {
+			return fmt.Errorf("%s: %w", t.Curve.Params().Name,
+				ErrUnsupported)
+		}
+	default:
+		return fmt.Errorf("%T: %w", pub, ErrUnsupported)
+	}
+	return nil
+}
+
+// LoadDtb adds the keys of the /signature node of a U-Boot control DTB as
+// written by "mkimage -K".
+func (kr *Keyring) LoadDtb(b []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	t := &fdt.Tree{}
+	if err = t.Parse(b); err != nil {
+		return err
+	}
+	sig := t.RootNode.Children["signature"]
+	if sig == nil {
+		return fmt.Errorf("no signature node")
+	}
+	for name, n := range sig.Children {
+		if !strings.HasPrefix(name, "key-") {
+			continue
+		}
+		k := &Key{Name: strings.TrimPrefix(name, "key-")}
+		if v, found := n.Properties["key-name-hint"]; found {
+			k.Name = t.PropString(v)
+		}
+		if v, found := n.Properties["required"]; found {
+			k.Required = t.PropString(v)
+		}
+		if k.Public, err = dtbPublicKey(t, n); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		kr.Add(k)
+	}
+	return nil
+}
+
+func dtbPublicKey(t *fdt.Tree, n *fdt.Node) (crypto.PublicKey, error) {
+	if mod, found := n.Properties["rsa,modulus"]; found {
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(mod),
+			E: 65537,
+		}
+		if v := n.Properties["rsa,exponent"]; len(v) == 8 {
+			e := new(big.Int).SetBytes(v)
+			if !e.IsInt64() || e.Int64() > 1<<31-1 {
+				return nil, fmt.Errorf("rsa,exponent: invalid")
+			}
+			pub.E = int(e.Int64())
+		}
+		return pub, nil
+	}
+	if x, found := n.Properties["ecdsa,x-point"]; found {
+		curve := t.PropString(n.Properties["ecdsa,curve"])
+		if curve != "prime256v1" {
+			return nil, fmt.Errorf("%s: %w", curve, ErrUnsupported)
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(n.Properties["ecdsa,y-point"]),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("ecdsa point isn't on curve")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("no public key")
+}
@@ -0,0 +1,81 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fit
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const mkimageDir = "testdata/mkimage"
+
+// TestMkimage verifies a FIT signed by U-Boot's mkimage. Without the vector
+// of testdata/mkimage/gen.sh, this generates one if mkimage, dtc and openssl
+// are installed.
+func TestMkimage(t *testing.T) {
+	dir := mkimageDir
+	if _, err := os.Stat(filepath.Join(dir, "signed.itb")); err != nil {
+		for _, tool := range []string{"mkimage", "dtc", "openssl"} {
+			if _, err := exec.LookPath(tool); err != nil {
+				t.Skip("no testdata/mkimage/signed.itb,",
+					"run gen.sh and commit its output;", err)
+			}
+		}
+		tmp, err := ioutil.TempDir("", "mkimage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+		gen := exec.Command("sh", filepath.Join(mkimageDir, "gen.sh"),
+			tmp)
+		if out, err := gen.CombinedOutput(); err != nil {
+			t.Fatalf("gen.sh: %v: %s", err, out)
+		}
+		dir = tmp
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "signed.itb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kr, err := LoadKeyring(filepath.Join(dir, "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Verify(f.DefaultConfig, required(kr)); err != nil {
+		t.Error("certificate:", err)
+	}
+
+	control, err := ioutil.ReadFile(filepath.Join(dir, "control.dtb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dkr := NewKeyring()
+	if err = dkr.LoadDtb(control); err != nil {
+		t.Fatal(err)
+	}
+	if !dkr.Required("conf") {
+		t.Error("control.dtb: key isn't required")
+	}
+	if err = f.Verify(f.DefaultConfig, dkr); err != nil {
+		t.Error("control.dtb:", err)
+	}
+
+	f = Parse(bytes.Replace(b, []byte("signed configuration"),
+		[]byte("hacked configuration"), 1))
+	if err = f.Verify(f.DefaultConfig, dkr); !errors.Is(err,
+		ErrBadSignature) {
+		t.Error("expected bad signature, got", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	fdtMagic     = 0xd00dfeed
+	fdtBeginNode = 0x1
+	fdtEndNode   = 0x2
+	fdtProp      = 0x3
+	fdtNop       = 0x4
+	fdtEnd       = 0x9
+	fdtMaxDepth  = 32
+)
+
+var ErrBadStructure = errors.New("bad FDT structure")
+
+// region is a span of the flattened blob that's covered by a signature.
+type region struct {
+	offset, size int
+}
+
+type blobHeader struct {
+	offStruct, offStrings   int
+	sizeStruct, sizeStrings int
+}
+
+func readBlobHeader(b []byte) (h blobHeader, err error) {
+	if len(b) < 40 || binary.BigEndian.Uint32(b) != fdtMagic {
+		return h, fmt.Errorf("%w: bad header", ErrBadStructure)
+	}
+	cell := func(i int) int { return int(binary.BigEndian.Uint32(b[i:])) }
+	h.offStruct, h.offStrings = cell(8), cell(12)
+	h.sizeStrings, h.sizeStruct = cell(32), cell(36)
+	if h.offStruct+h.sizeStruct > len(b) ||
+		h.offStrings+h.sizeStrings > len(b) {
+		return h, fmt.Errorf("%w: truncated", ErrBadStructure)
+	}
+	return h, nil
+}
+
+// nextTag returns the tag at the given structure offset and the offset of
+// the following tag.
+func nextTag(st []byte, offset int) (tag uint32, next int, err error) {
+	if offset+4 > len(st) {
+		return 0, 0, ErrBadStructure
+	}
+	tag = binary.BigEndian.Uint32(st[offset:])
+	next = offset + 4
+	switch tag {
+	case fdtBeginNode:
+		l := bytes.IndexByte(st[next:], 0)
+		if l < 0 {
+			return 0, 0, ErrBadStructure
+		}
+		next += l + 1
+	case fdtProp:
+		if next+8 > len(st) {
+			return 0, 0, ErrBadStructure
+		}
+		next += 8 + int(binary.BigEndian.Uint32(st[next:]))
+	case fdtEndNode, fdtNop, fdtEnd:
+	default:
+		return 0, 0, fmt.Errorf("%w: tag %#x", ErrBadStructure, tag)
+	}
+	next = (next + 3) &^ 3
+	if next > len(st) {
+		return 0, 0, ErrBadStructure
+	}
+	return tag, next, nil
+}
+
+// findRegions returns the blob regions of the included node paths less the
+// excluded properties. This follows U-Boot's fdt_find_regions() so that
+// signatures made by mkimage verify here.
+func findRegions(b []byte, inc, exc []string) ([]region, error) {
+	h, err := readBlobHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	st := b[h.offStruct : h.offStruct+h.sizeStruct]
+	in := func(s string, list []string) bool {
+		for _, t := range list {
+			if s == t {
+				return true
+			}
+		}
+		return false
+	}
+	var (
+		regions []region
+		stack   [fdtMaxDepth]int
+		path    []byte
+		tag     uint32
+	)
+	start, depth, want, next := -1, -1, 0, 0
+	for tag != fdtEnd {
+		offset := next
+		tag, next, err = nextTag(st, offset)
+		if err != nil {
+			return nil, err
+		}
+		include := 0
+		stopAt := next
+		switch tag {
+		case fdtProp:
+			if want >= 2 {
+				include = 1
+			}
+			stopAt = offset
+			nameoff := int(binary.BigEndian.Uint32(st[offset+8:]))
+			if nameoff >= h.sizeStrings {
+				return nil, ErrBadStructure
+			}
+			s := b[h.offStrings+nameoff : h.offStrings+h.sizeStrings]
+			if i := bytes.IndexByte(s, 0); i >= 0 {
+				s = s[:i]
+			}
+			if in(string(s), exc) {
+				include = 0
+			}
+		case fdtNop:
+			if want >= 2 {
+				include = 1
+			}
+			stopAt = offset
+		case fdtBeginNode:
+			depth++
+			if depth == fdtMaxDepth {
+				return nil, ErrBadStructure
+			}
+			name := st[offset+4:]
+			name = name[:bytes.IndexByte(name, 0)]
+			if len(path) != 1 {
+				path = append(path, '/')
+			}
+			path = append(path, name...)
+			stack[depth] = want
+			if want == 1 {
+				stopAt = offset
+			}
+			if in(string(path), inc) {
+				want = 2
+			} else if want > 0 {
+				want--
+			} else {
+				stopAt = offset
+			}
+			include = want
+		case fdtEndNode:
+			if depth < 0 {
+				return nil, ErrBadStructure
+			}
+			include = want
+			want = stack[depth]
+			depth--
+			if i := bytes.LastIndexByte(path, '/'); i >= 0 {
+				path = path[:i]
+			}
+		case fdtEnd:
+			include = 1
+		}
+		if include != 0 && start == -1 {
+			// merge with the previous region if adjacent
+			if n := len(regions); n > 0 && offset ==
+				regions[n-1].offset+regions[n-1].size-h.offStruct {
+				start = regions[n-1].offset - h.offStruct
+				regions = regions[:n-1]
+			} else {
+				start = offset
+			}
+		}
+		if include == 0 && start != -1 {
+			regions = append(regions, region{
+				offset: h.offStruct + start,
+				size:   stopAt - start,
+			})
+			start = -1
+		}
+	}
+	if next != h.sizeStruct {
+		return nil, fmt.Errorf("%w: bad layout", ErrBadStructure)
+	}
+	// the END tag
+	regions = append(regions, region{
+		offset: h.offStruct + start,
+		size:   next - start,
+	})
+	return regions, nil
+}
+
+// regionData returns the concatenated blob regions.
+func regionData(b []byte, regions []region) []byte {
+	var buf bytes.Buffer
+	for _, r := range regions {
+		buf.Write(b[r.offset : r.offset+r.size])
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,23 @@
+#!/bin/sh
+# Sign image.its with U-Boot's mkimage and a new key. The FIT, the key's
+# certificate and the control DTB with the required key are written to
+# the given directory, default: that of this script.
+set -e
+src=$(cd $(dirname $0) && pwd)
+out=$(mkdir -p ${1:-$src} && cd ${1:-$src} && pwd)
+tmp=$(mktemp -d)
+trap "rm -rf $tmp" EXIT
+cd $tmp
+mkdir keys
+printf 'not really a kernel' > kernel.bin
+printf 'not really a ramdisk' > ramdisk.bin
+cp $src/image.its .
+openssl genpkey -algorithm RSA -pkeyopt rsa_keygen_bits:2048 \
+	-out keys/dev.key 2>/dev/null
+openssl req -batch -new -x509 -key keys/dev.key -subj /CN=dev \
+	-days 36500 -out keys/dev.crt
+echo '/dts-v1/; / { };' | dtc -q -I dts -O dtb -o control.dtb
+mkimage -f image.its -k keys -K control.dtb -r signed.itb >/dev/null
+mkdir -p $out/keys
+cp signed.itb control.dtb $out
+cp keys/dev.crt $out/keys
@@ -0,0 +1,378 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/platinasystems/fdt"
+)
+
+var (
+	ErrUnsigned     = errors.New("not signed")
+	ErrUnknownKey   = errors.New("unknown key")
+	ErrBadSignature = errors.New("bad signature")
+	ErrUnsupported  = errors.New("unsupported")
+	ErrBadHash      = errors.New("bad image hash")
+)
+
+// secureHashes may alone cover the data of an image of a signed
+// configuration; crc32 and md5 may not.
+var secureHashes = map[string]bool{
+	"sha1":   true,
+	"sha256": true,
+}
+
+// These image properties are excluded from configuration signatures since
+// the image hash nodes cover the data.
+var excludedProperties = []string{
+	"data",
+	"data-size",
+	"data-position",
+	"data-offset",
+}
+
+// VerifyError describes a failed signature verification.
+type VerifyError struct {
+	Node string // e.g. /configurations/conf-1/signature-1
+	Key  string
+	Err  error
+}
+
+func (e *VerifyError) Error() string {
+	s := e.Node
+	if len(e.Key) > 0 {
+		s += fmt.Sprintf(": key %q", e.Key)
+	}
+	return s + ": " + e.Err.Error()
+}
+
+func (e *VerifyError) Unwrap() error { return e.Err }
+
+// Signature is a parsed signature node.
+type Signature struct {
+	Name    string
+	Algo    string
+	Hash    crypto.Hash
+	Crypto  string // rsa2048, rsa4096 or ecdsa256
+	Padding string // pkcs-1.5 or pss
+	KeyName string
+	Value   []byte
+	// configuration signatures only
+	HashedNodes   []string
+	HashedStrings []uint32
+}
+
+// parseSignature returns the signature of the given node.
+func (f *Fit) parseSignature(n *fdt.Node) (*Signature, error) {
+	sig := &Signature{
+		Name:    n.Name,
+		Padding: "pkcs-1.5",
+		Value:   n.Properties["value"],
+	}
+	if len(sig.Value) == 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+	if v, found := n.Properties["algo"]; found {
+		sig.Algo = f.fdt.PropString(v)
+	}
+	if v, found := n.Properties["key-name-hint"]; found {
+		sig.KeyName = f.fdt.PropString(v)
+	}
+	if v, found := n.Properties["padding"]; found {
+		sig.Padding = f.fdt.PropString(v)
+	}
+	if v, found := n.Properties["hashed-nodes"]; found {
+		for _, s := range f.fdt.PropStringSlice(v) {
+			if len(s) > 0 {
+				sig.HashedNodes = append(sig.HashedNodes, s)
+			}
+		}
+	}
+	if v, found := n.Properties["hashed-strings"]; found {
+		sig.HashedStrings = f.fdt.PropUint32Slice(v)
+	}
+	algo := strings.Split(sig.Algo, ",")
+	if len(algo) != 2 {
+		return nil, fmt.Errorf("algo %q: %w", sig.Algo, ErrUnsupported)
+	}
+	switch algo[0] {
+	case "sha256":
+		sig.Hash = crypto.SHA256
+	case "sha384":
+		sig.Hash = crypto.SHA384
+	default:
+		return nil, fmt.Errorf("%s: %w", algo[0], ErrUnsupported)
+	}
+	switch algo[1] {
+	case "rsa2048", "rsa3072", "rsa4096", "ecdsa256":
+		sig.Crypto = algo[1]
+	default:
+		return nil, fmt.Errorf("%s: %w", algo[1], ErrUnsupported)
+	}
+	switch sig.Padding {
+	case "pkcs-1.5", "pss":
+	default:
+		return nil, fmt.Errorf("padding %q: %w", sig.Padding,
+			ErrUnsupported)
+	}
+	return sig, nil
+}
+
+// Check the signature of data with the given key.
+func (sig *Signature) Check(k *Key, data []byte) error {
+	h := sig.Hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(sig.Crypto, "rsa") ||
+			fmt.Sprint("rsa", pub.N.BitLen()) != sig.Crypto {
+			return fmt.Errorf("%s key for %s: %w", k.Name, sig.Crypto,
+				ErrBadSignature)
+		}
+		var err error
+		if sig.Padding == "pss" {
+			err = rsa.VerifyPSS(pub, sig.Hash, digest, sig.Value,
+				&rsa.PSSOptions{
+					SaltLength: rsa.PSSSaltLengthAuto,
+				})
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, sig.Hash, digest,
+				sig.Value)
+		}
+		if err != nil {
+			return ErrBadSignature
+		}
+	case *ecdsa.PublicKey:
+		if sig.Crypto != "ecdsa256" {
+			return fmt.Errorf("ecdsa256 key for %s: %w", sig.Crypto,
+				ErrBadSignature)
+		}
+		ok := false
+		if len(sig.Value) == 64 {
+			// U-Boot's raw r || s
+			r := new(big.Int).SetBytes(sig.Value[:32])
+			s := new(big.Int).SetBytes(sig.Value[32:])
+			ok = ecdsa.Verify(pub, digest, r, s)
+		} else {
+			ok = ecdsa.VerifyASN1(pub, digest, sig.Value)
+		}
+		if !ok {
+			return ErrBadSignature
+		}
+	default:
+		return fmt.Errorf("%T: %w", pub, ErrUnsupported)
+	}
+	return nil
+}
+
+// signatures returns the sorted signature nodes of n.
+func signatures(n *fdt.Node) []*fdt.Node {
+	var nodes []*fdt.Node
+	for name, c := range n.Children {
+		if strings.HasPrefix(name, "signature") {
+			nodes = append(nodes, c)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes
+}
+
+// Verify checks the signatures of the named configuration and its images
+// with the trusted keys. A configuration or image must be signed if any
+// key is required for that; otherwise, signatures by unknown keys are
+// ignored but any signature by a trusted key must be valid.
+func (f *Fit) Verify(name string, kr *Keyring) error {
+	cfg, found := f.Configs[name]
+	if !found {
+		return fmt.Errorf("Can't find configuration %s", name)
+	}
+	for _, i := range cfg.ImageList {
+		if err := f.VerifyImage(i, kr); err != nil {
+			return err
+		}
+	}
+	return f.VerifyConfig(cfg, kr)
+}
+
+// VerifyImage checks the signatures of an image's data.
+func (f *Fit) VerifyImage(i *Image, kr *Keyring) error {
+	return f.verifyNode("/images/"+i.Name, i.node, kr, "image",
+		func(*Signature) ([]byte, error) {
+			return i.Data, nil
+		})
+}
+
+// VerifyConfig checks the signatures of a configuration, but not those of
+// its images, and the hashes of its images that the signatures cover.
+func (f *Fit) VerifyConfig(cfg *Config, kr *Keyring) error {
+	if err := f.checkHashes(cfg); err != nil {
+		return err
+	}
+	return f.verifyNode("/configurations/"+cfg.Name, cfg.node, kr, "conf",
+		func(sig *Signature) ([]byte, error) {
+			return f.configData(cfg, sig)
+		})
+}
+
+// checkHashes returns an error if an image of the configuration has an
+// incorrect hash or none; or, if the configuration is signed, none but
+// crc32 or md5.
+func (f *Fit) checkHashes(cfg *Config) error {
+	signed := len(signatures(cfg.node)) > 0
+	for _, i := range cfg.ImageList {
+		path := "/images/" + i.Name
+		secure := false
+		for _, h := range i.Hashes {
+			if h.Err != nil {
+				return &VerifyError{Node: path + "/" + h.Name,
+					Err: fmt.Errorf("%w: %v", ErrBadHash, h.Err)}
+			}
+			secure = secure || secureHashes[h.Algo]
+		}
+		switch {
+		case len(i.Hashes) == 0:
+			return &VerifyError{Node: path,
+				Err: fmt.Errorf("%w: missing", ErrBadHash)}
+		case signed && !secure:
+			return &VerifyError{Node: path,
+				Err: fmt.Errorf("%w: no sha1 or sha256", ErrBadHash)}
+		}
+	}
+	return nil
+}
+
+// Signatures returns the parsed signature nodes of an image or
+// configuration.
+func (f *Fit) Signatures(v interface{}) ([]*Signature, error) {
+	var n *fdt.Node
+	switch t := v.(type) {
+	case *Image:
+		n = t.node
+	case *Config:
+		n = t.node
+	default:
+		return nil, fmt.Errorf("%T: %w", v, ErrUnsupported)
+	}
+	var sigs []*Signature
+	for _, c := range signatures(n) {
+		sig, err := f.parseSignature(c)
+		if err != nil {
+			return sigs, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+func (f *Fit) verifyNode(path string, n *fdt.Node, kr *Keyring,
+	what string, data func(*Signature) ([]byte, error)) error {
+	if kr == nil {
+		kr = NewKeyring()
+	}
+	verified := make(map[string]bool)
+	var unknown *VerifyError
+	nodes := signatures(n)
+	for _, c := range nodes {
+		sigpath := path + "/" + c.Name
+		sig, err := f.parseSignature(c)
+		if err != nil {
+			return &VerifyError{Node: sigpath, Err: err}
+		}
+		k := kr.Keys[sig.KeyName]
+		if k == nil {
+			if f.Debug {
+				fmt.Printf("%s: unknown key %q\n", sigpath,
+					sig.KeyName)
+			}
+			unknown = &VerifyError{
+				Node: sigpath,
+				Key:  sig.KeyName,
+				Err:  ErrUnknownKey,
+			}
+			continue
+		}
+		b, err := data(sig)
+		if err == nil {
+			err = sig.Check(k, b)
+		}
+		if err != nil {
+			return &VerifyError{Node: sigpath, Key: k.Name, Err: err}
+		}
+		if f.Debug {
+			fmt.Printf("%s: verified with %q\n", sigpath, k.Name)
+		}
+		verified[k.Name] = true
+	}
+	for _, name := range kr.Names() {
+		if k := kr.Keys[name]; k.Required == what && !verified[name] {
+			if unknown != nil && len(verified) == 0 {
+				return unknown
+			}
+			return &VerifyError{Node: path, Key: name,
+				Err: ErrUnsigned}
+		}
+	}
+	return nil
+}
+
+// configData returns the signed content of a configuration.
+func (f *Fit) configData(cfg *Config, sig *Signature) ([]byte, error) {
+	if len(sig.HashedNodes) == 0 {
+		return nil, fmt.Errorf("missing hashed-nodes")
+	}
+	if len(sig.HashedStrings) != 2 {
+		return nil, fmt.Errorf("missing hashed-strings")
+	}
+	hashed := make(map[string]bool)
+	for _, s := range sig.HashedNodes {
+		hashed[s] = true
+	}
+	// a signature must cover the configuration, its images and their
+	// hashes; otherwise, these could be replaced
+	need := []string{"/", "/configurations/" + cfg.Name}
+	for _, i := range cfg.ImageList {
+		p := "/images/" + i.Name
+		need = append(need, p)
+		found := false
+		for c := range i.node.Children {
+			if strings.HasPrefix(c, "hash") && hashed[p+"/"+c] {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s hash isn't signed", p)
+		}
+	}
+	for _, p := range need {
+		if !hashed[p] {
+			return nil, fmt.Errorf("%s isn't signed", p)
+		}
+	}
+	regions, err := findRegions(f.blob, sig.HashedNodes,
+		excludedProperties)
+	if err != nil {
+		return nil, err
+	}
+	h, _ := readBlobHeader(f.blob)
+	off, size := int(sig.HashedStrings[0]), int(sig.HashedStrings[1])
+	if off < 0 || size < 0 || off+size > h.sizeStrings {
+		return nil, fmt.Errorf("hashed-strings: out of range")
+	}
+	regions = append(regions, region{h.offStrings + off, size})
+	return regionData(f.blob, regions), nil
+}
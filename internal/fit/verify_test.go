@@ -0,0 +1,425 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinasystems/fdt"
+)
+
+var update = flag.Bool("update", false, "regenerate testdata/signed")
+
+const signedDir = "testdata/signed"
+
+// signed test vectors: file name, key, algo and padding
+var vectors = []struct {
+	name, key, algo, padding string
+}{
+	{"rsa2048-sha256", "dev-rsa2048", "sha256,rsa2048", "pkcs-1.5"},
+	{"rsa4096-sha384-pss", "dev-rsa4096", "sha384,rsa4096", "pss"},
+	{"ecdsa256-sha256", "dev-ecdsa256", "sha256,ecdsa256", ""},
+}
+
+func TestSigned(t *testing.T) {
+	if *update {
+		generate(t)
+	}
+	kr, err := LoadKeyring(filepath.Join(signedDir, "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kr.Keys) != 3 {
+		t.Fatal("expected 3 keys, got", kr.Names())
+	}
+	for _, v := range vectors {
+		t.Run(v.name, func(t *testing.T) {
+			f := parseFile(t, v.name+".itb")
+			if err := f.Verify(f.DefaultConfig, kr); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	t.Run("dtb", func(t *testing.T) {
+		b, err := ioutil.ReadFile(filepath.Join(signedDir, "keys.dtb"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dkr := NewKeyring()
+		if err = dkr.LoadDtb(b); err != nil {
+			t.Fatal(err)
+		}
+		if len(dkr.Keys) != 2 || !dkr.Required("conf") {
+			t.Error("unexpected keys", dkr.Names())
+		}
+		f := parseFile(t, "rsa2048-sha256.itb")
+		if err := f.Verify(f.DefaultConfig, dkr); err != nil {
+			t.Error(err)
+		}
+		// the required rsa2048 key must sign every configuration
+		for _, v := range []string{"ecdsa256-sha256", "unsigned"} {
+			f := parseFile(t, v+".itb")
+			if err := f.Verify(f.DefaultConfig, dkr); !errors.Is(err,
+				ErrUnsigned) {
+				t.Error(v, err)
+			}
+		}
+	})
+	t.Run("image", func(t *testing.T) {
+		f := parseFile(t, "image-ecdsa256.itb")
+		if err := f.Verify(f.DefaultConfig, kr); err != nil {
+			t.Fatal(err)
+		}
+		f.Images["kernel"].Data[0] ^= 1
+		err := f.Verify(f.DefaultConfig, kr)
+		if !errors.Is(err, ErrBadSignature) {
+			t.Fatal("expected bad signature, got", err)
+		}
+	})
+	t.Run("hashes", func(t *testing.T) {
+		b, err := ioutil.ReadFile(filepath.Join(signedDir,
+			"rsa2048-sha256.itb"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the config signature covers the hashes, not the data
+		b = bytes.Replace(b, []byte("not really a kernel"),
+			[]byte("not really a kerneL"), 1)
+		f, err := Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rkr := required(kr)
+		if err = f.Verify(f.DefaultConfig, rkr); !errors.Is(err,
+			ErrBadHash) {
+			t.Error("altered data:", err)
+		}
+		for name, keep := range map[string]string{
+			"crc32 only": "crc32",
+			"no hash":    "none",
+		} {
+			f := parseFile(t, "rsa2048-sha256.itb")
+			i := f.Images["kernel"]
+			var hashes []Hash
+			for _, h := range i.Hashes {
+				if h.Algo == keep {
+					hashes = append(hashes, h)
+				}
+			}
+			i.Hashes = hashes
+			if err = f.Verify(f.DefaultConfig, rkr); !errors.Is(err,
+				ErrBadHash) {
+				t.Error(name, err)
+			}
+		}
+	})
+	t.Run("tampered", func(t *testing.T) {
+		f := parseFile(t, "tampered.itb")
+		err := f.Verify(f.DefaultConfig, kr)
+		var verr *VerifyError
+		if !errors.As(err, &verr) || !errors.Is(err, ErrBadSignature) {
+			t.Fatal("expected bad signature, got", err)
+		}
+		if verr.Node != "/configurations/conf-1/signature-1" {
+			t.Error("unexpected node", verr.Node)
+		}
+	})
+	t.Run("unsigned", func(t *testing.T) {
+		f := parseFile(t, "unsigned.itb")
+		if err := f.Verify(f.DefaultConfig, kr); err != nil {
+			t.Error("optional:", err)
+		}
+		rkr := required(kr)
+		if err := f.Verify(f.DefaultConfig, rkr); !errors.Is(err,
+			ErrUnsigned) {
+			t.Error("required:", err)
+		}
+	})
+	t.Run("unknown", func(t *testing.T) {
+		f := parseFile(t, "rsa2048-sha256.itb")
+		other := NewKeyring()
+		other.Add(&Key{
+			Name:   "other",
+			Public: kr.Keys["dev-ecdsa256"].Public,
+		})
+		if err := f.Verify(f.DefaultConfig, other); err != nil {
+			t.Error("optional:", err)
+		}
+		err := f.Verify(f.DefaultConfig, required(other))
+		if !errors.Is(err, ErrUnknownKey) {
+			t.Error("required:", err)
+		}
+	})
+}
+
+func TestRequiredPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b, err := ioutil.ReadFile(filepath.Join(signedDir, "keys",
+		"dev-rsa2048.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "dev-rsa2048.pem"), b, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "required"), []byte("conf\n"),
+		0644)
+	kr, err := LoadKeyring(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !kr.Required("conf") || kr.Required("image") {
+		t.Error("unexpected policy")
+	}
+	if kr, err = LoadKeyring(filepath.Join(dir, "missing")); err != nil ||
+		len(kr.Keys) != 0 {
+		t.Error("missing directory:", err)
+	}
+}
+
+func TestVerifyDetached(t *testing.T) {
+	data := []byte("not really an initramfs")
+	digest := sha256.Sum256(data)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr := NewKeyring()
+	kr.Add(&Key{Name: "rsa", Public: rsaKey.Public()})
+	kr.Add(&Key{Name: "ecdsa", Public: ecKey.Public()})
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256,
+		digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want, sig := range map[string][]byte{
+		"rsa":   rsaSig,
+		"ecdsa": ecSig,
+	} {
+		if name, err := kr.VerifyDetached(data, sig); err != nil ||
+			name != want {
+			t.Error(want, name, err)
+		}
+		if _, err := kr.VerifyDetached(append(data, '!'),
+			sig); !errors.Is(err, ErrBadSignature) {
+			t.Error(want, "tampered:", err)
+		}
+	}
+	if _, err := NewKeyring().VerifyDetached(data,
+		ecSig); !errors.Is(err, ErrUnknownKey) {
+		t.Error("no keys:", err)
+	}
+}
+
+func required(kr *Keyring) *Keyring {
+	rkr := NewKeyring()
+	for _, k := range kr.Keys {
+		rk := *k
+		rk.Required = "conf"
+		rkr.Add(&rk)
+	}
+	return rkr
+}
+
+func parseFile(t *testing.T, name string) *Fit {
+	b, err := ioutil.ReadFile(filepath.Join(signedDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Parse(b)
+}
+
+// generate the signed test vectors with new keys
+func generate(t *testing.T) {
+	keysDir := filepath.Join(signedDir, "keys")
+	if err := os.MkdirAll(keysDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	private, err := ioutil.TempDir("", "private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(private)
+	signers := make(map[string]crypto.Signer)
+	for _, v := range vectors {
+		var priv crypto.Signer
+		switch v.algo {
+		case "sha256,rsa2048":
+			priv, err = rsa.GenerateKey(rand.Reader, 2048)
+		case "sha384,rsa4096":
+			priv, err = rsa.GenerateKey(rand.Reader, 4096)
+		default:
+			priv, err = ecdsa.GenerateKey(elliptic.P256(),
+				rand.Reader)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers[v.key] = priv
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(private, v.key+".key"),
+			pem.EncodeToMemory(&pem.Block{
+				Type:  "PRIVATE KEY",
+				Bytes: der,
+			}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if der, err = x509.MarshalPKIXPublicKey(priv.Public()); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join("keys", v.key+".pem"),
+			pem.EncodeToMemory(&pem.Block{
+				Type:  "PUBLIC KEY",
+				Bytes: der,
+			}))
+	}
+	writeFile(t, "keys.dtb", keysDtb(signers))
+	writeFile(t, "unsigned.itb", buildFit(t, private, nil, false))
+	for _, v := range vectors {
+		b := buildFit(t, private, &SignDescription{
+			Key:     v.key,
+			Hash:    strings.Split(v.algo, ",")[0],
+			Padding: v.padding,
+		}, false)
+		writeFile(t, v.name+".itb", b)
+		if v.name == "rsa2048-sha256" {
+			b = bytes.Replace(b, []byte("signed configuration"),
+				[]byte("hacked configuration"), 1)
+			writeFile(t, "tampered.itb", b)
+		}
+	}
+	writeFile(t, "image-ecdsa256.itb", buildFit(t, private,
+		&SignDescription{Key: "dev-ecdsa256", Hash: "sha256"}, true))
+}
+
+func writeFile(t *testing.T, name string, b []byte) {
+	if err := ioutil.WriteFile(filepath.Join(signedDir, name), b,
+		0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func str(s string) []byte { return append([]byte(s), 0) }
+
+func cell(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func newNode(name string, depth int) *fdt.Node {
+	return &fdt.Node{
+		Name:       name,
+		Depth:      depth,
+		Properties: make(map[string][]byte),
+		Children:   make(map[string]*fdt.Node),
+	}
+}
+
+func keysDtb(signers map[string]crypto.Signer) []byte {
+	root := newNode("/", 1)
+	sig := newNode("signature", 2)
+	root.Children[sig.Name] = sig
+	for _, name := range []string{"dev-rsa2048", "dev-ecdsa256"} {
+		k := newNode("key-"+name, 3)
+		k.Properties["key-name-hint"] = str(name)
+		switch pub := signers[name].Public().(type) {
+		case *rsa.PublicKey:
+			e := make([]byte, 8)
+			binary.BigEndian.PutUint64(e, uint64(pub.E))
+			k.Properties["algo"] = str("sha256,rsa2048")
+			k.Properties["required"] = str("conf")
+			k.Properties["rsa,num-bits"] = cell(uint32(pub.N.BitLen()))
+			k.Properties["rsa,modulus"] = pub.N.Bytes()
+			k.Properties["rsa,exponent"] = e
+		case *ecdsa.PublicKey:
+			k.Properties["algo"] = str("sha256,ecdsa256")
+			k.Properties["ecdsa,curve"] = str("prime256v1")
+			k.Properties["ecdsa,x-point"] = pub.X.FillBytes(
+				make([]byte, 32))
+			k.Properties["ecdsa,y-point"] = pub.Y.FillBytes(
+				make([]byte, 32))
+		}
+		sig.Children[k.Name] = k
+	}
+	t := &fdt.Tree{RootNode: root}
+	return t.FlattenTreeToSlice()
+}
+
+// buildFit returns a FIT signed, if sd isn't nil, on its configuration or
+// kernel image.
+func buildFit(t *testing.T, keydir string, sd *SignDescription,
+	image bool) []byte {
+	d := &Description{
+		Description:   "test vector",
+		TimeStamp:     time.Unix(1609459200, 0),
+		DefaultConfig: "conf-1",
+	}
+	for _, x := range []struct{ name, typ string }{
+		{"kernel", "kernel"},
+		{"fdt-1", "flat_dt"},
+		{"ramdisk", "ramdisk"},
+	} {
+		d.Images = append(d.Images, &ImageDescription{
+			Name:        x.name,
+			Description: x.name,
+			Type:        x.typ,
+			Arch:        "arm",
+			Os:          "linux",
+			Compression: "none",
+			Load:        "0x80008000",
+			Data:        []byte("not really a " + x.name),
+			Hashes:      []string{"crc32", "sha256"},
+		})
+	}
+	conf := &ConfigDescription{
+		Name:        "conf-1",
+		Description: "signed configuration",
+		Kernel:      "kernel",
+		Fdt:         "fdt-1",
+		Ramdisk:     "ramdisk",
+	}
+	d.Configs = append(d.Configs, conf)
+	if image {
+		d.Images[0].Sign = sd
+	} else {
+		conf.Sign = sd
+	}
+	b, err := d.Build(keydir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,136 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package fit
+
+import (
+	"encoding/binary"
+)
+
+const (
+	fdtVersion         = 17
+	fdtLastCompVersion = 16
+	fdtHeaderSize      = 40
+	fdtRsvmapSize      = 16
+)
+
+// wnode is a node to flatten in order; unlike fdt.Tree, the order of its
+// properties and children is kept so the output is reproducible.
+type wnode struct {
+	name     string
+	props    []*wprop
+	children []*wnode
+}
+
+type wprop struct {
+	name  string
+	value []byte
+	// offset of the flattened value
+	offset int
+}
+
+func (n *wnode) child(name string) *wnode {
+	c := &wnode{name: name}
+	n.children = append(n.children, c)
+	return c
+}
+
+func (n *wnode) prop(name string, value []byte) *wprop {
+	p := &wprop{name: name, value: value}
+	n.props = append(n.props, p)
+	return p
+}
+
+func (n *wnode) str(name, value string) *wprop {
+	return n.prop(name, append([]byte(value), 0))
+}
+
+func (n *wnode) cell(name string, value uint32) *wprop {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, value)
+	return n.prop(name, b)
+}
+
+// flatten returns the device tree blob and the size of its strings block.
+// This also sets the blob offset of each property value.
+func (n *wnode) flatten() ([]byte, int) {
+	w := &writer{
+		b:       make([]byte, fdtHeaderSize+fdtRsvmapSize),
+		strings: make(map[string]int),
+	}
+	w.node(n)
+	w.tag(fdtEnd)
+	offStruct := fdtHeaderSize + fdtRsvmapSize
+	sizeStruct := len(w.b) - offStruct
+	offStrings := len(w.b)
+	w.b = append(w.b, w.s...)
+	// the value offsets are relative to the structure block
+	n.each(func(p *wprop) { p.offset += offStruct })
+	for i, v := range []uint32{
+		fdtMagic,
+		uint32(len(w.b)),
+		uint32(offStruct),
+		uint32(offStrings),
+		fdtHeaderSize,
+		fdtVersion,
+		fdtLastCompVersion,
+		0,
+		uint32(len(w.s)),
+		uint32(sizeStruct),
+	} {
+		binary.BigEndian.PutUint32(w.b[4*i:], v)
+	}
+	return w.b, len(w.s)
+}
+
+func (n *wnode) each(f func(*wprop)) {
+	for _, p := range n.props {
+		f(p)
+	}
+	for _, c := range n.children {
+		c.each(f)
+	}
+}
+
+type writer struct {
+	b, s    []byte
+	strings map[string]int
+}
+
+func (w *writer) tag(v uint32) {
+	w.b = append(w.b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(w.b[len(w.b)-4:], v)
+}
+
+func (w *writer) align() {
+	for len(w.b)%4 != 0 {
+		w.b = append(w.b, 0)
+	}
+}
+
+func (w *writer) node(n *wnode) {
+	w.tag(fdtBeginNode)
+	w.b = append(w.b, n.name...)
+	w.b = append(w.b, 0)
+	w.align()
+	for _, p := range n.props {
+		off, found := w.strings[p.name]
+		if !found {
+			off = len(w.s)
+			w.strings[p.name] = off
+			w.s = append(w.s, p.name...)
+			w.s = append(w.s, 0)
+		}
+		w.tag(fdtProp)
+		w.tag(uint32(len(p.value)))
+		w.tag(uint32(off))
+		p.offset = len(w.b) - fdtHeaderSize - fdtRsvmapSize
+		w.b = append(w.b, p.value...)
+		w.align()
+	}
+	for _, c := range n.children {
+		w.node(c)
+	}
+	w.tag(fdtEndNode)
+}
@@ -1,5 +1,5 @@
 // package kexec contains the kexec-related syscalls
-// +build !linux, linux,!amd64
+// +build !linux linux,!amd64,!arm64,!riscv64,!ppc64,!ppc64le,!s390x
 
 package kexec
 
@@ -8,7 +8,13 @@ import (
 	"syscall"
 )
 
-func fileLoadSyscall(k *os.File, i *os.File, cmdline string, flags uintptr) (err error) {
+const fileLoadDefault = false
+
+func FileLoadSyscall(k *os.File, i *os.File, cmdline string, flags uintptr) (err error) {
 	err = syscall.ENOSYS
 	return
 }
+
+func fileUnloadSyscall(flags uintptr) error {
+	return syscall.ENOSYS
+}
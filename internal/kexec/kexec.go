@@ -0,0 +1,66 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package kexec
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// kexec_load flags
+const (
+	KEXEC_ON_CRASH         = 0x00000001
+	KEXEC_PRESERVE_CONTEXT = 0x00000002
+)
+
+// kexec_file_load flags
+const (
+	KEXEC_FILE_UNLOAD       = 0x00000001
+	KEXEC_FILE_ON_CRASH     = 0x00000002
+	KEXEC_FILE_NO_INITRAMFS = 0x00000004
+)
+
+// SysKernel is the sysfs directory of kexec_loaded, kexec_crash_loaded and
+// kexec_crash_size.
+var SysKernel = "/sys/kernel"
+
+// Status of loaded kernels and the crashkernel= reservation.
+type Status struct {
+	Loaded      bool
+	CrashLoaded bool
+	CrashSize   uint64
+}
+
+// ReadStatus returns the kexec status from SysKernel.
+func ReadStatus() (*Status, error) {
+	read := func(name string) (uint64, error) {
+		b, err := ioutil.ReadFile(filepath.Join(SysKernel, name))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	}
+	st := &Status{}
+	n, err := read("kexec_loaded")
+	if err != nil {
+		return nil, err
+	}
+	st.Loaded = n != 0
+	if n, err = read("kexec_crash_loaded"); err == nil {
+		st.CrashLoaded = n != 0
+	}
+	st.CrashSize, _ = read("kexec_crash_size")
+	return st, nil
+}
+
+// segmentFlags returns the kexec_load flags of kexec_file_load flags.
+func segmentFlags(flags uintptr) uintptr {
+	if flags&KEXEC_FILE_ON_CRASH != 0 {
+		return KEXEC_ON_CRASH
+	}
+	return 0
+}
@@ -12,22 +12,33 @@ import (
 	"syscall"
 )
 
+// LoadSlices loads the kernel, initramfs and, if there's one, the device
+// tree with kexec_load. With KEXEC_ON_CRASH, these are placed in the
+// crashkernel= reservation rather than where the current kernel runs.
 func LoadSlices(kdat, idat []byte, cmdline string, flags uintptr) (err error) {
 	m, err := memmap.FileToMap("/proc/iomem")
 	if err != nil {
 		return err
 	}
 
-	kCode, ok := m["Kernel code"]
-	if !ok {
-		return fmt.Errorf("Can't find kernel code in /proc/iomem")
+	region := "Kernel code"
+	if flags&KEXEC_ON_CRASH != 0 {
+		region = "Crash kernel"
+	}
+	kCode, ok := m[region]
+	if !ok || len(kCode.Ranges) == 0 {
+		return fmt.Errorf("Can't find %s in /proc/iomem", region)
 	}
 	kBase := kCode.Ranges[0].Start
 	segments := make([]KexecSegment, 0, 3)
 
 	segments = SliceAddSegment(segments, &kdat, kBase)
 
-	segments = SliceAddSegment(segments, &idat, kBase+0x2000000)
+	initrd := -1
+	if len(idat) > 0 {
+		initrd = len(segments)
+		segments = SliceAddSegment(segments, &idat, kBase+0x2000000)
+	}
 
 	t := fdt.DefaultTree()
 	if t != nil {
@@ -37,34 +48,66 @@ func LoadSlices(kdat, idat []byte, cmdline string, flags uintptr) (err error) {
 			t.RootNode.Children["chosen"] = chosen
 		}
 		//need 64 bit support - parsing for #address-cells
-		if idat != nil {
-			chosen.Properties["linux,initrd-start"] = t.PropUint32ToSlice(uint32(segments[1].Mem))
-			chosen.Properties["linux,initrd-end"] = t.PropUint32ToSlice(uint32(segments[1].Mem) + uint32(segments[1].Bufsz) + 1)
+		if initrd >= 0 {
+			chosen.Properties["linux,initrd-start"] = t.PropUint32ToSlice(uint32(segments[initrd].Mem))
+			chosen.Properties["linux,initrd-end"] = t.PropUint32ToSlice(uint32(segments[initrd].Mem) + uint32(segments[initrd].Bufsz) + 1)
 		}
 		chosen.Properties["bootargs"] = []byte(cmdline + "\x00")
 		fdt := t.FlattenTreeToSlice()
 		segments = SliceAddSegment(segments, &fdt, kBase+0x1000000)
 	}
-	err = SegmentLoad(uint64(kBase), &segments, 0)
+	if flags&KEXEC_ON_CRASH != 0 {
+		end := kCode.Ranges[0].End
+		for _, s := range segments {
+			if s.Mem+uintptr(s.Memsz)-1 > end {
+				return fmt.Errorf("%s %x-%x: too small for %v",
+					region, kBase, end, s)
+			}
+		}
+	}
+	err = SegmentLoad(uint64(kBase), &segments, flags)
 	return err
 }
 
+// FileLoad loads the kernel and optional initramfs with kexec_file_load
+// flags, e.g. KEXEC_FILE_ON_CRASH. Except on amd64, or if the kernel
+// doesn't have kexec_file_load, this uses kexec_load.
 func FileLoad(k *os.File, i *os.File, cmdline string, flags uintptr) (err error) {
-	err = fileLoadSyscall(k, i, cmdline, flags)
-	if err == syscall.ENOSYS {
-		kdat, err := ioutil.ReadAll(k)
+	if fileLoadDefault {
+		err = FileLoadSyscall(k, i, cmdline, flags)
+		if err != syscall.ENOSYS {
+			return err
+		}
+	}
+	kdat, err := ioutil.ReadAll(k)
+	if err != nil {
+		return fmt.Errorf("Opening kernel %s: %w", k.Name(), err)
+	}
+	idat := []byte{}
+	if i != nil {
+		idat, err = ioutil.ReadAll(i)
 		if err != nil {
-			return fmt.Errorf("Opening kernel %s: %w", k.Name(), err)
+			return fmt.Errorf("Opening initramfs %s: %w",
+				i.Name(), err)
 		}
-		idat := []byte{}
-		if i != nil {
-			idat, err = ioutil.ReadAll(i)
-			if err != nil {
-				return fmt.Errorf("Opening initramfs %s: %w",
-					i.Name(), err)
-			}
+	}
+	return LoadSlices(kdat, idat, cmdline, segmentFlags(flags))
+}
+
+// Unload the kernel, or with KEXEC_ON_CRASH the crash kernel, loaded by
+// either kexec_load or kexec_file_load.
+func Unload(flags uintptr) error {
+	_, _, e := syscall.Syscall6(syscall.SYS_KEXEC_LOAD, 0, 0, 0, flags,
+		0, 0)
+	if e == syscall.ENOSYS {
+		fflags := uintptr(0)
+		if flags&KEXEC_ON_CRASH != 0 {
+			fflags = KEXEC_FILE_ON_CRASH
 		}
-		return LoadSlices(kdat, idat, cmdline, flags)
+		return fileUnloadSyscall(fflags)
 	}
-	return err
+	if e != 0 {
+		return e
+	}
+	return nil
 }
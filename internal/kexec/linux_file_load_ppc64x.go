@@ -0,0 +1,10 @@
+// package kexec contains the kexec-related syscalls
+// +build linux,ppc64 linux,ppc64le
+
+package kexec
+
+const sysKexecFileLoad = 382
+
+// FileLoad uses kexec_load, as it did before kexec_file_load was available
+// here, since the latter refuses some images, e.g. compressed, unsigned.
+const fileLoadDefault = false
@@ -0,0 +1,47 @@
+// package kexec contains the kexec-related syscalls
+// +build linux,amd64 linux,arm64 linux,riscv64 linux,ppc64 linux,ppc64le linux,s390x
+
+package kexec
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/platinasystems/goes/external/log"
+)
+
+// FileLoadSyscall loads the kernel and optional initramfs with
+// kexec_file_load, without falling back to kexec_load, so that a kernel
+// configured with KEXEC_SIG verifies the kernel's signature.
+func FileLoadSyscall(k *os.File, i *os.File, cmdline string, flags uintptr) (err error) {
+	c, err := syscall.BytePtrFromString(cmdline)
+	if err != nil {
+		return err
+	}
+	log.Printf("kexec command line", "%s", cmdline)
+	ifd := uintptr(0)
+	if i != nil {
+		ifd = i.Fd()
+	} else {
+		flags |= KEXEC_FILE_NO_INITRAMFS
+	}
+	_, _, e := syscall.Syscall6(sysKexecFileLoad,
+		k.Fd(), ifd, uintptr(len(cmdline)+1),
+		uintptr(unsafe.Pointer(c)), flags, uintptr(0))
+
+	err = nil
+	if e != 0 {
+		err = e
+	}
+	return err
+}
+
+func fileUnloadSyscall(flags uintptr) error {
+	_, _, e := syscall.Syscall6(sysKexecFileLoad, 0, 0, 0, 0,
+		flags|KEXEC_FILE_UNLOAD, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
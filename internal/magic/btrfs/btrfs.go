@@ -0,0 +1,20 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package btrfs
+
+// The primary superblock is at 64KiB.
+const (
+	SuperOff = 0x10000
+	MagicOff = SuperOff + 0x40
+	MagicVal = "_BHRfS_M"
+	UUIDOff  = SuperOff + 0x20
+	LabelOff = SuperOff + 0x12b
+	LabelLen = 256
+)
+
+func Probe(s []byte) bool {
+	return len(s) >= LabelOff+LabelLen &&
+		string(s[MagicOff:MagicOff+len(MagicVal)]) == MagicVal
+}
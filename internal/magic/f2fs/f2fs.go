@@ -0,0 +1,22 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package f2fs
+
+import "encoding/binary"
+
+const (
+	SuperOff = 0x400
+	MagicOff = SuperOff
+	MagicVal = 0xf2f52010
+	UUIDOff  = SuperOff + 0x6c
+	// LabelOff has LabelLen UTF-16LE characters.
+	LabelOff = SuperOff + 0x7c
+	LabelLen = 512
+)
+
+func Probe(s []byte) bool {
+	return len(s) >= LabelOff+2*LabelLen &&
+		binary.LittleEndian.Uint32(s[MagicOff:]) == MagicVal
+}
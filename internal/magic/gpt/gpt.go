@@ -0,0 +1,58 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+const (
+	Signature   = "EFI PART"
+	MinHeaderSz = 92
+	HeaderSzOff = 12
+	HeaderCRC   = 16
+)
+
+// SectorSizes are the logical block sizes that are probed for a header at
+// LBA 1.
+var SectorSizes = []int{512, 4096}
+
+// Header returns the header at LBA 1 of the given sniff or nil if it's
+// missing or its CRC is invalid.
+func Header(s []byte) []byte {
+	for _, sz := range SectorSizes {
+		if h := Valid(s, sz); h != nil {
+			return h
+		}
+	}
+	return nil
+}
+
+// Valid returns the header at the given offset if it has a correct
+// signature and CRC; otherwise nil.
+func Valid(s []byte, off int) []byte {
+	if len(s) < off+MinHeaderSz ||
+		!bytes.Equal(s[off:off+len(Signature)], []byte(Signature)) {
+		return nil
+	}
+	sz := int(binary.LittleEndian.Uint32(s[off+HeaderSzOff:]))
+	if sz < MinHeaderSz || sz > 512 || len(s) < off+sz {
+		return nil
+	}
+	h := make([]byte, sz)
+	copy(h, s[off:])
+	crc := binary.LittleEndian.Uint32(h[HeaderCRC:])
+	binary.LittleEndian.PutUint32(h[HeaderCRC:], 0)
+	if crc32.ChecksumIEEE(h) != crc {
+		return nil
+	}
+	return s[off : off+sz]
+}
+
+func Probe(s []byte) bool {
+	return Header(s) != nil
+}
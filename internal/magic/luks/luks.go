@@ -0,0 +1,33 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package luks
+
+import "encoding/binary"
+
+const (
+	MagicOff   = 0
+	MagicVal   = "LUKS\xba\xbe"
+	VersionOff = 6
+	// LUKS2 only
+	LabelOff = 24
+	LabelLen = 48
+	// The UUID is an ASCII string.
+	UUIDOff = 168
+	UUIDLen = 40
+)
+
+// Version returns the LUKS header version or 0 if it isn't LUKS.
+func Version(s []byte) int {
+	if len(s) < UUIDOff+UUIDLen ||
+		string(s[MagicOff:MagicOff+len(MagicVal)]) != MagicVal {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(s[VersionOff:]))
+}
+
+func Probe(s []byte) bool {
+	v := Version(s)
+	return v == 1 || v == 2
+}
@@ -5,22 +5,56 @@
 package magic
 
 import (
+	"github.com/platinasystems/goes/internal/magic/btrfs"
 	"github.com/platinasystems/goes/internal/magic/ext2"
 	"github.com/platinasystems/goes/internal/magic/ext3"
 	"github.com/platinasystems/goes/internal/magic/ext4"
+	"github.com/platinasystems/goes/internal/magic/f2fs"
+	"github.com/platinasystems/goes/internal/magic/gpt"
 	"github.com/platinasystems/goes/internal/magic/iso9660"
+	"github.com/platinasystems/goes/internal/magic/luks"
 	"github.com/platinasystems/goes/internal/magic/mbr"
+	"github.com/platinasystems/goes/internal/magic/squashfs"
+	"github.com/platinasystems/goes/internal/magic/swap"
+	"github.com/platinasystems/goes/internal/magic/ubifs"
 	"github.com/platinasystems/goes/internal/magic/vfat"
+	"github.com/platinasystems/goes/internal/magic/xfs"
 )
 
+// IdentifyPartitionMap returns "gpt" or "mbr" for a partitioned disk. The GPT
+// header is checked first since it follows a protective MBR; however, hybrid
+// ISO images have both and are mounted whole.
 func IdentifyPartitionMap(sniff []byte) string {
+	if gpt.Probe(sniff) && !iso9660.Probe(sniff) {
+		return "gpt"
+	}
 	if mbr.Probe(sniff) && IdentifyPartition(sniff) == "" {
 		return "mbr"
 	}
 	return ""
 }
 
+// IdentifyPartition returns the filesystem type as named by mount(2) or
+// "swap" or "crypto_LUKS" for those that can't be mounted.
 func IdentifyPartition(sniff []byte) string {
+	if xfs.Probe(sniff) {
+		return "xfs"
+	}
+	if squashfs.Probe(sniff) {
+		return "squashfs"
+	}
+	if ubifs.Probe(sniff) {
+		return "ubifs"
+	}
+	if luks.Probe(sniff) {
+		return "crypto_LUKS"
+	}
+	if f2fs.Probe(sniff) {
+		return "f2fs"
+	}
+	if btrfs.Probe(sniff) {
+		return "btrfs"
+	}
 	if ext2.Probe(sniff) {
 		return "ext2"
 	}
@@ -30,6 +64,9 @@ func IdentifyPartition(sniff []byte) string {
 	if ext4.Probe(sniff) {
 		return "ext4"
 	}
+	if swap.Probe(sniff) {
+		return "swap"
+	}
 	if vfat.Probe(sniff) {
 		return "vfat"
 	}
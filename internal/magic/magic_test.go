@@ -52,3 +52,35 @@ func TestMbr(t *testing.T) {
 func TestVfat(t *testing.T) {
 	testFile(t, "vfat-sb.dat", "", "vfat", "")
 }
+
+func TestGpt(t *testing.T) {
+	testFile(t, "gpt.dat", "gpt", "", "")
+}
+
+func TestXfs(t *testing.T) {
+	testFile(t, "xfs-sb.dat", "", "xfs", "")
+}
+
+func TestBtrfs(t *testing.T) {
+	testFile(t, "btrfs-sb.dat", "", "btrfs", "")
+}
+
+func TestSquashfs(t *testing.T) {
+	testFile(t, "squashfs-sb.dat", "", "squashfs", "")
+}
+
+func TestF2fs(t *testing.T) {
+	testFile(t, "f2fs-sb.dat", "", "f2fs", "")
+}
+
+func TestUbifs(t *testing.T) {
+	testFile(t, "ubifs-sb.dat", "", "ubifs", "")
+}
+
+func TestSwap(t *testing.T) {
+	testFile(t, "swap-sb.dat", "", "swap", "")
+}
+
+func TestLuks(t *testing.T) {
+	testFile(t, "luks-sb.dat", "", "crypto_LUKS", "")
+}
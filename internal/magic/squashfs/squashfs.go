@@ -0,0 +1,21 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package squashfs
+
+import "encoding/binary"
+
+const (
+	MagicOff   = 0
+	MagicVal   = "hsqs"
+	MajorOff   = 0x1c
+	MajorVal   = 4
+	SuperBlkSz = 96
+)
+
+func Probe(s []byte) bool {
+	return len(s) >= SuperBlkSz &&
+		string(s[MagicOff:MagicOff+len(MagicVal)]) == MagicVal &&
+		binary.LittleEndian.Uint16(s[MajorOff:]) == MajorVal
+}
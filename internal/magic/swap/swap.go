@@ -0,0 +1,37 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package swap
+
+// The signature is in the last 10 bytes of the first page; the version 1
+// header is after 1KiB of boot bits.
+const (
+	MagicLen = 10
+	MagicV1  = "SWAPSPACE2"
+	MagicV0  = "SWAP-SPACE"
+	UUIDOff  = 0x40c
+	LabelOff = 0x41c
+	LabelLen = 16
+)
+
+var PageSizes = []int{4096, 8192, 16384, 65536}
+
+// PageSize returns the page size of the swap signature or 0 if it isn't
+// swap space.
+func PageSize(s []byte) int {
+	for _, sz := range PageSizes {
+		if len(s) < sz {
+			break
+		}
+		switch string(s[sz-MagicLen : sz]) {
+		case MagicV1, MagicV0:
+			return sz
+		}
+	}
+	return 0
+}
+
+func Probe(s []byte) bool {
+	return PageSize(s) != 0
+}
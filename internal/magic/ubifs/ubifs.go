@@ -0,0 +1,23 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package ubifs
+
+import "encoding/binary"
+
+// The first node of a UBI volume with UBIFS is its superblock.
+const (
+	MagicOff    = 0
+	MagicVal    = 0x06101831
+	NodeTypeOff = 20
+	NodeTypeSB  = 6
+	UUIDOff     = 0x6c
+	UUIDLen     = 16
+)
+
+func Probe(s []byte) bool {
+	return len(s) >= UUIDOff+UUIDLen &&
+		binary.LittleEndian.Uint32(s[MagicOff:]) == MagicVal &&
+		s[NodeTypeOff] == NodeTypeSB
+}
@@ -0,0 +1,18 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package xfs
+
+const (
+	MagicOff = 0
+	MagicVal = "XFSB"
+	UUIDOff  = 0x20
+	LabelOff = 0x6c
+	LabelLen = 12
+)
+
+func Probe(s []byte) bool {
+	return len(s) >= LabelOff+LabelLen &&
+		string(s[MagicOff:MagicOff+len(MagicVal)]) == MagicVal
+}
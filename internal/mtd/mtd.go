@@ -0,0 +1,226 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package mtd provides the Linux Memory Technology Device ioctls of
+// /dev/mtdN character devices.
+package mtd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	MEMGETINFO     = 0x80204d01
+	MEMERASE       = 0x40084d02
+	MEMGETBADBLOCK = 0x40084d0b
+	MEMSETBADBLOCK = 0x40084d0c
+	ECCGETSTATS    = 0x80104d12
+	MTDFILEMODE    = 0x4d13
+	MEMREADOOB64   = 0xc0184d16
+	MEMWRITE       = 0xc0304d18
+)
+
+// Modes of WritePage
+const (
+	OpsPlaceOob = 0 // OOB at the given offsets
+	OpsAutoOob  = 1 // OOB in the free bytes of the ECC layout
+	OpsRaw      = 2 // data and OOB without ECC
+)
+
+// Modes of SetFileMode
+const (
+	FileModeNormal = 0
+	FileModeRaw    = 3
+)
+
+// Types of Info.Type
+const (
+	Absent       = 0
+	Ram          = 1
+	Rom          = 2
+	NorFlash     = 3
+	NandFlash    = 4
+	DataFlash    = 6
+	UbiVolume    = 7
+	MlcNandFlash = 8
+)
+
+// Info is struct mtd_info_user.
+type Info struct {
+	Type      uint8
+	Flags     uint32
+	Size      uint32
+	EraseSize uint32
+	WriteSize uint32
+	OobSize   uint32
+	_         uint64
+}
+
+// EccStats is struct mtd_ecc_stats.
+type EccStats struct {
+	Corrected uint32
+	Failed    uint32
+	BadBlocks uint32
+	BbtBlocks uint32
+}
+
+type eraseInfo struct {
+	start  uint32
+	length uint32
+}
+
+type oobBuf64 struct {
+	start  uint64
+	_      uint32
+	length uint32
+	ptr    uint64
+}
+
+type writeReq struct {
+	start   uint64
+	len     uint64
+	ooblen  uint64
+	data    uint64
+	oob     uint64
+	mode    uint8
+	padding [7]uint8
+}
+
+// Device is an open MTD character device.
+type Device struct {
+	*os.File
+	Info
+}
+
+// Open the named MTD device with os.O_RDONLY or os.O_RDWR and get its Info.
+func Open(fn string, flag int) (*Device, error) {
+	f, err := os.OpenFile(fn, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	d := &Device{File: f}
+	if err = d.ioctl(MEMGETINFO, unsafe.Pointer(&d.Info)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: MEMGETINFO: %w", fn, err)
+	}
+	return d, nil
+}
+
+// Erase the blocks of the given range.
+func (d *Device) Erase(off, size uint32) error {
+	if off%d.EraseSize != 0 || size%d.EraseSize != 0 {
+		return fmt.Errorf("%s: erase %#x+%#x: not aligned to %#x",
+			d.Name(), off, size, d.EraseSize)
+	}
+	ei := eraseInfo{off, size}
+	if err := d.ioctl(MEMERASE, unsafe.Pointer(&ei)); err != nil {
+		return fmt.Errorf("%s: erase %#x+%#x: %w", d.Name(), off, size,
+			err)
+	}
+	return nil
+}
+
+// IsNand returns true if the device has pages, OOB and bad blocks.
+func (d *Device) IsNand() bool {
+	return d.Type == NandFlash || d.Type == MlcNandFlash
+}
+
+// IsBad returns true if the erase block at off is marked bad. Devices
+// without bad blocks, i.e. NOR, are never bad.
+func (d *Device) IsBad(off int64) (bool, error) {
+	if !d.IsNand() {
+		return false, nil
+	}
+	r, _, e := syscall.Syscall(syscall.SYS_IOCTL, d.Fd(),
+		MEMGETBADBLOCK, uintptr(unsafe.Pointer(&off)))
+	if e != 0 {
+		return false, fmt.Errorf("%s: %#x: MEMGETBADBLOCK: %w",
+			d.Name(), off, e)
+	}
+	return r != 0, nil
+}
+
+// MarkBad marks the erase block at off bad.
+func (d *Device) MarkBad(off int64) error {
+	if err := d.ioctl(MEMSETBADBLOCK, unsafe.Pointer(&off)); err != nil {
+		return fmt.Errorf("%s: %#x: MEMSETBADBLOCK: %w", d.Name(), off,
+			err)
+	}
+	return nil
+}
+
+// ReadOob reads the OOB of the page at off.
+func (d *Device) ReadOob(b []byte, off int64) error {
+	if len(b) == 0 {
+		return nil
+	}
+	req := oobBuf64{
+		start:  uint64(off),
+		length: uint32(len(b)),
+		ptr:    uint64(uintptr(unsafe.Pointer(&b[0]))),
+	}
+	err := d.ioctl(MEMREADOOB64, unsafe.Pointer(&req))
+	runtime.KeepAlive(b)
+	if err != nil {
+		return fmt.Errorf("%s: %#x: MEMREADOOB64: %w", d.Name(), off,
+			err)
+	}
+	return nil
+}
+
+// WritePage writes the page and, if not empty, its OOB at off with one of
+// the Ops modes.
+func (d *Device) WritePage(off int64, data, oob []byte,
+	mode uint8) error {
+	req := writeReq{
+		start:  uint64(off),
+		len:    uint64(len(data)),
+		ooblen: uint64(len(oob)),
+		mode:   mode,
+	}
+	if len(data) > 0 {
+		req.data = uint64(uintptr(unsafe.Pointer(&data[0])))
+	}
+	if len(oob) > 0 {
+		req.oob = uint64(uintptr(unsafe.Pointer(&oob[0])))
+	}
+	err := d.ioctl(MEMWRITE, unsafe.Pointer(&req))
+	runtime.KeepAlive(data)
+	runtime.KeepAlive(oob)
+	if err != nil {
+		return fmt.Errorf("%s: %#x: MEMWRITE: %w", d.Name(), off, err)
+	}
+	return nil
+}
+
+// SetFileMode selects reads and writes with, FileModeNormal, or without,
+// FileModeRaw, ECC.
+func (d *Device) SetFileMode(mode int) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, d.Fd(), MTDFILEMODE,
+		uintptr(mode))
+	if e != 0 {
+		return fmt.Errorf("%s: MTDFILEMODE: %w", d.Name(), e)
+	}
+	return nil
+}
+
+func (d *Device) EccStats() (st EccStats, err error) {
+	if err = d.ioctl(ECCGETSTATS, unsafe.Pointer(&st)); err != nil {
+		err = fmt.Errorf("%s: ECCGETSTATS: %w", d.Name(), err)
+	}
+	return
+}
+
+func (d *Device) ioctl(req uintptr, arg unsafe.Pointer) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, d.Fd(), req,
+		uintptr(arg))
+	if e != 0 {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package mtd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// These are variables for tests.
+var (
+	SysClassMtd = "/sys/class/mtd"
+	DevDir      = "/dev"
+)
+
+// Attrs are the sysfs attributes of an MTD device.
+type Attrs struct {
+	Dev         string // e.g. mtd0
+	Name        string
+	Type        string // e.g. nand, nor, ram
+	Size        uint64
+	EraseSize   uint64
+	WriteSize   uint64
+	OobSize     uint64
+	BadBlocks   uint64
+	EccFailures uint64
+	Corrected   uint64
+}
+
+// Path returns the device file.
+func (a *Attrs) Path() string { return filepath.Join(DevDir, a.Dev) }
+
+// List returns the attributes of the MTD devices in numeric order.
+func List() ([]*Attrs, error) {
+	fis, err := ioutil.ReadDir(SysClassMtd)
+	if err != nil {
+		return nil, err
+	}
+	var l []*Attrs
+	for _, fi := range fis {
+		if unit(fi.Name()) < 0 {
+			continue
+		}
+		a, err := Read(fi.Name())
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, a)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return unit(l[i].Dev) < unit(l[j].Dev)
+	})
+	return l, nil
+}
+
+// Read returns the attributes of the named device, e.g. mtd0.
+func Read(dev string) (*Attrs, error) {
+	dir := filepath.Join(SysClassMtd, dev)
+	a := &Attrs{Dev: dev}
+	str := func(name string) string {
+		b, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		return strings.TrimSpace(string(b))
+	}
+	a.Name = str("name")
+	a.Type = str("type")
+	for _, x := range []struct {
+		name string
+		p    *uint64
+	}{
+		{"size", &a.Size},
+		{"erasesize", &a.EraseSize},
+		{"writesize", &a.WriteSize},
+		{"oobsize", &a.OobSize},
+		{"bad_blocks", &a.BadBlocks},
+		{"ecc_failures", &a.EccFailures},
+		{"corrected_bits", &a.Corrected},
+	} {
+		s := str(x.name)
+		if len(s) == 0 {
+			continue
+		}
+		u, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", dev, x.name, err)
+		}
+		*x.p = u
+	}
+	if len(a.Type) == 0 && a.Size == 0 {
+		return nil, fmt.Errorf("%s: no such device", dev)
+	}
+	return a, nil
+}
+
+// Find returns the device file of /dev/mtdN, mtdN, N or a partition name.
+func Find(s string) (string, error) {
+	if strings.HasPrefix(s, "/") {
+		return s, nil
+	}
+	if _, err := strconv.Atoi(s); err == nil {
+		s = "mtd" + s
+	}
+	if unit(s) >= 0 {
+		return filepath.Join(DevDir, s), nil
+	}
+	l, err := List()
+	if err != nil {
+		return "", err
+	}
+	for _, a := range l {
+		if a.Name == s {
+			return a.Path(), nil
+		}
+	}
+	return "", fmt.Errorf("%s: no such MTD device", s)
+}
+
+// unit returns N of mtdN or -1.
+func unit(s string) int {
+	if !strings.HasPrefix(s, "mtd") {
+		return -1
+	}
+	n, err := strconv.Atoi(s[3:])
+	if err != nil {
+		return -1
+	}
+	return n
+}
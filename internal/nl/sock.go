@@ -91,27 +91,16 @@ func NewSock(opts ...interface{}) (*Sock, error) {
 		sosndbuf = opts[5].(int)
 	}
 
-	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, proto)
+	fd, sa, gsa, err := bind(proto, groups)
 	if err != nil {
-		return nil, os.NewSyscallError("socket", err)
+		return nil, err
 	}
 	defer func() {
 		if err != nil {
 			syscall.Close(fd)
 		}
 	}()
-	sa := &syscall.SockaddrNetlink{
-		Family: syscall.AF_NETLINK,
-		Groups: groups,
-	}
-	if err = syscall.Bind(fd, sa); err != nil {
-		return nil, os.NewSyscallError("bind", err)
-	}
-	gsa, err := syscall.Getsockname(fd)
-	if err != nil {
-		return nil, os.NewSyscallError("getsockname", err)
-	}
-	PrintSockGrps(gsa.(*syscall.SockaddrNetlink).Groups)
+	PrintSockGrps(gsa.Groups)
 	if allnsid {
 		err = os.NewSyscallError("NETLINK_LISTEN_ALL_NSID",
 			syscall.SetsockoptInt(fd, SOL_NETLINK,
@@ -155,7 +144,7 @@ func NewSock(opts ...interface{}) (*Sock, error) {
 	}
 	rxch := make(chan []byte, depth)
 	sock := &Sock{
-		Pid:  gsa.(*syscall.SockaddrNetlink).Pid,
+		Pid:  gsa.Pid,
 		RxCh: rxch,
 		rxch: rxch,
 		fd:   fd,
@@ -172,6 +161,30 @@ func NewSock(opts ...interface{}) (*Sock, error) {
 	return sock, nil
 }
 
+// bind a new netlink socket to the given multicast groups and return it with
+// its local and bound addresses.
+func bind(proto int, groups uint32) (int, *syscall.SockaddrNetlink,
+	*syscall.SockaddrNetlink, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, proto)
+	if err != nil {
+		return -1, nil, nil, os.NewSyscallError("socket", err)
+	}
+	sa := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: groups,
+	}
+	if err = syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return -1, nil, nil, os.NewSyscallError("bind", err)
+	}
+	gsa, err := syscall.Getsockname(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return -1, nil, nil, os.NewSyscallError("getsockname", err)
+	}
+	return fd, sa, gsa.(*syscall.SockaddrNetlink), nil
+}
+
 type Sock struct {
 	Pid  uint32
 	RxCh <-chan []byte
@@ -0,0 +1,177 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package nl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// UEVENT_KERNEL is the multicast group of kernel object events; group 2 has
+// those relayed by udev.
+const UEVENT_KERNEL = 1
+
+// Uevent is a kernel object event, e.g.
+//
+//	add@/devices/.../block/sdb/sdb1
+//	ACTION=add
+//	DEVPATH=/devices/.../block/sdb/sdb1
+//	SUBSYSTEM=block
+//	DEVNAME=sdb1
+//	DEVTYPE=partition
+//	...
+type Uevent struct {
+	Action  string
+	DevPath string
+	Env     map[string]string
+}
+
+// ParseUevent returns the event of a kernel message.
+func ParseUevent(b []byte) (*Uevent, error) {
+	fields := bytes.Split(bytes.TrimRight(b, "\x00"), []byte{0})
+	at := bytes.IndexByte(fields[0], '@')
+	if at < 1 {
+		return nil, fmt.Errorf("%q: invalid uevent", fields[0])
+	}
+	ev := &Uevent{
+		Action:  string(fields[0][:at]),
+		DevPath: string(fields[0][at+1:]),
+		Env:     make(map[string]string),
+	}
+	for _, f := range fields[1:] {
+		if eq := bytes.IndexByte(f, '='); eq > 0 {
+			ev.Env[string(f[:eq])] = string(f[eq+1:])
+		}
+	}
+	return ev, nil
+}
+
+// Subsystem returns the SUBSYSTEM variable, e.g. "block".
+func (ev *Uevent) Subsystem() string { return ev.Env["SUBSYSTEM"] }
+
+func (ev *Uevent) String() string {
+	var b strings.Builder
+	fmt.Fprint(&b, ev.Action, "@", ev.DevPath)
+	for _, k := range []string{"SUBSYSTEM", "DEVNAME", "DEVTYPE"} {
+		if v, found := ev.Env[k]; found {
+			fmt.Fprint(&b, " ", k, "=", v)
+		}
+	}
+	return b.String()
+}
+
+// UeventSock receives kernel object events. Unlike Sock, these messages
+// don't have a netlink header so each datagram is a separate event.
+type UeventSock struct {
+	RxCh <-chan *Uevent
+	Err  error
+	fd   int
+	pr   *os.File
+	pw   *os.File
+	// quit stops a receiver blocked on a full RxCh
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewUeventSock returns a socket bound to the kernel uevent group with a
+// receive channel of the given depth.
+func NewUeventSock(depth int) (*UeventSock, error) {
+	fd, _, _, err := bind(NETLINK_KOBJECT_UEVENT, UEVENT_KERNEL)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	rxch := make(chan *Uevent, depth)
+	sock := &UeventSock{
+		RxCh: rxch,
+		fd:   fd,
+		pr:   pr,
+		pw:   pw,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go sock.gorx(rxch)
+	return sock, nil
+}
+
+func (sock *UeventSock) Close() error {
+	if sock.pw == nil {
+		return Eclosed
+	}
+	close(sock.quit)
+	sock.pw.Close()
+	sock.pw = nil
+	<-sock.done
+	return nil
+}
+
+func (sock *UeventSock) gorx(rxch chan<- *Uevent) {
+	defer close(sock.done)
+	defer close(rxch)
+	defer sock.pr.Close()
+	defer syscall.Close(sock.fd)
+
+	b := make([]byte, PAGE.Size()*2)
+	prfd := int(sock.pr.Fd())
+rx:
+	for {
+		var rfds syscall.FdSet
+		FD_ZERO(&rfds)
+		FD_SET(&rfds, sock.fd)
+		FD_SET(&rfds, prfd)
+		tv := syscall.Timeval{Sec: 10, Usec: 0}
+		n, err := syscall.Select(prfd+1, &rfds, nil, nil, &tv)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			sock.Err = err
+			break
+		}
+		if n == 0 {
+			continue
+		}
+		if FD_ISSET(&rfds, prfd) {
+			break
+		}
+		if !FD_ISSET(&rfds, sock.fd) {
+			continue
+		}
+		n, from, err := syscall.Recvfrom(sock.fd, b,
+			syscall.MSG_DONTWAIT)
+		if err == syscall.EAGAIN || err == syscall.ENOBUFS {
+			// ENOBUFS means that some events were dropped
+			continue
+		}
+		if err != nil {
+			sock.Err = err
+			break
+		}
+		// only trust the kernel
+		if sa, ok := from.(*syscall.SockaddrNetlink); !ok || sa.Pid != 0 {
+			continue
+		}
+		ev, err := ParseUevent(b[:n])
+		if err != nil {
+			continue
+		}
+		select {
+		case rxch <- ev:
+		case <-sock.quit:
+			break rx
+		}
+	}
+	if sock.Err == nil {
+		sock.Err = io.EOF
+	}
+}
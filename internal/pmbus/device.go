@@ -0,0 +1,248 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package pmbus
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/platinasystems/goes/external/i2c"
+)
+
+var ErrFormat = errors.New("unsupported format")
+var ErrNoPEC = errors.New("PEC unsupported")
+var ErrReadOnly = errors.New("read only")
+
+// Device is a PMBus slave.
+type Device struct {
+	// Bus with the device's address selected
+	Bus i2c.Device
+	// Coefficients of DIRECT format commands by code
+	Coefficients map[uint8]Coefficients
+}
+
+// SetPEC enables packet error checking of the device's transfers if the
+// bus, e.g. an *i2c.Bus, supports it.
+func (d *Device) SetPEC(on bool) error {
+	if p, ok := d.Bus.(interface{ SetPEC(bool) error }); ok {
+		return p.SetPEC(on)
+	}
+	return ErrNoPEC
+}
+
+// Raw returns the bytes of a command as transferred: one of a byte, two of
+// a little endian word, and those of a block without its length.
+func (d *Device) Raw(c *Command) ([]byte, error) {
+	var data i2c.SMBusData
+	switch c.Size {
+	case Byte:
+		err := d.Bus.Do(i2c.Read, c.Code, i2c.ByteData, &data)
+		return data[:1], err
+	case Word:
+		err := d.Bus.Do(i2c.Read, c.Code, i2c.WordData, &data)
+		return data[:2], err
+	case Block:
+		err := d.Bus.Do(i2c.Read, c.Code, i2c.BlockData, &data)
+		if err != nil {
+			return nil, err
+		}
+		n := int(data[0])
+		if n > i2c.SMBusMax {
+			return nil, fmt.Errorf("%s: block length %d", c, n)
+		}
+		return append([]byte{}, data[1:1+n]...), nil
+	}
+	return nil, fmt.Errorf("%s: send only", c)
+}
+
+// WriteRaw writes the bytes of a command as they would be read by Raw.
+// A SendByte command has none.
+func (d *Device) WriteRaw(c *Command, b []byte) error {
+	if c.RO {
+		return fmt.Errorf("%s: %w", c, ErrReadOnly)
+	}
+	var data i2c.SMBusData
+	want := map[Size]int{SendByte: 0, Byte: 1, Word: 2}
+	if n, found := want[c.Size]; found && len(b) != n {
+		return fmt.Errorf("%s: expected %d bytes", c, n)
+	}
+	switch c.Size {
+	case SendByte:
+		return d.Bus.Do(i2c.Write, c.Code, i2c.Byte, nil)
+	case Byte:
+		data[0] = b[0]
+		return d.Bus.Do(i2c.Write, c.Code, i2c.ByteData, &data)
+	case Word:
+		copy(data[:], b)
+		return d.Bus.Do(i2c.Write, c.Code, i2c.WordData, &data)
+	}
+	if len(b) > i2c.SMBusMax {
+		return fmt.Errorf("%s: block too long", c)
+	}
+	data[0] = uint8(len(b))
+	copy(data[1:], b)
+	return d.Bus.Do(i2c.Write, c.Code, i2c.BlockData, &data)
+}
+
+// Word returns the value of a word command.
+func (d *Device) Word(c *Command) (uint16, error) {
+	if c.Size != Word {
+		return 0, fmt.Errorf("%s: not a word", c)
+	}
+	b, err := d.Raw(c)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(b[1])<<8 | uint16(b[0]), nil
+}
+
+func (d *Device) VoutMode() (VoutMode, error) {
+	b, err := d.Raw(ByCode(0x20))
+	if err != nil {
+		return 0, err
+	}
+	return VoutMode(b[0]), nil
+}
+
+func (d *Device) StatusWord() (StatusWord, error) {
+	w, err := d.Word(ByCode(0x79))
+	return StatusWord(w), err
+}
+
+// Value returns the engineering units of a Linear, Vout or Direct command.
+func (d *Device) Value(c *Command) (float64, error) {
+	w, err := d.Word(c)
+	if err != nil {
+		return 0, err
+	}
+	switch c.Format {
+	case Linear:
+		return Linear11(w), nil
+	case Direct:
+		return d.direct(c).Value(w), nil
+	case Vout:
+		mode, err := d.VoutMode()
+		if err != nil {
+			return 0, err
+		}
+		switch mode.Mode() {
+		case ModeLinear:
+			return Linear16(w, mode.Exponent()), nil
+		case ModeDirect:
+			return d.direct(c).Value(w), nil
+		}
+		return 0, fmt.Errorf("%s: %s: %w", c, mode, ErrFormat)
+	}
+	return 0, fmt.Errorf("%s: %w", c, ErrFormat)
+}
+
+// SetValue writes the engineering units of a Linear, Vout or Direct
+// command.
+func (d *Device) SetValue(c *Command, v float64) error {
+	var (
+		w   uint16
+		err error
+	)
+	switch c.Format {
+	case Linear:
+		w, err = ToLinear11(v)
+	case Direct:
+		w, err = d.direct(c).Direct(v)
+	case Vout:
+		var mode VoutMode
+		if mode, err = d.VoutMode(); err != nil {
+			return err
+		}
+		switch mode.Mode() {
+		case ModeLinear:
+			w, err = ToLinear16(v, mode.Exponent())
+		case ModeDirect:
+			w, err = d.direct(c).Direct(v)
+		default:
+			err = fmt.Errorf("%s: %w", mode, ErrFormat)
+		}
+	default:
+		err = ErrFormat
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", c, err)
+	}
+	return d.WriteRaw(c, []byte{uint8(w), uint8(w >> 8)})
+}
+
+func (d *Device) direct(c *Command) Coefficients {
+	return d.Coefficients[c.Code]
+}
+
+// Get returns the formatted value of a command.
+func (d *Device) Get(c *Command) (string, error) {
+	switch c.Format {
+	case Linear, Vout, Direct:
+		v, err := d.Value(c)
+		if err != nil {
+			return "", err
+		}
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if len(c.Unit) > 0 {
+			s += " " + c.Unit
+		}
+		return s, nil
+	}
+	b, err := d.Raw(c)
+	if err != nil {
+		return "", err
+	}
+	switch c.Format {
+	case String:
+		return strconv.Quote(strings.TrimRight(string(b), "\x00 ")), nil
+	case Status:
+		w := StatusWord(uint16(b[1])<<8 | uint16(b[0]))
+		return fmt.Sprintf("%#04x %s", uint16(w), w), nil
+	case Mode:
+		return fmt.Sprintf("%#02x %s", b[0], VoutMode(b[0])), nil
+	}
+	switch c.Size {
+	case Byte:
+		return fmt.Sprintf("%#02x", b[0]), nil
+	case Word:
+		return fmt.Sprintf("%#04x", uint16(b[1])<<8|uint16(b[0])), nil
+	}
+	return fmt.Sprintf("% x", b), nil
+}
+
+// Set parses and writes the value of a command; SendByte commands have no
+// value.
+func (d *Device) Set(c *Command, s string) error {
+	switch c.Format {
+	case Linear, Vout, Direct:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %s: invalid", c, s)
+		}
+		return d.SetValue(c, v)
+	case String:
+		return d.WriteRaw(c, []byte(s))
+	}
+	switch c.Size {
+	case SendByte:
+		if len(s) > 0 {
+			return fmt.Errorf("%s: %s: unexpected", c, s)
+		}
+		return d.WriteRaw(c, nil)
+	case Block:
+		return fmt.Errorf("%s: %w", c, ErrFormat)
+	}
+	bits := 8
+	if c.Size == Word {
+		bits = 16
+	}
+	u, err := strconv.ParseUint(s, 0, bits)
+	if err != nil {
+		return fmt.Errorf("%s: %s: invalid", c, s)
+	}
+	return d.WriteRaw(c, []byte{uint8(u), uint8(u >> 8)}[:bits/8])
+}
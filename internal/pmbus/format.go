@@ -0,0 +1,97 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package pmbus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrRange = errors.New("out of range")
+
+// Linear11 returns the value of a 5-bit signed exponent and 11-bit signed
+// mantissa.
+func Linear11(w uint16) float64 {
+	exp := int(int16(w) >> 11)
+	mant := int(int16(w<<5) >> 5)
+	return math.Ldexp(float64(mant), exp)
+}
+
+// ToLinear11 returns the most precise LINEAR11 encoding of the value.
+func ToLinear11(v float64) (uint16, error) {
+	for exp := -16; exp <= 15; exp++ {
+		mant := math.Round(math.Ldexp(v, -exp))
+		if mant >= -1024 && mant <= 1023 {
+			return uint16(exp)<<11 | uint16(int16(mant))&0x7ff, nil
+		}
+	}
+	return 0, fmt.Errorf("%g: %w", v, ErrRange)
+}
+
+// Linear16 returns the value of an unsigned mantissa with the exponent of
+// VOUT_MODE.
+func Linear16(w uint16, exp int) float64 {
+	return math.Ldexp(float64(w), exp)
+}
+
+func ToLinear16(v float64, exp int) (uint16, error) {
+	mant := math.Round(math.Ldexp(v, -exp))
+	if mant < 0 || mant > math.MaxUint16 {
+		return 0, fmt.Errorf("%g: %w", v, ErrRange)
+	}
+	return uint16(mant), nil
+}
+
+// Coefficients of the DIRECT format, X = (Y * 10^-R - B) / M, are those
+// of the device datasheet or COEFFICIENTS command.
+type Coefficients struct {
+	M, B, R int
+}
+
+func (c Coefficients) Value(w uint16) float64 {
+	if c.M == 0 {
+		return math.NaN()
+	}
+	y := float64(int16(w))
+	return (y*math.Pow10(-c.R) - float64(c.B)) / float64(c.M)
+}
+
+// Direct returns the DIRECT encoding of Y = (M * X + B) * 10^R.
+func (c Coefficients) Direct(v float64) (uint16, error) {
+	y := math.Round((float64(c.M)*v + float64(c.B)) * math.Pow10(c.R))
+	if c.M == 0 || y < math.MinInt16 || y > math.MaxInt16 {
+		return 0, fmt.Errorf("%g: %w", v, ErrRange)
+	}
+	return uint16(int16(y)), nil
+}
+
+// VoutMode is the data format of output voltages.
+type VoutMode uint8
+
+// VoutMode modes
+const (
+	ModeLinear = iota
+	ModeVID
+	ModeDirect
+	ModeIEEE
+)
+
+func (m VoutMode) Mode() int { return int(m >> 5) }
+
+// Exponent of ModeLinear, or VID code type of ModeVID.
+func (m VoutMode) Exponent() int { return int(int8(m<<3) >> 3) }
+
+func (m VoutMode) String() string {
+	switch m.Mode() {
+	case ModeLinear:
+		return fmt.Sprint("linear 2^", m.Exponent())
+	case ModeVID:
+		return fmt.Sprint("vid ", m&0x1f)
+	case ModeDirect:
+		return "direct"
+	}
+	return fmt.Sprintf("%#x", uint8(m))
+}
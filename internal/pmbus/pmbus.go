@@ -0,0 +1,145 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package pmbus reads and writes the commands of PMBus power supplies and
+// regulators through the SMBus transfers of external/i2c.
+package pmbus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Size of a command's transfer.
+type Size int
+
+const (
+	SendByte Size = iota
+	Byte
+	Word
+	Block
+)
+
+// Format of a command's data.
+type Format int
+
+const (
+	Raw    Format = iota
+	Linear        // LINEAR11
+	Vout          // LINEAR16 or DIRECT per VOUT_MODE
+	Direct        // with the device's Coefficients
+	String        // ASCII block
+	Status        // STATUS_WORD
+	Mode          // VOUT_MODE
+)
+
+// Command describes a PMBus command code.
+type Command struct {
+	Name   string
+	Code   uint8
+	Size   Size
+	Format Format
+	Unit   string
+	RO     bool
+}
+
+// Commands are those of PMBus 1.2 part II that are common to PSUs.
+var Commands = []Command{
+	{"PAGE", 0x00, Byte, Raw, "", false},
+	{"OPERATION", 0x01, Byte, Raw, "", false},
+	{"ON_OFF_CONFIG", 0x02, Byte, Raw, "", false},
+	{"CLEAR_FAULTS", 0x03, SendByte, Raw, "", false},
+	{"WRITE_PROTECT", 0x10, Byte, Raw, "", false},
+	{"STORE_DEFAULT_ALL", 0x11, SendByte, Raw, "", false},
+	{"RESTORE_DEFAULT_ALL", 0x12, SendByte, Raw, "", false},
+	{"CAPABILITY", 0x19, Byte, Raw, "", true},
+	{"VOUT_MODE", 0x20, Byte, Mode, "", true},
+	{"VOUT_COMMAND", 0x21, Word, Vout, "V", false},
+	{"VOUT_MAX", 0x24, Word, Vout, "V", false},
+	{"VOUT_MARGIN_HIGH", 0x25, Word, Vout, "V", false},
+	{"VOUT_MARGIN_LOW", 0x26, Word, Vout, "V", false},
+	{"FAN_CONFIG_1_2", 0x3a, Byte, Raw, "", false},
+	{"FAN_COMMAND_1", 0x3b, Word, Linear, "", false},
+	{"FAN_COMMAND_2", 0x3c, Word, Linear, "", false},
+	{"VOUT_OV_FAULT_LIMIT", 0x40, Word, Vout, "V", false},
+	{"VOUT_OV_WARN_LIMIT", 0x42, Word, Vout, "V", false},
+	{"VOUT_UV_WARN_LIMIT", 0x43, Word, Vout, "V", false},
+	{"VOUT_UV_FAULT_LIMIT", 0x44, Word, Vout, "V", false},
+	{"IOUT_OC_FAULT_LIMIT", 0x46, Word, Linear, "A", false},
+	{"IOUT_OC_WARN_LIMIT", 0x4a, Word, Linear, "A", false},
+	{"OT_FAULT_LIMIT", 0x4f, Word, Linear, "C", false},
+	{"OT_WARN_LIMIT", 0x51, Word, Linear, "C", false},
+	{"VIN_OV_FAULT_LIMIT", 0x55, Word, Linear, "V", false},
+	{"VIN_OV_WARN_LIMIT", 0x57, Word, Linear, "V", false},
+	{"VIN_UV_WARN_LIMIT", 0x58, Word, Linear, "V", false},
+	{"VIN_UV_FAULT_LIMIT", 0x59, Word, Linear, "V", false},
+	{"IIN_OC_WARN_LIMIT", 0x5d, Word, Linear, "A", false},
+	{"POUT_OP_WARN_LIMIT", 0x6a, Word, Linear, "W", false},
+	{"PIN_OP_WARN_LIMIT", 0x6b, Word, Linear, "W", false},
+	{"STATUS_BYTE", 0x78, Byte, Raw, "", false},
+	{"STATUS_WORD", 0x79, Word, Status, "", false},
+	{"STATUS_VOUT", 0x7a, Byte, Raw, "", false},
+	{"STATUS_IOUT", 0x7b, Byte, Raw, "", false},
+	{"STATUS_INPUT", 0x7c, Byte, Raw, "", false},
+	{"STATUS_TEMPERATURE", 0x7d, Byte, Raw, "", false},
+	{"STATUS_CML", 0x7e, Byte, Raw, "", false},
+	{"STATUS_OTHER", 0x7f, Byte, Raw, "", false},
+	{"STATUS_MFR_SPECIFIC", 0x80, Byte, Raw, "", false},
+	{"STATUS_FANS_1_2", 0x81, Byte, Raw, "", false},
+	{"READ_VIN", 0x88, Word, Linear, "V", true},
+	{"READ_IIN", 0x89, Word, Linear, "A", true},
+	{"READ_VCAP", 0x8a, Word, Linear, "V", true},
+	{"READ_VOUT", 0x8b, Word, Vout, "V", true},
+	{"READ_IOUT", 0x8c, Word, Linear, "A", true},
+	{"READ_TEMPERATURE_1", 0x8d, Word, Linear, "C", true},
+	{"READ_TEMPERATURE_2", 0x8e, Word, Linear, "C", true},
+	{"READ_TEMPERATURE_3", 0x8f, Word, Linear, "C", true},
+	{"READ_FAN_SPEED_1", 0x90, Word, Linear, "RPM", true},
+	{"READ_FAN_SPEED_2", 0x91, Word, Linear, "RPM", true},
+	{"READ_DUTY_CYCLE", 0x94, Word, Linear, "%", true},
+	{"READ_FREQUENCY", 0x95, Word, Linear, "kHz", true},
+	{"READ_POUT", 0x96, Word, Linear, "W", true},
+	{"READ_PIN", 0x97, Word, Linear, "W", true},
+	{"PMBUS_REVISION", 0x98, Byte, Raw, "", true},
+	{"MFR_ID", 0x99, Block, String, "", false},
+	{"MFR_MODEL", 0x9a, Block, String, "", false},
+	{"MFR_REVISION", 0x9b, Block, String, "", false},
+	{"MFR_LOCATION", 0x9c, Block, String, "", false},
+	{"MFR_DATE", 0x9d, Block, String, "", false},
+	{"MFR_SERIAL", 0x9e, Block, String, "", false},
+}
+
+// Lookup a command by name, case insensitive, or code.
+func Lookup(s string) (*Command, error) {
+	for i := range Commands {
+		if strings.EqualFold(s, Commands[i].Name) {
+			return &Commands[i], nil
+		}
+	}
+	if code, err := strconv.ParseUint(s, 0, 8); err == nil {
+		if c := ByCode(uint8(code)); c != nil {
+			return c, nil
+		}
+		// undocumented, e.g. MFR_SPECIFIC
+		return &Command{
+			Name: fmt.Sprintf("%#02x", code),
+			Code: uint8(code),
+			Size: Word,
+		}, nil
+	}
+	return nil, fmt.Errorf("%s: unknown command", s)
+}
+
+// ByCode returns the command of the code or nil.
+func ByCode(code uint8) *Command {
+	for i := range Commands {
+		if Commands[i].Code == code {
+			return &Commands[i]
+		}
+	}
+	return nil
+}
+
+func (c *Command) String() string { return c.Name }
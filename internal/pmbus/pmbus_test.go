@@ -0,0 +1,176 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package pmbus
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/platinasystems/goes/external/i2c"
+)
+
+// loadImage returns the recorded register image of a device.
+func loadImage(t *testing.T, fn string) i2c.Image {
+	f, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img := make(i2c.Image)
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		s := scan.Text()
+		if len(s) == 0 || s[0] == '#' {
+			continue
+		}
+		var code uint8
+		var b []byte
+		colon := strings.IndexByte(s, ':')
+		_, err := fmt.Sscan(s[:colon], &code)
+		for _, f := range strings.Fields(s[colon+1:]) {
+			var u uint64
+			if u, err = strconv.ParseUint(f, 16, 8); err != nil {
+				break
+			}
+			b = append(b, uint8(u))
+		}
+		if err != nil {
+			t.Fatal(s, err)
+		}
+		img[code] = b
+	}
+	return img
+}
+
+func testDevice(t *testing.T) (*Device, *i2c.Mock, i2c.Image) {
+	img := loadImage(t, "testdata/psu.txt")
+	m := &i2c.Mock{Slaves: map[int]i2c.MockSlave{0x58: img}}
+	m.ForceSlaveAddress(0x58)
+	return &Device{Bus: m}, m, img
+}
+
+func TestFormats(t *testing.T) {
+	for _, x := range []struct {
+		w uint16
+		v float64
+	}{
+		{0xf8e6, 115},
+		{0xd280, 10},
+		{0xe260, 38},
+		{0x0014, 20},
+		{0x1bb8, 7616},
+		{0xb7ff, -0.0009765625},
+	} {
+		if v := Linear11(x.w); v != x.v {
+			t.Errorf("Linear11(%#x): got %g, want %g", x.w, v, x.v)
+		}
+		w, err := ToLinear11(x.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := Linear11(w); v != x.v {
+			t.Errorf("ToLinear11(%g): %#x is %g", x.v, w, v)
+		}
+	}
+	if _, err := ToLinear11(1e12); err == nil {
+		t.Error("expected range error")
+	}
+	mode := VoutMode(0x17)
+	if mode.Mode() != ModeLinear || mode.Exponent() != -9 {
+		t.Error(mode)
+	}
+	if v := Linear16(0x1802, mode.Exponent()); v != 12.00390625 {
+		t.Error("Linear16:", v)
+	}
+	if w, _ := ToLinear16(12, -9); w != 0x1800 {
+		t.Errorf("ToLinear16: %#x", w)
+	}
+	// e.g. a 0.01 resolution with m=1, b=0, R=2
+	c := Coefficients{M: 1, B: 0, R: 2}
+	w, err := c.Direct(12.34)
+	if err != nil || w != 1234 {
+		t.Fatal("Direct:", w, err)
+	}
+	if v := c.Value(w); math.Abs(v-12.34) > 1e-9 {
+		t.Error("Value:", v)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	w := StatusPowerGoodN | StatusTemperature | StatusOff
+	if s := w.String(); s != "temperature, off, power good#" {
+		t.Error(s)
+	}
+	if s := StatusWord(0).String(); s != "ok" {
+		t.Error(s)
+	}
+}
+
+func TestDevice(t *testing.T) {
+	d, m, img := testDevice(t)
+	for name, want := range map[string]string{
+		"READ_VIN":           "115 V",
+		"READ_VOUT":          "12.00390625 V",
+		"READ_IOUT":          "38 A",
+		"READ_TEMPERATURE_1": "43 C",
+		"READ_FAN_SPEED_1":   "7616 RPM",
+		"READ_POUT":          "287 W",
+		"VOUT_MODE":          "0x17 linear 2^-9",
+		"STATUS_WORD":        "0x0800 power good#",
+		"MFR_ID":             `"ACME"`,
+		"MFR_MODEL":          `"PSU-550W"`,
+		"MFR_SERIAL":         `"SN123456"`,
+		"OPERATION":          "0x80",
+		"0x79":               "0x0800 power good#",
+	} {
+		c, err := Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := d.Get(c)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if s != want {
+			t.Errorf("%s: got %q, want %q", name, s, want)
+		}
+	}
+	if _, err := d.Get(ByCode(0x9c)); err == nil {
+		t.Error("MFR_LOCATION: expected NAK")
+	}
+
+	c, _ := Lookup("vout_command")
+	if err := d.Set(c, "11.5"); err != nil {
+		t.Fatal(err)
+	}
+	if b := img[0x21]; len(b) != 2 || b[0] != 0x00 || b[1] != 0x17 {
+		t.Errorf("VOUT_COMMAND: % x", b)
+	}
+	c, _ = Lookup("ot_warn_limit")
+	if err := d.Set(c, "105"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := d.Value(c); v != 105 {
+		t.Error("OT_WARN_LIMIT:", v)
+	}
+	c, _ = Lookup("read_vout")
+	if err := d.Set(c, "1"); err == nil {
+		t.Error("READ_VOUT: expected read only")
+	}
+	c, _ = Lookup("clear_faults")
+	if err := d.Set(c, ""); err != nil {
+		t.Error("CLEAR_FAULTS:", err)
+	}
+	if img[0][0] != 0x03 {
+		t.Error("CLEAR_FAULTS not sent")
+	}
+	if err := d.SetPEC(true); err != nil || !m.PEC {
+		t.Error("PEC:", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package pmbus
+
+import "strings"
+
+// StatusWord summarizes the faults and warnings of a device; the low byte
+// is STATUS_BYTE.
+type StatusWord uint16
+
+// StatusWord bits
+const (
+	StatusNoneOfTheAbove StatusWord = 1 << iota
+	StatusCML
+	StatusTemperature
+	StatusVinUV
+	StatusIoutOC
+	StatusVoutOV
+	StatusOff
+	StatusBusy
+	StatusUnknown
+	StatusOther
+	StatusFans
+	StatusPowerGoodN
+	StatusMfr
+	StatusInput
+	StatusIoutPout
+	StatusVout
+)
+
+var statusNames = []string{
+	"none of the above",
+	"cml",
+	"temperature",
+	"vin uv",
+	"iout oc",
+	"vout ov",
+	"off",
+	"busy",
+	"unknown",
+	"other",
+	"fans",
+	"power good#",
+	"mfr",
+	"input",
+	"iout/pout",
+	"vout",
+}
+
+// Names of the set bits.
+func (w StatusWord) Names() []string {
+	var l []string
+	for i, name := range statusNames {
+		if w&(1<<uint(i)) != 0 {
+			l = append(l, name)
+		}
+	}
+	return l
+}
+
+func (w StatusWord) String() string {
+	if w == 0 {
+		return "ok"
+	}
+	return strings.Join(w.Names(), ", ")
+}
+
+// Status commands of the StatusWord bits that summarize them.
+var StatusDetail = map[StatusWord]string{
+	StatusVout:        "STATUS_VOUT",
+	StatusIoutPout:    "STATUS_IOUT",
+	StatusInput:       "STATUS_INPUT",
+	StatusTemperature: "STATUS_TEMPERATURE",
+	StatusCML:         "STATUS_CML",
+	StatusOther:       "STATUS_OTHER",
+	StatusMfr:         "STATUS_MFR_SPECIFIC",
+	StatusFans:        "STATUS_FANS_1_2",
+}
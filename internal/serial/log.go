@@ -0,0 +1,47 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package serial
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+const LogTimeFormat = "2006-01-02 15:04:05.000 "
+
+// Log writes session output with each line prefixed by the time of its
+// first byte; carriage returns are dropped.
+type Log struct {
+	w   io.Writer
+	mid bool
+	// Now is replaced by tests
+	Now func() time.Time
+}
+
+func NewLog(w io.Writer) *Log {
+	return &Log{w: w, Now: time.Now}
+}
+
+func (l *Log) Write(b []byte) (int, error) {
+	var buf bytes.Buffer
+	for _, c := range b {
+		if c == '\r' {
+			continue
+		}
+		if !l.mid {
+			buf.WriteString(l.Now().Format(LogTimeFormat))
+			l.mid = true
+		}
+		buf.WriteByte(c)
+		if c == '\n' {
+			l.mid = false
+		}
+	}
+	if _, err := l.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,452 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SOH = 0x01
+	STX = 0x02
+	EOT = 0x04
+	ACK = 0x06
+	NAK = 0x15
+	CAN = 0x18
+	SUB = 0x1a
+	CRC = 'C'
+)
+
+var (
+	ErrCanceled = errors.New("canceled")
+	ErrRetries  = errors.New("too many retries")
+	ErrSync     = errors.New("lost block sync")
+)
+
+var (
+	errBad = errors.New("bad block")
+	errEOT = errors.New("EOT")
+)
+
+// Conn is a Port, or a net.Conn of tests, with read deadlines.
+type Conn interface {
+	io.ReadWriter
+	SetReadDeadline(time.Time) error
+}
+
+// Modem transfers files with XMODEM-CRC or -1K, and YMODEM batches, as do
+// lrzsz and u-boot's loadx and loady.
+type Modem struct {
+	Conn Conn
+	// Timeout of each response, default: 3s
+	Timeout time.Duration
+	// Retries of each block, or to start, default: 10
+	Retries int
+	// Progress, if set, is called with the bytes transferred after each
+	// block.
+	Progress func(int64)
+}
+
+func (m *Modem) timeout() time.Duration {
+	if m.Timeout > 0 {
+		return m.Timeout
+	}
+	return 3 * time.Second
+}
+
+func (m *Modem) retries() int {
+	if m.Retries > 0 {
+		return m.Retries
+	}
+	return 10
+}
+
+func (m *Modem) read(b []byte) error {
+	err := m.Conn.SetReadDeadline(time.Now().Add(m.timeout()))
+	if err == nil {
+		_, err = io.ReadFull(m.Conn, b)
+	}
+	return err
+}
+
+func (m *Modem) readByte() (byte, error) {
+	var b [1]byte
+	err := m.read(b[:])
+	return b[0], err
+}
+
+func (m *Modem) write(b ...byte) error {
+	_, err := m.Conn.Write(b)
+	return err
+}
+
+// cancel the transfer with more than the two CAN that receivers require.
+func (m *Modem) cancel() {
+	m.write(CAN, CAN, CAN)
+}
+
+// purge input until it's quiet
+func (m *Modem) purge() {
+	b := make([]byte, 1024)
+	for {
+		m.Conn.SetReadDeadline(time.Now().Add(m.timeout() / 10))
+		if _, err := m.Conn.Read(b); err != nil {
+			return
+		}
+	}
+}
+
+func (m *Modem) progress(n int64) {
+	if m.Progress != nil {
+		m.Progress(n)
+	}
+}
+
+// SendXmodem with 1K blocks, if the receiver requests CRC, until EOF.
+func (m *Modem) SendXmodem(r io.Reader) error {
+	crc, err := m.start()
+	if err != nil {
+		return err
+	}
+	_, err = m.sendData(r, crc)
+	return err
+}
+
+// SendYmodem the named file as a batch of one.
+func (m *Modem) SendYmodem(name string, size int64, r io.Reader) error {
+	crc, err := m.start()
+	if err == nil && !crc {
+		err = fmt.Errorf("YMODEM receiver without CRC")
+	}
+	if err != nil {
+		return err
+	}
+	hdr := []byte(filepath.Base(name) + "\x00" +
+		strconv.FormatInt(size, 10))
+	if len(hdr) >= 1024 {
+		return fmt.Errorf("%s: name too long", name)
+	}
+	blk := make([]byte, 128)
+	if len(hdr) >= len(blk) {
+		blk = make([]byte, 1024)
+	}
+	copy(blk, hdr)
+	if err = m.sendBlock(0, blk, true); err != nil {
+		return err
+	}
+	if _, err = m.start(); err != nil {
+		return err
+	}
+	if _, err = m.sendData(r, true); err != nil {
+		return err
+	}
+	// end the batch with an empty header
+	if _, err = m.start(); err != nil {
+		return err
+	}
+	return m.sendBlock(0, make([]byte, 128), true)
+}
+
+// start waits for the receiver's C, or NAK of checksum mode, ignoring
+// other output, e.g. u-boot's "## Ready for binary...".
+func (m *Modem) start() (crc bool, err error) {
+	for timeouts := 0; timeouts < m.retries(); {
+		b, err := m.readByte()
+		switch {
+		case os.IsTimeout(err):
+			timeouts++
+		case err != nil:
+			return false, err
+		case b == CRC:
+			return true, nil
+		case b == NAK:
+			return false, nil
+		case b == CAN:
+			if b, err = m.readByte(); err == nil && b == CAN {
+				return false, ErrCanceled
+			}
+		}
+	}
+	return false, ErrRetries
+}
+
+// sendData in numbered blocks from 1 then EOT. Blocks are of 1K with CRC;
+// otherwise, and of the last 128 bytes, they're of 128 padded with SUB.
+func (m *Modem) sendData(r io.Reader, crc bool) (int64, error) {
+	var total int64
+	buf := make([]byte, 1024)
+	if !crc {
+		buf = buf[:128]
+	}
+	for num := byte(1); ; num++ {
+		n, err := io.ReadFull(r, buf)
+		if n == 0 {
+			if err == io.EOF {
+				break
+			}
+			return total, err
+		}
+		blk := buf
+		if n <= 128 {
+			blk = buf[:128]
+		}
+		for i := n; i < len(blk); i++ {
+			blk[i] = SUB
+		}
+		if err := m.sendBlock(num, blk, crc); err != nil {
+			return total, err
+		}
+		total += int64(n)
+		m.progress(total)
+		if err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil && err != io.EOF {
+			m.cancel()
+			return total, err
+		}
+	}
+	for i := 0; i < m.retries(); i++ {
+		if err := m.write(EOT); err != nil {
+			return total, err
+		}
+		b, err := m.readByte()
+		if err == nil && b == ACK {
+			return total, nil
+		}
+		if err != nil && !os.IsTimeout(err) {
+			return total, err
+		}
+	}
+	return total, ErrRetries
+}
+
+func (m *Modem) sendBlock(num byte, data []byte, crc bool) error {
+	hdr := byte(SOH)
+	if len(data) == 1024 {
+		hdr = STX
+	}
+	blk := make([]byte, 0, 3+len(data)+2)
+	blk = append(blk, hdr, num, ^num)
+	blk = append(blk, data...)
+	if crc {
+		sum := crc16(data)
+		blk = append(blk, byte(sum>>8), byte(sum))
+	} else {
+		blk = append(blk, checksum(data))
+	}
+	for i := 0; i < m.retries(); i++ {
+		if _, err := m.Conn.Write(blk); err != nil {
+			return err
+		}
+		b, err := m.readByte()
+		switch {
+		case err == nil && b == ACK:
+			return nil
+		case err == nil && b == CAN:
+			if b, err = m.readByte(); err == nil && b == CAN {
+				return ErrCanceled
+			}
+		case err != nil && !os.IsTimeout(err):
+			return err
+		}
+	}
+	m.cancel()
+	return ErrRetries
+}
+
+// ReceiveXmodem until EOT. The last block's SUB padding remains.
+func (m *Modem) ReceiveXmodem(w io.Writer) (int64, error) {
+	return m.receiveData(w, -1)
+}
+
+// ReceiveYmodem files, each to that of create, until the batch ends.
+func (m *Modem) ReceiveYmodem(create func(name string,
+	size int64) (io.WriteCloser, error)) error {
+	for {
+		name, size, err := m.receiveHeader()
+		if err != nil {
+			return err
+		}
+		if len(name) == 0 {
+			return m.write(ACK)
+		}
+		wc, err := create(name, size)
+		if err != nil {
+			m.cancel()
+			return err
+		}
+		if err = m.write(ACK); err == nil {
+			_, err = m.receiveData(wc, size)
+		}
+		if cerr := wc.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// receiveHeader returns the name and size, or -1 if unknown, of block 0.
+func (m *Modem) receiveHeader() (string, int64, error) {
+	for errs := 0; errs < m.retries(); errs++ {
+		if err := m.write(CRC); err != nil {
+			return "", 0, err
+		}
+		num, data, err := m.receiveBlock()
+		if err == errBad || os.IsTimeout(err) {
+			m.purge()
+			continue
+		}
+		if err == errEOT {
+			// of a previous file whose ACK was lost
+			m.write(ACK)
+			continue
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		if num != 0 {
+			m.cancel()
+			return "", 0, ErrSync
+		}
+		i := strings.IndexByte(string(data), 0)
+		if i < 0 {
+			m.cancel()
+			return "", 0, fmt.Errorf("header: missing name")
+		}
+		name := string(data[:i])
+		fields := strings.Fields(strings.TrimRight(string(data[i+1:]),
+			"\x00"))
+		size := int64(-1)
+		if len(fields) > 0 {
+			if n, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+				size = n
+			}
+		}
+		return name, size, nil
+	}
+	m.cancel()
+	return "", 0, ErrRetries
+}
+
+// receiveData of blocks from 1 through EOT, truncating at size if not
+// negative.
+func (m *Modem) receiveData(w io.Writer, size int64) (int64, error) {
+	var total int64
+	expect := byte(1)
+	reply := byte(CRC)
+	for errs := 0; ; {
+		if err := m.write(reply); err != nil {
+			return total, err
+		}
+		num, data, err := m.receiveBlock()
+		switch {
+		case err == errEOT:
+			return total, m.write(ACK)
+		case err == errBad || os.IsTimeout(err):
+			if errs++; errs >= m.retries() {
+				m.cancel()
+				return total, ErrRetries
+			}
+			m.purge()
+			if reply != CRC {
+				reply = NAK
+			}
+			continue
+		case err != nil:
+			return total, err
+		case num == expect-1:
+			// a retry of that whose ACK was lost
+			reply = ACK
+			continue
+		case num != expect:
+			m.cancel()
+			return total, ErrSync
+		}
+		errs = 0
+		if size >= 0 && total+int64(len(data)) > size {
+			data = data[:size-total]
+		}
+		if _, err = w.Write(data); err != nil {
+			m.cancel()
+			return total, err
+		}
+		total += int64(len(data))
+		m.progress(total)
+		expect++
+		reply = ACK
+	}
+}
+
+// receiveBlock returns the number and data of the next block, errEOT, or
+// errBad of a corrupt block; the receiver always requests CRC.
+func (m *Modem) receiveBlock() (byte, []byte, error) {
+	var size int
+	for size == 0 {
+		b, err := m.readByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch b {
+		case SOH:
+			size = 128
+		case STX:
+			size = 1024
+		case EOT:
+			return 0, nil, errEOT
+		case CAN:
+			if b, err = m.readByte(); err == nil && b == CAN {
+				return 0, nil, ErrCanceled
+			}
+		}
+	}
+	blk := make([]byte, 2+size+2)
+	if err := m.read(blk); os.IsTimeout(err) {
+		return 0, nil, errBad
+	} else if err != nil {
+		return 0, nil, err
+	}
+	num, data := blk[0], blk[2:2+size]
+	if blk[1] != ^num {
+		return 0, nil, errBad
+	}
+	sum := uint16(blk[len(blk)-2])<<8 | uint16(blk[len(blk)-1])
+	if sum != crc16(data) {
+		return 0, nil, errBad
+	}
+	return num, data, nil
+}
+
+// crc16 is CRC-16/XMODEM
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func checksum(b []byte) byte {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return sum
+}
@@ -0,0 +1,129 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package serial
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// corrupt flips a bit of the nth write
+type corrupt struct {
+	net.Conn
+	n int
+}
+
+func (c *corrupt) Write(b []byte) (int, error) {
+	if c.n--; c.n == 0 {
+		b = append([]byte(nil), b...)
+		b[len(b)/2] ^= 0x10
+	}
+	return c.Conn.Write(b)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func testData(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func TestCrc16(t *testing.T) {
+	if x := crc16([]byte("123456789")); x != 0x31c3 {
+		t.Errorf("%#x", x)
+	}
+}
+
+func TestXmodem(t *testing.T) {
+	for _, n := range []int{0, 100, 128, 1024, 1100, 3000} {
+		for _, bad := range []int{0, 3} {
+			data := testData(n)
+			a, b := net.Pipe()
+			tx := &Modem{
+				Conn:    &corrupt{a, bad},
+				Timeout: 100 * time.Millisecond,
+			}
+			rx := &Modem{Conn: b, Timeout: 100 * time.Millisecond}
+			errs := make(chan error, 1)
+			go func() {
+				errs <- tx.SendXmodem(bytes.NewReader(data))
+			}()
+			var buf bytes.Buffer
+			_, err := rx.ReceiveXmodem(&buf)
+			if err != nil {
+				t.Fatal(n, bad, err)
+			}
+			if err = <-errs; err != nil {
+				t.Fatal(n, bad, err)
+			}
+			a.Close()
+			b.Close()
+			got := buf.Bytes()
+			if len(got) < n || !bytes.Equal(got[:n], data) {
+				t.Errorf("%d, %d: mismatch", n, bad)
+			}
+			for _, c := range got[n:] {
+				if c != SUB {
+					t.Errorf("%d, %d: padding %#x", n, bad, c)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestYmodem(t *testing.T) {
+	for _, n := range []int{0, 1, 1024, 5000} {
+		data := testData(n)
+		a, b := net.Pipe()
+		tx := &Modem{Conn: &corrupt{a, 4}, Timeout: 100 * time.Millisecond}
+		rx := &Modem{Conn: b, Timeout: 100 * time.Millisecond}
+		errs := make(chan error, 1)
+		go func() {
+			errs <- tx.SendYmodem("/tmp/test.bin", int64(n),
+				bytes.NewReader(data))
+		}()
+		var buf bytes.Buffer
+		var name string
+		var size int64
+		err := rx.ReceiveYmodem(func(s string, sz int64) (io.WriteCloser,
+			error) {
+			name, size = s, sz
+			return nopCloser{&buf}, nil
+		})
+		if err != nil {
+			t.Fatal(n, err)
+		}
+		if err = <-errs; err != nil {
+			t.Fatal(n, err)
+		}
+		a.Close()
+		b.Close()
+		if name != "test.bin" || size != int64(n) {
+			t.Errorf("%d: %q %d", n, name, size)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("%d: mismatch", n)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	tx := &Modem{Conn: a, Timeout: 100 * time.Millisecond}
+	go b.Write([]byte{CAN, CAN})
+	if err := tx.SendXmodem(bytes.NewReader(nil)); err != ErrCanceled {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package serial
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxExpect is the most unmatched input retained by Expect.
+const maxExpect = 64 << 10
+
+// Script runs expect-style lines of:
+//
+//	timeout DURATION
+//	expect REGEXP
+//	send TEXT
+//	sendline TEXT
+//	sleep DURATION
+//	break
+//
+// REGEXP and TEXT may be Go quoted strings, e.g. "\x03". Sendline appends
+// a carriage return. Lines beginning with '#' are comments.
+type Script struct {
+	Conn Conn
+	// Output, if set, receives all that's read from Conn.
+	Output io.Writer
+	// Timeout of each expect, default: 10s
+	Timeout time.Duration
+
+	buf []byte
+}
+
+func (s *Script) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return 10 * time.Second
+}
+
+func (s *Script) Run(r io.Reader) error {
+	scan := bufio.NewScanner(r)
+	for line := 1; scan.Scan(); line++ {
+		if err := s.do(scan.Text()); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	return scan.Err()
+}
+
+func (s *Script) do(line string) error {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 || line[0] == '#' {
+		return nil
+	}
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i > 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	if len(arg) > 0 && (arg[0] == '"' || arg[0] == '`') {
+		var err error
+		if arg, err = strconv.Unquote(arg); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	switch name {
+	case "timeout", "sleep":
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%s: %q: invalid duration", name, arg)
+		}
+		if name == "timeout" {
+			s.Timeout = d
+		} else {
+			time.Sleep(d)
+		}
+	case "expect":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return err
+		}
+		return s.Expect(re)
+	case "send":
+		return s.Send(arg)
+	case "sendline":
+		return s.Send(arg + "\r")
+	case "break":
+		if len(arg) > 0 {
+			return fmt.Errorf("break: %q: unexpected", arg)
+		}
+		b, ok := s.Conn.(interface{ SendBreak() error })
+		if !ok {
+			return fmt.Errorf("break: unsupported")
+		}
+		return b.SendBreak()
+	default:
+		return fmt.Errorf("%s: unknown", name)
+	}
+	return nil
+}
+
+// Expect reads until the input matches the expression, or times out; the
+// input through the match is then discarded.
+func (s *Script) Expect(re *regexp.Regexp) error {
+	deadline := time.Now().Add(s.timeout())
+	rx := make([]byte, 4096)
+	for {
+		if loc := re.FindIndex(s.buf); loc != nil {
+			s.buf = s.buf[:copy(s.buf, s.buf[loc[1]:])]
+			return nil
+		}
+		if err := s.Conn.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+		n, err := s.Conn.Read(rx)
+		if n > 0 {
+			if s.Output != nil {
+				s.Output.Write(rx[:n])
+			}
+			s.buf = append(s.buf, rx[:n]...)
+			if over := len(s.buf) - maxExpect; over > 0 {
+				s.buf = s.buf[:copy(s.buf, s.buf[over:])]
+			}
+		}
+		if os.IsTimeout(err) {
+			return fmt.Errorf("expect %s: timeout", re)
+		} else if err != nil {
+			return fmt.Errorf("expect %s: %v", re, err)
+		}
+	}
+}
+
+func (s *Script) Send(text string) error {
+	_, err := io.WriteString(s.Conn, text)
+	return err
+}
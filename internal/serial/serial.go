@@ -0,0 +1,268 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// Package serial provides the serial port options and termios setup of
+// femtocom and ldp, session logs, XMODEM/YMODEM transfers and expect-style
+// scripts.
+package serial
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/platinasystems/goes/external/flags"
+	"github.com/platinasystems/goes/external/parms"
+)
+
+// Flags and Parms of the serial port options.
+var (
+	Flags = []interface{}{"-noinit", "-noreset", "-nolock"}
+	Parms = []interface{}{"-baud", "-parity", "-databits", "-stopbits"}
+)
+
+// Options is the man page text of Flags and Parms.
+const Options = `
+	-baud BAUD
+		The valid baud rates are 300, 600, 1200, 2400,
+		4800, 9600, 19200, 38400, 57600, and default, 115200.
+
+	-parity PARITY
+		The valid parity options are "odd", "even" and default, "none".
+
+	-databits BITS
+		The valid bits per character are 5, 6, 7, and default, 8.
+
+	-stopbits BITS
+		The valid stop bits per character are 2 and default, 1.
+
+	-noinit
+		Don't initialize the device at start-up or reset on exit.
+
+	-noreset
+		Don't reset the device on exit.
+
+	-nolock
+		Don't attempt exclusive device use.`
+
+var Bauds = map[string]uint32{
+	"50":      syscall.B50,
+	"75":      syscall.B75,
+	"110":     syscall.B110,
+	"134":     syscall.B134,
+	"150":     syscall.B150,
+	"200":     syscall.B200,
+	"300":     syscall.B300,
+	"600":     syscall.B600,
+	"1200":    syscall.B1200,
+	"1800":    syscall.B1800,
+	"2400":    syscall.B2400,
+	"4800":    syscall.B4800,
+	"9600":    syscall.B9600,
+	"19200":   syscall.B19200,
+	"38400":   syscall.B38400,
+	"57600":   syscall.B57600,
+	"115200":  syscall.B115200,
+	"230400":  syscall.B230400,
+	"460800":  syscall.B460800,
+	"500000":  syscall.B500000,
+	"576000":  syscall.B576000,
+	"921600":  syscall.B921600,
+	"1000000": syscall.B1000000,
+	"1152000": syscall.B1152000,
+	"1500000": syscall.B1500000,
+	"2000000": syscall.B2000000,
+	"2500000": syscall.B2500000,
+	"3000000": syscall.B3000000,
+	"3500000": syscall.B3500000,
+	"4000000": syscall.B4000000,
+}
+
+var Parities = map[string]uint32{
+	"odd":  syscall.PARENB | syscall.PARODD,
+	"even": syscall.PARENB,
+	"none": 0,
+}
+
+var DataBits = map[string]uint32{
+	"5": syscall.CS5,
+	"6": syscall.CS6,
+	"7": syscall.CS7,
+	"8": syscall.CS8,
+}
+
+var StopBits = map[string]uint32{
+	"1": 0,
+	"2": syscall.CSTOPB,
+}
+
+// Config of a port; Cflag is that of its baud, parity, data and stop bits.
+type Config struct {
+	Cflag   uint32
+	NoInit  bool
+	NoReset bool
+	NoLock  bool
+}
+
+// ParseConfig of the Flags and Parms, with defaults of 115200 baud, no
+// parity, 8 data bits and 1 stop bit.
+func ParseConfig(flag *flags.Flags, parm *parms.Parms) (Config, error) {
+	cfg := Config{
+		NoInit:  flag.ByName["-noinit"],
+		NoReset: flag.ByName["-noreset"],
+		NoLock:  flag.ByName["-nolock"],
+	}
+	for _, x := range []struct {
+		name, def string
+		m         map[string]uint32
+	}{
+		{"baud", "115200", Bauds},
+		{"parity", "none", Parities},
+		{"databits", "8", DataBits},
+		{"stopbits", "1", StopBits},
+	} {
+		s := parm.ByName["-"+x.name]
+		if len(s) == 0 {
+			s = x.def
+		}
+		bits, found := x.m[s]
+		if !found {
+			return cfg, fmt.Errorf("%s: invalid %s", s, x.name)
+		}
+		cfg.Cflag |= bits
+	}
+	return cfg, nil
+}
+
+func GetTermios(fd uintptr, t *syscall.Termios) error {
+	return ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(t)))
+}
+
+func SetTermios(fd uintptr, t *syscall.Termios) error {
+	return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(t)))
+}
+
+// MakeRaw clears the input, output and local processing of the terminal.
+func MakeRaw(t *syscall.Termios) {
+	t.Iflag &^= syscall.IGNBRK |
+		syscall.BRKINT |
+		syscall.PARMRK |
+		syscall.ISTRIP |
+		syscall.INLCR |
+		syscall.IGNCR |
+		syscall.ICRNL |
+		syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO |
+		syscall.ECHONL |
+		syscall.ICANON |
+		syscall.ISIG |
+		syscall.IEXTEN
+}
+
+func ioctl(fd, op, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, op, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// linux/asm-generic/ioctls.h
+const tcsbrk = 0x5409
+
+// Port is an open serial device, or other file, with a saved terminal
+// configuration that's restored on Close. Its ioctls are through
+// SyscallConn rather than Fd, which would disable SetReadDeadline.
+type Port struct {
+	*os.File
+	cfg    Config
+	tty    bool
+	locked bool
+	saved  syscall.Termios
+}
+
+// Open the device and, if it's a terminal, lock it for exclusive use and
+// initialize it as raw with the config's Cflag.
+func Open(fn string, cfg Config) (*Port, error) {
+	f, err := os.OpenFile(fn, os.O_RDWR, 0664)
+	if err != nil {
+		return nil, err
+	}
+	p := &Port{File: f, cfg: cfg}
+	if err = p.init(); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Port) init() error {
+	err := p.ioctl(syscall.TCGETS, uintptr(unsafe.Pointer(&p.saved)))
+	if err == syscall.ENOTTY {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("TCGETS: %s: %v", p.Name(), err)
+	}
+	p.tty = true
+	if !p.cfg.NoLock {
+		if err = p.ioctl(syscall.TIOCEXCL, 0); err != nil {
+			return fmt.Errorf("TIOCEXCL: %v", err)
+		}
+		p.locked = true
+	}
+	if p.cfg.NoInit {
+		return nil
+	}
+	t := p.saved
+	MakeRaw(&t)
+	t.Cflag = p.cfg.Cflag |
+		syscall.HUPCL |
+		syscall.CREAD |
+		syscall.CLOCAL
+	err = p.ioctl(syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+	if err != nil {
+		return fmt.Errorf("TCSETS: %v", err)
+	}
+	return nil
+}
+
+// SendBreak of 0.25 to 0.5 seconds of zero bits.
+func (p *Port) SendBreak() error {
+	if !p.tty {
+		return fmt.Errorf("%s: not a terminal", p.Name())
+	}
+	if err := p.ioctl(tcsbrk, 0); err != nil {
+		return fmt.Errorf("TCSBRK: %v", err)
+	}
+	return nil
+}
+
+func (p *Port) ioctl(op, arg uintptr) error {
+	rc, err := p.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioerr error
+	err = rc.Control(func(fd uintptr) {
+		ioerr = ioctl(fd, op, arg)
+	})
+	if err == nil {
+		err = ioerr
+	}
+	return err
+}
+
+// Close restores the saved terminal configuration unless NoInit or
+// NoReset, and releases the lock.
+func (p *Port) Close() error {
+	if p.tty && !p.cfg.NoInit && !p.cfg.NoReset {
+		p.ioctl(syscall.TCSETS, uintptr(unsafe.Pointer(&p.saved)))
+	}
+	if p.locked {
+		p.ioctl(syscall.TIOCNXCL, 0)
+	}
+	return p.File.Close()
+}
@@ -0,0 +1,125 @@
+// Copyright © 2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package serial
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// pty opens a pseudo-terminal master and returns it with the slave's name.
+func pty(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	var unlock int32
+	var n uint32
+	if err = ioctl(master.Fd(), syscall.TIOCSPTLCK,
+		uintptr(unsafe.Pointer(&unlock))); err == nil {
+		err = ioctl(master.Fd(), syscall.TIOCGPTN,
+			uintptr(unsafe.Pointer(&n)))
+	}
+	if err != nil {
+		master.Close()
+		t.Skip(err)
+	}
+	return master, fmt.Sprint("/dev/pts/", n)
+}
+
+func TestScript(t *testing.T) {
+	master, slave := pty(t)
+	defer master.Close()
+	p, err := Open(slave, Config{Cflag: Bauds["115200"] | DataBits["8"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// a login prompt on the master side
+	go func() {
+		r := bufio.NewReader(master)
+		master.Write([]byte("\r\nU-Boot 2021.01\r\nlogin: "))
+		if s, err := r.ReadString('\r'); err != nil || s != "root\r" {
+			master.Write([]byte("bad user\r\n"))
+			return
+		}
+		master.Write([]byte("Password: "))
+		r.ReadString('\r')
+		master.Write([]byte("\r\n# "))
+	}()
+
+	var out bytes.Buffer
+	s := &Script{Conn: p, Output: &out}
+	err = s.Run(strings.NewReader(`
+# log in
+timeout 2s
+expect login:
+sendline root
+expect "Pass\\w+: "
+send "secret\r"
+expect #
+`))
+	if err != nil {
+		t.Fatal(err, out.String())
+	}
+	if !strings.Contains(out.String(), "U-Boot") {
+		t.Errorf("output: %q", out.String())
+	}
+
+	s.Timeout = 50 * time.Millisecond
+	err = s.Run(strings.NewReader("expect never"))
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Error("expected timeout, got", err)
+	}
+	for _, x := range []string{
+		"bogus",
+		"sleep soon",
+		"expect (",
+		"send \"unterminated",
+	} {
+		if err = s.Run(strings.NewReader(x)); err == nil {
+			t.Errorf("%q: not an error", x)
+		}
+	}
+	if err = s.Run(strings.NewReader("break")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNotTerminal(t *testing.T) {
+	p, err := Open(os.DevNull, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err = p.SendBreak(); err == nil {
+		t.Error("break of", os.DevNull)
+	}
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLog(&buf)
+	now := time.Date(2021, 3, 4, 5, 6, 7, 8e6, time.UTC)
+	l.Now = func() time.Time { return now }
+	l.Write([]byte("one\r\ntw"))
+	now = now.Add(time.Second)
+	l.Write([]byte("o\r\n\r\nthree"))
+	want := `2021-03-04 05:06:07.008 one
+2021-03-04 05:06:07.008 two
+2021-03-04 05:06:08.008 
+2021-03-04 05:06:08.008 three`
+	if s := buf.String(); s != want {
+		t.Errorf("\n%s", s)
+	}
+}
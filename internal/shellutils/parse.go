@@ -21,6 +21,27 @@ func srcin(i io.ReadWriter, prompt string) (s string, err error) {
 	return
 }
 
+// RedirectionOps are the recognized I/O redirection operators, longest
+// first so that the lexer finds the greedy match. Any of those beginning
+// with '<' or '>' may be prefaced by a descriptor number, e.g. 2>>.
+var RedirectionOps = []string{
+	"<<<", "<<-", "<<", "<&", "<>", "<",
+	">>>>", ">>>", ">>", ">&", ">",
+	"&>>", "&>",
+}
+
+// redirection returns the longest redirection operator beginning with r and
+// the remaining input.
+func redirection(r rune, s string) (string, string) {
+	in := string(r) + s
+	for _, op := range RedirectionOps {
+		if strings.HasPrefix(in, op) {
+			return op, s[len(op)-1:]
+		}
+	}
+	return string(r), s
+}
+
 // break up string into Lists, Pipelines, and command lines
 // a List is a slice of Pipelines [][]Cmdline{}
 // a Pipeline is a slice of commandlines []Cmdline{}
@@ -56,12 +77,32 @@ processRune:
 				continue
 			}
 
+			// A descriptor number immediately preceding the
+			// operator is part of the redirection, e.g. 2>&1
+			if (r == '<' || r == '>') && w.isDescriptor() {
+				var op string
+				op, s = redirection(r, s)
+				w.addLiteral(op)
+				c.add(&w)
+				inWS = true
+				continue
+			}
+
 			if strings.ContainsRune("|&;()<>", r) {
 				c.add(&w)
 			}
 		}
 
-		if strings.ContainsRune("&;()<", r) {
+		if r == '<' || r == '>' || (r == '&' && len(s) > 0 && s[0] == '>') {
+			var op string
+			op, s = redirection(r, s)
+			w.addLiteral(op)
+			c.add(&w)
+			inWS = true
+			continue
+		}
+
+		if strings.ContainsRune("&;()", r) {
 			w.addLiteral(string(r))
 			// hack - we know these are single-byte runes
 			if len(s) >= 1 && s[0] == byte(r) {
@@ -114,25 +155,6 @@ processRune:
 			continue
 		}
 
-		if r == '>' {
-			w.addLiteral(">")
-			if len(s) >= 1 && s[0] == '>' {
-				s = s[1:]
-				w.addLiteral(">")
-				if len(s) >= 1 && s[0] == '>' {
-					s = s[1:]
-					w.addLiteral(">")
-					if len(s) >= 1 && s[0] == '>' {
-						s = s[1:]
-						w.addLiteral(">")
-					}
-				}
-			}
-			c.add(&w)
-			inWS = true
-			continue
-		}
-
 		if r == '\'' {
 			for {
 				for len(s) > 0 {
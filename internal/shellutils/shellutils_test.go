@@ -123,3 +123,38 @@ func TestDoublequote(t *testing.T) {
 
 	cmd.print()
 }
+
+func TestRedirection(t *testing.T) {
+	for _, x := range []struct {
+		line string
+		args []string
+	}{
+		{"ls >out", []string{"ls", ">", "out"}},
+		{"ls 2>err", []string{"ls", "2>", "err"}},
+		{"ls 2>>err", []string{"ls", "2>>", "err"}},
+		{"ls >out 2>&1", []string{"ls", ">", "out", "2>&", "1"}},
+		{"ls >&2", []string{"ls", ">&", "2"}},
+		{"ls &>out", []string{"ls", "&>", "out"}},
+		{"ls&>>out", []string{"ls", "&>>", "out"}},
+		{"cat 3<&-", []string{"cat", "3<&", "-"}},
+		{"cat <>rw", []string{"cat", "<>", "rw"}},
+		{"cat <<<here", []string{"cat", "<<<", "here"}},
+		{"cat <<-EOF", []string{"cat", "<<-", "EOF"}},
+		{"echo a2>b", []string{"echo", "a2", ">", "b"}},
+		{"echo 1 2 >>>> tee", []string{"echo", "1", "2", ">>>>", "tee"}},
+	} {
+		ls, err := testSlice([]string{x.line})
+		if err != nil {
+			t.Error(x.line, err)
+			continue
+		}
+		if len(ls.Cmds) != 1 {
+			t.Error(x.line, "unexpected list", ls.Cmds)
+			continue
+		}
+		_, args := ls.Cmds[0].Slice(os.Getenv)
+		if strings.Join(args, "|") != strings.Join(x.args, "|") {
+			t.Errorf("%s: got %q, want %q", x.line, args, x.args)
+		}
+	}
+}
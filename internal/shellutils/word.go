@@ -74,6 +74,20 @@ func (w *Word) parseEnv(s string) (string, error) {
 	return s, nil
 }
 
+// isDescriptor returns true if the word is an unquoted, unexpanded number
+// that may preface a redirection operator.
+func (w *Word) isDescriptor() bool {
+	if len(w.Tokens) != 1 || w.Tokens[0].T != TokenLiteral {
+		return false
+	}
+	for _, r := range w.Tokens[0].V {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return len(w.Tokens[0].V) > 0
+}
+
 func (w *Word) String() string {
 	s := ""
 	for _, t := range w.Tokens {
@@ -48,6 +48,7 @@ SEE ALSO
 }
 
 func (g *Goes) man(args ...string) error {
+	w := g.Stdout()
 	var cmds []cmd.Cmd
 	for i, arg := range args {
 		v := g.ByName[arg]
@@ -64,19 +65,19 @@ func (g *Goes) man(args ...string) error {
 	}
 	for i, v := range cmds {
 		if i > 0 {
-			fmt.Println()
+			fmt.Fprintln(w)
 		}
-		fmt.Print(section.name, "\n\t", v, " - ",
+		fmt.Fprint(w, section.name, "\n\t", v, " - ",
 			v.Apropos(), "\n\n", section.synopsis, "\n\t",
 			strings.TrimSpace(v.Usage()), "\n")
 		if method, found := v.(maner); found {
 			man := method.Man().String()
 			if !strings.HasPrefix(man, "\n") {
-				fmt.Println()
+				fmt.Fprintln(w)
 			}
-			fmt.Print(man)
+			fmt.Fprint(w, man)
 			if !strings.HasSuffix(man, "\n") {
-				fmt.Println()
+				fmt.Fprintln(w)
 			}
 		}
 	}
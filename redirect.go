@@ -0,0 +1,349 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// +build linux
+
+package goes
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/platinasystems/goes/internal/shellutils"
+	"github.com/platinasystems/url"
+)
+
+// redirection is a parsed command line I/O redirection, e.g. 2>&1 FILE
+type redirection struct {
+	fd  int
+	op  string
+	arg string
+}
+
+func (rd redirection) String() string {
+	return fmt.Sprint(rd.fd, rd.op, rd.arg)
+}
+
+// closed is a descriptor closed by <&- or >&-; as an exec.Cmd Stdin,
+// Stdout, Stderr or ExtraFiles entry, the nil file closes that descriptor
+// in the child, and in-process reads and writes fail.
+var closed = (*os.File)(nil)
+
+// stdio is the descriptor table of a command after redirection.
+type stdio struct {
+	fds map[int]interface{}
+	// explicit is the set of descriptors changed by redirection
+	explicit map[int]bool
+}
+
+// redirectionOp returns the descriptor and operator of a redirection
+// argument like 2>> or &>.
+func redirectionOp(s string) (int, string, bool) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	op := s[i:]
+	found := false
+	for _, t := range shellutils.RedirectionOps {
+		if op == t {
+			found = true
+			break
+		}
+	}
+	if !found || (i > 0 && op[0] == '&') {
+		return 0, "", false
+	}
+	fd := 1
+	if op[0] == '<' {
+		fd = 0
+	}
+	if i > 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, "", false
+		}
+		fd = n
+	}
+	return fd, op, true
+}
+
+// parseRedirections removes redirection operators and their operands from
+// the command arguments.
+func parseRedirections(args []string) ([]redirection, []string, error) {
+	var rds []redirection
+	cmdargs := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		fd, op, found := redirectionOp(args[i])
+		if !found {
+			cmdargs = append(cmdargs, args[i])
+			continue
+		}
+		if i == len(args)-1 {
+			return nil, nil, fmt.Errorf("%s: missing operand",
+				args[i])
+		}
+		i++
+		rds = append(rds, redirection{fd: fd, op: op, arg: args[i]})
+	}
+	return rds, cmdargs, nil
+}
+
+func newStdio(stdin io.Reader, stdout, stderr io.Writer) *stdio {
+	return &stdio{
+		fds: map[int]interface{}{
+			0: stdin,
+			1: stdout,
+			2: stderr,
+		},
+		explicit: make(map[int]bool),
+	}
+}
+
+func (std *stdio) set(fd int, v interface{}) {
+	std.fds[fd] = v
+	std.explicit[fd] = true
+}
+
+func (std *stdio) writer(fd int) (io.Writer, error) {
+	v, found := std.fds[fd]
+	if !found {
+		return nil, fmt.Errorf("%d: bad file descriptor", fd)
+	}
+	w, ok := v.(io.Writer)
+	if !ok {
+		return nil, fmt.Errorf("%d: not open for writing", fd)
+	}
+	return w, nil
+}
+
+// redirect applies each redirection in order, so, like other shells,
+//
+//	COMMAND >FILE 2>&1
+//
+// sends both stdout and stderr to FILE whereas
+//
+//	COMMAND 2>&1 >FILE
+//
+// sends stderr to the former stdout.
+func (g *Goes) redirect(std *stdio, rds []redirection, closers *[]io.Closer) error {
+	for _, rd := range rds {
+		switch rd.op {
+		case "<":
+			rc, err := url.Open(rd.arg)
+			if err != nil {
+				return err
+			}
+			*closers = append(*closers, rc)
+			std.set(rd.fd, rc)
+		case "<>":
+			f, err := os.OpenFile(rd.arg, os.O_RDWR|os.O_CREATE,
+				0666)
+			if err != nil {
+				return err
+			}
+			*closers = append(*closers, f)
+			std.set(rd.fd, f)
+		case "<<<":
+			std.set(rd.fd, strings.NewReader(rd.arg+"\n"))
+		case "<<", "<<-":
+			r, err := g.hereDocument(rd.arg, rd.op == "<<-")
+			if err != nil {
+				return err
+			}
+			*closers = append(*closers, r)
+			std.set(rd.fd, r)
+		case ">", ">>", ">>>", ">>>>":
+			var (
+				wc  io.WriteCloser
+				err error
+			)
+			if rd.op == ">" || rd.op == ">>>" {
+				wc, err = url.Create(rd.arg)
+			} else {
+				wc, err = url.Append(rd.arg)
+			}
+			if err != nil {
+				return err
+			}
+			*closers = append(*closers, wc)
+			if len(rd.op) > 2 {
+				// tee to the former descriptor
+				w, err := std.writer(rd.fd)
+				if err != nil {
+					return err
+				}
+				std.set(rd.fd, io.MultiWriter(w, wc))
+			} else {
+				std.set(rd.fd, wc)
+			}
+		case "&>", "&>>":
+			var (
+				wc  io.WriteCloser
+				err error
+			)
+			if rd.op == "&>" {
+				wc, err = url.Create(rd.arg)
+			} else {
+				wc, err = url.Append(rd.arg)
+			}
+			if err != nil {
+				return err
+			}
+			*closers = append(*closers, wc)
+			std.set(1, wc)
+			std.set(2, wc)
+		case "<&", ">&":
+			if rd.arg == "-" {
+				std.set(rd.fd, closed)
+				continue
+			}
+			n, err := strconv.Atoi(rd.arg)
+			if err != nil {
+				if rd.op == ">&" && rd.fd == 1 {
+					// >&FILE is the same as &>FILE
+					rd.op = "&>"
+					if err = g.redirect(std,
+						[]redirection{rd},
+						closers); err != nil {
+						return err
+					}
+					continue
+				}
+				return fmt.Errorf("%s: ambiguous redirect",
+					rd.arg)
+			}
+			v, found := std.fds[n]
+			if !found {
+				return fmt.Errorf("%d: bad file descriptor", n)
+			}
+			std.set(rd.fd, v)
+		default:
+			return fmt.Errorf("%s: unsupported redirection", rd)
+		}
+	}
+	return nil
+}
+
+// hereDocument returns a reader of the command input up to label.
+func (g *Goes) hereDocument(lbl string, trim bool) (io.ReadCloser, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	WG.Add(1)
+	go func(w io.WriteCloser, lbl string) {
+		defer WG.Done()
+		defer w.Close()
+		prompt := "<<" + lbl + " "
+		for {
+			g.Catline.Write([]byte(prompt))
+			buf := make([]byte, 1024)
+			n, err := g.Catline.Read(buf)
+			s := string(buf[0:n])
+			if trim {
+				s = strings.TrimLeft(s, " \t")
+			}
+			if err != nil || s == lbl {
+				break
+			}
+			fmt.Fprintln(w, s)
+		}
+	}(w, lbl)
+	return r, nil
+}
+
+func (std *stdio) stdin() (io.Reader, error) {
+	r, ok := std.fds[0].(io.Reader)
+	if !ok {
+		return nil, fmt.Errorf("0: not open for reading")
+	}
+	return r, nil
+}
+
+func (std *stdio) stdout() (io.Writer, error) { return std.writer(1) }
+func (std *stdio) stderr() (io.Writer, error) { return std.writer(2) }
+
+// extraFiles returns the redirected descriptors above stderr for a forked
+// command; these must be files.
+func (std *stdio) extraFiles() ([]*os.File, error) {
+	max := 2
+	for fd := range std.fds {
+		if fd > max {
+			max = fd
+		}
+	}
+	if max == 2 {
+		return nil, nil
+	}
+	files := make([]*os.File, max-2)
+	for fd, v := range std.fds {
+		if fd <= 2 {
+			continue
+		}
+		f, ok := v.(*os.File)
+		if !ok {
+			return nil, fmt.Errorf("%d: must redirect to a file",
+				fd)
+		}
+		files[fd-3] = f
+	}
+	return files, nil
+}
+
+// inProcess runs f with the explicitly redirected descriptors as the
+// Stdin, Stdout and Stderr of g rather than those of the process, which
+// other commands and goroutines may be using.
+func (g *Goes) inProcess(std *stdio, f func() error) error {
+	if len(std.explicit) == 0 {
+		return f()
+	}
+	stdin, stdout, stderr := g.stdin, g.stdout, g.stderr
+	defer func() {
+		g.stdin, g.stdout, g.stderr = stdin, stdout, stderr
+	}()
+	if std.explicit[0] {
+		g.stdin, _ = std.fds[0].(io.Reader)
+	}
+	if std.explicit[1] {
+		g.stdout, _ = std.fds[1].(io.Writer)
+	}
+	if std.explicit[2] {
+		g.stderr, _ = std.fds[2].(io.Writer)
+	}
+	return f()
+}
+
+// Stdin is that of an in-process command, os.Stdin unless redirected.
+func (g *Goes) Stdin() io.Reader {
+	for p := g; p != nil; p = p.parent {
+		if p.stdin != nil {
+			return p.stdin
+		}
+	}
+	return os.Stdin
+}
+
+// Stdout is that of an in-process command, os.Stdout unless redirected.
+func (g *Goes) Stdout() io.Writer {
+	for p := g; p != nil; p = p.parent {
+		if p.stdout != nil {
+			return p.stdout
+		}
+	}
+	return os.Stdout
+}
+
+// Stderr is that of an in-process command, os.Stderr unless redirected.
+func (g *Goes) Stderr() io.Writer {
+	for p := g; p != nil; p = p.parent {
+		if p.stderr != nil {
+			return p.stderr
+		}
+	}
+	return os.Stderr
+}
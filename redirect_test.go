@@ -0,0 +1,138 @@
+// Copyright © 2015-2021 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+// +build linux
+
+package goes
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseRedirections(t *testing.T) {
+	rds, args, err := parseRedirections([]string{"ls", "-l", ">", "out",
+		"2>&", "1", "3<&", "-", "<<<", "word", "&>>", "all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(args, []string{"ls", "-l"}) {
+		t.Error("wrong args:", args)
+	}
+	if !reflect.DeepEqual(rds, []redirection{
+		{fd: 1, op: ">", arg: "out"},
+		{fd: 2, op: ">&", arg: "1"},
+		{fd: 3, op: "<&", arg: "-"},
+		{fd: 0, op: "<<<", arg: "word"},
+		{fd: 1, op: "&>>", arg: "all"},
+	}) {
+		t.Error("wrong redirections:", rds)
+	}
+	if _, _, err = parseRedirections([]string{"ls", "2>"}); err == nil {
+		t.Error("missing operand not detected")
+	}
+}
+
+func TestRedirectOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redirect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "out")
+
+	var closers []io.Closer
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+
+	std := newStdio(os.Stdin, stdout, stderr)
+	err = new(Goes).redirect(std, []redirection{
+		{fd: 2, op: ">&", arg: "1"},
+		{fd: 1, op: ">", arg: fn},
+	}, &closers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := std.stderr(); w != stdout {
+		t.Error("stderr isn't the former stdout")
+	}
+	f, ok := std.fds[1].(*os.File)
+	if !ok || f.Name() != fn {
+		t.Error("stdout isn't", fn)
+	}
+
+	std = newStdio(os.Stdin, stdout, stderr)
+	err = new(Goes).redirect(std, []redirection{
+		{fd: 1, op: ">>", arg: fn},
+		{fd: 2, op: ">&", arg: "1"},
+		{fd: 0, op: "<<<", arg: "hello"},
+	}, &closers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := new(Goes)
+	err = g.inProcess(std, func() error {
+		if g.Stdout() == os.Stdout {
+			t.Error("in-process stdout isn't redirected")
+		}
+		var buf [64]byte
+		n, _ := g.Stdin().Read(buf[:])
+		g.Stdout().Write(buf[:n])
+		g.Stderr().Write([]byte("world\n"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range closers {
+		c.Close()
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello\nworld\n" {
+		t.Errorf("wrong output: %q", b)
+	}
+	if stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Error("output leaked to former stdout or stderr")
+	}
+}
+
+func TestRedirectClose(t *testing.T) {
+	var closers []io.Closer
+	std := newStdio(os.Stdin, os.Stdout, os.Stderr)
+	err := new(Goes).redirect(std, []redirection{
+		{fd: 1, op: ">&", arg: "-"},
+		{fd: 3, op: "<&", arg: "-"},
+	}, &closers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(closers) != 0 {
+		t.Error("closed descriptor opened a file")
+	}
+	g := new(Goes)
+	err = g.inProcess(std, func() error {
+		_, err := g.Stdout().Write([]byte("leaked\n"))
+		return err
+	})
+	if err == nil {
+		t.Error("wrote to closed stdout")
+	}
+	if g.Stdout() != os.Stdout {
+		t.Error("stdout wasn't restored")
+	}
+	files, err := std.extraFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != nil {
+		t.Error("descriptor 3 isn't closed in the child")
+	}
+}
@@ -25,6 +25,7 @@ func (g *Goes) Usage() string {
 	goes COMMAND -[-]HELPER [ ARGS ]...
 	goes HELPER [ COMMAND ] [ ARGS ]...
 	goes [ -d ] [ -x ] [[ -f ][ - | SCRIPT ]]
+	goes -n [ -x ] SCRIPT
 
 	HELPER := { apropos | complete | help | man | usage }`
 	}
@@ -39,6 +40,6 @@ func (g *Goes) usage(args ...string) error {
 			return fmt.Errorf("%s: not found", args[0])
 		}
 	}
-	fmt.Println(Usage(u))
+	fmt.Fprintln(g.Stdout(), Usage(u))
 	return nil
 }